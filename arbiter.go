@@ -2,26 +2,17 @@ package main
 
 import (
 	"flag"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/mainchain"
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/sidechain"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/lifecycle"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
-	"github.com/elastos/Elastos.ELA.Arbiter/net/servers/httpjsonrpc"
+	"github.com/elastos/Elastos.ELA.Arbiter/node"
 	"github.com/elastos/Elastos.ELA.Arbiter/password"
-	"github.com/elastos/Elastos.ELA.Arbiter/sideauxpow"
-	"github.com/elastos/Elastos.ELA.Arbiter/store"
 
-	"github.com/elastos/Elastos.ELA.SPV/interface"
 	"github.com/elastos/Elastos.ELA/account"
-	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
-	"github.com/elastos/Elastos.ELA/utils/elalog"
 )
 
 var (
@@ -31,15 +22,14 @@ var (
 )
 
 const (
-	defaultSpvMaxPerLogFileSize int64 = elalog.MBSize * 20
-	defaultSpvMaxLogsFolderSize int64 = elalog.GBSize * 2
-
-	defaultArbiterMaxPerLogFileSize int64 = 20
-	defaultArbiterMaxLogsFolderSize int64 = 2 * 1024
+	defaultMaxPerLogFileSize int64 = 20
+	defaultMaxLogsFolderSize int64 = 2 * 1024
 )
 
 var walletPath string
 var pstr string
+var verifyAuditPath string
+var sandboxMode bool
 
 func init() {
 	v := versionFlag{}
@@ -47,6 +37,10 @@ func init() {
 	flag.StringVar(&walletPath, "wallet", "", "wallet path, default: keystore.dat")
 	flag.StringVar(&walletPath, "w", "", "wallet path, default: keystore.dat")
 	flag.StringVar(&pstr, "p", "", "wallet password")
+	flag.StringVar(&verifyAuditPath, "verifyaudit", "",
+		"verify the hash chain of the audit log at the path and exit, the log of arbiter is "+audit.DefaultPath)
+	flag.BoolVar(&sandboxMode, "sandbox", false,
+		"run against fake main and side nodes listening on the rpc addresses of the nodes in config")
 	flag.Parse()
 }
 
@@ -61,77 +55,34 @@ func (r *versionFlag) Set(s string) error {
 	return nil
 }
 
-func setSideChainAccountMonitor(arbitrator arbitrator.Arbitrator) {
-	monitor := sidechain.SideChainAccountMonitorImpl{ParentArbitrator: arbitrator}
-
-	for _, side := range arbitrator.GetSideChainManager().GetAllChains() {
-		monitor.AddListener(side)
-	}
-
-	for _, node := range config.Parameters.SideNodeList {
-		go monitor.SyncChainData(node)
-	}
-}
-
-func initP2P(arbitrator arbitrator.Arbitrator) error {
-	pk, err := arbitrator.GetPublicKey().EncodePoint(true)
-	if err != nil {
-		return err
-	}
-
-	var id peer.PID
-	copy(id[:], pk)
-	if err := cs.InitP2PClient(id); err != nil {
-		return err
-	}
-
-	//register p2p client listener
-	if err := mainchain.InitMainChain(arbitrator); err != nil {
-		return err
-	}
-
-	cs.P2PClientSingleton.Start()
-	return nil
-}
-
-func initialize() {
+func initialize() *account.Client {
 	config.Initialize()
 
-	spvMaxPerLogFileSize := defaultSpvMaxPerLogFileSize
-	spvMaxLogsFolderSize := defaultSpvMaxLogsFolderSize
+	maxPerLogFileSize := defaultMaxPerLogFileSize
+	maxLogsFolderSize := defaultMaxLogsFolderSize
 	if config.Parameters.MaxPerLogSize > 0 {
-		spvMaxPerLogFileSize = int64(config.Parameters.MaxPerLogSize) * elalog.MBSize
+		maxPerLogFileSize = int64(config.Parameters.MaxPerLogSize)
 	}
 	if config.Parameters.MaxLogsSize > 0 {
-		spvMaxLogsFolderSize = int64(config.Parameters.MaxLogsSize) * elalog.MBSize
-	}
-	fileWriter := elalog.NewFileWriter(
-		SpvLogOutputPath,
-		spvMaxPerLogFileSize,
-		spvMaxLogsFolderSize,
-	)
-	logWriter := io.MultiWriter(os.Stdout, fileWriter)
-	level := elalog.Level(config.Parameters.SPVPrintLevel)
-	backend := elalog.NewBackend(logWriter, elalog.Llongfile)
-
-	spvslog := backend.Logger("SPVS", level)
-	_interface.UseLogger(spvslog)
-
-	arbiterMaxPerLogFileSize := defaultArbiterMaxPerLogFileSize
-	arbiterMaxLogsFolderSize := defaultArbiterMaxLogsFolderSize
-	if config.Parameters.MaxPerLogSize > 0 {
-		arbiterMaxPerLogFileSize = int64(config.Parameters.MaxPerLogSize)
-	}
-	if config.Parameters.MaxLogsSize > 0 {
-		arbiterMaxLogsFolderSize = int64(config.Parameters.MaxLogsSize)
+		maxLogsFolderSize = int64(config.Parameters.MaxLogsSize)
 	}
 
 	log.Init(
 		ArbiterLogOutputPath,
 		config.Parameters.PrintLevel,
-		arbiterMaxPerLogFileSize,
-		arbiterMaxLogsFolderSize,
+		maxPerLogFileSize,
+		maxLogsFolderSize,
 	)
+	log.SPV.SetOutput(log.NewLogger(
+		SpvLogOutputPath,
+		config.Parameters.SPVPrintLevel,
+		maxPerLogFileSize,
+		maxLogsFolderSize,
+	))
+	if err := node.ConfigureLogs(config.Parameters.Configuration); err != nil {
+		log.Fatal("Configure logs error:", err)
+		os.Exit(1)
+	}
 
 	if walletPath != "" {
 		config.Parameters.WalletPath = walletPath
@@ -151,64 +102,47 @@ func initialize() {
 		os.Exit(1)
 	}
 
-	sideauxpow.Init(c)
-	arbitrator.Init(c)
-	sidechain.Init()
+	return c
 }
 
-func main() {
-	initialize()
-
-	log.Info("1. Init chain utxo cache.")
-	dataStore, err := store.OpenDataStore()
+// verifyAudit verifies the audit log of path and exits, the status is 1 if
+// the log fails verification.
+func verifyAudit(path string) {
+	count, err := audit.Verify(path)
 	if err != nil {
-		log.Fatalf("Data store open failed error: [s%]", err.Error())
+		println("audit log verification failed after", count, "entries:", err.Error())
 		os.Exit(1)
 	}
-	store.DbCache = *dataStore
+	println("audit log verified,", count, "entries")
+	os.Exit(0)
+}
 
-	log.Info("2. Init finished transaction cache.")
-	finishedDataStore, err := store.OpenFinishedTxsDataStore()
-	if err != nil {
-		log.Fatalf("Side chain monitor setup error: [s%]", err.Error())
-		os.Exit(1)
+func main() {
+	if verifyAuditPath != "" {
+		verifyAudit(verifyAuditPath)
 	}
-	store.FinishedTxsDbCache = finishedDataStore
-
-	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
 
-	log.Info("3. Start arbitrator P2P networks.")
-	if err := initP2P(currentArbitrator); err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+	client := initialize()
+	if sandboxMode {
+		s, err := startSandbox(config.Parameters.Configuration, client)
+		if err != nil {
+			log.Fatal("Start sandbox error:", err)
+			os.Exit(1)
+		}
+		defer s.stop()
 	}
 
-	setSideChainAccountMonitor(currentArbitrator)
-
-	log.Info("4. Init configurations.")
-	if err := arbitrator.ArbitratorGroupSingleton.InitArbitrators(); err != nil {
+	n := node.New(config.Parameters.Configuration, node.DefaultDataDir, client)
+	if err := n.Start(); err != nil {
 		log.Fatal(err)
+		n.Stop()
 		os.Exit(1)
 	}
 
-	log.Info("5. Start arbitrator spv module.")
-	if err := currentArbitrator.StartSpvModule(); err != nil {
-		log.Fatal(err)
+	sig := lifecycle.WaitSignal()
+	log.Info("Received signal", sig.String(), ", shutting down.")
+	if err := n.Stop(); err != nil {
+		log.Error("Shut down error:", err)
 		os.Exit(1)
 	}
-
-	log.Info("6. Start arbitrator group monitor.")
-	go arbitrator.ArbitratorGroupSingleton.SyncLoop()
-
-	log.Info("7. Start servers.")
-	pServer := new(http.Server)
-	go httpjsonrpc.StartRPCServer(pServer)
-
-	log.Info("8. Start check and remove cross chain transactions from db.")
-	go currentArbitrator.CheckAndRemoveCrossChainTransactionsFromDBLoop()
-
-	log.Info("9. Start side chain account divide.")
-	go sideauxpow.SidechainAccountDivide()
-
-	select {}
 }
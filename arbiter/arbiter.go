@@ -0,0 +1,270 @@
+// Package arbiter embeds an arbiter in process. The arbiter is configured by
+// a config.Configuration instead of config.json, signs by the given account
+// client, and may use data stores opened by the embedder:
+//
+//	cfg, _ := config.Default("testnet")
+//	// set main node and side nodes of cfg
+//	a, err := arbiter.New(cfg, client, nil)
+//	if err != nil {
+//		return err
+//	}
+//	if err := a.Start(ctx); err != nil {
+//		return err
+//	}
+//	defer a.Stop()
+//
+// Logs must be initialized by log.Init before New, which applies the log
+// format and the levels of log modules of the config. An arbiter owns its
+// components, more than one arbiter may be embedded in a process given
+// different data directories and ports. The logs are the exception: loggers
+// are global to the process, the arbiters of a process write to the same
+// outputs, and the log format and levels of the arbiter created last apply
+// to all of them.
+package arbiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/sidechain"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/node"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/account"
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+var (
+	// ErrNotStarted is returned by the status accessors before Start or after
+	// Stop.
+	ErrNotStarted = errors.New("arbiter not started")
+
+	// ErrStarted is returned by Start if the arbiter has been started.
+	ErrStarted = errors.New("arbiter already started")
+)
+
+// Stores are the data stores and the audit log of an arbiter, the ones nil
+// are opened in the data directory of the arbiter by Start. Stores are closed
+// by Stop.
+type Stores struct {
+	// DataDir is the data directory of the arbiter, node.DefaultDataDir if
+	// empty.
+	DataDir          string
+	DataStore        *store.DataStoreImpl
+	FinishedTxsStore store.FinishedTransactionsDataStore
+	AuditLog         *audit.Log
+}
+
+// Arbiter is an arbiter embedded in process.
+type Arbiter struct {
+	mux     sync.Mutex
+	node    *node.Node
+	started bool
+	running bool
+}
+
+// New creates the arbiter configured by cfg and signing by signer, stores may
+// be nil to open the default ones.
+func New(cfg *config.Configuration, signer *account.Client, stores *Stores) (*Arbiter, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	if signer == nil {
+		return nil, errors.New("signer is nil")
+	}
+
+	c, err := config.Prepare(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.ConfigureLogs(c); err != nil {
+		return nil, err
+	}
+
+	dataDir := node.DefaultDataDir
+	if stores != nil && stores.DataDir != "" {
+		dataDir = stores.DataDir
+	}
+	n := node.New(c, dataDir, signer)
+	if stores != nil {
+		n.DataStore = stores.DataStore
+		n.FinishedTxsStore = stores.FinishedTxsStore
+		n.AuditLog = stores.AuditLog
+	}
+	return &Arbiter{node: n}, nil
+}
+
+// Start starts the arbiter, it is stopped by Stop or when ctx is done. The
+// components started are stopped if Start fails.
+func (a *Arbiter) Start(ctx context.Context) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.started {
+		return ErrStarted
+	}
+	a.started = true
+
+	if err := a.node.Start(); err != nil {
+		a.node.Stop()
+		return err
+	}
+	a.running = true
+
+	stopped := a.node.Lifecycle.Context().Done()
+	go func() {
+		select {
+		case <-ctx.Done():
+			a.Stop()
+		case <-stopped:
+		}
+	}()
+	return nil
+}
+
+// Stop stops the arbiter in ShutdownTimeout of the config, it is safe to be
+// called more than once. A stopped arbiter can not be started again.
+func (a *Arbiter) Stop() error {
+	a.mux.Lock()
+	a.started = true
+	a.running = false
+	a.mux.Unlock()
+	return a.node.Stop()
+}
+
+// Node returns the node of the arbiter, to reach the components not covered
+// by the accessors.
+func (a *Arbiter) Node() *node.Node {
+	return a.node
+}
+
+// SideChainStatus is the status of a side chain in view of the arbiter.
+type SideChainStatus struct {
+	GenesisAddress string
+	// Height is the height of the side chain synced by the arbiter.
+	Height uint32
+}
+
+// Status is the status of the arbiter.
+type Status struct {
+	Version   string
+	PublicKey string
+	OnDuty    bool
+	// OnDutyArbiter is the public key of the on duty arbiter of main chain.
+	OnDutyArbiter string
+	Arbiters      []string
+	// MainChainHeight is the height of main chain synced by the arbiter.
+	MainChainHeight uint32
+	SPVHeight       uint32
+	SideChains      []SideChainStatus
+	// PendingDeposits and PendingWithdraws are the counts of cross chain
+	// transactions not finished yet.
+	PendingDeposits  int
+	PendingWithdraws int
+	ArbiterPeers     int
+}
+
+func (a *Arbiter) checkRunning() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if !a.running {
+		return ErrNotStarted
+	}
+	return nil
+}
+
+// Status returns the status of the running arbiter.
+func (a *Arbiter) Status() (*Status, error) {
+	if err := a.checkRunning(); err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Version:         config.NodePrefix + config.Version,
+		PublicKey:       a.PublicKey(),
+		OnDuty:          a.node.Arbitrator.IsOnDutyOfMain(),
+		Arbiters:        a.node.ArbitratorGroup.GetAllArbitrators(),
+		MainChainHeight: a.node.ArbitratorGroup.GetCurrentHeight(),
+		ArbiterPeers:    len(a.node.Network.DumpArbiterPeersInfo()),
+	}
+	status.OnDutyArbiter, _ = a.node.ArbitratorGroup.GetOnDutyArbitratorOfMain()
+
+	spvHeight, err := a.SPVHeight()
+	if err != nil {
+		return nil, err
+	}
+	status.SPVHeight = spvHeight
+
+	for _, sideNode := range a.node.Config.SideNodeList {
+		status.SideChains = append(status.SideChains, SideChainStatus{
+			GenesisAddress: sideNode.GenesisBlockAddress,
+			Height: a.node.DataStore.SideChainStore.CurrentSideHeight(
+				sideNode.GenesisBlockAddress, store.QueryHeightCode),
+		})
+	}
+
+	depositHashes, _, err := a.node.DataStore.MainChainStore.GetAllMainChainTxHashes()
+	if err != nil {
+		return nil, err
+	}
+	status.PendingDeposits = len(depositHashes)
+	withdrawHashes, err := a.node.DataStore.SideChainStore.GetAllSideChainTxHashes()
+	if err != nil {
+		return nil, err
+	}
+	status.PendingWithdraws = len(withdrawHashes)
+
+	return status, nil
+}
+
+// PublicKey returns the public key of the arbiter in hex.
+func (a *Arbiter) PublicKey() string {
+	pk, err := a.node.Arbitrator.GetPublicKey().EncodePoint(true)
+	if err != nil {
+		return ""
+	}
+	return common.BytesToHexString(pk)
+}
+
+// IsOnDuty returns if the arbiter is on duty of main chain.
+func (a *Arbiter) IsOnDuty() bool {
+	return a.node.Arbitrator.IsOnDutyOfMain()
+}
+
+// MainChainHeight returns the height of main chain synced by the arbiter.
+func (a *Arbiter) MainChainHeight() uint32 {
+	return a.node.ArbitratorGroup.GetCurrentHeight()
+}
+
+// SPVHeight returns the best height of the spv module.
+func (a *Arbiter) SPVHeight() (uint32, error) {
+	if err := a.checkRunning(); err != nil {
+		return 0, err
+	}
+	spv := a.node.Arbitrator.GetSpvService()
+	if spv == nil {
+		return 0, ErrNotStarted
+	}
+	best, err := spv.HeaderStore().GetBest()
+	if err != nil {
+		return 0, err
+	}
+	return best.Height, nil
+}
+
+// SideChainHeight returns the height of the side chain of the genesis address
+// synced by the arbiter.
+func (a *Arbiter) SideChainHeight(genesisAddress string) (uint32, error) {
+	if err := a.checkRunning(); err != nil {
+		return 0, err
+	}
+	return a.node.DataStore.SideChainStore.CurrentSideHeight(
+		genesisAddress, store.QueryHeightCode), nil
+}
+
+// SolvencyReports returns the last solvency reports of the side chains.
+func (a *Arbiter) SolvencyReports() []*sidechain.SolvencyReport {
+	return a.node.Solvency.GetReports()
+}
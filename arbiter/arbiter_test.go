@@ -0,0 +1,145 @@
+package arbiter
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+	"github.com/elastos/Elastos.ELA.Arbiter/simulation/fakenode"
+
+	"github.com/elastos/Elastos.ELA/account"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logDir, err := ioutil.TempDir("", "arbiter")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(logDir, 5, 0, 0)
+
+	code := m.Run()
+	os.RemoveAll(logDir)
+	os.Exit(code)
+}
+
+func TestNew_InvalidArguments(t *testing.T) {
+	_, err := New(nil, nil, nil)
+	assert.Error(t, err)
+
+	cfg, err := config.Default("regnet")
+	assert.NoError(t, err)
+	_, err = New(cfg, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestArbiter_NotStarted(t *testing.T) {
+	a := &Arbiter{}
+	_, err := a.Status()
+	assert.Equal(t, ErrNotStarted, err)
+	_, err = a.SPVHeight()
+	assert.Equal(t, ErrNotStarted, err)
+	_, err = a.SideChainHeight("XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ")
+	assert.Equal(t, ErrNotStarted, err)
+
+	a.started = true
+	assert.Equal(t, ErrStarted, a.Start(context.Background()))
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestArbiter_StartStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arbiter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	client, err := account.Create(filepath.Join(dir, "keystore.dat"), []byte("arbiter"))
+	assert.NoError(t, err)
+	pk, err := client.GetMainAccount().PublicKey.EncodePoint(true)
+	assert.NoError(t, err)
+	publicKey := common.BytesToHexString(pk)
+
+	mainNode := fakenode.NewMainNode()
+	mainNode.Start()
+	defer mainNode.Close()
+	mainNode.SetArbitrators([]string{publicKey}, 0)
+	mainNode.AddBlock()
+	sideNode := fakenode.NewSideNode()
+	sideNode.Start()
+	defer sideNode.Close()
+	sideNode.AddBlock(nil, nil)
+
+	cfg, err := config.Default("regnet")
+	assert.NoError(t, err)
+	// arbiters are got from the main node
+	cfg.CRCOnlyDPOSHeight = 1
+	cfg.CRClaimDPOSNodeStartHeight = 1
+	cfg.NodePort = uint16(freePort(t))
+	cfg.HttpJsonPort = freePort(t)
+	cfg.MainNode.Rpc = mainNode.RpcConfig()
+	cfg.MainNode.SpvSeedList = []string{"127.0.0.1:" + strconv.Itoa(freePort(t))}
+	powChain := false
+	cfg.SideNodeList = []*config.SideNodeConfig{{
+		Rpc:          sideNode.RpcConfig(),
+		GenesisBlock: "56be936978c261b2e649d58dbfaf3f23d4a868274f5522cd2adb4308a955c4a3",
+		PowChain:     &powChain,
+	}}
+
+	a, err := New(cfg, client, nil)
+	assert.NoError(t, err)
+	// the config is copied
+	assert.NotEqual(t, cfg, a.Node().Config)
+
+	assert.NoError(t, a.Start(context.Background()))
+	status, err := a.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, status.PublicKey)
+	assert.Equal(t, publicKey, status.OnDutyArbiter)
+	assert.Equal(t, []string{publicKey}, status.Arbiters)
+	assert.Equal(t, uint32(1), status.MainChainHeight)
+	assert.Len(t, status.SideChains, 1)
+	assert.Equal(t, a.Node().Config.SideNodeList[0].GenesisBlockAddress,
+		status.SideChains[0].GenesisAddress)
+
+	assert.NoError(t, a.Stop())
+	_, err = a.Status()
+	assert.Equal(t, ErrNotStarted, err)
+
+	// another arbiter runs in process in another data directory
+	a, err = New(cfg, client, &Stores{DataDir: filepath.Join(dir, "another")})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "another"), a.Node().DataDir)
+	assert.NoError(t, a.Stop())
+
+	// failing to get the peers of the arbiters network fails Start
+	failPeers := func(params servers.Params) (interface{}, *rpc.Error) {
+		return nil, &rpc.Error{Code: -32603, Message: "peers unavailable"}
+	}
+	mainNode.Handle("getcrcpeersinfo", failPeers)
+	mainNode.Handle("getcrosschainpeersinfo", failPeers)
+	cfg.CRClaimDPOSNodeStartHeight = 0
+	a, err = New(cfg, client, &Stores{DataDir: filepath.Join(dir, "failed")})
+	assert.NoError(t, err)
+	assert.Error(t, a.Start(context.Background()))
+	_, err = a.Status()
+	assert.Equal(t, ErrNotStarted, err)
+	assert.NoError(t, a.Stop())
+}
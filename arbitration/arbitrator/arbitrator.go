@@ -2,11 +2,18 @@ package arbitrator
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
@@ -21,12 +28,11 @@ import (
 )
 
 const (
+	SCErrInternalError        int64 = 45002
 	SCErrMainchainTxDuplicate int64 = 45013
 	ErrInvalidMainchainTx     int64 = 45022
 )
 
-var SpvService SPVService
-
 type Arbitrator interface {
 	GetPublicKey() *crypto.PublicKey
 
@@ -39,11 +45,23 @@ type Arbitrator interface {
 	GetSideChainManager() SideChainManager
 	GetMainChain() MainChain
 
+	GetConfig() *config.Configuration
+	GetDataStore() *store.DataStoreImpl
+	GetFinishedTxsStore() store.FinishedTransactionsDataStore
+	GetAuditLog() *audit.Log
+
 	InitAccount(client *account.Client)
 	StartSpvModule() error
+	StopSpvModule()
+	GetSpvService() SPVService
+	RescanMainChain(height uint32) error
+	GetMainChainRescanProgress() (*RescanProgress, bool)
 
 	//deposit
 	SendDepositTransactions(spvTxs []*SpvTransaction, genesisAddress string)
+	RetryDepositTransactionsLoop(ctx context.Context)
+	RedriveDepositTx(txHash string, genesisAddress string) error
+	StopDepositPools()
 
 	//withdraw
 	CreateWithdrawTransaction(withdrawTxs []*WithdrawTx,
@@ -53,17 +71,41 @@ type Arbitrator interface {
 
 	BroadcastSidechainIllegalData(data *payload.SidechainIllegalData)
 
-	CheckAndRemoveCrossChainTransactionsFromDBLoop()
+	CheckAndRemoveCrossChainTransactionsFromDBLoop(ctx context.Context)
+	TakeoverWatchdogLoop(ctx context.Context)
+	IsWithdrawTakeoverAllowed(arbiters []string, onDutyIndex int,
+		publicKey *crypto.PublicKey, genesisAddress string, txHashes []string) bool
 }
 
 type ArbitratorImpl struct {
 	mainOnDutyMux *sync.Mutex
 	isOnDuty      bool
 
+	config           *config.Configuration
+	group            *ArbitratorGroupImpl
+	dataDir          string
+	dataStore        *store.DataStoreImpl
+	finishedTxsStore store.FinishedTransactionsDataStore
+	auditLog         *audit.Log
+
 	mainChainImpl        MainChain
 	mainChainClientImpl  MainChainClient
 	sideChainManagerImpl SideChainManager
 	client               *account.Client
+
+	spvMux     sync.RWMutex
+	spvService SPVService
+	// newSpvService creates spvService, it is kept to restart the spv module.
+	newSpvService func(cfg *Config) (SPVService, error)
+	// spvListeners are the listeners registered into spvService.
+	spvListeners []TransactionListener
+
+	mainChainRescanMux      sync.Mutex
+	mainChainRescanProgress *RescanProgress
+
+	depositPoolsMux sync.Mutex
+	depositPools    map[string]*depositPool
+	depositStopped  bool
 }
 
 func (ar *ArbitratorImpl) GetSideChainManager() SideChainManager {
@@ -82,18 +124,19 @@ func (ar *ArbitratorImpl) OnDutyArbitratorChanged(onDuty bool) {
 	ar.mainOnDutyMux.Unlock()
 
 	if onDuty {
-		log.Info("[OnDutyArbitratorChanged] I am on duty of main")
+		log.Arbiter.Info("[OnDutyArbitratorChanged] I am on duty of main")
 		ar.ProcessDepositTransactions()
 		ar.processWithdrawTransactions()
+		ar.processUTXOConsolidation()
 		ar.ProcessSideChainPowTransaction()
 	} else {
-		log.Info("[OnDutyArbitratorChanged] I became not on duty of main")
+		log.Arbiter.Info("[OnDutyArbitratorChanged] I became not on duty of main")
 	}
 }
 
 func (ar *ArbitratorImpl) ProcessDepositTransactions() {
 	if err := ar.mainChainImpl.SyncMainChainCachedTxs(); err != nil {
-		log.Warn(err)
+		log.Deposit.Warn("[ProcessDepositTransactions] sync main chain cached transactions failed", log.Err(err))
 	}
 }
 
@@ -103,6 +146,12 @@ func (ar *ArbitratorImpl) processWithdrawTransactions() {
 	}
 }
 
+func (ar *ArbitratorImpl) processUTXOConsolidation() {
+	for _, sc := range ar.sideChainManagerImpl.GetAllChains() {
+		go sc.ConsolidateUTXOs()
+	}
+}
+
 func (ar *ArbitratorImpl) ProcessSideChainPowTransaction() {
 	ar.sideChainManagerImpl.StartSideChainMining()
 }
@@ -111,10 +160,25 @@ func (ar *ArbitratorImpl) GetComplainSolving() ComplainSolving {
 	return nil
 }
 
+// Sign signs the content by the main account. The public key is set into the
+// ecdsa key, which crypto.Sign leaves out and newer versions of ecdsa refuse
+// to sign without.
 func (ar *ArbitratorImpl) Sign(content []byte) ([]byte, error) {
 	mainAccount := ar.client.GetMainAccount()
 
-	return mainAccount.Sign(content)
+	privateKey := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(mainAccount.PrivateKey)}
+	privateKey.Curve = crypto.DefaultCurve
+	privateKey.X, privateKey.Y = mainAccount.PublicKey.X, mainAccount.PublicKey.Y
+
+	digest := sha256.Sum256(content)
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, crypto.SignatureLength)
+	copy(signature[crypto.SignerLength-len(r.Bytes()):], r.Bytes())
+	copy(signature[crypto.SignatureLength-len(s.Bytes()):], s.Bytes())
+	return signature, nil
 }
 
 func (ar *ArbitratorImpl) IsOnDutyOfMain() bool {
@@ -124,7 +188,38 @@ func (ar *ArbitratorImpl) IsOnDutyOfMain() bool {
 }
 
 func (ar *ArbitratorImpl) GetArbitratorGroup() ArbitratorGroup {
-	return ArbitratorGroupSingleton
+	return ar.group
+}
+
+// GetConfig returns the configuration the arbiter runs by.
+func (ar *ArbitratorImpl) GetConfig() *config.Configuration {
+	return ar.config
+}
+
+// GetDataStore returns the databases of cached cross chain transactions.
+func (ar *ArbitratorImpl) GetDataStore() *store.DataStoreImpl {
+	return ar.dataStore
+}
+
+// GetFinishedTxsStore returns the database of finished cross chain
+// transactions.
+func (ar *ArbitratorImpl) GetFinishedTxsStore() store.FinishedTransactionsDataStore {
+	return ar.finishedTxsStore
+}
+
+// GetAuditLog returns the log signatures of the arbiter are recorded to, nil
+// if not recorded.
+func (ar *ArbitratorImpl) GetAuditLog() *audit.Log {
+	return ar.auditLog
+}
+
+// SetStores sets the databases and the audit log used by the arbiter, they
+// are set before the arbiter is started.
+func (ar *ArbitratorImpl) SetStores(dataStore *store.DataStoreImpl,
+	finishedTxsStore store.FinishedTransactionsDataStore, auditLog *audit.Log) {
+	ar.dataStore = dataStore
+	ar.finishedTxsStore = finishedTxsStore
+	ar.auditLog = auditLog
 }
 
 func (ar *ArbitratorImpl) CreateWithdrawTransaction(withdrawTxs []*WithdrawTx,
@@ -133,11 +228,13 @@ func (ar *ArbitratorImpl) CreateWithdrawTransaction(withdrawTxs []*WithdrawTx,
 	withdrawTransaction, err := ar.mainChainImpl.CreateWithdrawTransaction(
 		sideChain, withdrawTxs, mcFunc)
 	if err != nil {
-		log.Warn(err.Error())
+		log.Withdraw.Warn("[CreateWithdrawTransaction] create withdraw transaction failed",
+			log.Chain(sideChain.GetKey()), log.F("txs", len(withdrawTxs)), log.Err(err))
 		return nil
 	}
 	if withdrawTransaction == nil {
-		log.Warn("Created an empty withdraw transaction.")
+		log.Withdraw.Warn("[CreateWithdrawTransaction] created an empty withdraw transaction",
+			log.Chain(sideChain.GetKey()))
 		return nil
 	}
 
@@ -149,73 +246,108 @@ type DepositTxInfo struct {
 	sideChain       SideChain
 }
 
+// SendDepositTransactions sends the deposit transactions to the side chain
+// through the deposit pool of the side chain, in order of main chain height.
 func (ar *ArbitratorImpl) SendDepositTransactions(spvTxs []*SpvTransaction, genesisAddress string) {
-	var failedMainChainTxHashes []string
-	var failedGenesisAddresses []string
 	var succeedMainChainTxHashes []string
 	var succeedGenesisAddresses []string
-	sideChain, ok := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(genesisAddress)
+	sideChain, ok := ar.sideChainManagerImpl.GetChain(genesisAddress)
 	if !ok {
-		log.Error("[SyncMainChainCachedTxs] Get side chain from genesis address failed, genesis address:", genesisAddress)
+		log.Deposit.Error("[SendDepositTransactions] Get side chain from genesis address failed",
+			log.Chain(genesisAddress))
+		return
+	}
+	pool, err := ar.getDepositPool(genesisAddress)
+	if err != nil {
+		log.Deposit.Warn("Send deposit transactions failed", log.Chain(genesisAddress), log.Err(err))
 		return
 	}
+
+	sort.SliceStable(spvTxs, func(i, j int) bool {
+		return depositHeight(spvTxs[i]) < depositHeight(spvTxs[j])
+	})
+	var mux sync.Mutex
+	var wg sync.WaitGroup
 	for _, tx := range spvTxs {
-		hash := tx.MainChainTransaction.Hash()
-		resp, err := sideChain.SendTransaction(&hash)
-		if err != nil || resp.Error != nil && resp.Code != ErrInvalidMainchainTx {
-			log.Warn("Send deposit transaction failed, move to finished db, main chain tx hash:", hash.String())
-			failedMainChainTxHashes = append(failedMainChainTxHashes, hash.String())
-			failedGenesisAddresses = append(failedGenesisAddresses, genesisAddress)
-		} else if resp.Error == nil && resp.Result != nil || resp.Error != nil && resp.Code == SCErrMainchainTxDuplicate {
-			if resp.Error != nil {
-				log.Info("Send deposit found transaction has been processed, move to finished db, main chain tx hash:", hash.String())
-			} else {
-				log.Info("Send deposit transaction succeed, move to finished db, main chain tx hash:", hash.String())
-				if txHash, ok := resp.Result.(string); ok {
-					log.Info("Send deposit transaction succeed, move to finished db, side chain tx hash:", txHash)
-				} else {
-					log.Info("Send deposit transaction, received invalid response")
-				}
+		tx := tx
+		wg.Add(1)
+		err := pool.submit(func() {
+			defer wg.Done()
+			if ar.sendDepositTransaction(sideChain, tx, genesisAddress) {
+				mux.Lock()
+				succeedMainChainTxHashes = append(succeedMainChainTxHashes, tx.MainChainTransaction.Hash().String())
+				succeedGenesisAddresses = append(succeedGenesisAddresses, genesisAddress)
+				mux.Unlock()
 			}
-			succeedMainChainTxHashes = append(succeedMainChainTxHashes, hash.String())
-			succeedGenesisAddresses = append(succeedGenesisAddresses, genesisAddress)
-		} else {
-			log.Warn("Send deposit transaction failed, need to resend, main chain tx hash:", hash.String())
+		})
+		if err != nil {
+			wg.Done()
+			log.Deposit.Warn("Send deposit transactions stopped", log.Chain(genesisAddress), log.Err(err))
+			break
 		}
 	}
+	wg.Wait()
 
-	for i := 0; i < len(failedMainChainTxHashes); i++ {
-		err := store.DbCache.MainChainStore.RemoveMainChainTxs(failedMainChainTxHashes, failedGenesisAddresses)
+	if len(succeedMainChainTxHashes) != 0 {
+		err := ar.dataStore.MainChainStore.RemoveMainChainTxs(succeedMainChainTxHashes, succeedGenesisAddresses)
 		if err != nil {
-			log.Warn("Remove faild transaction from db failed")
+			log.Deposit.Warn("Remove succeed deposit transaction from db failed",
+				log.Chain(genesisAddress), log.Err(err))
 		}
-		err = store.FinishedTxsDbCache.AddFailedDepositTxs(failedMainChainTxHashes, failedGenesisAddresses)
+		err = ar.finishedTxsStore.AddSucceedDepositTxs(succeedMainChainTxHashes, succeedGenesisAddresses)
 		if err != nil {
-			log.Warn("Add faild transaction to finished db failed")
+			log.Deposit.Warn("Add succeed deposit transaction to finished db failed",
+				log.Chain(genesisAddress), log.Err(err))
 		}
 	}
-	for i := 0; i < len(succeedMainChainTxHashes); i++ {
-		err := store.DbCache.MainChainStore.RemoveMainChainTxs(succeedMainChainTxHashes, succeedGenesisAddresses)
-		if err != nil {
-			log.Warn("Remove succeed deposit transaction from db failed")
-		}
-		err = store.FinishedTxsDbCache.AddSucceedDepositTxs(succeedMainChainTxHashes, succeedGenesisAddresses)
-		if err != nil {
-			log.Warn("Add succeed deposit transaction to finished db failed")
+}
+
+// sendDepositTransaction sends the deposit transaction to the side chain,
+// and returns true if it succeed.
+func (ar *ArbitratorImpl) sendDepositTransaction(sideChain SideChain, tx *SpvTransaction, genesisAddress string) bool {
+	hash := tx.MainChainTransaction.Hash()
+	resp, err := sideChain.SendTransaction(&hash)
+	logger := log.Deposit.With(log.Chain(genesisAddress), log.TxHash(hash.String()),
+		log.Height(depositHeight(tx)))
+	switch classifyDepositResponse(resp, err) {
+	case depositSucceed:
+		if resp.Error != nil {
+			logger.Info("Send deposit found transaction has been processed, move to finished db")
+		} else if txHash, ok := resp.Result.(string); ok {
+			logger.Info("Send deposit transaction succeed, move to finished db",
+				log.F("sidetxhash", txHash))
+		} else {
+			logger.Info("Send deposit transaction succeed, move to finished db, received invalid response")
 		}
+		return true
+	case depositRetryable:
+		ar.retryDepositTransaction(tx, genesisAddress, resp, err)
+	default:
+		logger.Warn("Send deposit transaction failed, move to dead letters")
+		ar.deadLetterDepositTransaction(tx, genesisAddress, 0, resp, err)
+	}
+	return false
+}
+
+func depositHeight(tx *SpvTransaction) uint32 {
+	if tx.Proof == nil {
+		return 0
 	}
+	return tx.Proof.Height
 }
 
 func (ar *ArbitratorImpl) BroadcastWithdrawProposal(txn *types.Transaction) {
 	err := ar.mainChainImpl.BroadcastWithdrawProposal(txn)
 	if err != nil {
-		log.Warn(err.Error())
+		log.Withdraw.Warn("[BroadcastWithdrawProposal] broadcast withdraw proposal failed",
+			log.Proposal(txn.Hash().String()), log.Err(err))
 	}
 }
 
 func (ar *ArbitratorImpl) BroadcastSidechainIllegalData(data *payload.SidechainIllegalData) {
 	if err := ar.mainChainImpl.BroadcastSidechainIllegalData(data); err != nil {
-		log.Warn(err.Error())
+		log.Arbiter.Warn("[BroadcastSidechainIllegalData] broadcast side chain illegal data failed",
+			log.Chain(data.GenesisBlockAddress), log.Height(data.Height), log.Err(err))
 	}
 }
 
@@ -225,13 +357,14 @@ func (ar *ArbitratorImpl) SendWithdrawTransaction(txn *types.Transaction) (rpc.R
 		return rpc.Response{}, err
 	}
 
-	log.Info("[Rpc-sendrawtransaction] Withdraw transaction to main chain：",
-		config.Parameters.MainNode.Rpc.IpAddress, ":", config.Parameters.MainNode.Rpc.HttpJsonPort)
+	log.Withdraw.Info("[Rpc-sendrawtransaction] Withdraw transaction to main chain",
+		log.TxHash(txn.Hash().String()), log.F("ip", ar.config.MainNode.Rpc.IpAddress),
+		log.F("port", ar.config.MainNode.Rpc.HttpJsonPort))
 	resp, err := rpc.CallAndUnmarshalResponse("sendrawtransaction",
-		rpc.Param("data", content), config.Parameters.MainNode.Rpc)
+		rpc.Param("data", content), ar.config.MainNode.Rpc)
 	if err != nil {
-		log.Error("[Rpc-sendrawtransaction] Withdraw transaction to main "+
-			"chain error:", err)
+		log.Withdraw.Error("[Rpc-sendrawtransaction] Withdraw transaction to main chain error",
+			log.TxHash(txn.Hash().String()), log.Err(err))
 		return rpc.Response{}, err
 	}
 
@@ -271,45 +404,96 @@ func (ar *ArbitratorImpl) InitAccount(client *account.Client) {
 }
 
 func (ar *ArbitratorImpl) StartSpvModule() error {
-	params := config.GetSpvChainParams()
+	return ar.StartSpvModuleWithService(func(cfg *Config) (SPVService, error) {
+		return NewSPVService(cfg)
+	})
+}
+
+// StartSpvModuleWithService starts the spv module on the service newService
+// creates, such as a scripted one of simulations.
+func (ar *ArbitratorImpl) StartSpvModuleWithService(newService func(cfg *Config) (SPVService, error)) error {
+	ar.spvMux.Lock()
+	defer ar.spvMux.Unlock()
+	return ar.startSpvModule(newService)
+}
+
+func (ar *ArbitratorImpl) startSpvModule(newService func(cfg *Config) (SPVService, error)) error {
+	params := ar.config.GetSpvChainParams()
 	spvCfg := &Config{
-		DataDir:        filepath.Join(config.DataPath, config.DataDir, config.SpvDir),
+		DataDir:        filepath.Join(ar.dataDir, config.SpvDir),
 		ChainParams:    params,
-		PermanentPeers: config.Parameters.MainNode.SpvSeedList,
+		PermanentPeers: ar.config.MainNode.SpvSeedList,
 		NodeVersion : config.NodePrefix + config.Version,
 	}
 
-	var err error
-	SpvService, err = NewSPVService(spvCfg)
+	spvService, err := newService(spvCfg)
 	if err != nil {
 		return err
 	}
-
-	for _, sideNode := range config.Parameters.SideNodeList {
-		if sideNode.PowChain {
-			log.Info("[StartSpvModule] register auxpow listener:", sideNode.MiningAddr)
-			auxpowListener := &AuxpowListener{ListenAddress: sideNode.MiningAddr}
+	ar.spvService = spvService
+	ar.newSpvService = newService
+	ar.spvListeners = nil
+
+	for _, sideNode := range ar.config.SideNodeList {
+		if sideNode.IsPowChain() {
+			log.Auxpow.Info("[StartSpvModule] register auxpow listener",
+				log.Chain(sideNode.GenesisBlockAddress), log.F("address", sideNode.MiningAddr))
+			auxpowListener := &AuxpowListener{ListenAddress: sideNode.MiningAddr, spv: spvService, arbitrator: ar}
 			auxpowListener.start()
-			err = SpvService.RegisterTransactionListener(auxpowListener)
+			err = spvService.RegisterTransactionListener(auxpowListener)
 			if err != nil {
 				return err
 			}
+			ar.spvListeners = append(ar.spvListeners, auxpowListener)
 		}
 
-		log.Info("[StartSpvModule] register dposit listener:", sideNode.GenesisBlockAddress)
-		dpListener := &DepositListener{ListenAddress: sideNode.GenesisBlockAddress}
+		log.Deposit.Info("[StartSpvModule] register deposit listener", log.Chain(sideNode.GenesisBlockAddress))
+		dpListener := &DepositListener{ListenAddress: sideNode.GenesisBlockAddress, spv: spvService, arbitrator: ar}
 		dpListener.start()
-		err = SpvService.RegisterTransactionListener(dpListener)
+		err = spvService.RegisterTransactionListener(dpListener)
 		if err != nil {
 			return err
 		}
+		ar.spvListeners = append(ar.spvListeners, dpListener)
 	}
 
-	go SpvService.Start()
+	go spvService.Start()
 
 	return nil
 }
 
+// StopSpvModule stops the spv service and its listeners.
+func (ar *ArbitratorImpl) StopSpvModule() {
+	ar.spvMux.Lock()
+	defer ar.spvMux.Unlock()
+	ar.stopSpvModule()
+}
+
+func (ar *ArbitratorImpl) stopSpvModule() {
+	if ar.spvService == nil {
+		return
+	}
+	ar.spvService.Stop()
+	for _, listener := range ar.spvListeners {
+		switch l := listener.(type) {
+		case *AuxpowListener:
+			l.stop()
+		case *DepositListener:
+			l.stop()
+		}
+	}
+	ar.spvService = nil
+	ar.spvListeners = nil
+}
+
+// GetSpvService returns the spv service started by StartSpvModule, nil if not
+// started.
+func (ar *ArbitratorImpl) GetSpvService() SPVService {
+	ar.spvMux.RLock()
+	defer ar.spvMux.RUnlock()
+	return ar.spvService
+}
+
 func (ar *ArbitratorImpl) convertToTransactionContent(txn *types.Transaction) (string, error) {
 	buf := new(bytes.Buffer)
 	err := txn.Serialize(buf)
@@ -320,17 +504,24 @@ func (ar *ArbitratorImpl) convertToTransactionContent(txn *types.Transaction) (s
 	return content, nil
 }
 
-func (ar *ArbitratorImpl) CheckAndRemoveCrossChainTransactionsFromDBLoop() {
+func (ar *ArbitratorImpl) CheckAndRemoveCrossChainTransactionsFromDBLoop(ctx context.Context) {
 	for {
 		err := ar.mainChainImpl.CheckAndRemoveDepositTransactionsFromDB()
 		if err != nil {
-			log.Warn("Check and remove deposit transactions from db error:", err)
+			log.Deposit.Warn("[CheckAndRemoveCrossChainTransactionsFromDBLoop] check and remove "+
+				"deposit transactions from db error", log.Err(err))
 		}
 		err = ar.GetSideChainManager().CheckAndRemoveWithdrawTransactionsFromDB()
 		if err != nil {
-			log.Warn("Check and remove withdraw transactions from db error:", err)
+			log.Withdraw.Warn("[CheckAndRemoveCrossChainTransactionsFromDBLoop] check and remove "+
+				"withdraw transactions from db error", log.Err(err))
+		}
+		log.Store.Info("[CheckAndRemoveCrossChainTransactionsFromDBLoop] check and remove " +
+			"cross chain transactions from dbcache finished")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * ar.config.ClearTransactionInterval):
 		}
-		log.Info("Check and remove cross chain transactions from dbcache finished")
-		time.Sleep(time.Millisecond * config.Parameters.ClearTransactionInterval)
 	}
 }
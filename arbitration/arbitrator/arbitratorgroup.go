@@ -1,6 +1,7 @@
 package arbitrator
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -13,10 +14,6 @@ import (
 	"github.com/elastos/Elastos.ELA/crypto"
 )
 
-var (
-	ArbitratorGroupSingleton *ArbitratorGroupImpl
-)
-
 type ArbitratorGroupListener interface {
 	GetPublicKey() *crypto.PublicKey
 	OnDutyArbitratorChanged(onDuty bool)
@@ -26,13 +23,15 @@ type ArbitratorGroup interface {
 	GetCurrentArbitrator() Arbitrator
 	GetArbitratorsCount() int
 	GetAllArbitrators() []string
+	GetCurrentHeight() uint32
 	GetOnDutyArbitratorOfMain() (string, error)
 	CheckOnDutyStatus(uint32)
 	SetListener(listener ArbitratorGroupListener)
 }
 
 type ArbitratorGroupImpl struct {
-	mux sync.Mutex
+	mux    sync.Mutex
+	config *config.Configuration
 
 	onDutyArbitratorIndex int
 	arbitrators           []string
@@ -46,14 +45,18 @@ type ArbitratorGroupImpl struct {
 	isListenerOnDuty bool
 }
 
-func (group *ArbitratorGroupImpl) SyncLoop() {
+func (group *ArbitratorGroupImpl) SyncLoop(ctx context.Context) {
 	for {
 		err := group.SyncFromMainNode()
 		if err != nil {
-			log.Error("Arbitrator group sync error: ", err)
+			log.Arbiter.Error("[SyncLoop] arbitrator group sync error", log.Err(err))
 		}
 
-		time.Sleep(time.Millisecond * config.Parameters.SyncInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * group.config.SyncInterval):
+		}
 	}
 }
 
@@ -72,13 +75,13 @@ func (group *ArbitratorGroupImpl) InitArbitratorsByStrings(arbiters []string, on
 func (group *ArbitratorGroupImpl) SyncFromMainNode() error {
 	currentTime := uint64(time.Now().UnixNano())
 	if group.lastSyncTime != nil && (currentTime-*group.lastSyncTime)*uint64(time.Millisecond) < group.timeoutLimit {
-		log.Info("[SyncFromMainNode] less than timeout limit")
+		log.Arbiter.Info("[SyncFromMainNode] less than timeout limit")
 		return nil
 	}
 
-	height, err := rpc.GetCurrentHeight(config.Parameters.MainNode.Rpc)
+	height, err := rpc.GetCurrentHeight(group.config.MainNode.Rpc)
 	if err != nil {
-		log.Info("[SyncFromMainNode] rpc get current height failed")
+		log.Arbiter.Info("[SyncFromMainNode] rpc get current height failed", log.Err(err))
 		return err
 	}
 
@@ -93,9 +96,10 @@ func (group *ArbitratorGroupImpl) SyncFromMainNode() error {
 	if mc := group.GetCurrentArbitrator().GetMainChain(); mc != nil {
 		currentHeight = mc.SyncChainData()
 	}
-	groupInfo, err := rpc.GetArbitratorGroupInfoByHeight(currentHeight)
+	groupInfo, err := rpc.GetArbitratorGroupInfoByHeight(currentHeight, group.config)
 	if err != nil {
-		log.Info("[SyncFromMainNode] get arbitrator group info failed")
+		log.Arbiter.Info("[SyncFromMainNode] get arbitrator group info failed",
+			log.Height(currentHeight), log.Err(err))
 		return err
 	}
 
@@ -118,7 +122,7 @@ func (group *ArbitratorGroupImpl) CheckOnDutyStatus(height uint32) {
 		return
 	}
 
-	onDutyArbiter, err := ArbitratorGroupSingleton.GetOnDutyArbitratorOfMain()
+	onDutyArbiter, err := group.GetOnDutyArbitratorOfMain()
 	if err != nil {
 		return
 	}
@@ -129,7 +133,7 @@ func (group *ArbitratorGroupImpl) CheckOnDutyStatus(height uint32) {
 			(group.isListenerOnDuty == true && !crypto.Equal(group.listener.GetPublicKey(), pk)) {
 			group.isListenerOnDuty = !group.isListenerOnDuty
 			group.listener.OnDutyArbitratorChanged(group.isListenerOnDuty)
-		} else if group.isListenerOnDuty == true && crypto.Equal(group.listener.GetPublicKey(), pk) && config.Parameters.CRClaimDPOSNodeStartHeight == height {
+		} else if group.isListenerOnDuty == true && crypto.Equal(group.listener.GetPublicKey(), pk) && group.config.CRClaimDPOSNodeStartHeight == height {
 			group.listener.OnDutyArbitratorChanged(group.isListenerOnDuty)
 		}
 	} else if ok && err != nil {
@@ -180,19 +184,29 @@ func (group *ArbitratorGroupImpl) SetListener(listener ArbitratorGroupListener)
 	group.isListenerOnDuty = false
 }
 
-func Init(client *account.Client) {
-	ArbitratorGroupSingleton = &ArbitratorGroupImpl{
+// NewArbitratorGroup creates the arbitrator group of the arbiter configured
+// by cfg and signing by client, the current arbitrator keeps its data in
+// dataDir.
+func NewArbitratorGroup(cfg *config.Configuration, dataDir string,
+	client *account.Client) *ArbitratorGroupImpl {
+	group := &ArbitratorGroupImpl{
+		config:           cfg,
 		timeoutLimit:     1000,
 		currentHeight:    new(uint32),
 		lastSyncTime:     new(uint64),
 		isListenerOnDuty: false,
 	}
 
-	currentArbitrator := &ArbitratorImpl{mainOnDutyMux: new(sync.Mutex)}
+	currentArbitrator := &ArbitratorImpl{
+		mainOnDutyMux: new(sync.Mutex),
+		config:        cfg,
+		group:         group,
+		dataDir:       dataDir,
+		depositPools:  make(map[string]*depositPool),
+	}
 	currentArbitrator.InitAccount(client)
 
-	ArbitratorGroupSingleton.currentArbitrator = currentArbitrator
-	ArbitratorGroupSingleton.SetListener(currentArbitrator)
-
-	//spvLog.Init(config.Parameters.SPVPrintLevel, 20, 1024)
+	group.currentArbitrator = currentArbitrator
+	group.SetListener(currentArbitrator)
+	return group
 }
@@ -3,7 +3,6 @@ package arbitrator
 import (
 	"bytes"
 
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 
 	"github.com/elastos/Elastos.ELA.SPV/bloom"
@@ -18,7 +17,10 @@ import (
 type AuxpowListener struct {
 	ListenAddress string
 
+	spv         spv.SPVService
+	arbitrator  *ArbitratorImpl
 	notifyQueue chan *notifyTask
+	quit        chan struct{}
 }
 
 func (l *AuxpowListener) Address() string {
@@ -37,8 +39,9 @@ func (l *AuxpowListener) Rollback(height uint32) {}
 
 func (l *AuxpowListener) Notify(id common.Uint256, proof bloom.MerkleProof, tx types.Transaction) {
 	l.notifyQueue <- &notifyTask{id, &proof, &tx}
-	log.Info("[Notify-Auxpow][", l.ListenAddress, "] find side aux pow transaction, hash:", tx.Hash().String())
-	err := SpvService.SubmitTransactionReceipt(id, tx.Hash())
+	log.Auxpow.Info("[Notify-Auxpow] find side aux pow transaction",
+		log.F("address", l.ListenAddress), log.TxHash(tx.Hash().String()))
+	err := l.spv.SubmitTransactionReceipt(id, tx.Hash())
 	if err != nil {
 		return
 	}
@@ -46,17 +49,18 @@ func (l *AuxpowListener) Notify(id common.Uint256, proof bloom.MerkleProof, tx t
 
 func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 	task := tasks[len(tasks)-1]
-	log.Info("[Notify-ProcessNotifyData][", l.ListenAddress, "] process hash:", task.tx.Hash().String(), "len tasks:", len(tasks))
-	err := SpvService.VerifyTransaction(*task.proof, *task.tx)
+	logger := log.Auxpow.With(log.F("address", l.ListenAddress), log.TxHash(task.tx.Hash().String()))
+	logger.Info("[Notify-ProcessNotifyData] process side aux pow transaction", log.F("tasks", len(tasks)))
+	err := l.spv.VerifyTransaction(*task.proof, *task.tx)
 	if err != nil {
-		log.Error("verify transaction error: ", err)
+		logger.Error("verify transaction error", log.Err(err))
 		return
 	}
 
 	// Get Header from main chain
-	header, err := SpvService.HeaderStore().Get(&task.proof.BlockHash)
+	header, err := l.spv.HeaderStore().Get(&task.proof.BlockHash)
 	if err != nil {
-		log.Error("can not get block from main chain")
+		logger.Error("can not get block from main chain", log.Err(err))
 		return
 	}
 
@@ -71,38 +75,38 @@ func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 	txId := task.tx.Hash()
 	merkleBranch, err := bloom.GetTxMerkleBranch(merkleBlock, &txId)
 	if err != nil {
-		log.Error("can not get merkle branch")
+		logger.Error("can not get merkle branch", log.Err(err))
 		return
 	}
 
 	// serialize main chain tx
 	buf := new(bytes.Buffer)
 	if err := task.tx.Serialize(buf); err != nil {
-		log.Error("invalid payload tx")
+		logger.Error("invalid payload tx", log.Err(err))
 		return
 	}
 
 	// serialize merkle branch
 	if err := common.WriteUint32(buf, uint32(len(merkleBranch.Branches))); err != nil {
-		log.Error("serialize merkle branch count failed:", err.Error())
+		logger.Error("serialize merkle branch count failed", log.Err(err))
 		return
 	}
 	for _, branch := range merkleBranch.Branches {
 		err = branch.Serialize(buf)
 		if err != nil {
-			log.Error("serialize merkle branch failed:", err.Error())
+			logger.Error("serialize merkle branch failed", log.Err(err))
 			return
 		}
 	}
 	if err := common.WriteUint32(buf, uint32(merkleBranch.Index)); err != nil {
-		log.Error("serialize merkle branch index failed:", err.Error())
+		logger.Error("serialize merkle branch index failed", log.Err(err))
 		return
 	}
 
 	// serialize ela header
 	elaHeader := header.BlockHeader.(*iutil.Header)
 	if err := elaHeader.Serialize(buf); err != nil {
-		log.Error("invalid elaHeader")
+		logger.Error("invalid elaHeader", log.Err(err))
 		return
 	}
 
@@ -110,31 +114,31 @@ func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 
 	p, ok := task.tx.Payload.(*payload.SideChainPow)
 	if !ok {
-		log.Error("invalid payload type")
+		logger.Error("invalid payload type")
 		return
 	}
 	blockhashString := p.SideBlockHash.String()
 	genesishashString := p.SideGenesisHash.String()
 	blockHeight := p.BlockHeight
+	logger = logger.With(log.Height(blockHeight))
 
 	var sideChain SideChain
-	for _, sideNode := range config.Parameters.SideNodeList {
-		log.Info("side node genesis block:", sideNode.GenesisBlock,
-			"side aux pow tx genesis hash:", genesishashString)
+	for _, sideNode := range l.arbitrator.config.SideNodeList {
+		logger.Debug("match side node genesis block", log.Chain(sideNode.GenesisBlockAddress),
+			log.F("genesis", sideNode.GenesisBlock), log.F("auxpowgenesis", genesishashString))
 		if sideNode.GenesisBlock == genesishashString {
-			sc, ok := ArbitratorGroupSingleton.GetCurrentArbitrator().
-				GetSideChainManager().GetChain(sideNode.GenesisBlockAddress)
+			sc, ok := l.arbitrator.GetSideChainManager().GetChain(sideNode.GenesisBlockAddress)
 			if ok {
 				currentHeight, err := sc.GetCurrentHeight()
 				if err != nil {
-					log.Error("side chain GetCurrentHeight failed")
+					logger.Error("side chain GetCurrentHeight failed", log.Chain(sc.GetKey()), log.Err(err))
 					return
 				}
 				if currentHeight == blockHeight {
 					sideChain = sc
 				} else {
-					log.Warn("No need to submit auxpow, current side chain height:",
-						currentHeight, " block height:", blockHeight)
+					logger.Warn("No need to submit auxpow", log.Chain(sc.GetKey()),
+						log.F("sideheight", currentHeight))
 					return
 				}
 			}
@@ -142,20 +146,20 @@ func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 	}
 
 	if sideChain == nil {
-		log.Error("arbiter not find side chain")
-		allChains := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetAllChains()
-		for index, chain := range allChains {
-			log.Error("side chain", index, ":", chain.GetKey())
+		var chains []string
+		allChains := l.arbitrator.GetSideChainManager().GetAllChains()
+		for _, chain := range allChains {
+			chains = append(chains, chain.GetKey())
 		}
-
-		log.Error("can not find side chain from genesis block hash: [", genesishashString, "]")
+		logger.Error("can not find side chain from genesis block hash",
+			log.F("genesis", genesishashString), log.F("chains", chains))
 		return
 	}
 
 	sideChain.UpdateLastNotifySideMiningHeight(p.SideGenesisHash)
 	err = sideChain.SubmitAuxpow(genesishashString, blockhashString, sideAuxpowString)
 	if err != nil {
-		log.Error("[Notify-Auxpow] submit SideAuxpow error: ", err)
+		logger.Error("[Notify-Auxpow] submit SideAuxpow error", log.Chain(sideChain.GetKey()), log.Err(err))
 		return
 	}
 	sideChain.UpdateLastSubmitAuxpowHeight(p.SideGenesisHash)
@@ -163,6 +167,7 @@ func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 
 func (l *AuxpowListener) start() {
 	l.notifyQueue = make(chan *notifyTask, 10000)
+	l.quit = make(chan struct{})
 	go func() {
 		var tasks []*notifyTask
 		for {
@@ -181,11 +186,20 @@ func (l *AuxpowListener) start() {
 					l.ProcessNotifyData(tasks)
 					tasks = make([]*notifyTask, 0)
 				}
-				data, ok := <-l.notifyQueue
-				if ok {
-					tasks = append(tasks, data)
+				select {
+				case data, ok := <-l.notifyQueue:
+					if ok {
+						tasks = append(tasks, data)
+					}
+				case <-l.quit:
+					return
 				}
 			}
 		}
 	}()
 }
+
+// stop stops processing notified transactions after the ones being processed.
+func (l *AuxpowListener) stop() {
+	close(l.quit)
+}
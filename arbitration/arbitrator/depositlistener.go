@@ -13,7 +13,10 @@ import (
 
 type DepositListener struct {
 	ListenAddress string
+	spv           SPVService
+	arbitrator    *ArbitratorImpl
 	notifyQueue   chan *notifyTask
+	quit          chan struct{}
 }
 
 func (l *DepositListener) Address() string {
@@ -29,12 +32,14 @@ func (l *DepositListener) Flags() uint64 {
 }
 
 func (l *DepositListener) Notify(id common.Uint256, proof bloom.MerkleProof, tx types.Transaction) {
-	log.Info("[Notify-Deposit] find deposit transaction and add into channel, transaction hash:", tx.Hash().String())
+	log.Deposit.Info("[Notify-Deposit] find deposit transaction and add into channel",
+		log.Chain(l.ListenAddress), log.TxHash(tx.Hash().String()))
 	l.notifyQueue <- &notifyTask{id, &proof, &tx}
 }
 
 func (l *DepositListener) ProcessNotifyData(tasks []*notifyTask) {
-	log.Info("[Notify-Process] deal with", len(tasks), "transactions")
+	log.Deposit.Info("[Notify-Process] deal with transactions",
+		log.Chain(l.ListenAddress), log.F("count", len(tasks)))
 
 	var ids []common.Uint256
 	var txs []*MainChainTransaction
@@ -48,18 +53,21 @@ func (l *DepositListener) ProcessNotifyData(tasks []*notifyTask) {
 		})
 	}
 
-	result, err := store.DbCache.MainChainStore.AddMainChainTxs(txs)
+	result, err := l.arbitrator.dataStore.MainChainStore.AddMainChainTxs(txs)
 	if err != nil {
-		log.Error("[Notify-Process] AddMainChainTx error:", err)
+		log.Deposit.Error("[Notify-Process] AddMainChainTx error",
+			log.Chain(l.ListenAddress), log.Err(err))
 		return
 	}
 
+	l.addSolvencyFlows(txs)
+
 	for i := 0; i < len(ids); i++ {
-		SpvService.SubmitTransactionReceipt(ids[i], txs[i].Transaction.Hash())
+		l.spv.SubmitTransactionReceipt(ids[i], txs[i].Transaction.Hash())
 	}
 
-	if !ArbitratorGroupSingleton.GetCurrentArbitrator().IsOnDutyOfMain() {
-		log.Warn("[Notify-Process] i am not onduty")
+	if !l.arbitrator.IsOnDutyOfMain() {
+		log.Deposit.Warn("[Notify-Process] i am not onduty", log.Chain(l.ListenAddress))
 		return
 	}
 
@@ -69,11 +77,37 @@ func (l *DepositListener) ProcessNotifyData(tasks []*notifyTask) {
 			spvTxs = append(spvTxs, &SpvTransaction{MainChainTransaction: txs[i].Transaction, Proof: txs[i].Proof})
 		}
 	}
-	log.Info("[Notify-Process] find deposit transaction, create and send deposit transaction, size of txs:", len(spvTxs))
-	for index, spvTx := range spvTxs {
-		log.Info("[Notify-Process] tx hash[", index, "]:", spvTx.MainChainTransaction.Hash().String())
+	log.Deposit.Info("[Notify-Process] find deposit transaction, create and send deposit transaction",
+		log.Chain(l.ListenAddress), log.F("count", len(spvTxs)))
+	for _, spvTx := range spvTxs {
+		log.Deposit.Info("[Notify-Process] send deposit transaction", log.Chain(l.ListenAddress),
+			log.TxHash(spvTx.MainChainTransaction.Hash().String()))
+	}
+	l.arbitrator.SendDepositTransactions(spvTxs, l.ListenAddress)
+}
+
+// addSolvencyFlows records the amounts the deposit transactions lock into the
+// genesis address, the bridge solvency is reconciled by them.
+func (l *DepositListener) addSolvencyFlows(txs []*MainChainTransaction) {
+	var flows []*store.SolvencyFlow
+	for _, tx := range txs {
+		amount, err := GetDepositAmount(tx.Transaction, l.ListenAddress)
+		if err != nil {
+			log.Deposit.Warn("[Notify-Process] get deposit amount failed",
+				log.Chain(l.ListenAddress), log.TxHash(tx.TransactionHash), log.Err(err))
+			continue
+		}
+		flows = append(flows, &store.SolvencyFlow{
+			TransactionHash:     tx.TransactionHash,
+			GenesisBlockAddress: l.ListenAddress,
+			Deposit:             true,
+			Amount:              amount,
+		})
+	}
+	if err := l.arbitrator.finishedTxsStore.AddSolvencyFlows(flows); err != nil {
+		log.Deposit.Warn("[Notify-Process] add solvency flows failed",
+			log.Chain(l.ListenAddress), log.Err(err))
 	}
-	ArbitratorGroupSingleton.GetCurrentArbitrator().SendDepositTransactions(spvTxs, l.ListenAddress)
 }
 
 func (l *DepositListener) Rollback(height uint32) {
@@ -87,6 +121,7 @@ type notifyTask struct {
 
 func (l *DepositListener) start() {
 	l.notifyQueue = make(chan *notifyTask, 10000)
+	l.quit = make(chan struct{})
 	go func() {
 		var tasks []*notifyTask
 		for {
@@ -94,7 +129,7 @@ func (l *DepositListener) start() {
 			case data, ok := <-l.notifyQueue:
 				if ok {
 					tasks = append(tasks, data)
-					log.Info("[DepositListener] len tasks:", len(tasks))
+					log.Deposit.Debug("[DepositListener] queued", log.F("tasks", len(tasks)))
 					if len(tasks) >= 10000 {
 						l.ProcessNotifyData(tasks)
 						tasks = make([]*notifyTask, 0)
@@ -105,12 +140,21 @@ func (l *DepositListener) start() {
 					l.ProcessNotifyData(tasks)
 					tasks = make([]*notifyTask, 0)
 				}
-				data, ok := <-l.notifyQueue
-				if ok {
-					tasks = append(tasks, data)
-					log.Info("[DepositListener] len tasks:", len(tasks))
+				select {
+				case data, ok := <-l.notifyQueue:
+					if ok {
+						tasks = append(tasks, data)
+						log.Deposit.Debug("[DepositListener] queued", log.F("tasks", len(tasks)))
+					}
+				case <-l.quit:
+					return
 				}
 			}
 		}
 	}()
 }
+
+// stop stops processing notified transactions after the ones being processed.
+func (l *DepositListener) stop() {
+	close(l.quit)
+}
@@ -0,0 +1,103 @@
+package arbitrator
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+// depositPool sends the deposit transactions of one side chain one by one in
+// the order submitted, no faster than the rate limit. Each side chain has its
+// own pool, so side chains are sent to in parallel.
+type depositPool struct {
+	mux     sync.RWMutex
+	stopped bool
+	jobs    chan func()
+	ticker  *time.Ticker
+	wg      sync.WaitGroup
+}
+
+// depositQueueSize is the count of jobs queued before submit blocks.
+const depositQueueSize = 16
+
+// newDepositPool starts the worker of the pool, rate is the max count of jobs
+// started per second, 0 for no limit.
+func newDepositPool(rate int) *depositPool {
+	p := &depositPool{jobs: make(chan func(), depositQueueSize)}
+	if rate > 0 {
+		p.ticker = time.NewTicker(time.Second / time.Duration(rate))
+	}
+	p.wg.Add(1)
+	go p.work()
+	return p
+}
+
+func (p *depositPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		if p.ticker != nil {
+			<-p.ticker.C
+		}
+		job()
+	}
+}
+
+// submit queues the job in order, it blocks while the queue is full.
+func (p *depositPool) submit(job func()) error {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	if p.stopped {
+		return errors.New("deposit pool stopped")
+	}
+	p.jobs <- job
+	return nil
+}
+
+// stop stops accepting jobs and waits for the queued jobs to finish.
+func (p *depositPool) stop() {
+	p.mux.Lock()
+	if p.stopped {
+		p.mux.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.jobs)
+	p.mux.Unlock()
+
+	p.wg.Wait()
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+}
+
+func (ar *ArbitratorImpl) getDepositPool(genesisAddress string) (*depositPool, error) {
+	ar.depositPoolsMux.Lock()
+	defer ar.depositPoolsMux.Unlock()
+	if ar.depositStopped {
+		return nil, errors.New("deposit pools stopped")
+	}
+
+	pool, ok := ar.depositPools[genesisAddress]
+	if !ok {
+		pool = newDepositPool(ar.config.DepositRateLimit)
+		ar.depositPools[genesisAddress] = pool
+	}
+	return pool, nil
+}
+
+// StopDepositPools stops accepting deposit transactions and waits for the
+// queued ones to be sent. The others are kept in db and sent after restart.
+func (ar *ArbitratorImpl) StopDepositPools() {
+	ar.depositPoolsMux.Lock()
+	ar.depositStopped = true
+	pools := ar.depositPools
+	ar.depositPools = make(map[string]*depositPool)
+	ar.depositPoolsMux.Unlock()
+
+	for genesisAddress, pool := range pools {
+		pool.stop()
+		log.Deposit.Info("[StopDepositPools] deposit pool drained", log.Chain(genesisAddress))
+	}
+}
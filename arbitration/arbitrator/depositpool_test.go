@@ -0,0 +1,80 @@
+package arbitrator
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDepositPool_Order(t *testing.T) {
+	pool := newDepositPool(0)
+
+	var mux sync.Mutex
+	var sent []int
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		i := i
+		wg.Add(1)
+		err := pool.submit(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, n)
+			}
+			// the later ones finish sooner if sent at the same time
+			time.Sleep(time.Duration(30-i) * 100 * time.Microsecond)
+			mux.Lock()
+			sent = append(sent, i)
+			mux.Unlock()
+			atomic.AddInt32(&running, -1)
+		})
+		assert.NoError(t, err)
+	}
+	wg.Wait()
+	pool.stop()
+
+	// sent one by one in the order submitted
+	assert.Equal(t, int32(1), maxRunning)
+	assert.Equal(t, 30, len(sent))
+	for i, n := range sent {
+		assert.Equal(t, i, n)
+	}
+}
+
+func TestDepositPool_Stop(t *testing.T) {
+	pool := newDepositPool(0)
+
+	var done int32
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, pool.submit(func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		}))
+	}
+	pool.stop()
+
+	// queued jobs are drained before stop returns
+	assert.Equal(t, int32(2), atomic.LoadInt32(&done))
+	assert.Error(t, pool.submit(func() {}))
+	pool.stop()
+}
+
+func TestDepositPool_RateLimit(t *testing.T) {
+	pool := newDepositPool(100)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		assert.NoError(t, pool.submit(wg.Done))
+	}
+	wg.Wait()
+	pool.stop()
+
+	// 10 jobs at 100 per second take about 100ms
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+}
@@ -0,0 +1,186 @@
+package arbitrator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+)
+
+type depositResult int
+
+const (
+	depositSucceed depositResult = iota
+
+	// depositRetryable is the failure may disappear later, such as the side
+	// node is unreachable or has not synced the main chain transaction.
+	depositRetryable
+
+	// depositTerminal is the failure sending again does not help.
+	depositTerminal
+)
+
+// classifyDepositResponse classifies the response of side node to the deposit
+// transaction.
+func classifyDepositResponse(resp rpc.Response, err error) depositResult {
+	if err != nil {
+		return depositRetryable
+	}
+	if resp.Error == nil {
+		if resp.Result != nil {
+			return depositSucceed
+		}
+		return depositRetryable
+	}
+	switch resp.Code {
+	case SCErrMainchainTxDuplicate:
+		return depositSucceed
+	case SCErrInternalError, ErrInvalidMainchainTx:
+		return depositRetryable
+	default:
+		return depositTerminal
+	}
+}
+
+// depositRetryDelay returns the delay before the next retry of the deposit
+// transaction failed the given times, doubled on each attempt and up to
+// maxDelay.
+func depositRetryDelay(attempts uint32, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := uint32(1); i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func (ar *ArbitratorImpl) retryDepositTransaction(tx *SpvTransaction, genesisAddress string, resp rpc.Response, err error) {
+	hash := tx.MainChainTransaction.Hash().String()
+	logger := log.Deposit.With(log.Chain(genesisAddress), log.TxHash(hash))
+	attempts, e := ar.dataStore.MainChainStore.AddMainChainTxAttempt(hash, genesisAddress)
+	if e != nil {
+		logger.Warn("Send deposit transaction failed, add attempt failed", log.Err(e))
+		return
+	}
+	maxAttempts := ar.config.DepositRetryMaxAttempts
+	if maxAttempts > 0 && int(attempts) >= maxAttempts {
+		logger.Warn("Send deposit transaction failed, move to dead letters", log.F("attempts", attempts))
+		ar.deadLetterDepositTransaction(tx, genesisAddress, attempts, resp, err)
+		return
+	}
+
+	delay := depositRetryDelay(attempts,
+		time.Millisecond*ar.config.DepositRetryBaseDelay,
+		time.Millisecond*ar.config.DepositRetryMaxDelay)
+	e = ar.dataStore.MainChainStore.SetMainChainTxNextRetryTime(hash, genesisAddress, time.Now().Add(delay).Unix())
+	if e != nil {
+		logger.Warn("Send deposit transaction failed, set next retry time failed", log.Err(e))
+		return
+	}
+	logger.Warn("Send deposit transaction failed, retry later",
+		log.F("delay", delay), log.F("attempts", attempts))
+}
+
+func (ar *ArbitratorImpl) deadLetterDepositTransaction(tx *SpvTransaction, genesisAddress string, attempts uint32,
+	resp rpc.Response, err error) {
+	hash := tx.MainChainTransaction.Hash().String()
+	deadLetter := &store.DeadLetterDepositTx{
+		TransactionHash:     hash,
+		GenesisBlockAddress: genesisAddress,
+		Transaction:         tx.MainChainTransaction,
+		Proof:               tx.Proof,
+		Attempts:            attempts,
+	}
+	if err != nil {
+		deadLetter.ErrorMessage = err.Error()
+	} else if resp.Error != nil {
+		deadLetter.ErrorCode = resp.Code
+		deadLetter.ErrorMessage = resp.Message
+	}
+
+	if err := ar.finishedTxsStore.AddDeadLetterDepositTx(deadLetter); err != nil {
+		log.Deposit.Warn("Add dead letter deposit transaction to finished db failed",
+			log.Chain(genesisAddress), log.TxHash(hash), log.Err(err))
+		return
+	}
+	if err := ar.dataStore.MainChainStore.RemoveMainChainTx(hash, genesisAddress); err != nil {
+		log.Deposit.Warn("Remove dead letter deposit transaction from db failed",
+			log.Chain(genesisAddress), log.TxHash(hash), log.Err(err))
+	}
+}
+
+// RetryDepositTransactionsLoop sends the deposit transactions failed with
+// retryable errors again when their retry time comes.
+func (ar *ArbitratorImpl) RetryDepositTransactionsLoop(ctx context.Context) {
+	if ar.config.DepositRetryBaseDelay <= 0 {
+		log.Deposit.Info("[RetryDepositTransactionsLoop] deposit retry disabled")
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * ar.config.DepositRetryBaseDelay):
+		}
+		if !ar.IsOnDutyOfMain() {
+			continue
+		}
+
+		txs, err := ar.dataStore.MainChainStore.GetMainChainTxsToRetry(time.Now().Unix())
+		if err != nil {
+			log.Deposit.Warn("[RetryDepositTransactionsLoop] get deposit transactions to retry failed", log.Err(err))
+			continue
+		}
+		spvTxs := make(map[string][]*SpvTransaction)
+		for _, tx := range txs {
+			spvTxs[tx.GenesisBlockAddress] = append(spvTxs[tx.GenesisBlockAddress],
+				&SpvTransaction{MainChainTransaction: tx.Transaction, Proof: tx.Proof})
+		}
+		for genesisAddress, txs := range spvTxs {
+			log.Deposit.Info("[RetryDepositTransactionsLoop] retry deposit transactions",
+				log.Chain(genesisAddress), log.F("count", len(txs)))
+			ar.SendDepositTransactions(txs, genesisAddress)
+		}
+	}
+}
+
+// RedriveDepositTx moves the dead letter deposit transaction back into the
+// cached main chain transactions with attempts reset, it is sent at once if
+// the arbiter is on duty.
+func (ar *ArbitratorImpl) RedriveDepositTx(txHash string, genesisAddress string) error {
+	deadLetter, err := ar.finishedTxsStore.GetDeadLetterDepositTx(txHash, genesisAddress)
+	if err != nil {
+		return err
+	}
+
+	added, err := ar.dataStore.MainChainStore.AddMainChainTxs([]*MainChainTransaction{{
+		TransactionHash:     deadLetter.TransactionHash,
+		GenesisBlockAddress: deadLetter.GenesisBlockAddress,
+		Transaction:         deadLetter.Transaction,
+		Proof:               deadLetter.Proof,
+	}})
+	if err != nil {
+		return errors.New("add deposit transaction into db failed: " + err.Error())
+	}
+	if len(added) != 1 || !added[0] {
+		return errors.New("deposit transaction is already in db")
+	}
+	if err := ar.finishedTxsStore.RemoveDeadLetterDepositTx(txHash, genesisAddress); err != nil {
+		return errors.New("remove deposit transaction from dead letters failed: " + err.Error())
+	}
+	log.Deposit.Info("[RedriveDepositTx] deposit transaction re-driven", log.Chain(genesisAddress), log.TxHash(txHash))
+
+	if ar.IsOnDutyOfMain() {
+		go ar.SendDepositTransactions([]*SpvTransaction{{
+			MainChainTransaction: deadLetter.Transaction,
+			Proof:                deadLetter.Proof,
+		}}, genesisAddress)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package arbitrator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyDepositResponse(t *testing.T) {
+	assert.Equal(t, depositSucceed, classifyDepositResponse(rpc.Response{Result: "txid"}, nil))
+	assert.Equal(t, depositSucceed, classifyDepositResponse(
+		rpc.Response{Error: &rpc.Error{Code: SCErrMainchainTxDuplicate}}, nil))
+
+	assert.Equal(t, depositRetryable, classifyDepositResponse(rpc.Response{}, errors.New("connection refused")))
+	assert.Equal(t, depositRetryable, classifyDepositResponse(rpc.Response{}, nil))
+	assert.Equal(t, depositRetryable, classifyDepositResponse(
+		rpc.Response{Error: &rpc.Error{Code: ErrInvalidMainchainTx}}, nil))
+	assert.Equal(t, depositRetryable, classifyDepositResponse(
+		rpc.Response{Error: &rpc.Error{Code: SCErrInternalError}}, nil))
+
+	assert.Equal(t, depositTerminal, classifyDepositResponse(
+		rpc.Response{Error: &rpc.Error{Code: 43001, Message: "invalid transaction"}}, nil))
+}
+
+func TestDepositRetryDelay(t *testing.T) {
+	base := 10 * time.Second
+	max := time.Minute
+	assert.Equal(t, 10*time.Second, depositRetryDelay(1, base, max))
+	assert.Equal(t, 20*time.Second, depositRetryDelay(2, base, max))
+	assert.Equal(t, 40*time.Second, depositRetryDelay(3, base, max))
+	assert.Equal(t, time.Minute, depositRetryDelay(4, base, max))
+	assert.Equal(t, time.Minute, depositRetryDelay(1000, base, max))
+}
@@ -5,7 +5,6 @@ import (
 	"math"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 	"github.com/elastos/Elastos.ELA.Arbiter/store"
 
@@ -18,6 +17,8 @@ import (
 type MainChain interface {
 	CreateWithdrawTransaction(sideChain SideChain, withdrawTxs []*base.WithdrawTx,
 		mcFunc MainChainFunc) (*types.Transaction, error)
+	CreateConsolidateTransaction(sideChain SideChain,
+		mcFunc MainChainFunc) (*types.Transaction, error)
 
 	BroadcastWithdrawProposal(txn *types.Transaction) error
 	BroadcastSidechainIllegalData(data *payload.SidechainIllegalData) error
@@ -35,11 +36,13 @@ type MainChainClient interface {
 type MainChainFunc interface {
 	GetWithdrawUTXOsByAmount(withdrawBank string,
 		fixed64 common.Fixed64) ([]*store.AddressUTXO, error)
+	GetWithdrawUTXOs(withdrawBank string) ([]*store.AddressUTXO, error)
 	GetMainNodeCurrentHeight() (uint32, error)
 	GetAmountByInputs(inputs []*types.Input) (common.Fixed64, error)
 }
 
 type MainChainFuncImpl struct {
+	ParentArbitrator Arbitrator
 }
 
 func (dbFunc *MainChainFuncImpl) GetWithdrawUTXOsByAmount(
@@ -49,7 +52,7 @@ func (dbFunc *MainChainFuncImpl) GetWithdrawUTXOsByAmount(
 		return nil, errors.New("get spender's UTXOs failed, err:" + err.Error())
 	}
 	var availableUTXOs []*store.AddressUTXO
-	var currentHeight = store.DbCache.MainChainStore.CurrentHeight(
+	var currentHeight = dbFunc.ParentArbitrator.GetDataStore().MainChainStore.CurrentHeight(
 		store.QueryHeightCode)
 	for _, utxo := range utxos {
 		if utxo.Input.Sequence > 0 {
@@ -68,11 +71,39 @@ func (dbFunc *MainChainFuncImpl) GetWithdrawUTXOsByAmount(
 func (dbFunc *MainChainFuncImpl) GetWithdrawAddressUTXOsByAmount(
 	genesisBlockAddress string, amount common.Fixed64) ([]*store.AddressUTXO, error) {
 	utxoInfos, err := rpc.GetWithdrawUTXOsByAmount(genesisBlockAddress, amount,
-		config.Parameters.MainNode.Rpc)
+		dbFunc.ParentArbitrator.GetConfig().MainNode.Rpc)
 	if err != nil {
 		return nil, err
 	}
 
+	return toAddressUTXOs(genesisBlockAddress, utxoInfos)
+}
+
+// GetWithdrawUTXOs returns all spendable UTXOs of the withdraw bank, the
+// ones locked above the current main chain height are excluded.
+func (dbFunc *MainChainFuncImpl) GetWithdrawUTXOs(
+	withdrawBank string) ([]*store.AddressUTXO, error) {
+	utxoInfos, err := rpc.GetUnspentUtxo([]string{withdrawBank},
+		dbFunc.ParentArbitrator.GetConfig().MainNode.Rpc)
+	if err != nil {
+		return nil, errors.New("get spender's UTXOs failed, err:" + err.Error())
+	}
+
+	var currentHeight = dbFunc.ParentArbitrator.GetDataStore().MainChainStore.CurrentHeight(
+		store.QueryHeightCode)
+	var unlocked []base.UTXOInfo
+	for _, utxoInfo := range utxoInfos {
+		if utxoInfo.OutputLock > currentHeight {
+			continue
+		}
+		unlocked = append(unlocked, utxoInfo)
+	}
+
+	return toAddressUTXOs(withdrawBank, unlocked)
+}
+
+func toAddressUTXOs(genesisBlockAddress string,
+	utxoInfos []base.UTXOInfo) ([]*store.AddressUTXO, error) {
 	var inputs []*store.AddressUTXO
 	for _, utxoInfo := range utxoInfos {
 
@@ -108,7 +139,7 @@ func (dbFunc *MainChainFuncImpl) GetWithdrawAddressUTXOsByAmount(
 }
 
 func (dbFunc *MainChainFuncImpl) GetMainNodeCurrentHeight() (uint32, error) {
-	chainHeight, err := rpc.GetCurrentHeight(config.Parameters.MainNode.Rpc)
+	chainHeight, err := rpc.GetCurrentHeight(dbFunc.ParentArbitrator.GetConfig().MainNode.Rpc)
 	if err != nil {
 		return 0, err
 	}
@@ -117,7 +148,7 @@ func (dbFunc *MainChainFuncImpl) GetMainNodeCurrentHeight() (uint32, error) {
 
 func (dbFunc *MainChainFuncImpl) GetAmountByInputs(
 	inputs []*types.Input) (common.Fixed64, error) {
-	amount, err := rpc.GetAmountByInputs(inputs, config.Parameters.MainNode.Rpc)
+	amount, err := rpc.GetAmountByInputs(inputs, dbFunc.ParentArbitrator.GetConfig().MainNode.Rpc)
 	if err != nil {
 		return 0, err
 	}
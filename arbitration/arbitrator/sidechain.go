@@ -2,17 +2,39 @@ package arbitrator
 
 import (
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/core/types"
 )
 
+// WithdrawProposals are the withdraw transactions created of side chain
+// withdraw transactions by a side chain.
+type WithdrawProposals struct {
+	Transactions []*types.Transaction
+	// UTXOs are the UTXOs of withdraw bank spent by the transactions.
+	UTXOs map[types.OutPoint]*store.AddressUTXO
+	// Held are the hashes of side chain withdraw transactions waiting for
+	// approval of operator.
+	Held []string
+	// Unpacked are the hashes of side chain withdraw transactions not packed
+	// into the transactions, such as the UTXOs can not cover them.
+	Unpacked []string
+}
+
 type SideChain interface {
 	base.AccountListener
 	SideChainNode
 
 	GetKey() string
-	GetExchangeRate() (float64, error)
+	GetExchangeRate() (*base.ExchangeRate, error)
 
 	GetExistDepositTransactions(txs []string) ([]string, error)
 	GetWithdrawTransaction(txHash string) (*base.WithdrawTxInfo, error)
+	CreateAndBroadcastWithdrawProposal(txnHashes []string) error
+	DryRunWithdrawProposal(txnHashes []string) (*WithdrawProposals, error)
+	ConsolidateUTXOs()
+	CheckHeldWithdrawTxs(txs []*base.WithdrawTx) error
+	GetHeldWithdrawTxs(txs []*base.WithdrawTx) ([]string, error)
 	CheckIllegalEvidence(evidence *base.SidechainIllegalDataInfo) (bool, error)
 }
 
@@ -0,0 +1,242 @@
+package arbitrator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	. "github.com/elastos/Elastos.ELA.SPV/interface"
+	spvstore "github.com/elastos/Elastos.ELA.SPV/interface/store"
+	"github.com/elastos/Elastos.ELA.SPV/util"
+	"github.com/syndtr/goleveldb/leveldb"
+	dbutil "github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// mainChainRescanInterval is the interval the progress of a main chain
+// rescan is updated at.
+const mainChainRescanInterval = time.Second
+
+// RescanMainChain makes spv sync the main chain again from the given height.
+// The spv module is stopped, its headers and transactions from the height
+// are removed the same as a rollback of the main chain, and it is started to
+// sync them from the main nodes again, so the transactions missed before are
+// notified to the listeners.
+func (ar *ArbitratorImpl) RescanMainChain(height uint32) error {
+	spvService := ar.GetSpvService()
+	if spvService == nil {
+		return errors.New("spv service not started")
+	}
+	if height == 0 {
+		return errors.New("rescan height should be higher than 0")
+	}
+
+	ar.mainChainRescanMux.Lock()
+	defer ar.mainChainRescanMux.Unlock()
+	if ar.mainChainRescanProgress != nil && !ar.mainChainRescanProgress.Finished {
+		return errors.New("main chain rescan is running")
+	}
+
+	best, err := spvService.HeaderStore().GetBest()
+	if err != nil {
+		return errors.New("get spv best header failed: " + err.Error())
+	}
+	if height > best.Height {
+		return errors.New("rescan height is higher than spv best height")
+	}
+
+	ar.mainChainRescanProgress = &RescanProgress{
+		StartHeight:   height,
+		CurrentHeight: height - 1,
+		TargetHeight:  best.Height,
+	}
+	log.SPV.Info("[RescanMainChain] rescan main chain", log.Height(height), log.F("best", best.Height))
+	go ar.rescanMainChain(height, best.Height)
+	return nil
+}
+
+// GetMainChainRescanProgress returns the progress of the last main chain
+// rescan.
+func (ar *ArbitratorImpl) GetMainChainRescanProgress() (*RescanProgress, bool) {
+	ar.mainChainRescanMux.Lock()
+	defer ar.mainChainRescanMux.Unlock()
+
+	if ar.mainChainRescanProgress == nil {
+		return nil, false
+	}
+	p := *ar.mainChainRescanProgress
+	return &p, true
+}
+
+func (ar *ArbitratorImpl) rescanMainChain(from, to uint32) {
+	spvService, err := ar.restartSpvModule(from)
+	if err == nil {
+		err = ar.waitSpvSynced(spvService, to)
+	}
+
+	ar.mainChainRescanMux.Lock()
+	defer ar.mainChainRescanMux.Unlock()
+	if err != nil {
+		log.SPV.Error("[RescanMainChain] rescan failed", log.Height(from), log.Err(err))
+		ar.mainChainRescanProgress.Error = err.Error()
+	}
+	ar.mainChainRescanProgress.Finished = true
+	log.SPV.Info("[RescanMainChain] rescan finished", log.Height(ar.mainChainRescanProgress.CurrentHeight))
+}
+
+// restartSpvModule stops the spv module, removes the spv data from the height
+// and starts it again, it returns the spv service started.
+func (ar *ArbitratorImpl) restartSpvModule(height uint32) (SPVService, error) {
+	ar.spvMux.Lock()
+	defer ar.spvMux.Unlock()
+	if ar.spvService == nil {
+		return nil, errors.New("spv service stopped")
+	}
+
+	ar.stopSpvModule()
+	rewindErr := rewindSpvData(filepath.Join(ar.dataDir, config.SpvDir), height)
+	if err := ar.startSpvModule(ar.newSpvService); err != nil {
+		return nil, err
+	}
+	return ar.spvService, rewindErr
+}
+
+// waitSpvSynced updates the progress of the rescan by the best height of spv
+// until it reaches the target height.
+func (ar *ArbitratorImpl) waitSpvSynced(spvService SPVService, target uint32) error {
+	ticker := time.NewTicker(mainChainRescanInterval)
+	defer ticker.Stop()
+	for {
+		if ar.GetSpvService() != spvService {
+			return errors.New("spv service stopped")
+		}
+		best, err := spvService.HeaderStore().GetBest()
+		if err == nil {
+			current := best.Height
+			if current > target {
+				current = target
+			}
+			ar.mainChainRescanMux.Lock()
+			if current > ar.mainChainRescanProgress.CurrentHeight {
+				ar.mainChainRescanProgress.CurrentHeight = current
+			}
+			ar.mainChainRescanMux.Unlock()
+			if current == target {
+				return nil
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// rewindSpvData removes the headers and transactions of the heights from the
+// given one in the spv data of dataDir, and sets the chain tip to the header
+// of the height before, the same as spv does on a rollback of the main
+// chain. The spv module should be stopped. Headers are removed first, so the
+// transactions left by a failure are synced again by spv.
+func rewindSpvData(dataDir string, height uint32) error {
+	headerDir := filepath.Join(dataDir, "header")
+	if _, err := os.Stat(headerDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	db, err := leveldb.OpenFile(headerDir, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	prevHash, err := db.Get(spvHeightKey(height-1), nil)
+	if err != nil {
+		return errors.New("get spv header failed: " + err.Error())
+	}
+	prevHeader, err := db.Get(spvKey(spvstore.BKTHeaders, prevHash...), nil)
+	if err != nil {
+		return errors.New("get spv header failed: " + err.Error())
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(spvstore.BKTChainTip, prevHeader)
+	last := height - 1
+	for h := height; ; h++ {
+		hash, err := db.Get(spvHeightKey(h), nil)
+		if err == leveldb.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch.Delete(spvHeightKey(h))
+		batch.Delete(spvKey(spvstore.BKTHeaders, hash...))
+		last = h
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return err
+	}
+	log.SPV.Info("[RescanMainChain] spv headers removed", log.Height(height), log.F("best", last))
+
+	dataStore, err := spvstore.NewDataStore(dataDir, nil, 0)
+	if err != nil {
+		return err
+	}
+	dataBatch := dataStore.Batch()
+	for h := height; h <= last; h++ {
+		if err := dataBatch.DelAll(h); err != nil {
+			dataBatch.Rollback()
+			dataStore.Close()
+			return err
+		}
+	}
+	err = dataBatch.Commit()
+	dataStore.Close()
+	if err != nil {
+		return err
+	}
+	return removeSpvTxs(dataDir, height)
+}
+
+// removeSpvTxs removes the transactions of the heights from the given one in
+// the spv data of dataDir. Transactions spv stores in batches are not indexed
+// by their heights, so they are not removed by DelAll and found by a scan.
+func removeSpvTxs(dataDir string, height uint32) error {
+	db, err := leveldb.OpenFile(filepath.Join(dataDir, "store"), nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	batch := new(leveldb.Batch)
+	it := db.NewIterator(dbutil.BytesPrefix(spvstore.BKTTxs), nil)
+	for it.Next() {
+		var tx util.Tx
+		if err := tx.Deserialize(bytes.NewReader(it.Value())); err != nil {
+			continue
+		}
+		if tx.Height >= height {
+			batch.Delete(spvKey(it.Key()))
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return db.Write(batch, nil)
+}
+
+// spvKey returns the key of the spv store in the bucket.
+func spvKey(bucket []byte, key ...byte) []byte {
+	return append(append([]byte{}, bucket...), key...)
+}
+
+// spvHeightKey returns the key of the spv header index of the height.
+func spvHeightKey(height uint32) []byte {
+	var key [4]byte
+	binary.LittleEndian.PutUint32(key[:], height)
+	return spvKey(spvstore.BKTIndexes, key[:]...)
+}
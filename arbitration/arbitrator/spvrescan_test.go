@@ -0,0 +1,101 @@
+package arbitrator
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/interface/iutil"
+	spvstore "github.com/elastos/Elastos.ELA.SPV/interface/store"
+	"github.com/elastos/Elastos.ELA.SPV/util"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSpvHeader() util.BlockHeader {
+	return iutil.NewHeader(&types.Header{})
+}
+
+// newSpvData stores the headers to the best height and a transaction in
+// every block into the spv data of dataDir, and returns the hashes of the
+// transactions.
+func newSpvData(t *testing.T, dataDir string, best uint32) []common.Uint256 {
+	headers, err := spvstore.NewHeaderStore(dataDir, newSpvHeader)
+	assert.NoError(t, err)
+	dataStore, err := spvstore.NewDataStore(dataDir, nil, 0)
+	assert.NoError(t, err)
+
+	var previous common.Uint256
+	var txHashes []common.Uint256
+	batch := dataStore.Batch()
+	for height := uint32(0); height <= best; height++ {
+		header := &util.Header{
+			BlockHeader: iutil.NewHeader(&types.Header{Previous: previous, Height: height}),
+			Height:      height,
+			TotalWork:   big.NewInt(int64(height)),
+		}
+		assert.NoError(t, headers.Put(header, true))
+		previous = header.Hash()
+
+		tx := &types.Transaction{
+			TxType:  types.TransferAsset,
+			Payload: &payload.TransferAsset{},
+			Attributes: []*types.Attribute{{
+				Usage: types.Nonce,
+				Data:  []byte(strconv.Itoa(int(height))),
+			}},
+		}
+		assert.NoError(t, batch.Txs().Put(util.NewTx(iutil.NewTx(tx), height)))
+		txHashes = append(txHashes, tx.Hash())
+	}
+	assert.NoError(t, batch.Commit())
+	headers.Close()
+	dataStore.Close()
+	return txHashes
+}
+
+func TestRewindSpvData(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "spvrescan")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+	txHashes := newSpvData(t, dataDir, 10)
+
+	assert.NoError(t, rewindSpvData(dataDir, 6))
+
+	headers, err := spvstore.NewHeaderStore(dataDir, newSpvHeader)
+	assert.NoError(t, err)
+	defer headers.Close()
+	dataStore, err := spvstore.NewDataStore(dataDir, nil, 0)
+	assert.NoError(t, err)
+	defer dataStore.Close()
+
+	// the chain tip is the header before the height, the headers and the
+	// transactions from the height are removed so spv syncs them again.
+	best, err := headers.GetBest()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(5), best.Height)
+	for height := uint32(0); height <= 10; height++ {
+		_, err := headers.GetByHeight(height)
+		_, txErr := dataStore.Txs().Get(&txHashes[height])
+		if height < 6 {
+			assert.NoError(t, err)
+			assert.NoError(t, txErr)
+		} else {
+			assert.Error(t, err)
+			assert.Error(t, txErr)
+		}
+	}
+}
+
+func TestRewindSpvData_NotSynced(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "spvrescan")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	// nothing to remove if spv has not synced
+	assert.NoError(t, rewindSpvData(dataDir, 6))
+}
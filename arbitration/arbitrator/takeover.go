@@ -0,0 +1,195 @@
+package arbitrator
+
+import (
+	"context"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/crypto"
+)
+
+// takeoverDistance returns how many arbiters the arbiter is after the on duty
+// arbiter in duty order, 0 if it is on duty and -1 if it is not an arbiter.
+func takeoverDistance(arbiters []string, onDutyIndex int, publicKey *crypto.PublicKey) int {
+	for i, arbiter := range arbiters {
+		pk, err := PublicKeyFromString(arbiter)
+		if err != nil || !crypto.Equal(pk, publicKey) {
+			continue
+		}
+		return (i - onDutyIndex + len(arbiters)) % len(arbiters)
+	}
+	return -1
+}
+
+// takeoverBlocks returns how many main chain blocks a cross chain transaction
+// has to be pending before the arbiter of the distance processes it, 0 if
+// the arbiter never takes over.
+func takeoverBlocks(distance int, pendingBlocks uint32) uint32 {
+	if distance <= 0 {
+		return 0
+	}
+	return pendingBlocks * uint32(distance)
+}
+
+// IsWithdrawTakeoverAllowed returns if the arbiter may propose the withdraw
+// of the side chain transactions in place of the on duty arbiter, that is all
+// of them are packed in side chain blocks deep enough. The depth is counted
+// from the side chain blocks the transactions are packed in, which every
+// signer shares, so the arbiters agree on it whenever they see them.
+func (ar *ArbitratorImpl) IsWithdrawTakeoverAllowed(arbiters []string, onDutyIndex int,
+	publicKey *crypto.PublicKey, genesisAddress string, txHashes []string) bool {
+	blocks := takeoverBlocks(takeoverDistance(arbiters, onDutyIndex, publicKey),
+		ar.config.TakeoverPendingBlocks)
+	if blocks == 0 || len(txHashes) == 0 {
+		return false
+	}
+	sc, ok := ar.sideChainManagerImpl.GetChain(genesisAddress)
+	if !ok {
+		return false
+	}
+	height, err := sc.GetCurrentHeight()
+	if err != nil {
+		log.Withdraw.Warn("[IsWithdrawTakeoverAllowed] get side chain height failed",
+			log.Chain(genesisAddress), log.Err(err))
+		return false
+	}
+
+	txHeights, err := ar.dataStore.SideChainStore.GetSideChainTxHeights(txHashes, genesisAddress)
+	if err != nil {
+		log.Withdraw.Warn("[IsWithdrawTakeoverAllowed] get side chain transaction heights failed",
+			log.Chain(genesisAddress), log.Err(err))
+		return false
+	}
+	for _, hash := range txHashes {
+		txHeight, ok := txHeights[hash]
+		if !ok || height < txHeight+blocks {
+			return false
+		}
+	}
+	return true
+}
+
+// TakeoverWatchdogLoop processes the cross chain transactions pending too
+// long in place of the on duty arbiter on every main chain block, see
+// TakeoverPendingTxs.
+func (ar *ArbitratorImpl) TakeoverWatchdogLoop(ctx context.Context) {
+	if ar.config.TakeoverPendingBlocks == 0 {
+		log.Withdraw.Info("[TakeoverWatchdogLoop] takeover disabled")
+		return
+	}
+	var lastHeight uint32
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * ar.config.SyncInterval):
+		}
+		height := ar.group.GetCurrentHeight()
+		if height == lastHeight {
+			continue
+		}
+		lastHeight = height
+		ar.TakeoverPendingTxs()
+	}
+}
+
+// TakeoverPendingTxs processes the cross chain transactions pending too long
+// in place of the on duty arbiter. The arbiter next to the on duty one takes
+// over after TakeoverPendingBlocks blocks, the one after it after twice the
+// blocks, and so on. Deposit transactions are pending since the main chain
+// blocks they are packed in, and withdraw transactions since the side chain
+// blocks they are packed in. Transactions processed twice are rejected by the
+// chains as duplicated and treated as succeed.
+func (ar *ArbitratorImpl) TakeoverPendingTxs() {
+	group := ar.group
+	group.mux.Lock()
+	arbiters := group.arbitrators
+	onDutyIndex := group.onDutyArbitratorIndex
+	group.mux.Unlock()
+
+	blocks := takeoverBlocks(takeoverDistance(arbiters, onDutyIndex, ar.GetPublicKey()),
+		ar.config.TakeoverPendingBlocks)
+	if blocks == 0 || ar.IsOnDutyOfMain() {
+		return
+	}
+	ar.takeoverDeposits(group.GetCurrentHeight(), blocks)
+	ar.takeoverWithdraws(ar.getOverdueWithdraws(blocks))
+}
+
+// getOverdueWithdraws returns the cached withdraw transactions of each side
+// chain packed in side chain blocks blocks or more deep.
+func (ar *ArbitratorImpl) getOverdueWithdraws(blocks uint32) map[string][]string {
+	overdue := make(map[string][]string)
+	for _, sc := range ar.sideChainManagerImpl.GetAllChains() {
+		txHashes, txHeights, err := ar.dataStore.SideChainStore.GetAllSideChainTxHashesAndHeights(sc.GetKey())
+		if err != nil {
+			log.Withdraw.Warn("[TakeoverWatchdogLoop] get cached withdraw transactions failed",
+				log.Chain(sc.GetKey()), log.Err(err))
+			continue
+		}
+		if len(txHashes) == 0 {
+			continue
+		}
+		height, err := sc.GetCurrentHeight()
+		if err != nil {
+			log.Withdraw.Warn("[TakeoverWatchdogLoop] get side chain height failed",
+				log.Chain(sc.GetKey()), log.Err(err))
+			continue
+		}
+		for i, hash := range txHashes {
+			if height >= txHeights[i]+blocks {
+				overdue[sc.GetKey()] = append(overdue[sc.GetKey()], hash)
+			}
+		}
+	}
+	return overdue
+}
+
+func (ar *ArbitratorImpl) takeoverDeposits(height uint32, blocks uint32) {
+	txs, err := ar.dataStore.MainChainStore.GetMainChainTxsToSend(time.Now().Unix())
+	if err != nil {
+		log.Deposit.Warn("[TakeoverWatchdogLoop] get cached deposit transactions failed", log.Err(err))
+		return
+	}
+	overdue := make(map[string][]*SpvTransaction)
+	for _, tx := range txs {
+		if tx.Proof == nil || height < tx.Proof.Height+blocks {
+			continue
+		}
+		overdue[tx.GenesisBlockAddress] = append(overdue[tx.GenesisBlockAddress],
+			&SpvTransaction{MainChainTransaction: tx.Transaction, Proof: tx.Proof})
+	}
+	for genesisAddress, spvTxs := range overdue {
+		log.Deposit.Warn("[TakeoverWatchdogLoop] take over deposit transactions",
+			log.Chain(genesisAddress), log.F("count", len(spvTxs)))
+		ar.SendDepositTransactions(spvTxs, genesisAddress)
+	}
+}
+
+func (ar *ArbitratorImpl) takeoverWithdraws(overdue map[string][]string) {
+	for genesisAddress, txHashes := range overdue {
+		sc, ok := ar.sideChainManagerImpl.GetChain(genesisAddress)
+		if !ok {
+			continue
+		}
+		exist, err := rpc.GetExistWithdrawTransactions(txHashes, ar.config.MainNode.Rpc)
+		if err != nil {
+			log.Withdraw.Warn("[TakeoverWatchdogLoop] get exist withdraw transactions failed",
+				log.Chain(genesisAddress), log.Err(err))
+			continue
+		}
+		txHashes = SubstractTransactionHashes(txHashes, exist)
+		if len(txHashes) == 0 {
+			continue
+		}
+		log.Withdraw.Warn("[TakeoverWatchdogLoop] take over withdraw transactions",
+			log.Chain(genesisAddress), log.F("count", len(txHashes)))
+		if err := sc.CreateAndBroadcastWithdrawProposal(txHashes); err != nil {
+			log.Withdraw.Warn("[TakeoverWatchdogLoop] propose withdraw transactions failed",
+				log.Chain(genesisAddress), log.Err(err))
+		}
+	}
+}
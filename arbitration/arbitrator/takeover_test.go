@@ -0,0 +1,31 @@
+package arbitrator
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeoverDistance(t *testing.T) {
+	var arbiters []string
+	var publicKeys []*crypto.PublicKey
+	for i := 0; i < 4; i++ {
+		_, pk, err := crypto.GenerateKeyPair()
+		assert.NoError(t, err)
+		pkBytes, err := pk.EncodePoint(true)
+		assert.NoError(t, err)
+		arbiters = append(arbiters, common.BytesToHexString(pkBytes))
+		publicKeys = append(publicKeys, pk)
+	}
+
+	assert.Equal(t, 0, takeoverDistance(arbiters, 2, publicKeys[2]))
+	assert.Equal(t, 1, takeoverDistance(arbiters, 2, publicKeys[3]))
+	assert.Equal(t, 2, takeoverDistance(arbiters, 2, publicKeys[0]))
+	assert.Equal(t, 3, takeoverDistance(arbiters, 2, publicKeys[1]))
+
+	_, other, err := crypto.GenerateKeyPair()
+	assert.NoError(t, err)
+	assert.Equal(t, -1, takeoverDistance(arbiters, 2, other))
+}
@@ -0,0 +1,68 @@
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// ExchangeRate is the exact rate of side chain amount to main chain amount.
+// It is configured as a decimal number such as 1.1, or a string of a decimal
+// or a fraction such as "1/3", so no precision is lost by float numbers.
+type ExchangeRate struct {
+	rat big.Rat
+}
+
+// NewExchangeRate parses a decimal or fraction string to a positive exchange
+// rate.
+func NewExchangeRate(s string) (*ExchangeRate, error) {
+	r := new(ExchangeRate)
+	if _, ok := r.rat.SetString(strings.TrimSpace(s)); !ok {
+		return nil, errors.New("invalid exchange rate " + s)
+	}
+	if r.rat.Sign() <= 0 {
+		return nil, errors.New("exchange rate must be positive")
+	}
+	return r, nil
+}
+
+// ToMainChainAmount converts the side chain amount to main chain amount.
+// Arbiters building and checking withdraw transactions must all use this
+// function, the result is rounded toward zero.
+func (r *ExchangeRate) ToMainChainAmount(amount common.Fixed64) (common.Fixed64, error) {
+	value := new(big.Int).Mul(big.NewInt(int64(amount)), r.rat.Denom())
+	value.Quo(value, r.rat.Num())
+	if !value.IsInt64() {
+		return 0, errors.New("main chain amount overflow")
+	}
+	return common.Fixed64(value.Int64()), nil
+}
+
+func (r *ExchangeRate) String() string {
+	if r.rat.IsInt() {
+		return r.rat.Num().String()
+	}
+	return r.rat.RatString()
+}
+
+func (r *ExchangeRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if strings.HasPrefix(s, "\"") {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	rate, err := NewExchangeRate(s)
+	if err != nil {
+		return err
+	}
+	r.rat.Set(&rate.rat)
+	return nil
+}
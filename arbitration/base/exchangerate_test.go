@@ -0,0 +1,78 @@
+package base
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewExchangeRate(t *testing.T) {
+	for _, s := range []string{"1", "1.0", "0.5", "1.1", "1/3", " 2 "} {
+		_, err := NewExchangeRate(s)
+		assert.NoError(t, err, s)
+	}
+	for _, s := range []string{"", "0", "-1", "0/1", "abc", "1/0"} {
+		_, err := NewExchangeRate(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestExchangeRate_ToMainChainAmount(t *testing.T) {
+	cases := []struct {
+		rate   string
+		amount common.Fixed64
+		result common.Fixed64
+	}{
+		{"1", 0, 0},
+		{"1", 1, 1},
+		{"1", math.MaxInt64, math.MaxInt64},
+		{"2", 1, 0},
+		{"2", 3, 1},
+		{"0.5", 1, 2},
+		{"1/3", 1, 3},
+		{"3", 8, 2},
+		{"3", 9, 3},
+		// float64 gives 33 / 1.1 = 29.999999999999996
+		{"1.1", 33, 30},
+		{"1.1", 32, 29},
+		{"1000", 999, 0},
+		{"1000", 1000, 1},
+		{"1.5", math.MaxInt64, 6148914691236517204},
+	}
+	for _, c := range cases {
+		rate, err := NewExchangeRate(c.rate)
+		assert.NoError(t, err)
+		result, err := rate.ToMainChainAmount(c.amount)
+		assert.NoError(t, err)
+		assert.Equal(t, c.result, result, "rate %s amount %d", c.rate, c.amount)
+	}
+
+	rate, _ := NewExchangeRate("0.5")
+	_, err := rate.ToMainChainAmount(math.MaxInt64)
+	assert.Error(t, err)
+	result, err := rate.ToMainChainAmount(math.MaxInt64 / 2)
+	assert.NoError(t, err)
+	assert.Equal(t, common.Fixed64(math.MaxInt64-1), result)
+}
+
+func TestExchangeRate_JSON(t *testing.T) {
+	var config struct {
+		ExchangeRate *ExchangeRate
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"ExchangeRate": 1.1}`), &config))
+	assert.Equal(t, "11/10", config.ExchangeRate.String())
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"ExchangeRate": "1/3"}`), &config))
+	assert.Equal(t, "1/3", config.ExchangeRate.String())
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"ExchangeRate": 1.0}`), &config))
+	data, err := json.Marshal(&config)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"ExchangeRate":"1"}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"ExchangeRate": 0}`), &config))
+	assert.Error(t, json.Unmarshal([]byte(`{"ExchangeRate": -1.5}`), &config))
+}
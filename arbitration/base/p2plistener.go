@@ -5,5 +5,7 @@ import (
 )
 
 type MainchainMsgListener interface {
-	OnReceivedSignMsg(id peer2.PID, content []byte)
+	// OnReceivedSignMsg handles the message, a cs.MisbehaviorError returned
+	// penalizes the peer sending it.
+	OnReceivedSignMsg(id peer2.PID, content []byte) error
 }
@@ -0,0 +1,10 @@
+package base
+
+// RescanProgress is the state of a rescan requested through the admin rpc.
+type RescanProgress struct {
+	StartHeight   uint32 `json:"startheight"`
+	CurrentHeight uint32 `json:"currentheight"`
+	TargetHeight  uint32 `json:"targetheight"`
+	Finished      bool   `json:"finished"`
+	Error         string `json:"error,omitempty"`
+}
@@ -125,3 +125,33 @@ func GetGenesisAddress(genesisHash common.Uint256) (string, error) {
 func genesisProgramHash(genesisHash common.Uint256) (*common.Uint168, error) {
 	return common.ToProgramHash(byte(contract.PrefixCrossChain), contract.CreateCrossChainRedeemScript(genesisHash)), nil
 }
+
+// GetDepositAmount returns the amount of the outputs of the deposit
+// transaction locked into the genesis address.
+func GetDepositAmount(tx *types.Transaction, genesisAddress string) (common.Fixed64, error) {
+	programHash, err := common.Uint168FromAddress(genesisAddress)
+	if err != nil {
+		return 0, err
+	}
+	var amount common.Fixed64
+	for _, output := range tx.Outputs {
+		if output.ProgramHash.IsEqual(*programHash) {
+			amount += output.Value
+		}
+	}
+	return amount, nil
+}
+
+// GetWithdrawAmount returns the amount of ELA released for the side chain
+// withdraw transaction.
+func GetWithdrawAmount(tx *WithdrawTx, rate *ExchangeRate) (common.Fixed64, error) {
+	var amount common.Fixed64
+	for _, asset := range tx.WithdrawInfo.WithdrawAssets {
+		a, err := rate.ToMainChainAmount(*asset.Amount)
+		if err != nil {
+			return 0, err
+		}
+		amount += a
+	}
+	return amount, nil
+}
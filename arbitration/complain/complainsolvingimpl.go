@@ -3,9 +3,7 @@ package complain
 import (
 	"bytes"
 
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
-	"github.com/elastos/Elastos.ELA.Arbiter/store"
 
 	"github.com/elastos/Elastos.ELA/common"
 	"github.com/elastos/Elastos.ELA/core/types"
@@ -18,10 +16,6 @@ const (
 	Done
 )
 
-var (
-	ComplainSolver base.ComplainSolving
-)
-
 type ComplainSolvingImpl struct {
 	*cs.DistributedNodeServer
 }
@@ -53,7 +47,7 @@ func (comp *ComplainSolvingImpl) BroadcastComplainSolving([]byte) error {
 }
 
 func (comp *ComplainSolvingImpl) GetComplainStatus(transactionHash common.Uint256) uint {
-	txs, err := store.DbCache.SideChainStore.GetSideChainTxsFromHashes([]string{transactionHash.String()})
+	txs, err := comp.Arbitrator.GetDataStore().SideChainStore.GetSideChainTxsFromHashes([]string{transactionHash.String()})
 	if err == nil && len(txs) != 0 {
 		return Solving
 	}
@@ -63,7 +57,7 @@ func (comp *ComplainSolvingImpl) GetComplainStatus(transactionHash common.Uint25
 		return Solving
 	}*/
 
-	succeedList, _, err := store.FinishedTxsDbCache.GetDepositTxByHash(transactionHash.String())
+	succeedList, _, err := comp.Arbitrator.GetFinishedTxsStore().GetDepositTxByHash(transactionHash.String())
 	if err == nil && len(succeedList) != 0 {
 		for _, succeed := range succeedList {
 			if succeed {
@@ -73,7 +67,7 @@ func (comp *ComplainSolvingImpl) GetComplainStatus(transactionHash common.Uint25
 		return Rejected
 	}
 
-	succeed, _, err := store.FinishedTxsDbCache.GetWithdrawTxByHash(transactionHash.String())
+	succeed, _, err := comp.Arbitrator.GetFinishedTxsStore().GetWithdrawTxByHash(transactionHash.String())
 	if err == nil {
 		if succeed {
 			return Done
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"strconv"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 
 	"github.com/elastos/Elastos.ELA/common"
 	"github.com/elastos/Elastos.ELA/core/contract"
 	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
 	"github.com/elastos/Elastos.ELA/crypto"
 )
 
@@ -39,10 +43,12 @@ type DistrubutedItemFunc interface {
 }
 
 type DistrubutedItemFuncImpl struct {
+	// Config is the configuration the main node is queried by.
+	Config *config.Configuration
 }
 
 func (item *DistributedItem) InitScript(arbitrator arbitrator.Arbitrator) error {
-	err := item.createMultiSignRedeemScript()
+	err := item.createMultiSignRedeemScript(arbitrator)
 	if err != nil {
 		return err
 	}
@@ -94,7 +100,7 @@ func (item *DistributedItem) Sign(arbitrator arbitrator.Arbitrator, isFeedback b
 		return err
 	}
 	// Append signature
-	err = item.appendSignature(signerIndex, newSign, isFeedback, itemFunc)
+	err = item.appendSignature(arbitrator, signerIndex, newSign, isFeedback, itemFunc)
 	if err != nil {
 		return err
 	}
@@ -102,6 +108,36 @@ func (item *DistributedItem) Sign(arbitrator arbitrator.Arbitrator, isFeedback b
 	return nil
 }
 
+// audit records the signature of the item to the audit log, signed under
+// the policy decision. The item should not be sent if it fails.
+func (item *DistributedItem) audit(auditLog *audit.Log, decision string) error {
+	buf := new(bytes.Buffer)
+	if err := item.ItemContent.SerializeUnsigned(buf); err != nil {
+		return err
+	}
+
+	typ, summary := "", make(map[string]string)
+	switch content := item.ItemContent.(type) {
+	case *TxDistributedContent:
+		typ, summary = audit.TypeWithdrawProposal, audit.TxSummary(content.Tx)
+		if withdraw, ok := content.Tx.Payload.(*payload.WithdrawFromSideChain); ok {
+			summary["chain"] = withdraw.GenesisBlockAddress
+			summary["sidetxs"] = strconv.Itoa(len(withdraw.SideChainTransactionHashes))
+		}
+	case *IllegalDistributedContent:
+		typ = audit.TypeIllegalEvidence
+		summary["chain"] = content.Evidence.GenesisBlockAddress
+		summary["illegaltype"] = strconv.Itoa(int(content.Evidence.IllegalType))
+		summary["height"] = strconv.FormatUint(uint64(content.Evidence.Height), 10)
+		summary["illegalsigner"] = common.BytesToHexString(content.Evidence.IllegalSigner)
+	default:
+		return nil
+	}
+	summary["proposal"] = item.ItemContent.Hash().String()
+	return auditLog.RecordSignature(typ, buf.Bytes(), summary,
+		audit.PublicKey(item.TargetArbitratorPublicKey), decision)
+}
+
 func (item *DistributedItem) GetSignedData() []byte {
 	return item.signedData
 }
@@ -195,8 +231,8 @@ func (item *DistributedItem) Deserialize(r io.Reader) error {
 	return nil
 }
 
-func (item *DistributedItem) createMultiSignRedeemScript() error {
-	script, err := CreateRedeemScript()
+func (item *DistributedItem) createMultiSignRedeemScript(arbitrator arbitrator.Arbitrator) error {
+	script, err := CreateRedeemScript(arbitrator)
 	if err != nil {
 		return err
 	}
@@ -252,10 +288,10 @@ func (item *DistributedItem) IsFeedback() bool {
 }
 
 func (itemFunc *DistrubutedItemFuncImpl) GetArbitratorGroupInfoByHeight(height uint32) (*rpc.ArbitratorGroupInfo, error) {
-	return rpc.GetArbitratorGroupInfoByHeight(height)
+	return rpc.GetArbitratorGroupInfoByHeight(height, itemFunc.Config)
 }
 
-func (item *DistributedItem) appendSignature(signerIndex int, signature []byte, isFeedback bool, itemFunc DistrubutedItemFunc) error {
+func (item *DistributedItem) appendSignature(arbitrator arbitrator.Arbitrator, signerIndex int, signature []byte, isFeedback bool, itemFunc DistrubutedItemFunc) error {
 	// Create new signature
 	newSign := append([]byte{}, byte(len(signature)))
 	newSign = append(newSign, signature...)
@@ -291,7 +327,8 @@ func (item *DistributedItem) appendSignature(signerIndex int, signature []byte,
 			return err
 		}
 
-		if !crypto.Equal(targetPk, onDutyArbitratorPk) {
+		if !crypto.Equal(targetPk, onDutyArbitratorPk) &&
+			!isTakeoverProposal(arbitrator, targetPk, groupInfo, item.ItemContent) {
 			return errors.New("Can not sign without current arbitrator's signing.")
 		}
 
@@ -315,3 +352,86 @@ func (item *DistributedItem) appendSignature(signerIndex int, signature []byte,
 
 	return nil
 }
+
+// checkProposer checks the proposal is signed by the arbiter on duty at the
+// height of the content. Invalid signatures and proposers never allowed to
+// propose the content are returned as misbehavior errors. The other failures
+// depend on the state of this arbiter, such as the main chain height known
+// and the withdraw transactions pending for takeover, so they are returned
+// as plain errors.
+func (item *DistributedItem) checkProposer(itemFunc DistrubutedItemFunc) error {
+	if item.TargetArbitratorPublicKey == nil || len(item.signedData) != crypto.SignatureScriptLength {
+		return NewMisbehaviorError(PenaltyInvalidSignature, errors.New("invalid proposer sign data"))
+	}
+	buf := new(bytes.Buffer)
+	if err := item.ItemContent.SerializeUnsigned(buf); err != nil {
+		return NewMisbehaviorError(PenaltyUndecodable, err)
+	}
+	if err := crypto.Verify(*item.TargetArbitratorPublicKey, buf.Bytes(), item.signedData[1:]); err != nil {
+		return NewMisbehaviorError(PenaltyInvalidSignature, errors.New("invalid proposer signature"))
+	}
+
+	blockHeight, err := item.ItemContent.CurrentBlockHeight()
+	if err != nil {
+		return NewMisbehaviorError(PenaltyUndecodable, err)
+	}
+	groupInfo, err := itemFunc.GetArbitratorGroupInfoByHeight(blockHeight)
+	if err != nil {
+		return err
+	}
+	if groupInfo.OnDutyArbitratorIndex < 0 || groupInfo.OnDutyArbitratorIndex >= len(groupInfo.Arbitrators) {
+		return errors.New("invalid on duty arbitrator index")
+	}
+	onDutyArbitratorPk, err :=
+		base.PublicKeyFromString(groupInfo.Arbitrators[groupInfo.OnDutyArbitratorIndex])
+	if err != nil {
+		return err
+	}
+	if crypto.Equal(item.TargetArbitratorPublicKey, onDutyArbitratorPk) {
+		return nil
+	}
+
+	// withdraw transactions pending too long are proposed by the arbiters
+	// not on duty, if they are pending long enough is checked on signing.
+	// Consolidations withdraw nothing and are never taken over.
+	if isWithdrawProposal(item.ItemContent) {
+		for _, arbiter := range groupInfo.Arbitrators {
+			pk, err := base.PublicKeyFromString(arbiter)
+			if err == nil && crypto.Equal(item.TargetArbitratorPublicKey, pk) {
+				return nil
+			}
+		}
+	}
+	return NewMisbehaviorError(PenaltyNotOnDuty, errors.New("proposer is not on duty"))
+}
+
+// isWithdrawProposal returns if the content is a withdraw transaction of side
+// chain withdraw transactions.
+func isWithdrawProposal(content base.DistributedContent) bool {
+	txContent, ok := content.(*TxDistributedContent)
+	if !ok {
+		return false
+	}
+	withdrawPayload, ok := txContent.Tx.Payload.(*payload.WithdrawFromSideChain)
+	return ok && len(withdrawPayload.SideChainTransactionHashes) > 0
+}
+
+// isTakeoverProposal returns if the withdraw proposal is proposed by a backup
+// arbiter taking over the withdraw transactions pending too long.
+func isTakeoverProposal(arbitrator arbitrator.Arbitrator, targetPk *crypto.PublicKey, groupInfo *rpc.ArbitratorGroupInfo,
+	content base.DistributedContent) bool {
+	txContent, ok := content.(*TxDistributedContent)
+	if !ok {
+		return false
+	}
+	withdrawPayload, ok := txContent.Tx.Payload.(*payload.WithdrawFromSideChain)
+	if !ok {
+		return false
+	}
+	var txHashes []string
+	for _, hash := range withdrawPayload.SideChainTransactionHashes {
+		txHashes = append(txHashes, hash.String())
+	}
+	return arbitrator.IsWithdrawTakeoverAllowed(groupInfo.Arbitrators,
+		groupInfo.OnDutyArbitratorIndex, targetPk, withdrawPayload.GenesisBlockAddress, txHashes)
+}
@@ -0,0 +1,170 @@
+package cs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.Init(".", 5, 0, 0)
+}
+
+func TestDistributedItem_Audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l, err := audit.Open(filepath.Join(dir, "audit.log"))
+	assert.NoError(t, err)
+	defer l.Close()
+
+	_, publicKey, err := crypto.GenerateKeyPair()
+	assert.NoError(t, err)
+	txn := newTestWithdrawTx(t, 0, []common.Uint256{{1}, {2}},
+		map[string]common.Fixed64{testAddress1: 1000})
+	item := &DistributedItem{
+		TargetArbitratorPublicKey: publicKey,
+		ItemContent:               &TxDistributedContent{Tx: txn},
+	}
+	assert.NoError(t, item.audit(l, audit.DecisionApproved))
+
+	entries, err := l.Query(audit.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, audit.TypeWithdrawProposal, entries[0].Type)
+	assert.Equal(t, audit.DecisionApproved, entries[0].Decision)
+	assert.Equal(t, audit.PublicKey(publicKey), entries[0].Proposer)
+	assert.Equal(t, txn.Hash().String(), entries[0].Summary["proposal"])
+	assert.Equal(t, testGenesisAddress, entries[0].Summary["chain"])
+	assert.Equal(t, "2", entries[0].Summary["sidetxs"])
+	assert.Equal(t, "2", entries[0].Summary["outputs"])
+
+	// the item is not sent if its signature is not audited
+	assert.NoError(t, l.Close())
+	assert.Error(t, item.audit(l, audit.DecisionApproved))
+}
+
+type testItemFunc struct {
+	groupInfo *rpc.ArbitratorGroupInfo
+	err       error
+}
+
+func (f *testItemFunc) GetArbitratorGroupInfoByHeight(height uint32) (*rpc.ArbitratorGroupInfo, error) {
+	return f.groupInfo, f.err
+}
+
+// testPenalty returns the penalty of the misbehavior error, 0 for the others.
+func testPenalty(err error) uint32 {
+	misbehavior, ok := err.(*MisbehaviorError)
+	if !ok {
+		return 0
+	}
+	return misbehavior.Penalty
+}
+
+func TestDistributedItem_CheckProposer(t *testing.T) {
+	var arbiters []string
+	var privateKeys [][]byte
+	var publicKeys []*crypto.PublicKey
+	for i := 0; i < 3; i++ {
+		privateKey, publicKey, err := crypto.GenerateKeyPair()
+		assert.NoError(t, err)
+		buf, err := publicKey.EncodePoint(true)
+		assert.NoError(t, err)
+		arbiters = append(arbiters, common.BytesToHexString(buf))
+		privateKeys = append(privateKeys, privateKey)
+		publicKeys = append(publicKeys, publicKey)
+	}
+	itemFunc := &testItemFunc{groupInfo: &rpc.ArbitratorGroupInfo{
+		OnDutyArbitratorIndex: 0,
+		Arbitrators:           arbiters[:2],
+	}}
+
+	newItem := func(index int) *DistributedItem {
+		txn := newTestWithdrawTx(t, 0, []common.Uint256{{1}},
+			map[string]common.Fixed64{testAddress1: 1000})
+		item := &DistributedItem{
+			TargetArbitratorPublicKey: publicKeys[index],
+			ItemContent:               &TxDistributedContent{Tx: txn},
+		}
+		buf := new(bytes.Buffer)
+		assert.NoError(t, item.ItemContent.SerializeUnsigned(buf))
+		sign := testSign(t, privateKeys[index], buf.Bytes())
+		item.signedData = append([]byte{byte(len(sign))}, sign...)
+		return item
+	}
+
+	// proposed by the arbiter on duty
+	assert.NoError(t, newItem(0).checkProposer(itemFunc))
+
+	// signed by another key
+	item := newItem(0)
+	item.TargetArbitratorPublicKey = publicKeys[1]
+	assert.Equal(t, PenaltyInvalidSignature, testPenalty(item.checkProposer(itemFunc)))
+
+	// withdraw taken over by a backup arbiter is checked on signing
+	assert.NoError(t, newItem(1).checkProposer(itemFunc))
+
+	// consolidations are never taken over
+	item = newItem(1)
+	item.ItemContent.(*TxDistributedContent).Tx.Payload.(*payload.WithdrawFromSideChain).
+		SideChainTransactionHashes = nil
+	buf := new(bytes.Buffer)
+	assert.NoError(t, item.ItemContent.SerializeUnsigned(buf))
+	sign := testSign(t, privateKeys[1], buf.Bytes())
+	item.signedData = append([]byte{byte(len(sign))}, sign...)
+	assert.Equal(t, PenaltyNotOnDuty, testPenalty(item.checkProposer(itemFunc)))
+
+	// proposed by a key not of the arbiters
+	assert.Equal(t, PenaltyNotOnDuty, testPenalty(newItem(2).checkProposer(itemFunc)))
+
+	// arbiters unknown to this arbiter is not penalized
+	err := newItem(0).checkProposer(&testItemFunc{err: errors.New("height not reached")})
+	assert.Error(t, err)
+	assert.Equal(t, uint32(0), testPenalty(err))
+}
+
+func TestIsFeedbackContent(t *testing.T) {
+	_, publicKey, err := crypto.GenerateKeyPair()
+	assert.NoError(t, err)
+	txn := newTestWithdrawTx(t, 0, []common.Uint256{{1}},
+		map[string]common.Fixed64{testAddress1: 1000})
+	item := &DistributedItem{
+		TargetArbitratorPublicKey:   publicKey,
+		TargetArbitratorProgramHash: &common.Uint168{},
+		Type:                        TxDistribute,
+		ItemContent:                 &TxDistributedContent{Tx: txn},
+		redeemScript:                make([]byte, 71),
+	}
+	serialize := func(signs int) []byte {
+		item.signedData = bytes.Repeat([]byte{crypto.SignatureLength}, crypto.SignatureScriptLength*signs)
+		buf := new(bytes.Buffer)
+		assert.NoError(t, item.Serialize(buf))
+		return buf.Bytes()
+	}
+
+	proposal := serialize(1)
+	feedback := serialize(2)
+	assert.False(t, isFeedbackContent(proposal))
+	assert.True(t, isFeedbackContent(feedback))
+
+	// classified the same as deserialized
+	for _, content := range [][]byte{proposal, feedback} {
+		deserialized := &DistributedItem{}
+		assert.NoError(t, deserialized.Deserialize(bytes.NewReader(content)))
+		assert.Equal(t, deserialized.IsFeedback(), isFeedbackContent(content))
+	}
+	assert.False(t, isFeedbackContent(nil))
+}
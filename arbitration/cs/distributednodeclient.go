@@ -3,53 +3,103 @@ package cs
 import (
 	"bytes"
 	"errors"
+	"sync"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 
 	"github.com/elastos/Elastos.ELA/core/contract"
 	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
 )
 
 type DistributedNodeClient struct {
+	// Arbitrator is the arbitrator proposals are checked and signed by.
+	Arbitrator arbitrator.Arbitrator
+	// Network is the arbiters network feedback is sent through.
+	Network *ArbitratorsNetwork
+	// Policy is the signing policy withdraw proposals are checked against.
+	Policy *SigningPolicy
+
+	// signMux serializes checking the signing policy and signing, as
+	// proposals are verified by multiple workers at the same time.
+	signMux sync.Mutex
 }
 
 type DistributedNodeClientFunc interface {
-	GetSideChainAndExchangeRate(genesisAddress string) (arbitrator.SideChain, float64, error)
+	GetArbitrator() arbitrator.Arbitrator
+	GetSideChainAndExchangeRate(genesisAddress string) (arbitrator.SideChain, *base.ExchangeRate, error)
 }
 
-func (client *DistributedNodeClient) GetSideChainAndExchangeRate(genesisAddress string) (arbitrator.SideChain, float64, error) {
-	sideChain, ok := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(genesisAddress)
+func (client *DistributedNodeClient) GetArbitrator() arbitrator.Arbitrator {
+	return client.Arbitrator
+}
+
+func (client *DistributedNodeClient) GetSideChainAndExchangeRate(genesisAddress string) (arbitrator.SideChain, *base.ExchangeRate, error) {
+	sideChain, ok := client.Arbitrator.GetSideChainManager().GetChain(genesisAddress)
 	if !ok || sideChain == nil {
-		return nil, 0, errors.New("Get side chain from genesis address failed.")
+		return nil, nil, errors.New("Get side chain from genesis address failed.")
 	}
 	rate, err := sideChain.GetExchangeRate()
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
 	return sideChain, rate, nil
 }
 
 func (client *DistributedNodeClient) SignProposal(item *DistributedItem) error {
-	return item.Sign(arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator(), true, &DistrubutedItemFuncImpl{})
+	return item.Sign(client.Arbitrator, true, &DistrubutedItemFuncImpl{Config: client.Arbitrator.GetConfig()})
 }
 
 func (client *DistributedNodeClient) OnReceivedProposal(id peer.PID, content []byte) error {
 	transactionItem := &DistributedItem{}
 	if err := transactionItem.Deserialize(bytes.NewReader(content)); err != nil {
-		return err
+		return NewMisbehaviorError(PenaltyUndecodable, err)
+	}
+
+	if transactionItem.ItemContent == nil {
+		return NewMisbehaviorError(PenaltyUndecodable, errors.New("unknown proposal content type"))
 	}
 
 	if transactionItem.IsFeedback() {
 		return nil
 	}
 
+	if err := transactionItem.checkProposer(&DistrubutedItemFuncImpl{Config: client.Arbitrator.GetConfig()}); err != nil {
+		return err
+	}
+
+	// the proposals invalid regardless of the state of this arbiter fail the
+	// check with misbehavior errors and are penalized, the other failures
+	// depend on the side chain transactions and UTXOs known by this arbiter,
+	// they do not prove the proposer misbehaved and are not penalized.
 	if err := transactionItem.ItemContent.Check(client); err != nil {
 		return err
 	}
 
+	client.signMux.Lock()
+	defer client.signMux.Unlock()
+	txContent, isWithdraw := transactionItem.ItemContent.(*TxDistributedContent)
+	if isWithdraw {
+		if err := client.Policy.CheckWithdrawTransaction(txContent.Tx, client); err != nil {
+			return err
+		}
+	}
+
 	if err := client.SignProposal(transactionItem); err != nil {
 		return err
 	}
+	decision := audit.DecisionUnchecked
+	if isWithdraw {
+		decision = audit.DecisionApproved
+	}
+	// the signature not audited is discarded instead of sent back
+	if err := transactionItem.audit(client.Arbitrator.GetAuditLog(), decision); err != nil {
+		return err
+	}
+	if isWithdraw {
+		client.Policy.RecordWithdrawTransaction(txContent.Tx)
+	}
 
 	if err := client.Feedback(id, transactionItem); err != nil {
 		return err
@@ -59,8 +109,7 @@ func (client *DistributedNodeClient) OnReceivedProposal(id peer.PID, content []b
 }
 
 func (client *DistributedNodeClient) Feedback(id peer.PID, item *DistributedItem) error {
-	ar := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
-	item.TargetArbitratorPublicKey = ar.GetPublicKey()
+	item.TargetArbitratorPublicKey = client.Arbitrator.GetPublicKey()
 
 	pkBuf, err := item.TargetArbitratorPublicKey.EncodePoint(true)
 	if err != nil {
@@ -78,7 +127,7 @@ func (client *DistributedNodeClient) Feedback(id peer.PID, item *DistributedItem
 		return errors.New("Send complaint failed.")
 	}
 
-	return P2PClientSingleton.SendMessageToPeer(id, &DistributedItemMessage{
+	return client.Network.SendMessageToPeer(id, &DistributedItemMessage{
 		Content: messageReader.Bytes(),
 	})
 }
@@ -8,7 +8,7 @@ import (
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 
 	"github.com/elastos/Elastos.ELA/common"
@@ -24,6 +24,11 @@ const (
 )
 
 type DistributedNodeServer struct {
+	// Arbitrator is the arbitrator proposals are signed and submitted by.
+	Arbitrator arbitrator.Arbitrator
+	// Network is the arbiters network proposals are broadcast to.
+	Network *ArbitratorsNetwork
+
 	mux                       *sync.Mutex
 	withdrawMux               *sync.Mutex
 	unsolvedContents          map[common.Uint256]base.DistributedContent
@@ -51,9 +56,9 @@ func (dns *DistributedNodeServer) UnsolvedTransactions() map[common.Uint256]base
 	return dns.unsolvedContents
 }
 
-func CreateRedeemScript() ([]byte, error) {
+func CreateRedeemScript(ar arbitrator.Arbitrator) ([]byte, error) {
 	var publicKeys []*crypto.PublicKey
-	arbiters := arbitrator.ArbitratorGroupSingleton.GetAllArbitrators()
+	arbiters := ar.GetArbitratorGroup().GetAllArbitrators()
 	for _, arStr := range arbiters {
 		if arStr == "" {
 			continue
@@ -64,7 +69,7 @@ func CreateRedeemScript() ([]byte, error) {
 		}
 		publicKeys = append(publicKeys, temp)
 	}
-	arbitersCount := getTransactionAgreementArbitratorsCount(len(arbiters))
+	arbitersCount := getTransactionAgreementArbitratorsCount(ar, len(arbiters))
 	redeemScript, err := base.CreateWithdrawRedeemScript(arbitersCount, publicKeys)
 	if err != nil {
 		return nil, err
@@ -72,11 +77,11 @@ func CreateRedeemScript() ([]byte, error) {
 	return redeemScript, nil
 }
 
-func getTransactionAgreementArbitratorsCount(arbitersCount int) int {
-	currentHeight := arbitrator.ArbitratorGroupSingleton.GetCurrentHeight()
-	if currentHeight <= config.Parameters.CRClaimDPOSNodeStartHeight {
+func getTransactionAgreementArbitratorsCount(ar arbitrator.Arbitrator, arbitersCount int) int {
+	currentHeight := ar.GetArbitratorGroup().GetCurrentHeight()
+	if currentHeight <= ar.GetConfig().CRClaimDPOSNodeStartHeight {
 		return arbitersCount*2/3 + 1
-	} else if currentHeight < config.Parameters.DPOSNodeCrossChainHeight {
+	} else if currentHeight < ar.GetConfig().DPOSNodeCrossChainHeight {
 		return arbitersCount * 2 / 3
 	}
 	return arbitersCount*2/3 + 1
@@ -87,25 +92,28 @@ func (dns *DistributedNodeServer) sendToArbitrator(content []byte) {
 		Content: content,
 	}
 
-	P2PClientSingleton.BroadcastMessage(msg)
-	log.Info("[sendToArbitrator] Send withdraw transaction to arbiters for multi sign")
+	dns.Network.BroadcastMessage(msg)
 }
 
 func (dns *DistributedNodeServer) BroadcastWithdrawProposal(txn *types.Transaction) error {
 
-	proposal, err := dns.generateDistributedProposal(&TxDistributedContent{Tx: txn}, &DistrubutedItemFuncImpl{})
+	proposal, err := dns.generateDistributedProposal(&TxDistributedContent{
+		Tx: txn, ParentArbitrator: dns.Arbitrator}, &DistrubutedItemFuncImpl{Config: dns.Arbitrator.GetConfig()})
 	if err != nil {
 		return err
 	}
 
 	dns.sendToArbitrator(proposal)
+	log.Withdraw.Info("[BroadcastWithdrawProposal] Send withdraw transaction to arbiters for multi sign",
+		log.Proposal(txn.Hash().String()))
 
 	return nil
 }
 
 func (dns *DistributedNodeServer) BroadcastSidechainIllegalData(data *payload.SidechainIllegalData) error {
 
-	proposal, err := dns.generateDistributedProposal(&IllegalDistributedContent{Evidence: data}, &DistrubutedItemFuncImpl{})
+	proposal, err := dns.generateDistributedProposal(&IllegalDistributedContent{
+		Evidence: data, ParentArbitrator: dns.Arbitrator}, &DistrubutedItemFuncImpl{Config: dns.Arbitrator.GetConfig()})
 	if err != nil {
 		return err
 	}
@@ -118,7 +126,7 @@ func (dns *DistributedNodeServer) BroadcastSidechainIllegalData(data *payload.Si
 func (dns *DistributedNodeServer) generateDistributedProposal(itemContent base.DistributedContent, itemFunc DistrubutedItemFunc) ([]byte, error) {
 	dns.tryInit()
 
-	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
+	currentArbitrator := dns.Arbitrator
 	pkBuf, err := currentArbitrator.GetPublicKey().EncodePoint(true)
 	if err != nil {
 		return nil, err
@@ -139,6 +147,9 @@ func (dns *DistributedNodeServer) generateDistributedProposal(itemContent base.D
 	if err = transactionItem.Sign(currentArbitrator, false, itemFunc); err != nil {
 		return nil, err
 	}
+	if err = transactionItem.audit(currentArbitrator.GetAuditLog(), audit.DecisionProposer); err != nil {
+		return nil, err
+	}
 
 	buf := new(bytes.Buffer)
 	if err = transactionItem.Serialize(buf); err != nil {
@@ -170,14 +181,14 @@ func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error
 
 	transactionItem := DistributedItem{}
 	if err := transactionItem.Deserialize(bytes.NewReader(content)); err != nil {
-		return err
+		return NewMisbehaviorError(PenaltyUndecodable, err)
 	}
 	newSign, msg, err := transactionItem.ParseFeedbackSignedData()
 	if err != nil {
-		return err
+		return NewMisbehaviorError(PenaltyInvalidSignature, err)
 	}
 	if msg != "" {
-		log.Warn(msg)
+		log.Withdraw.Warn("[ReceiveProposalFeedback] "+msg, log.Proposal(transactionItem.ItemContent.Hash().String()))
 		return nil
 	}
 
@@ -197,7 +208,7 @@ func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error
 
 	signs := dns.unsolvedContentsSignature[hash]
 	if _, ok := signs[targetCodeHash]; ok {
-		log.Warn("arbiter already signed ")
+		log.Withdraw.Warn("[ReceiveProposalFeedback] arbiter already signed", log.Proposal(hash.String()))
 		return nil
 	}
 	signedCount, err := txn.MergeSign(newSign, &targetCodeHash)
@@ -206,16 +217,17 @@ func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error
 	}
 	signs[targetCodeHash] = true
 	pk, _ := transactionItem.TargetArbitratorPublicKey.EncodePoint(true)
-	log.Info("receive signature from ", hex.EncodeToString(pk))
-	if signedCount >= getTransactionAgreementArbitratorsCount(
-		len(arbitrator.ArbitratorGroupSingleton.GetAllArbitrators())) {
+	log.Withdraw.Info("[ReceiveProposalFeedback] receive signature", log.Proposal(hash.String()),
+		log.F("arbiter", hex.EncodeToString(pk)), log.F("signs", signedCount))
+	if signedCount >= getTransactionAgreementArbitratorsCount(dns.Arbitrator,
+		len(dns.Arbitrator.GetArbitratorGroup().GetAllArbitrators())) {
 		dns.mux.Lock()
 		delete(dns.unsolvedContents, hash)
 		delete(dns.unsolvedContentsSignature, hash)
 		dns.mux.Unlock()
 
 		if err = txn.Submit(); err != nil {
-			log.Warn(err.Error())
+			log.Withdraw.Warn("[ReceiveProposalFeedback] submit proposal failed", log.Proposal(hash.String()), log.Err(err))
 			return err
 		}
 	}
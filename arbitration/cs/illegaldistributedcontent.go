@@ -7,7 +7,6 @@ import (
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 
 	"github.com/elastos/Elastos.ELA/common"
@@ -17,11 +16,19 @@ import (
 type IllegalDistributedContent struct {
 	Evidence *payload.SidechainIllegalData
 
+	// ParentArbitrator is the arbitrator proposing the evidence, it submits
+	// the evidence once enough arbiters signed it.
+	ParentArbitrator arbitrator.Arbitrator
+
 	hash *common.Uint256
 }
 
-func (i *IllegalDistributedContent) Check(clientFunc interface{}) error {
-	sideChain, ok := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(i.Evidence.GenesisBlockAddress)
+func (i *IllegalDistributedContent) Check(client interface{}) error {
+	clientFunc, ok := client.(DistributedNodeClientFunc)
+	if !ok {
+		return errors.New("unknown client function")
+	}
+	sideChain, ok := clientFunc.GetArbitrator().GetSideChainManager().GetChain(i.Evidence.GenesisBlockAddress)
 	if !ok || sideChain == nil {
 		return errors.New("get side chain from genesis address failed when check illegal evidence")
 	}
@@ -85,7 +92,7 @@ func (i *IllegalDistributedContent) Submit() error {
 
 	content := common.BytesToHexString(buf.Bytes())
 	if _, err = rpc.CallAndUnmarshalResponse("submitsidechainillegaldata",
-		rpc.Param("illegaldata", content), config.Parameters.MainNode.Rpc); err != nil {
+		rpc.Param("illegaldata", content), i.ParentArbitrator.GetConfig().MainNode.Rpc); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,60 @@
+package cs
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/metrics"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	elap2p "github.com/elastos/Elastos.ELA/p2p"
+)
+
+const defaultMessageQueueCapacity = 10000
+
+type messageItem struct {
+	ID       peer.PID
+	Message  elap2p.Message
+	received time.Time
+}
+
+// messageQueue is a bounded queue of the received messages. Messages are
+// dropped instead of blocking the peer when the queue is full, the drops,
+// length and wait time are reported as metrics prefixed by "p2p.<name>.".
+type messageQueue struct {
+	name  string
+	items chan *messageItem
+}
+
+func newMessageQueue(name string, capacity int) *messageQueue {
+	if capacity <= 0 {
+		capacity = defaultMessageQueueCapacity
+	}
+	return &messageQueue{name: name, items: make(chan *messageItem, capacity)}
+}
+
+// push queues the item, returns false if the item is dropped as the queue is
+// full.
+func (q *messageQueue) push(item *messageItem) bool {
+	item.received = time.Now()
+	select {
+	case q.items <- item:
+		metrics.SetGauge(q.metric("length"), int64(len(q.items)))
+		return true
+	default:
+		metrics.AddCounter(q.metric("dropped"), 1)
+		return false
+	}
+}
+
+// popped records the wait time of the item taken from the queue.
+func (q *messageQueue) popped(item *messageItem) {
+	wait := int64(time.Since(item.received) / time.Millisecond)
+	metrics.SetGauge(q.metric("length"), int64(len(q.items)))
+	metrics.SetGauge(q.metric("waitms"), wait)
+	metrics.AddCounter(q.metric("totalwaitms"), wait)
+	metrics.AddCounter(q.metric("processed"), 1)
+}
+
+func (q *messageQueue) metric(name string) string {
+	return "p2p." + q.name + "." + name
+}
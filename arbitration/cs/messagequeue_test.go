@@ -0,0 +1,30 @@
+package cs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/metrics"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageQueue(t *testing.T) {
+	queue := newMessageQueue("test", 2)
+	assert.True(t, queue.push(&messageItem{ID: peer.PID{1}}))
+	assert.True(t, queue.push(&messageItem{ID: peer.PID{2}}))
+	assert.False(t, queue.push(&messageItem{ID: peer.PID{3}}))
+	assert.Equal(t, int64(1), metrics.Get("p2p.test.dropped"))
+	assert.Equal(t, int64(2), metrics.Get("p2p.test.length"))
+
+	item := <-queue.items
+	item.received = item.received.Add(-time.Second)
+	queue.popped(item)
+	assert.Equal(t, peer.PID{1}, item.ID)
+	assert.True(t, metrics.Get("p2p.test.waitms") >= 1000)
+	assert.Equal(t, int64(1), metrics.Get("p2p.test.processed"))
+	assert.Equal(t, int64(1), metrics.Get("p2p.test.length"))
+
+	assert.Equal(t, defaultMessageQueueCapacity, cap(newMessageQueue("default", 0).items))
+}
@@ -1,158 +1,323 @@
 package cs
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"math/rand"
-	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 	"github.com/elastos/Elastos.ELA.Arbiter/store"
 
+	"github.com/elastos/Elastos.ELA/crypto"
 	"github.com/elastos/Elastos.ELA/dpos/dtime"
 	"github.com/elastos/Elastos.ELA/dpos/p2p"
 	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
 	elap2p "github.com/elastos/Elastos.ELA/p2p"
 )
 
-var P2PClientSingleton *arbitratorsNetwork
-
 const (
 	//len of message need to less than 12
 	DistributeItemCommand = "disitem"
+	StatusCommand         = "arbstatus"
 )
 
-type messageItem struct {
-	ID      peer.PID
-	Message elap2p.Message
-}
+// ArbitratorsNetwork is the p2p network of the arbiters, proposals and
+// feedback of withdraw transactions are exchanged through it.
+type ArbitratorsNetwork struct {
+	// arbitrator is the arbitrator the network connects, its configuration
+	// and stores are used by the network.
+	arbitrator arbitrator.Arbitrator
 
-type arbitratorsNetwork struct {
 	mainchainListeners []base.MainchainMsgListener
 
 	peersLock      sync.Mutex
 	connectedPeers []peer.PID
 
-	p2pServer    p2p.Server
-	messageQueue chan *messageItem
-	quit         chan bool
+	peerStatuses *peerStatuses
+	peerScores   *peerScores
+
+	p2pServer p2p.Server
+
+	// feedbackQueue is the feedback of own proposals. It is a separate lane
+	// rather than a strict priority: its own loop processes it concurrently
+	// with the loops of messageQueue, so collecting signatures does not wait
+	// behind the proposals of others, but a proposal being verified is not
+	// preempted by feedback either.
+	feedbackQueue *messageQueue
+	messageQueue  *messageQueue
+	quit          chan bool
+	// processing tracks the process loops, Stop waits for the messages in
+	// process, such as withdraw transactions being sent.
+	processing sync.WaitGroup
 }
 
-func (n *arbitratorsNetwork) AddMainchainListener(listener base.MainchainMsgListener) {
+func (n *ArbitratorsNetwork) AddMainchainListener(listener base.MainchainMsgListener) {
 	n.mainchainListeners = append(n.mainchainListeners, listener)
 }
 
-func (n *arbitratorsNetwork) Start() {
+// Start starts the p2p server and connects the active dpos peers, the server
+// started is stopped by Stop if getting the peers fails.
+func (n *ArbitratorsNetwork) Start() error {
 	n.p2pServer.Start()
 
-	currentHeight := store.DbCache.MainChainStore.CurrentHeight(store.QueryHeightCode)
-	peers, err := rpc.GetActiveDposPeers(currentHeight)
+	cfg := n.arbitrator.GetConfig()
+	currentHeight := n.arbitrator.GetDataStore().MainChainStore.CurrentHeight(store.QueryHeightCode)
+	peers, err := rpc.GetActiveDposPeers(currentHeight, cfg)
 	if err != nil {
-		log.Error("Get active dpos peers error when start, details: ", err)
-		os.Exit(1)
+		log.P2P.Error("Get active dpos peers error when start", log.Height(currentHeight), log.Err(err))
+		return errors.New("get active dpos peers failed: " + err.Error())
 	}
 	n.UpdatePeers(peers)
 
-	go func() {
-	out:
-		for {
-			select {
-			case msgItem := <-n.messageQueue:
-				n.processMessage(msgItem)
-			case <-n.quit:
-				break out
-			}
+	workers := cfg.P2PVerifyWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	n.processing.Add(workers + 1)
+	go n.processLoop(n.feedbackQueue)
+	for i := 0; i < workers; i++ {
+		go n.processLoop(n.messageQueue)
+	}
+	return nil
+}
+
+func (n *ArbitratorsNetwork) processLoop(queue *messageQueue) {
+	defer n.processing.Done()
+	for {
+		select {
+		case msgItem := <-queue.items:
+			queue.popped(msgItem)
+			n.processMessage(msgItem)
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+// ProcessQueued processes the queued messages in the calling goroutine, the
+// feedback first, and returns the count processed. Simulations use it in
+// place of Start to process messages deterministically.
+func (n *ArbitratorsNetwork) ProcessQueued() int {
+	count := 0
+	for _, queue := range []*messageQueue{n.feedbackQueue, n.messageQueue} {
+		for len(queue.items) > 0 {
+			msgItem := <-queue.items
+			queue.popped(msgItem)
+			n.processMessage(msgItem)
+			count++
 		}
-	}()
+	}
+	return count
 }
 
-func (n *arbitratorsNetwork) Stop() error {
-	n.quit <- true
+// Stop stops processing messages after the ones in process, and stops the
+// p2p server.
+func (n *ArbitratorsNetwork) Stop() error {
+	close(n.quit)
+	n.processing.Wait()
 	return n.p2pServer.Stop()
 }
 
-func (n *arbitratorsNetwork) SendMessageToPeer(id peer.PID, msg elap2p.Message) error {
+func (n *ArbitratorsNetwork) SendMessageToPeer(id peer.PID, msg elap2p.Message) error {
+	traceMessage("send", id.String(), msg)
 	return n.p2pServer.SendMessageToPeer(id, msg)
 }
 
-func (n *arbitratorsNetwork) BroadcastMessage(msg elap2p.Message) {
+func (n *ArbitratorsNetwork) BroadcastMessage(msg elap2p.Message) {
+	traceMessage("broadcast", "", msg)
 	n.peersLock.Lock()
-	log.Info("[BroadcastMessage] current connected peers:", len(n.connectedPeers))
+	log.P2P.Info("[BroadcastMessage] broadcast message", log.F("cmd", msg.CMD()),
+		log.F("peers", len(n.connectedPeers)))
 	n.peersLock.Unlock()
 
 	n.p2pServer.BroadcastMessage(msg)
 }
 
-func (n *arbitratorsNetwork) UpdatePeers(connectedPeers []peer.PID) {
+func (n *ArbitratorsNetwork) UpdatePeers(connectedPeers []peer.PID) {
 	n.peersLock.Lock()
 	n.connectedPeers = connectedPeers
 	for _, pid := range connectedPeers {
-		n.p2pServer.AddAddr(pid, config.Parameters.DPoSNetAddress)
+		n.p2pServer.AddAddr(pid, n.arbitrator.GetConfig().DPoSNetAddress)
 	}
 	n.peersLock.Unlock()
 
-	n.p2pServer.ConnectPeers(n.connectedPeers)
+	n.connectPeers()
+}
+
+// connectPeers connects the peers not banned and disconnects the others.
+func (n *ArbitratorsNetwork) connectPeers() {
+	n.peersLock.Lock()
+	peers := n.peerScores.filterBanned(n.connectedPeers, time.Now())
+	n.peersLock.Unlock()
+
+	n.p2pServer.ConnectPeers(peers)
+}
+
+// penalize adds the penalty to the misbehavior score of the peer, the peer is
+// disconnected until the ban expires if the score reaches the ban threshold.
+func (n *ArbitratorsNetwork) penalize(pid peer.PID, penalty uint32, reason string) {
+	log.P2P.Warn("[penalize] peer misbehaved", log.F("peer", pid.String()), log.F("reason", reason))
+	if !n.peerScores.penalize(pid, penalty, reason, time.Now()) {
+		return
+	}
+	log.P2P.Warn("[penalize] ban peer", log.F("peer", pid.String()), log.F("duration", n.peerScores.banDuration))
+	n.connectPeers()
+	time.AfterFunc(n.peerScores.banDuration, n.connectPeers)
+}
+
+// penalizeErrors penalizes the peer by the largest penalty of the
+// misbehavior errors, as listeners may fail by the same misbehavior.
+func (n *ArbitratorsNetwork) penalizeErrors(pid peer.PID, errs []error) {
+	if misbehavior := largestMisbehavior(errs); misbehavior != nil {
+		n.penalize(pid, misbehavior.Penalty, misbehavior.Error())
+	}
+}
+
+func (n *ArbitratorsNetwork) DumpPeerScores() []*PeerScore {
+	return n.peerScores.dump(time.Now())
 }
 
-func (n *arbitratorsNetwork) notifyFlag(flag p2p.NotifyFlag) {
+func (n *ArbitratorsNetwork) notifyFlag(flag p2p.NotifyFlag) {
+}
+
+// traceMessage logs a message sent or received while the p2p module is
+// tracing.
+func traceMessage(direction, pid string, msg elap2p.Message) {
+	if !log.P2P.Tracing() {
+		return
+	}
+	buf := new(bytes.Buffer)
+	msg.Serialize(buf)
+	log.P2P.Debug("[traceMessage] "+direction, log.F("cmd", msg.CMD()),
+		log.F("peer", pid), log.F("size", buf.Len()))
+}
+
+func (n *ArbitratorsNetwork) handleMessage(pid peer.PID, msg elap2p.Message) {
+	traceMessage("receive", pid.String(), msg)
+	now := time.Now()
+	if n.peerScores.isBanned(pid, now) {
+		return
+	}
+	if !n.peerScores.allow(pid, now) {
+		n.penalize(pid, PenaltyExcessiveRate, "excessive message rate")
+		return
+	}
+
+	queue := n.messageQueue
+	if item, ok := msg.(*DistributedItemMessage); ok && isFeedbackContent(item.Content) {
+		queue = n.feedbackQueue
+	}
+	if !queue.push(&messageItem{ID: pid, Message: msg}) {
+		log.P2P.Warn("[handleMessage] message queue is full, drop message", log.F("queue", queue.name),
+			log.F("cmd", msg.CMD()), log.F("peer", pid.String()))
+	}
 }
 
-func (n *arbitratorsNetwork) handleMessage(pid peer.PID, msg elap2p.Message) {
-	n.messageQueue <- &messageItem{pid, msg}
+// isFeedbackContent returns if the distributed item is the feedback of a
+// proposal by the signed data ending it, which is two signatures in feedback
+// and one in proposals. It runs on the read loop of the peer, so the item is
+// not deserialized, the items malformed are penalized when processed. An item
+// misclassified is only processed in the other lane.
+func isFeedbackContent(content []byte) bool {
+	size := crypto.SignatureScriptLength * 2
+	if len(content) <= size {
+		return false
+	}
+	return int(content[len(content)-size-1]) == size
 }
 
-func (n *arbitratorsNetwork) processMessage(msgItem *messageItem) {
+func (n *ArbitratorsNetwork) processMessage(msgItem *messageItem) {
 	m := msgItem.Message
 	switch m.CMD() {
 	case DistributeItemCommand:
 		withdraw, processed := m.(*DistributedItemMessage)
 		if processed {
+			var errs []error
 			for _, v := range n.mainchainListeners {
-				v.OnReceivedSignMsg(msgItem.ID, withdraw.Content)
+				if err := v.OnReceivedSignMsg(msgItem.ID, withdraw.Content); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			n.penalizeErrors(msgItem.ID, errs)
+		}
+	case StatusCommand:
+		status, processed := m.(*StatusMessage)
+		if processed {
+			if err := n.peerStatuses.update(msgItem.ID, &status.Status); err != nil {
+				log.P2P.Warn("[processMessage] drop status of peer", log.F("peer", msgItem.ID.String()), log.Err(err))
+				n.penalizeErrors(msgItem.ID, []error{err})
 			}
 		}
 	}
 }
 
-func (n *arbitratorsNetwork) getNonce(pid peer.PID) uint64 {
+func (n *ArbitratorsNetwork) getNonce(pid peer.PID) uint64 {
 	return rand.Uint64()
 }
 
-func (n *arbitratorsNetwork) sign(data []byte) []byte {
-	sign, _ := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().Sign(data)
+// sign signs the handshake data, the signature failed to be audited is not
+// returned and the handshake fails.
+func (n *ArbitratorsNetwork) sign(data []byte) []byte {
+	sign, err := n.arbitrator.Sign(data)
+	if err != nil {
+		return sign
+	}
+	err = n.arbitrator.GetAuditLog().RecordSignature(audit.TypeHandshake, data, nil,
+		audit.PublicKey(n.arbitrator.GetPublicKey()), audit.DecisionUnchecked)
+	if err != nil {
+		log.P2P.Error("[sign] handshake signature discarded", log.Err(err))
+		return nil
+	}
 	return sign
 }
 
-func (n *arbitratorsNetwork) DumpArbiterPeersInfo() []*p2p.PeerInfo {
+func (n *ArbitratorsNetwork) DumpArbiterPeersInfo() []*p2p.PeerInfo {
 	return n.p2pServer.DumpPeersInfo()
 }
 
-func InitP2PClient(pid peer.PID) error {
-	var err error
-	P2PClientSingleton, err = NewArbitratorsNetwork(pid)
-	return err
+// NewArbitratorsNetwork creates the arbiters network of the arbitrator, the
+// p2p data is kept under dataDir.
+func NewArbitratorsNetwork(pid peer.PID, ar arbitrator.Arbitrator,
+	dataDir string) (*ArbitratorsNetwork, error) {
+	return NewArbitratorsNetworkWithServer(pid, ar, dataDir, func(cfg *p2p.Config) (p2p.Server, error) {
+		return p2p.NewServer(cfg)
+	})
 }
 
-func NewArbitratorsNetwork(pid peer.PID) (*arbitratorsNetwork, error) {
-	network := &arbitratorsNetwork{
+// NewArbitratorsNetworkWithServer creates the arbiters network on the server
+// newServer creates, such as an in-memory one of simulations.
+func NewArbitratorsNetworkWithServer(pid peer.PID, ar arbitrator.Arbitrator, dataDir string,
+	newServer func(cfg *p2p.Config) (p2p.Server, error)) (*ArbitratorsNetwork, error) {
+	cfg := ar.GetConfig()
+	scores := newPeerScores(cfg.PeerBanThreshold,
+		time.Millisecond*cfg.PeerBanDuration,
+		cfg.PeerMessageRateLimit)
+	network := &ArbitratorsNetwork{
+		arbitrator:         ar,
 		mainchainListeners: make([]base.MainchainMsgListener, 0),
 		connectedPeers:     make([]peer.PID, 0),
-		messageQueue:       make(chan *messageItem, 10000), //todo config handle capacity though config file
+		peerStatuses:       newPeerStatuses(),
+		peerScores:         scores,
+		feedbackQueue:      newMessageQueue("feedback", cfg.P2PQueueCapacity),
+		messageQueue:       newMessageQueue("message", cfg.P2PQueueCapacity),
 		quit:               make(chan bool),
 	}
 	notifier := p2p.NewNotifier(p2p.NFNetStabled|p2p.NFBadNetwork, network.notifyFlag)
 
-	server, err := p2p.NewServer(&p2p.Config{
-		DataDir:          filepath.Join(config.DataPath, config.DataDir, config.ArbiterDir),
+	server, err := newServer(&p2p.Config{
+		DataDir:          filepath.Join(dataDir, config.ArbiterDir),
 		PID:              pid,
-		MagicNumber:      config.Parameters.Magic,
-		DefaultPort:      config.Parameters.NodePort,
+		MagicNumber:      cfg.Magic,
+		DefaultPort:      cfg.NodePort,
 		TimeSource:       dtime.NewMedianTime(),
 		Sign:             network.sign,
 		PingNonce:        network.getNonce,
@@ -165,14 +330,14 @@ func NewArbitratorsNetwork(pid peer.PID) (*arbitratorsNetwork, error) {
 		return nil, err
 	}
 
-	for _, p := range config.Parameters.CRCCrossChainArbiters {
+	for _, p := range cfg.CRCCrossChainArbiters {
 		id := peer.PID{}
 		pk, err := hex.DecodeString(p)
 		if err != nil {
 			return nil, errors.New("invalid CRC public key in config")
 		}
 		copy(id[:], pk)
-		server.AddAddr(id, config.Parameters.DPoSNetAddress)
+		server.AddAddr(id, cfg.DPoSNetAddress)
 	}
 
 	network.p2pServer = server
@@ -184,6 +349,8 @@ func makeEmptyMessage(cmd string) (message elap2p.Message, err error) {
 	switch cmd {
 	case DistributeItemCommand:
 		message = &DistributedItemMessage{}
+	case StatusCommand:
+		message = &StatusMessage{}
 	default:
 		return nil, errors.New("received unsupported message, CMD " + cmd)
 	}
@@ -0,0 +1,202 @@
+package cs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+)
+
+const (
+	// PenaltyUndecodable is the penalty of sending a message can not be
+	// decoded.
+	PenaltyUndecodable uint32 = 20
+
+	// PenaltyFailedCheck is the penalty of sending a message fails the check
+	// regardless of the state of the receiving arbiter.
+	PenaltyFailedCheck uint32 = 10
+
+	// PenaltyNotOnDuty is the penalty of sending a proposal of an arbiter not
+	// allowed to propose it.
+	PenaltyNotOnDuty uint32 = 10
+
+	// PenaltyInvalidSignature is the penalty of sending a feedback or status
+	// with invalid signature.
+	PenaltyInvalidSignature uint32 = 20
+
+	// PenaltyExcessiveRate is the penalty of each message exceeds the
+	// message rate limit.
+	PenaltyExcessiveRate uint32 = 1
+
+	// scoreHalfLife is the time the score of a peer takes to halve.
+	scoreHalfLife = 10 * time.Minute
+)
+
+// MisbehaviorError is the error caused by the misbehavior of the peer sending
+// the message, the peer is penalized by Penalty.
+type MisbehaviorError struct {
+	Penalty uint32
+	Err     error
+}
+
+func (e *MisbehaviorError) Error() string {
+	return e.Err.Error()
+}
+
+// NewMisbehaviorError returns the err as the misbehavior of the sending peer.
+func NewMisbehaviorError(penalty uint32, err error) error {
+	return &MisbehaviorError{Penalty: penalty, Err: err}
+}
+
+// largestMisbehavior returns the misbehavior error of the largest penalty
+// in errs, nil if there is none.
+func largestMisbehavior(errs []error) *MisbehaviorError {
+	var misbehavior *MisbehaviorError
+	for _, err := range errs {
+		e, ok := err.(*MisbehaviorError)
+		if ok && (misbehavior == nil || e.Penalty > misbehavior.Penalty) {
+			misbehavior = e
+		}
+	}
+	return misbehavior
+}
+
+// PeerScore is the misbehavior score of an arbiter peer.
+type PeerScore struct {
+	PID         peer.PID
+	Score       uint32
+	LastReason  string
+	Banned      bool
+	BannedUntil time.Time
+	BanCount    uint32
+}
+
+type peerScore struct {
+	score       uint32
+	lastDecay   time.Time
+	lastReason  string
+	bannedUntil time.Time
+	banCount    uint32
+
+	windowStart time.Time
+	windowCount int
+}
+
+// decay halves the score for every scoreHalfLife passed since last decay.
+func (s *peerScore) decay(now time.Time) {
+	halves := now.Sub(s.lastDecay) / scoreHalfLife
+	if halves <= 0 {
+		return
+	}
+	if halves >= 32 {
+		s.score = 0
+	} else {
+		s.score >>= uint(halves)
+	}
+	s.lastDecay = s.lastDecay.Add(halves * scoreHalfLife)
+}
+
+// peerScores keeps the misbehavior score of each arbiter peer, a peer is
+// banned for banDuration when its score reaches banThreshold.
+type peerScores struct {
+	mux    sync.Mutex
+	scores map[peer.PID]*peerScore
+
+	banThreshold uint32
+	banDuration  time.Duration
+	rateLimit    int
+}
+
+// newPeerScores creates the peer scores, banThreshold 0 disables banning
+// and rateLimit 0 disables the limit of messages per second.
+func newPeerScores(banThreshold uint32, banDuration time.Duration, rateLimit int) *peerScores {
+	return &peerScores{
+		scores:       make(map[peer.PID]*peerScore),
+		banThreshold: banThreshold,
+		banDuration:  banDuration,
+		rateLimit:    rateLimit,
+	}
+}
+
+func (p *peerScores) get(pid peer.PID, now time.Time) *peerScore {
+	score, ok := p.scores[pid]
+	if !ok {
+		score = &peerScore{lastDecay: now}
+		p.scores[pid] = score
+	}
+	score.decay(now)
+	return score
+}
+
+// allow counts the message received from the peer, and returns false if the
+// peer has sent more than rate limit messages in the current second.
+func (p *peerScores) allow(pid peer.PID, now time.Time) bool {
+	if p.rateLimit <= 0 {
+		return true
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	score := p.get(pid, now)
+	if now.Sub(score.windowStart) >= time.Second {
+		score.windowStart = now
+		score.windowCount = 0
+	}
+	score.windowCount++
+	return score.windowCount <= p.rateLimit
+}
+
+// penalize adds the penalty to the score of the peer, and returns true if the
+// peer is banned by the penalty.
+func (p *peerScores) penalize(pid peer.PID, penalty uint32, reason string, now time.Time) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	score := p.get(pid, now)
+	score.score += penalty
+	score.lastReason = reason
+	if p.banThreshold == 0 || score.score < p.banThreshold || now.Before(score.bannedUntil) {
+		return false
+	}
+	score.bannedUntil = now.Add(p.banDuration)
+	score.banCount++
+	score.score = 0
+	return true
+}
+
+func (p *peerScores) isBanned(pid peer.PID, now time.Time) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	score, ok := p.scores[pid]
+	return ok && now.Before(score.bannedUntil)
+}
+
+// filterBanned returns the peers not banned.
+func (p *peerScores) filterBanned(pids []peer.PID, now time.Time) []peer.PID {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	result := make([]peer.PID, 0, len(pids))
+	for _, pid := range pids {
+		if score, ok := p.scores[pid]; ok && now.Before(score.bannedUntil) {
+			continue
+		}
+		result = append(result, pid)
+	}
+	return result
+}
+
+func (p *peerScores) dump(now time.Time) []*PeerScore {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	result := make([]*PeerScore, 0, len(p.scores))
+	for pid, score := range p.scores {
+		score.decay(now)
+		result = append(result, &PeerScore{
+			PID:         pid,
+			Score:       score.score,
+			LastReason:  score.lastReason,
+			Banned:      now.Before(score.bannedUntil),
+			BannedUntil: score.bannedUntil,
+			BanCount:    score.banCount,
+		})
+	}
+	return result
+}
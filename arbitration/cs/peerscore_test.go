@@ -0,0 +1,79 @@
+package cs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerScores_Penalize(t *testing.T) {
+	scores := newPeerScores(100, time.Hour, 0)
+	pid1, pid2 := peer.PID{1}, peer.PID{2}
+	now := time.Now()
+
+	for i := 0; i < 4; i++ {
+		assert.False(t, scores.penalize(pid1, PenaltyUndecodable, "undecodable", now))
+	}
+	assert.False(t, scores.isBanned(pid1, now))
+	assert.True(t, scores.penalize(pid1, PenaltyUndecodable, "undecodable", now))
+	assert.True(t, scores.isBanned(pid1, now))
+	assert.False(t, scores.isBanned(pid2, now))
+	assert.Equal(t, []peer.PID{pid2}, scores.filterBanned([]peer.PID{pid1, pid2}, now))
+
+	// penalties while banned do not ban again
+	assert.False(t, scores.penalize(pid1, 100, "undecodable", now))
+
+	later := now.Add(time.Hour)
+	assert.False(t, scores.isBanned(pid1, later))
+	assert.Equal(t, []peer.PID{pid1, pid2}, scores.filterBanned([]peer.PID{pid1, pid2}, later))
+
+	dump := scores.dump(later)
+	assert.Equal(t, 1, len(dump))
+	assert.Equal(t, uint32(1), dump[0].BanCount)
+	assert.Equal(t, "undecodable", dump[0].LastReason)
+}
+
+func TestPeerScores_Decay(t *testing.T) {
+	scores := newPeerScores(100, time.Hour, 0)
+	pid := peer.PID{1}
+	now := time.Now()
+
+	scores.penalize(pid, 80, "failed check", now)
+	now = now.Add(scoreHalfLife)
+	assert.False(t, scores.penalize(pid, 40, "failed check", now))
+	assert.Equal(t, uint32(80), scores.dump(now)[0].Score)
+
+	now = now.Add(100 * scoreHalfLife)
+	assert.Equal(t, uint32(0), scores.dump(now)[0].Score)
+}
+
+func TestPeerScores_Allow(t *testing.T) {
+	scores := newPeerScores(100, time.Hour, 3)
+	pid := peer.PID{1}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, scores.allow(pid, now))
+	}
+	assert.False(t, scores.allow(pid, now.Add(500*time.Millisecond)))
+	assert.True(t, scores.allow(pid, now.Add(time.Second)))
+	assert.True(t, scores.allow(peer.PID{2}, now))
+
+	assert.True(t, newPeerScores(100, time.Hour, 0).allow(pid, now))
+}
+
+func TestLargestMisbehavior(t *testing.T) {
+	assert.Nil(t, largestMisbehavior(nil))
+	assert.Nil(t, largestMisbehavior([]error{errors.New("can not find proposal")}))
+
+	misbehavior := largestMisbehavior([]error{
+		errors.New("can not find proposal"),
+		NewMisbehaviorError(PenaltyFailedCheck, errors.New("failed check")),
+		NewMisbehaviorError(PenaltyUndecodable, errors.New("undecodable")),
+	})
+	assert.Equal(t, PenaltyUndecodable, misbehavior.Penalty)
+	assert.Equal(t, "undecodable", misbehavior.Error())
+}
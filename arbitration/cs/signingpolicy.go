@@ -0,0 +1,327 @@
+package cs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+const (
+	// withdrawVolumeWindow is the rolling window of DailyWithdrawLimit.
+	withdrawVolumeWindow = 24 * time.Hour
+
+	// maxPolicyRejections is the count of the latest rejections kept.
+	maxPolicyRejections = 100
+)
+
+// PolicyRejection is a withdraw proposal refused by the signing policy.
+type PolicyRejection struct {
+	Time           int64  `json:"time"`
+	TxHash         string `json:"txhash"`
+	GenesisAddress string `json:"genesisaddress"`
+	Reason         string `json:"reason"`
+}
+
+type withdrawVolume struct {
+	time   time.Time
+	txHash common.Uint256
+	amount common.Fixed64
+}
+
+// SigningPolicy is the local policy of this arbiter checked before signing
+// withdraw proposals of other arbiters, it limits what a compromised arbiter
+// can get signed.
+type SigningPolicy struct {
+	mux        sync.Mutex
+	volumes    map[string][]*withdrawVolume
+	rejections []*PolicyRejection
+	// db persists the volumes signed so the daily limit holds across
+	// restarts, they are kept in memory only if it is nil.
+	db store.DataStoreSideChain
+}
+
+func NewSigningPolicy() *SigningPolicy {
+	return &SigningPolicy{
+		volumes: make(map[string][]*withdrawVolume),
+	}
+}
+
+// Load reloads the volumes signed within the window of DailyWithdrawLimit from
+// db, the volumes signed later are persisted into it.
+func (p *SigningPolicy) Load(db store.DataStoreSideChain) error {
+	return p.load(db, time.Now())
+}
+
+func (p *SigningPolicy) load(db store.DataStoreSideChain, now time.Time) error {
+	volumes, err := db.GetSignedWithdrawVolumes(now.Add(-withdrawVolumeWindow).Unix())
+	if err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.db = db
+	p.volumes = make(map[string][]*withdrawVolume)
+	for _, v := range volumes {
+		txHash, err := common.Uint256FromHexString(v.TransactionHash)
+		if err != nil {
+			continue
+		}
+		p.volumes[v.GenesisBlockAddress] = append(p.volumes[v.GenesisBlockAddress],
+			&withdrawVolume{time: time.Unix(v.SignTime, 0), txHash: *txHash, amount: v.Amount})
+	}
+	return nil
+}
+
+// CheckWithdrawTransaction checks the withdraw transaction against the
+// configured policy, the reason is recorded if it is rejected.
+func (p *SigningPolicy) CheckWithdrawTransaction(txn *types.Transaction,
+	clientFunc DistributedNodeClientFunc) error {
+	withdrawPayload, ok := txn.Payload.(*payload.WithdrawFromSideChain)
+	if !ok {
+		return errors.New("check signing policy failed, unknown payload type")
+	}
+	if err := p.verify(withdrawPayload, txn, clientFunc, time.Now()); err != nil {
+		p.reject(txn, withdrawPayload.GenesisBlockAddress, err)
+		return err
+	}
+	return nil
+}
+
+// RecordWithdrawTransaction adds the withdraw amount of the signed transaction
+// into the daily volume of its side chain.
+func (p *SigningPolicy) RecordWithdrawTransaction(txn *types.Transaction) {
+	p.record(txn, time.Now())
+}
+
+// GetRejections returns the latest rejections, the earliest first.
+func (p *SigningPolicy) GetRejections() []*PolicyRejection {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	rejections := make([]*PolicyRejection, len(p.rejections))
+	copy(rejections, p.rejections)
+	return rejections
+}
+
+// verify checks the withdraw transaction against the configured policy.
+func (p *SigningPolicy) verify(withdrawPayload *payload.WithdrawFromSideChain,
+	txn *types.Transaction, clientFunc DistributedNodeClientFunc, now time.Time) error {
+	policy := &clientFunc.GetArbitrator().GetConfig().SigningPolicy
+	var sourceTxAges map[string]uint32
+	if policy.MinSourceTxAge > 0 {
+		var err error
+		if sourceTxAges, err = getSourceTxAges(withdrawPayload, clientFunc); err != nil {
+			return err
+		}
+	}
+	return p.check(policy, txn, sourceTxAges, now)
+}
+
+// dryRun returns a copy of the policy with the volumes signed, checking and
+// recording withdraw transactions against the copy leaves the policy and its
+// db unchanged.
+func (p *SigningPolicy) dryRun() *SigningPolicy {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	policy := NewSigningPolicy()
+	for genesisAddress, volumes := range p.volumes {
+		policy.volumes[genesisAddress] = append([]*withdrawVolume(nil), volumes...)
+	}
+	return policy
+}
+
+func (p *SigningPolicy) check(policy *config.SigningPolicy, txn *types.Transaction,
+	sourceTxAges map[string]uint32, now time.Time) error {
+	withdrawPayload := txn.Payload.(*payload.WithdrawFromSideChain)
+	genesisProgramHash, err := common.Uint168FromAddress(withdrawPayload.GenesisBlockAddress)
+	if err != nil {
+		return errors.New("invalid genesis block address")
+	}
+
+	allowed := make(map[string]struct{})
+	for _, addr := range policy.AllowedAddresses {
+		allowed[addr] = struct{}{}
+	}
+	denied := make(map[string]struct{})
+	for _, addr := range policy.DeniedAddresses {
+		denied[addr] = struct{}{}
+	}
+
+	var total common.Fixed64
+	for _, output := range txn.Outputs {
+		if output.ProgramHash.IsEqual(*genesisProgramHash) {
+			continue
+		}
+		addr, err := output.ProgramHash.ToAddress()
+		if err != nil {
+			return errors.New("invalid withdraw output address")
+		}
+		if _, ok := denied[addr]; ok {
+			return fmt.Errorf("withdraw to denied address %s", addr)
+		}
+		if _, ok := allowed[addr]; len(allowed) != 0 && !ok {
+			return fmt.Errorf("withdraw to address %s not allowed", addr)
+		}
+		if policy.MaxWithdrawOutputAmount > 0 &&
+			output.Value > common.Fixed64(policy.MaxWithdrawOutputAmount) {
+			return fmt.Errorf("withdraw output amount %s to %s exceeds limit",
+				output.Value.String(), addr)
+		}
+		total += output.Value
+	}
+
+	if policy.MaxWithdrawTxAmount > 0 && total > common.Fixed64(policy.MaxWithdrawTxAmount) {
+		return fmt.Errorf("withdraw amount %s exceeds limit", total.String())
+	}
+
+	if policy.DailyWithdrawLimit > 0 {
+		volume := p.getVolume(withdrawPayload.GenesisBlockAddress, txn.Hash(), now)
+		if volume+total > common.Fixed64(policy.DailyWithdrawLimit) {
+			return fmt.Errorf("withdraw amount %s exceeds daily limit, signed %s",
+				total.String(), volume.String())
+		}
+	}
+
+	if policy.MinSourceTxAge > 0 {
+		for _, hash := range withdrawPayload.SideChainTransactionHashes {
+			age, ok := sourceTxAges[hash.String()]
+			if !ok {
+				return fmt.Errorf("side chain transaction %s not found", hash.String())
+			}
+			if age < policy.MinSourceTxAge {
+				return fmt.Errorf("side chain transaction %s age %d is too young",
+					hash.String(), age)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getVolume returns the amount signed of the side chain within the window,
+// not including the given transaction signed before.
+func (p *SigningPolicy) getVolume(genesisAddress string, txHash common.Uint256,
+	now time.Time) common.Fixed64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	var volume common.Fixed64
+	for _, v := range p.volumes[genesisAddress] {
+		if now.Sub(v.time) < withdrawVolumeWindow && !v.txHash.IsEqual(txHash) {
+			volume += v.amount
+		}
+	}
+	return volume
+}
+
+func (p *SigningPolicy) record(txn *types.Transaction, now time.Time) {
+	withdrawPayload, ok := txn.Payload.(*payload.WithdrawFromSideChain)
+	if !ok {
+		return
+	}
+	genesisProgramHash, err := common.Uint168FromAddress(withdrawPayload.GenesisBlockAddress)
+	if err != nil {
+		return
+	}
+	var total common.Fixed64
+	for _, output := range txn.Outputs {
+		if !output.ProgramHash.IsEqual(*genesisProgramHash) {
+			total += output.Value
+		}
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	txHash := txn.Hash()
+	var volumes []*withdrawVolume
+	for _, v := range p.volumes[withdrawPayload.GenesisBlockAddress] {
+		if now.Sub(v.time) < withdrawVolumeWindow && !v.txHash.IsEqual(txHash) {
+			volumes = append(volumes, v)
+		}
+	}
+	p.volumes[withdrawPayload.GenesisBlockAddress] = append(volumes,
+		&withdrawVolume{time: now, txHash: txHash, amount: total})
+
+	if p.db == nil {
+		return
+	}
+	err = p.db.AddSignedWithdrawVolume(&store.SignedWithdrawVolume{
+		TransactionHash:     txHash.String(),
+		GenesisBlockAddress: withdrawPayload.GenesisBlockAddress,
+		Amount:              total,
+		SignTime:            now.Unix(),
+	})
+	if err == nil {
+		err = p.db.RemoveSignedWithdrawVolumes(now.Add(-withdrawVolumeWindow).Unix())
+	}
+	if err != nil {
+		log.Withdraw.Error("[SigningPolicy] persist signed withdraw volume failed",
+			log.Chain(withdrawPayload.GenesisBlockAddress), log.Proposal(txHash.String()), log.Err(err))
+	}
+}
+
+func (p *SigningPolicy) reject(txn *types.Transaction, genesisAddress string, reason error) {
+	log.Withdraw.Warn("[SigningPolicy] reject withdraw transaction", log.Chain(genesisAddress),
+		log.Proposal(txn.Hash().String()), log.F("reason", reason.Error()))
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.rejections = append(p.rejections, &PolicyRejection{
+		Time:           time.Now().Unix(),
+		TxHash:         txn.Hash().String(),
+		GenesisAddress: genesisAddress,
+		Reason:         reason.Error(),
+	})
+	if len(p.rejections) > maxPolicyRejections {
+		p.rejections = p.rejections[len(p.rejections)-maxPolicyRejections:]
+	}
+}
+
+// getSourceTxAges returns the count of side chain blocks since the side chain
+// withdraw transactions were packed, transactions not scanned by this arbiter
+// are not in the result.
+func getSourceTxAges(withdrawPayload *payload.WithdrawFromSideChain,
+	clientFunc DistributedNodeClientFunc) (map[string]uint32, error) {
+	sideChain, _, err := clientFunc.GetSideChainAndExchangeRate(withdrawPayload.GenesisBlockAddress)
+	if err != nil {
+		return nil, err
+	}
+	currentHeight, err := sideChain.GetCurrentHeight()
+	if err != nil {
+		return nil, errors.New("get side chain height failed: " + err.Error())
+	}
+
+	var hashes []string
+	for _, hash := range withdrawPayload.SideChainTransactionHashes {
+		hashes = append(hashes, hash.String())
+	}
+	heights, err := clientFunc.GetArbitrator().GetDataStore().SideChainStore.GetSideChainTxHeights(
+		hashes, withdrawPayload.GenesisBlockAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	ages := make(map[string]uint32)
+	for hash, height := range heights {
+		if currentHeight > height {
+			ages[hash] = currentHeight - height
+		} else {
+			ages[hash] = 0
+		}
+	}
+	return ages, nil
+}
@@ -0,0 +1,183 @@
+package cs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testGenesisAddress = "XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ"
+	testAddress1       = "ETcwuryQ3MfGWW1UyPrXx3UfEfAygBoM7J"
+	testAddress2       = "EbgLkYci91V9VMzyBnCs2kLYVuXHfCTkd6"
+)
+
+func newTestWithdrawTx(t *testing.T, lockTime uint32, hashes []common.Uint256,
+	amounts map[string]common.Fixed64) *types.Transaction {
+	txn := &types.Transaction{
+		TxType:   types.WithdrawFromSideChain,
+		LockTime: lockTime,
+		Payload: &payload.WithdrawFromSideChain{
+			GenesisBlockAddress:        testGenesisAddress,
+			SideChainTransactionHashes: hashes,
+		},
+	}
+	for addr, amount := range amounts {
+		programHash, err := common.Uint168FromAddress(addr)
+		assert.NoError(t, err)
+		txn.Outputs = append(txn.Outputs, &types.Output{
+			AssetID:     base.SystemAssetId,
+			ProgramHash: *programHash,
+			Value:       amount,
+		})
+	}
+
+	// change goes back to the genesis address and is not a withdraw
+	programHash, _ := common.Uint168FromAddress(testGenesisAddress)
+	txn.Outputs = append(txn.Outputs, &types.Output{
+		AssetID:     base.SystemAssetId,
+		ProgramHash: *programHash,
+		Value:       100000,
+	})
+	return txn
+}
+
+func TestSigningPolicy_Amounts(t *testing.T) {
+	p := NewSigningPolicy()
+	policy := &config.SigningPolicy{
+		MaxWithdrawOutputAmount: 100,
+		MaxWithdrawTxAmount:     150,
+	}
+	now := time.Now()
+
+	txn := newTestWithdrawTx(t, 0, nil, map[string]common.Fixed64{testAddress1: 100, testAddress2: 50})
+	assert.NoError(t, p.check(policy, txn, nil, now))
+
+	txn = newTestWithdrawTx(t, 0, nil, map[string]common.Fixed64{testAddress1: 101})
+	assert.Error(t, p.check(policy, txn, nil, now))
+
+	txn = newTestWithdrawTx(t, 0, nil, map[string]common.Fixed64{testAddress1: 100, testAddress2: 51})
+	assert.Error(t, p.check(policy, txn, nil, now))
+}
+
+func TestSigningPolicy_DailyLimit(t *testing.T) {
+	p := NewSigningPolicy()
+	policy := &config.SigningPolicy{DailyWithdrawLimit: 100}
+	now := time.Now()
+
+	txn1 := newTestWithdrawTx(t, 1, nil, map[string]common.Fixed64{testAddress1: 60})
+	assert.NoError(t, p.check(policy, txn1, nil, now))
+	p.record(txn1, now)
+
+	// signing the same transaction again is not counted twice
+	assert.NoError(t, p.check(policy, txn1, nil, now))
+	p.record(txn1, now)
+
+	txn2 := newTestWithdrawTx(t, 2, nil, map[string]common.Fixed64{testAddress1: 50})
+	assert.Error(t, p.check(policy, txn2, nil, now))
+
+	// the volume out of the window is released
+	later := now.Add(withdrawVolumeWindow)
+	assert.NoError(t, p.check(policy, txn2, nil, later))
+}
+
+// testVolumeStore keeps the signed withdraw volumes in memory.
+type testVolumeStore struct {
+	store.DataStoreSideChain
+	volumes map[string]*store.SignedWithdrawVolume
+}
+
+func (s *testVolumeStore) AddSignedWithdrawVolume(volume *store.SignedWithdrawVolume) error {
+	s.volumes[volume.TransactionHash] = volume
+	return nil
+}
+
+func (s *testVolumeStore) RemoveSignedWithdrawVolumes(before int64) error {
+	for hash, volume := range s.volumes {
+		if volume.SignTime < before {
+			delete(s.volumes, hash)
+		}
+	}
+	return nil
+}
+
+func (s *testVolumeStore) GetSignedWithdrawVolumes(since int64) ([]*store.SignedWithdrawVolume, error) {
+	var volumes []*store.SignedWithdrawVolume
+	for _, volume := range s.volumes {
+		if volume.SignTime >= since {
+			volumes = append(volumes, volume)
+		}
+	}
+	return volumes, nil
+}
+
+func TestSigningPolicy_LoadVolumes(t *testing.T) {
+	db := &testVolumeStore{volumes: make(map[string]*store.SignedWithdrawVolume)}
+	policy := &config.SigningPolicy{DailyWithdrawLimit: 100}
+	now := time.Now()
+	earlier := now.Add(-withdrawVolumeWindow / 2)
+
+	p := NewSigningPolicy()
+	assert.NoError(t, p.load(db, earlier))
+	txn1 := newTestWithdrawTx(t, 1, nil, map[string]common.Fixed64{testAddress1: 30})
+	p.record(txn1, earlier)
+	txn2 := newTestWithdrawTx(t, 2, nil, map[string]common.Fixed64{testAddress1: 60})
+	p.record(txn2, now)
+	assert.Len(t, db.volumes, 2)
+
+	// the volumes signed within the window are reloaded after restarting
+	p = NewSigningPolicy()
+	assert.NoError(t, p.load(db, now))
+	txn3 := newTestWithdrawTx(t, 3, nil, map[string]common.Fixed64{testAddress1: 50})
+	assert.Error(t, p.check(policy, txn3, nil, now))
+	assert.NoError(t, p.check(policy, txn2, nil, now))
+
+	// the volumes out of the window are removed
+	later := now.Add(withdrawVolumeWindow/2 + time.Second)
+	p.record(txn3, later)
+	assert.Len(t, db.volumes, 2)
+	assert.Nil(t, db.volumes[txn1.Hash().String()])
+}
+
+func TestSigningPolicy_Addresses(t *testing.T) {
+	p := NewSigningPolicy()
+	now := time.Now()
+	txn := newTestWithdrawTx(t, 0, nil, map[string]common.Fixed64{testAddress1: 10})
+
+	policy := &config.SigningPolicy{DeniedAddresses: []string{testAddress1}}
+	assert.Error(t, p.check(policy, txn, nil, now))
+
+	policy = &config.SigningPolicy{AllowedAddresses: []string{testAddress2}}
+	assert.Error(t, p.check(policy, txn, nil, now))
+
+	policy = &config.SigningPolicy{AllowedAddresses: []string{testAddress1, testAddress2}}
+	assert.NoError(t, p.check(policy, txn, nil, now))
+}
+
+func TestSigningPolicy_MinSourceTxAge(t *testing.T) {
+	p := NewSigningPolicy()
+	policy := &config.SigningPolicy{MinSourceTxAge: 6}
+	now := time.Now()
+
+	hash1 := common.Uint256{1}
+	hash2 := common.Uint256{2}
+	txn := newTestWithdrawTx(t, 0, []common.Uint256{hash1, hash2},
+		map[string]common.Fixed64{testAddress1: 10})
+
+	ages := map[string]uint32{hash1.String(): 6, hash2.String(): 10}
+	assert.NoError(t, p.check(policy, txn, ages, now))
+
+	ages[hash2.String()] = 5
+	assert.Error(t, p.check(policy, txn, ages, now))
+
+	delete(ages, hash2.String())
+	assert.Error(t, p.check(policy, txn, ages, now))
+}
@@ -0,0 +1,352 @@
+package cs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+)
+
+const (
+	// maxStatusMessageSize is the max size of a serialized status message.
+	maxStatusMessageSize = 64 * 1024
+
+	// maxStatusSideChains is the max count of side chains in a status.
+	maxStatusSideChains = 256
+)
+
+// SideChainHeight is the height a side chain is synced to.
+type SideChainHeight struct {
+	GenesisBlockAddress string
+	Height              uint32
+}
+
+// ArbiterStatus is the status an arbiter broadcasts to the other arbiters
+// periodically, signed by the arbiter.
+type ArbiterStatus struct {
+	PID              peer.PID
+	Version          string
+	MainChainHeight  uint32
+	SideChainHeights []SideChainHeight
+
+	// OnDutyArbiter and ArbitersHash are the view of the arbiter on the
+	// current arbiter set, ArbitersHash is the hash of the public keys in
+	// duty order.
+	OnDutyArbiter string
+	ArbitersCount uint32
+	ArbitersHash  common.Uint256
+
+	PendingDeposits  uint32
+	PendingWithdraws uint32
+	Timestamp        int64
+
+	Signature []byte
+}
+
+func (s *ArbiterStatus) serializeUnsigned(w io.Writer) error {
+	if _, err := w.Write(s.PID[:]); err != nil {
+		return err
+	}
+	if err := common.WriteVarString(w, s.Version); err != nil {
+		return err
+	}
+	if err := common.WriteUint32(w, s.MainChainHeight); err != nil {
+		return err
+	}
+	if err := common.WriteVarUint(w, uint64(len(s.SideChainHeights))); err != nil {
+		return err
+	}
+	for _, h := range s.SideChainHeights {
+		if err := common.WriteVarString(w, h.GenesisBlockAddress); err != nil {
+			return err
+		}
+		if err := common.WriteUint32(w, h.Height); err != nil {
+			return err
+		}
+	}
+	if err := common.WriteVarString(w, s.OnDutyArbiter); err != nil {
+		return err
+	}
+	if err := common.WriteUint32(w, s.ArbitersCount); err != nil {
+		return err
+	}
+	if err := s.ArbitersHash.Serialize(w); err != nil {
+		return err
+	}
+	if err := common.WriteUint32(w, s.PendingDeposits); err != nil {
+		return err
+	}
+	if err := common.WriteUint32(w, s.PendingWithdraws); err != nil {
+		return err
+	}
+	return common.WriteUint64(w, uint64(s.Timestamp))
+}
+
+func (s *ArbiterStatus) deserializeUnsigned(r io.Reader) error {
+	if _, err := io.ReadFull(r, s.PID[:]); err != nil {
+		return err
+	}
+	var err error
+	if s.Version, err = common.ReadVarString(r); err != nil {
+		return err
+	}
+	if s.MainChainHeight, err = common.ReadUint32(r); err != nil {
+		return err
+	}
+	count, err := common.ReadVarUint(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > maxStatusSideChains {
+		return errors.New("too many side chains in status")
+	}
+	s.SideChainHeights = make([]SideChainHeight, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var h SideChainHeight
+		if h.GenesisBlockAddress, err = common.ReadVarString(r); err != nil {
+			return err
+		}
+		if h.Height, err = common.ReadUint32(r); err != nil {
+			return err
+		}
+		s.SideChainHeights = append(s.SideChainHeights, h)
+	}
+	if s.OnDutyArbiter, err = common.ReadVarString(r); err != nil {
+		return err
+	}
+	if s.ArbitersCount, err = common.ReadUint32(r); err != nil {
+		return err
+	}
+	if err := s.ArbitersHash.Deserialize(r); err != nil {
+		return err
+	}
+	if s.PendingDeposits, err = common.ReadUint32(r); err != nil {
+		return err
+	}
+	if s.PendingWithdraws, err = common.ReadUint32(r); err != nil {
+		return err
+	}
+	timestamp, err := common.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	s.Timestamp = int64(timestamp)
+	return nil
+}
+
+func (s *ArbiterStatus) unsignedData() []byte {
+	buf := new(bytes.Buffer)
+	s.serializeUnsigned(buf)
+	return buf.Bytes()
+}
+
+// Sign signs the status by the arbiter.
+func (s *ArbiterStatus) Sign(arbiter arbitrator.Arbitrator) error {
+	signature, err := arbiter.Sign(s.unsignedData())
+	if err != nil {
+		return err
+	}
+	s.Signature = signature
+	return nil
+}
+
+// Verify checks the status is signed by the arbiter of its PID.
+func (s *ArbiterStatus) Verify() error {
+	pk, err := crypto.DecodePoint(s.PID[:])
+	if err != nil {
+		return errors.New("invalid public key of status: " + err.Error())
+	}
+	return crypto.Verify(*pk, s.unsignedData(), s.Signature)
+}
+
+type StatusMessage struct {
+	Status ArbiterStatus
+}
+
+func (s *StatusMessage) CMD() string {
+	return StatusCommand
+}
+
+func (s *StatusMessage) MaxLength() uint32 {
+	return maxStatusMessageSize
+}
+
+func (s *StatusMessage) Serialize(w io.Writer) error {
+	if err := s.Status.serializeUnsigned(w); err != nil {
+		return err
+	}
+	return common.WriteVarBytes(w, s.Status.Signature)
+}
+
+func (s *StatusMessage) Deserialize(r io.Reader) error {
+	if err := s.Status.deserializeUnsigned(r); err != nil {
+		return err
+	}
+	signature, err := common.ReadVarBytes(r, crypto.SignatureLength, "Signature")
+	if err != nil {
+		return err
+	}
+	s.Status.Signature = signature
+	return nil
+}
+
+// PeerStatus is the latest status received from an arbiter peer.
+type PeerStatus struct {
+	ArbiterStatus
+	ReceivedTime time.Time
+}
+
+// peerStatuses keeps the latest status of each arbiter peer.
+type peerStatuses struct {
+	mux      sync.RWMutex
+	statuses map[peer.PID]*PeerStatus
+}
+
+func newPeerStatuses() *peerStatuses {
+	return &peerStatuses{statuses: make(map[peer.PID]*PeerStatus)}
+}
+
+// update verifies the status received from the peer and keeps it if it is
+// newer than the kept one.
+func (p *peerStatuses) update(pid peer.PID, status *ArbiterStatus) error {
+	if !bytes.Equal(pid[:], status.PID[:]) {
+		return NewMisbehaviorError(PenaltyFailedCheck,
+			errors.New("status is not of the sending peer"))
+	}
+	if err := status.Verify(); err != nil {
+		return NewMisbehaviorError(PenaltyInvalidSignature,
+			errors.New("invalid status signature: "+err.Error()))
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if old, ok := p.statuses[pid]; ok && old.Timestamp >= status.Timestamp {
+		return errors.New("status is not newer than the kept one")
+	}
+	p.statuses[pid] = &PeerStatus{ArbiterStatus: *status, ReceivedTime: time.Now()}
+	return nil
+}
+
+func (p *peerStatuses) get(pid peer.PID) (*PeerStatus, bool) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	status, ok := p.statuses[pid]
+	return status, ok
+}
+
+// arbitersHash returns the hash of the arbiter public keys in duty order.
+func arbitersHash(arbiters []string) common.Uint256 {
+	buf := new(bytes.Buffer)
+	for _, arbiter := range arbiters {
+		common.WriteVarString(buf, arbiter)
+	}
+	return common.Hash(buf.Bytes())
+}
+
+// newArbiterStatus collects and signs the current status of the arbiter.
+func (n *ArbitratorsNetwork) newArbiterStatus() (*ArbiterStatus, error) {
+	currentArbitrator := n.arbitrator
+	group := currentArbitrator.GetArbitratorGroup()
+	dataStore := currentArbitrator.GetDataStore()
+	pk, err := currentArbitrator.GetPublicKey().EncodePoint(true)
+	if err != nil {
+		return nil, err
+	}
+	status := &ArbiterStatus{
+		Version:         config.NodePrefix + config.Version,
+		MainChainHeight: group.GetCurrentHeight(),
+		Timestamp:       time.Now().Unix(),
+	}
+	copy(status.PID[:], pk)
+
+	for _, node := range currentArbitrator.GetConfig().SideNodeList {
+		status.SideChainHeights = append(status.SideChainHeights, SideChainHeight{
+			GenesisBlockAddress: node.GenesisBlockAddress,
+			Height: dataStore.SideChainStore.CurrentSideHeight(
+				node.GenesisBlockAddress, store.QueryHeightCode),
+		})
+	}
+
+	arbiters := group.GetAllArbitrators()
+	status.OnDutyArbiter, _ = group.GetOnDutyArbitratorOfMain()
+	status.ArbitersCount = uint32(len(arbiters))
+	status.ArbitersHash = arbitersHash(arbiters)
+
+	depositHashes, _, err := dataStore.MainChainStore.GetAllMainChainTxHashes()
+	if err != nil {
+		return nil, err
+	}
+	status.PendingDeposits = uint32(len(depositHashes))
+	withdrawHashes, err := dataStore.SideChainStore.GetAllSideChainTxHashes()
+	if err != nil {
+		return nil, err
+	}
+	status.PendingWithdraws = uint32(len(withdrawHashes))
+
+	if err := status.Sign(currentArbitrator); err != nil {
+		return nil, err
+	}
+	err = currentArbitrator.GetAuditLog().RecordSignature(audit.TypeStatus, status.unsignedData(), map[string]string{
+		"height":    strconv.FormatUint(uint64(status.MainChainHeight), 10),
+		"timestamp": strconv.FormatInt(status.Timestamp, 10),
+	}, common.BytesToHexString(pk), audit.DecisionUnchecked)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// BroadcastStatusLoop broadcasts the status of the arbiter to the other
+// arbiters every StatusBroadcastInterval if EnableStatusBroadcast is set.
+func (n *ArbitratorsNetwork) BroadcastStatusLoop(ctx context.Context) {
+	cfg := n.arbitrator.GetConfig()
+	if !cfg.EnableStatusBroadcast || cfg.StatusBroadcastInterval <= 0 {
+		log.P2P.Info("[BroadcastStatusLoop] status broadcast disabled")
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * cfg.StatusBroadcastInterval):
+		}
+		if err := n.BroadcastStatus(); err != nil {
+			log.P2P.Warn("[BroadcastStatusLoop] collect status failed", log.Err(err))
+		}
+	}
+}
+
+// BroadcastStatus broadcasts the status of the arbiter to the other arbiters
+// once.
+func (n *ArbitratorsNetwork) BroadcastStatus() error {
+	status, err := n.newArbiterStatus()
+	if err != nil {
+		return err
+	}
+	n.p2pServer.BroadcastMessage(&StatusMessage{Status: *status})
+	return nil
+}
+
+// GetPeerStatus returns the latest status received from the arbiter peer.
+func (n *ArbitratorsNetwork) GetPeerStatus(pid peer.PID) (*PeerStatus, bool) {
+	return n.peerStatuses.get(pid)
+}
+
+// CurrentArbitersHash returns the hash of the current arbiter set in view of
+// this arbiter, to compare with the ones of peer statuses.
+func (n *ArbitratorsNetwork) CurrentArbitersHash() common.Uint256 {
+	return arbitersHash(n.arbitrator.GetArbitratorGroup().GetAllArbitrators())
+}
@@ -0,0 +1,96 @@
+package cs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSign signs like crypto.Sign, with the public key of the private key
+// set as newer ecdsa requires.
+func testSign(t *testing.T, privateKey []byte, data []byte) []byte {
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(privateKey)}
+	key.Curve = crypto.DefaultCurve
+	key.X, key.Y = crypto.DefaultCurve.ScalarBaseMult(privateKey)
+
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	signature := make([]byte, crypto.SignatureLength)
+	copy(signature[crypto.SignerLength-len(r.Bytes()):], r.Bytes())
+	copy(signature[crypto.SignatureLength-len(s.Bytes()):], s.Bytes())
+	return signature
+}
+
+func newTestStatus(t *testing.T, timestamp int64) (*ArbiterStatus, []byte) {
+	privateKey, publicKey, err := crypto.GenerateKeyPair()
+	assert.NoError(t, err)
+	pk, err := publicKey.EncodePoint(true)
+	assert.NoError(t, err)
+
+	status := &ArbiterStatus{
+		Version:         "v0.0.1",
+		MainChainHeight: 1000,
+		SideChainHeights: []SideChainHeight{
+			{GenesisBlockAddress: testGenesisAddress, Height: 500},
+		},
+		OnDutyArbiter:    "02a3bb9ee5d2a4d1d2c1c6c0e0a0d3b1ce2e9d7a83c8c0e7b1a5d6e4c2b1a0f9e8",
+		ArbitersCount:    12,
+		ArbitersHash:     arbitersHash([]string{"a", "b"}),
+		PendingDeposits:  3,
+		PendingWithdraws: 4,
+		Timestamp:        timestamp,
+	}
+	copy(status.PID[:], pk)
+	status.Signature = testSign(t, privateKey, status.unsignedData())
+	return status, privateKey
+}
+
+func TestStatusMessage_Serialize(t *testing.T) {
+	status, _ := newTestStatus(t, 100)
+	msg := &StatusMessage{Status: *status}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, msg.Serialize(buf))
+	assert.True(t, uint32(buf.Len()) <= msg.MaxLength())
+
+	decoded := &StatusMessage{}
+	assert.NoError(t, decoded.Deserialize(buf))
+	assert.Equal(t, *status, decoded.Status)
+	assert.NoError(t, decoded.Status.Verify())
+
+	decoded.Status.PendingDeposits++
+	assert.Error(t, decoded.Status.Verify())
+}
+
+func TestPeerStatuses_Update(t *testing.T) {
+	statuses := newPeerStatuses()
+	status, privateKey := newTestStatus(t, 100)
+
+	assert.Error(t, statuses.update(peer.PID{}, status))
+	_, ok := statuses.get(status.PID)
+	assert.False(t, ok)
+
+	assert.NoError(t, statuses.update(status.PID, status))
+	kept, ok := statuses.get(status.PID)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1000), kept.MainChainHeight)
+
+	// replayed or older statuses are dropped
+	assert.Error(t, statuses.update(status.PID, status))
+
+	newer := *status
+	newer.Timestamp = 200
+	newer.MainChainHeight = 1001
+	assert.Error(t, statuses.update(status.PID, &newer))
+	newer.Signature = testSign(t, privateKey, newer.unsignedData())
+	assert.NoError(t, statuses.update(status.PID, &newer))
+	kept, _ = statuses.get(status.PID)
+	assert.Equal(t, uint32(1001), kept.MainChainHeight)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/store"
 
@@ -20,6 +21,10 @@ import (
 
 type TxDistributedContent struct {
 	Tx *types.Transaction
+
+	// ParentArbitrator is the arbitrator proposing the transaction, it
+	// submits the transaction once enough arbiters signed it.
+	ParentArbitrator arbitrator.Arbitrator
 }
 
 func (d *TxDistributedContent) InitSign(newSign []byte) error {
@@ -33,16 +38,27 @@ func (d *TxDistributedContent) Submit() error {
 		return errors.New("received proposal feed back but withdraw transaction has invalid payload")
 	}
 
-	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
-	resp, err := currentArbitrator.SendWithdrawTransaction(d.Tx)
+	resp, err := d.ParentArbitrator.SendWithdrawTransaction(d.Tx)
+	logger := log.Withdraw.With(log.Proposal(d.Tx.Hash().String()))
+	if len(withdrawPayload.SideChainTransactionHashes) == 0 {
+		if err != nil || resp.Error != nil {
+			logger.Warn("send consolidate transaction failed", log.F("code", resp.Code),
+				log.F("result", resp.Result), log.Err(err))
+		} else {
+			logger.Info("send consolidate transaction succeed")
+		}
+		return nil
+	}
 
 	var transactionHashes []string
 	for _, hash := range withdrawPayload.SideChainTransactionHashes {
 		transactionHashes = append(transactionHashes, hash.String())
 	}
+	logger = logger.With(log.F("txhashes", transactionHashes))
 
 	if err != nil || resp.Error != nil && resp.Code != MCErrDoubleSpend {
-		log.Warn("send withdraw transaction failed, move to finished db, txHash:", d.Tx.Hash().String(), ", code: ", resp.Code, ", result:", resp.Result)
+		logger.Warn("send withdraw transaction failed, move to finished db", log.F("code", resp.Code),
+			log.F("result", resp.Result), log.Err(err))
 
 		buf := new(bytes.Buffer)
 		err := d.Tx.Serialize(buf)
@@ -50,35 +66,36 @@ func (d *TxDistributedContent) Submit() error {
 			return errors.New("send withdraw transaction faild, invalid transaction")
 		}
 
-		err = store.DbCache.SideChainStore.RemoveSideChainTxs(transactionHashes)
+		err = d.ParentArbitrator.GetDataStore().SideChainStore.RemoveSideChainTxs(transactionHashes)
 		if err != nil {
 			return errors.New("remove failed withdraw transaction from db failed")
 		}
-		err = store.FinishedTxsDbCache.AddFailedWithdrawTxs(transactionHashes, buf.Bytes())
+		err = d.ParentArbitrator.GetFinishedTxsStore().AddFailedWithdrawTxs(transactionHashes, buf.Bytes())
 		if err != nil {
 			return errors.New("add failed withdraw transaction into finished db failed")
 		}
 	} else if resp.Error == nil && resp.Result != nil || resp.Error != nil && resp.Code == MCErrSidechainTxDuplicate {
 		if resp.Error != nil {
-			log.Info("send withdraw transaction found has been processed, move to finished db, txHash:", d.Tx.Hash().String())
+			logger.Info("send withdraw transaction found has been processed, move to finished db")
 		} else {
-			log.Info("send withdraw transaction succeed, move to finished db, txHash:", d.Tx.Hash().String())
+			logger.Info("send withdraw transaction succeed, move to finished db")
 		}
 		var newUsedUtxos []types.OutPoint
 		for _, input := range d.Tx.Inputs {
 			newUsedUtxos = append(newUsedUtxos, input.Previous)
 		}
 
-		err = store.DbCache.SideChainStore.RemoveSideChainTxs(transactionHashes)
+		err = d.ParentArbitrator.GetDataStore().SideChainStore.RemoveSideChainTxs(transactionHashes)
 		if err != nil {
 			return errors.New("remove succeed withdraw transaction from db failed")
 		}
-		err = store.FinishedTxsDbCache.AddSucceedWithdrawTxs(transactionHashes)
+		err = d.ParentArbitrator.GetFinishedTxsStore().AddSucceedWithdrawTxs(transactionHashes)
 		if err != nil {
 			return errors.New("add succeed withdraw transaction into finished db failed")
 		}
 	} else {
-		log.Warn("send withdraw transaction failed, need to resend")
+		logger.Warn("send withdraw transaction failed, need to resend", log.F("code", resp.Code),
+			log.F("result", resp.Result))
 	}
 
 	return nil
@@ -113,8 +130,9 @@ func (d *TxDistributedContent) Check(client interface{}) error {
 	if !ok {
 		return errors.New("unknown client function")
 	}
-	mainFunc := &arbitrator.MainChainFuncImpl{}
-	err := checkWithdrawTransaction(d.Tx, clientFunc, mainFunc)
+	mainFunc := &arbitrator.MainChainFuncImpl{ParentArbitrator: clientFunc.GetArbitrator()}
+	err := checkWithdrawTransaction(d.Tx, clientFunc, mainFunc,
+		arbitrator.SideChain.CheckHeldWithdrawTxs)
 	if err != nil {
 		return err
 	}
@@ -149,11 +167,31 @@ func (d *TxDistributedContent) Hash() common.Uint256 {
 	return d.Tx.Hash()
 }
 
-func checkWithdrawTransaction(txn *types.Transaction,
-	clientFunc DistributedNodeClientFunc, mainFunc *arbitrator.MainChainFuncImpl) error {
+// checkWithdrawTransaction checks the withdraw transaction, checkHeld checks
+// if any of the side chain withdraw transactions waits for approval. The
+// failures regardless of the state of this arbiter, such as a malformed
+// payload or outputs, are returned as misbehavior errors.
+func checkWithdrawTransaction(txn *types.Transaction, clientFunc DistributedNodeClientFunc,
+	mainFunc *arbitrator.MainChainFuncImpl,
+	checkHeld func(arbitrator.SideChain, []*base.WithdrawTx) error) error {
 	payloadWithdraw, ok := txn.Payload.(*payload.WithdrawFromSideChain)
 	if !ok {
-		return errors.New("check withdraw transaction failed, unknown payload type")
+		return NewMisbehaviorError(PenaltyFailedCheck,
+			errors.New("check withdraw transaction failed, unknown payload type"))
+	}
+	if _, err := common.Uint168FromAddress(payloadWithdraw.GenesisBlockAddress); err != nil {
+		return NewMisbehaviorError(PenaltyFailedCheck, errors.New("check withdraw transaction "+
+			"failed, genesis block address to program hash failed"))
+	}
+	for _, output := range txn.Outputs {
+		if output.AssetID != base.SystemAssetId {
+			return NewMisbehaviorError(PenaltyFailedCheck,
+				errors.New("check withdraw transaction failed, invalid asset id"))
+		}
+		if output.OutputLock != 0 {
+			return NewMisbehaviorError(PenaltyFailedCheck,
+				errors.New("check withdraw transaction failed, invalid output lock"))
+		}
 	}
 
 	// check if side chain exist.
@@ -162,55 +200,20 @@ func checkWithdrawTransaction(txn *types.Transaction,
 		return err
 	}
 
-	var transactionHashes []string
-	for _, hash := range payloadWithdraw.SideChainTransactionHashes {
-		transactionHashes = append(transactionHashes, hash.String())
+	if len(payloadWithdraw.SideChainTransactionHashes) == 0 {
+		return checkConsolidateTransaction(txn, mainFunc.ParentArbitrator.GetConfig(), mainFunc)
 	}
 
-	// check if withdraw transactions exist in db, if not found then will check
-	// by the rpc interface of the side chain.
-	var txs []*base.WithdrawTx
-	sideChainTxs, err := store.DbCache.SideChainStore.GetSideChainTxsFromHashesAndGenesisAddress(
-		transactionHashes, payloadWithdraw.GenesisBlockAddress)
-	if err != nil || len(sideChainTxs) != len(payloadWithdraw.SideChainTransactionHashes) {
-		log.Info("[checkWithdrawTransaction], need to get side chain transaction from rpc")
-		for _, txHash := range payloadWithdraw.SideChainTransactionHashes {
-			tx, err := sideChain.GetWithdrawTransaction(txHash.String())
-			if err != nil {
-				return errors.New("[checkWithdrawTransaction] failed, unknown side chain transactions")
-			}
-
-			txID, err := common.Uint256FromHexString(tx.TxID)
-			if err != nil {
-				return errors.New("[checkWithdrawTransaction] failed, invalid txID")
-			}
-
-			var withdrawAssets []*base.WithdrawAsset
-			for _, cs := range tx.CrossChainAssets {
-				csAmount, err := common.StringToFixed64(cs.CrossChainAmount)
-				if err != nil {
-					return errors.New("[checkWithdrawTransaction] invalid cross chain amount in tx")
-				}
-				opAmount, err := common.StringToFixed64(cs.OutputAmount)
-				if err != nil {
-					return errors.New("[checkWithdrawTransaction] invalid output amount in tx")
-				}
-				withdrawAssets = append(withdrawAssets, &base.WithdrawAsset{
-					TargetAddress:    cs.CrossChainAddress,
-					Amount:           opAmount,
-					CrossChainAmount: csAmount,
-				})
-			}
+	txs, err := getWithdrawTxs(clientFunc.GetArbitrator().GetDataStore().SideChainStore,
+		sideChain, payloadWithdraw.GenesisBlockAddress,
+		payloadWithdraw.SideChainTransactionHashes)
+	if err != nil {
+		return err
+	}
 
-			txs = append(txs, &base.WithdrawTx{
-				Txid: txID,
-				WithdrawInfo: &base.WithdrawInfo{
-					WithdrawAssets: withdrawAssets,
-				},
-			})
-		}
-	} else {
-		txs = sideChainTxs
+	// check if any of withdraw transactions waits for approval of operator.
+	if err := checkHeld(sideChain, txs); err != nil {
+		return err
 	}
 
 	inputTotalAmount, err := mainFunc.GetAmountByInputs(txn.Inputs)
@@ -251,22 +254,33 @@ func checkWithdrawTransaction(txn *types.Transaction,
 				return errors.New("check withdraw transaction " +
 					"failed, cross chain amount less than 0")
 			}
-			oriOutputAmount += common.Fixed64(float64(*w.CrossChainAmount) / exchangeRate)
-			totalFee += common.Fixed64(float64(*w.Amount-*w.CrossChainAmount) / exchangeRate)
+			// convert the same way as the withdraw transaction is built, so
+			// both sides get the same rounding.
+			crossChainAmount, err := exchangeRate.ToMainChainAmount(*w.CrossChainAmount)
+			if err != nil {
+				return errors.New("check withdraw transaction failed, " + err.Error())
+			}
+			withdrawAmount, err := exchangeRate.ToMainChainAmount(*w.Amount)
+			if err != nil {
+				return errors.New("check withdraw transaction failed, " + err.Error())
+			}
+			oriOutputAmount += crossChainAmount
+			totalFee += withdrawAmount - crossChainAmount
 
 			amount, ok := crossChainOutputsMap[w.TargetAddress]
 			if ok {
-				crossChainOutputsMap[w.TargetAddress] = amount + *w.CrossChainAmount
+				crossChainOutputsMap[w.TargetAddress] = amount + crossChainAmount
 			} else {
-				crossChainOutputsMap[w.TargetAddress] = *w.CrossChainAmount
+				crossChainOutputsMap[w.TargetAddress] = crossChainAmount
 			}
 		}
 		totalCrossChainAmount += len(tx.WithdrawInfo.WithdrawAssets)
 	}
 
 	if inputTotalAmount != outputTotalAmount+totalFee {
-		log.Info("inputTotalAmount-", inputTotalAmount,
-			" outputTotalAmount-", outputTotalAmount, " totalFee-", totalFee)
+		log.Withdraw.Info("check withdraw transaction failed, input amount not equal output amount",
+			log.Proposal(txn.Hash().String()), log.F("input", inputTotalAmount),
+			log.F("output", outputTotalAmount), log.F("fee", totalFee))
 		return errors.New("check withdraw transaction failed, input " +
 			"amount not equal output amount")
 	}
@@ -294,7 +308,7 @@ func checkWithdrawTransaction(txn *types.Transaction,
 
 	for k, v := range withdrawOutputsMap {
 		amount, ok := crossChainOutputsMap[k]
-		if !ok || common.Fixed64(float64(amount)/exchangeRate) != v {
+		if !ok || amount != v {
 			return fmt.Errorf("check withdraw transaction failed, addr"+
 				" %s amount is invalid, real is %s, need to be %s", k,
 				v.String(), amount.String())
@@ -302,9 +316,139 @@ func checkWithdrawTransaction(txn *types.Transaction,
 	}
 
 	if oriOutputAmount != withdrawOutputAmount {
-		log.Info("oriOutputAmount-", oriOutputAmount, " withdrawOutputAmount-", withdrawOutputAmount)
+		log.Withdraw.Info("check withdraw transaction failed, exchange rate verify failed",
+			log.Proposal(txn.Hash().String()), log.F("expected", oriOutputAmount),
+			log.F("output", withdrawOutputAmount))
 		return errors.New("check withdraw transaction failed, exchange rate verify failed")
 	}
 
 	return nil
 }
+
+// getWithdrawTxs returns the side chain withdraw transactions of the hashes
+// from db, if not all found then from the rpc interface of the side chain.
+func getWithdrawTxs(sideChainStore store.DataStoreSideChain, sideChain arbitrator.SideChain,
+	genesisAddress string, hashes []common.Uint256) ([]*base.WithdrawTx, error) {
+	var transactionHashes []string
+	for _, hash := range hashes {
+		transactionHashes = append(transactionHashes, hash.String())
+	}
+
+	// check if withdraw transactions exist in db, if not found then will check
+	// by the rpc interface of the side chain.
+	var txs []*base.WithdrawTx
+	sideChainTxs, err := sideChainStore.GetSideChainTxsFromHashesAndGenesisAddress(
+		transactionHashes, genesisAddress)
+	if err != nil || len(sideChainTxs) != len(hashes) {
+		log.Withdraw.Info("[checkWithdrawTransaction] need to get side chain transaction from rpc",
+			log.Chain(genesisAddress))
+		for _, txHash := range hashes {
+			tx, err := sideChain.GetWithdrawTransaction(txHash.String())
+			if err != nil {
+				return nil, errors.New("[checkWithdrawTransaction] failed, unknown side chain transactions")
+			}
+
+			txID, err := common.Uint256FromHexString(tx.TxID)
+			if err != nil {
+				return nil, errors.New("[checkWithdrawTransaction] failed, invalid txID")
+			}
+
+			var withdrawAssets []*base.WithdrawAsset
+			for _, cs := range tx.CrossChainAssets {
+				csAmount, err := common.StringToFixed64(cs.CrossChainAmount)
+				if err != nil {
+					return nil, errors.New("[checkWithdrawTransaction] invalid cross chain amount in tx")
+				}
+				opAmount, err := common.StringToFixed64(cs.OutputAmount)
+				if err != nil {
+					return nil, errors.New("[checkWithdrawTransaction] invalid output amount in tx")
+				}
+				withdrawAssets = append(withdrawAssets, &base.WithdrawAsset{
+					TargetAddress:    cs.CrossChainAddress,
+					Amount:           opAmount,
+					CrossChainAmount: csAmount,
+				})
+			}
+
+			txs = append(txs, &base.WithdrawTx{
+				Txid: txID,
+				WithdrawInfo: &base.WithdrawInfo{
+					WithdrawAssets: withdrawAssets,
+				},
+			})
+		}
+	} else {
+		txs = sideChainTxs
+	}
+
+	return txs, nil
+}
+
+// checkConsolidateTransaction checks the withdraw transaction withdrawing
+// nothing, which sweeps UTXOs of the withdraw bank into one. Every input
+// should be a spendable UTXO of the withdraw bank, and the only output pays
+// the rest of them to the withdraw bank without lock. The failures regardless
+// of the config and UTXOs known by this arbiter are misbehavior errors.
+func checkConsolidateTransaction(txn *types.Transaction, cfg *config.Configuration,
+	mainFunc arbitrator.MainChainFunc) error {
+	payloadWithdraw := txn.Payload.(*payload.WithdrawFromSideChain)
+	if len(txn.Inputs) < 2 {
+		return NewMisbehaviorError(PenaltyFailedCheck,
+			errors.New("check consolidate transaction failed, too few inputs"))
+	}
+	maxInputs := cfg.ConsolidateMaxInputs
+	if maxInputs > 0 && len(txn.Inputs) > maxInputs {
+		return errors.New("check consolidate transaction failed, too many inputs")
+	}
+	if txn.LockTime != 0 {
+		return NewMisbehaviorError(PenaltyFailedCheck,
+			errors.New("check consolidate transaction failed, invalid lock time"))
+	}
+
+	genesisBlockProgramHash, err := common.Uint168FromAddress(payloadWithdraw.GenesisBlockAddress)
+	if err != nil {
+		return NewMisbehaviorError(PenaltyFailedCheck, errors.New("check consolidate "+
+			"transaction failed, genesis block address to program hash failed"))
+	}
+	if len(txn.Outputs) != 1 || txn.Outputs[0].ProgramHash != *genesisBlockProgramHash {
+		return NewMisbehaviorError(PenaltyFailedCheck, errors.New("check consolidate "+
+			"transaction failed, outputs should be only one to genesis block address"))
+	}
+	output := txn.Outputs[0]
+	if output.AssetID != base.SystemAssetId {
+		return NewMisbehaviorError(PenaltyFailedCheck,
+			errors.New("check consolidate transaction failed, invalid asset id"))
+	}
+	if output.OutputLock != 0 {
+		return NewMisbehaviorError(PenaltyFailedCheck,
+			errors.New("check consolidate transaction failed, invalid output lock"))
+	}
+
+	utxos, err := mainFunc.GetWithdrawUTXOs(payloadWithdraw.GenesisBlockAddress)
+	if err != nil {
+		return errors.New("get spender's UTXOs failed")
+	}
+	amounts := make(map[types.OutPoint]common.Fixed64, len(utxos))
+	for _, utxo := range utxos {
+		amounts[utxo.Input.Previous] = *utxo.Amount
+	}
+	var inputTotalAmount common.Fixed64
+	for _, input := range txn.Inputs {
+		amount, ok := amounts[input.Previous]
+		if !ok {
+			return fmt.Errorf("check consolidate transaction failed, input %s:%d "+
+				"is not a spendable UTXO of genesis block address",
+				input.Previous.TxID.String(), input.Previous.Index)
+		}
+		// an input spent twice is found at the second time
+		delete(amounts, input.Previous)
+		inputTotalAmount += amount
+	}
+
+	fee := inputTotalAmount - output.Value
+	if fee <= 0 || fee > common.Fixed64(cfg.ConsolidateFee) {
+		return fmt.Errorf("check consolidate transaction failed, invalid fee %s", fee.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package cs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+// bankMainChainFunc lists the UTXOs of the withdraw bank.
+type bankMainChainFunc struct {
+	utxos []*store.AddressUTXO
+}
+
+func (f *bankMainChainFunc) GetWithdrawUTXOsByAmount(withdrawBank string,
+	amount common.Fixed64) ([]*store.AddressUTXO, error) {
+	return f.utxos, nil
+}
+
+func (f *bankMainChainFunc) GetWithdrawUTXOs(withdrawBank string) ([]*store.AddressUTXO, error) {
+	if withdrawBank != testGenesisAddress {
+		return nil, errors.New("unknown withdraw bank")
+	}
+	return f.utxos, nil
+}
+
+func (f *bankMainChainFunc) GetMainNodeCurrentHeight() (uint32, error) {
+	return 0, nil
+}
+
+func (f *bankMainChainFunc) GetAmountByInputs(inputs []*types.Input) (common.Fixed64, error) {
+	return 0, errors.New("not supported")
+}
+
+func newBankMainChainFunc(count int, amount common.Fixed64) *bankMainChainFunc {
+	f := &bankMainChainFunc{}
+	for i := 0; i < count; i++ {
+		a := amount
+		f.utxos = append(f.utxos, &store.AddressUTXO{
+			Input:               &types.Input{Previous: types.OutPoint{TxID: common.Uint256{1}, Index: uint16(i)}},
+			Amount:              &a,
+			GenesisBlockAddress: testGenesisAddress,
+		})
+	}
+	return f
+}
+
+// newTestConsolidateTx spends the UTXOs to one output of the genesis address
+// paying the fee.
+func newTestConsolidateTx(t *testing.T, utxos []*store.AddressUTXO,
+	fee common.Fixed64) *types.Transaction {
+	txn := &types.Transaction{
+		TxType:  types.WithdrawFromSideChain,
+		Payload: &payload.WithdrawFromSideChain{GenesisBlockAddress: testGenesisAddress},
+	}
+	var total common.Fixed64
+	for _, utxo := range utxos {
+		input := *utxo.Input
+		txn.Inputs = append(txn.Inputs, &input)
+		total += *utxo.Amount
+	}
+	programHash, err := common.Uint168FromAddress(testGenesisAddress)
+	assert.NoError(t, err)
+	txn.Outputs = []*types.Output{{
+		AssetID:     base.SystemAssetId,
+		ProgramHash: *programHash,
+		Value:       total - fee,
+	}}
+	return txn
+}
+
+func TestCheckConsolidateTransaction(t *testing.T) {
+	cfg := &config.Configuration{ConsolidateMaxInputs: 3, ConsolidateFee: 100}
+	mcFunc := newBankMainChainFunc(4, 1000)
+
+	txn := newTestConsolidateTx(t, mcFunc.utxos[:3], 100)
+	assert.NoError(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+
+	// too few or too many inputs
+	txn = newTestConsolidateTx(t, mcFunc.utxos[:1], 100)
+	assert.Error(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+	txn = newTestConsolidateTx(t, mcFunc.utxos, 100)
+	assert.Error(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+
+	// no fee or more fee than allowed
+	txn = newTestConsolidateTx(t, mcFunc.utxos[:2], 0)
+	assert.Error(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+	txn = newTestConsolidateTx(t, mcFunc.utxos[:2], 101)
+	assert.Error(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+}
+
+func TestCheckConsolidateTransaction_ForeignInput(t *testing.T) {
+	cfg := &config.Configuration{ConsolidateMaxInputs: 3, ConsolidateFee: 100}
+	mcFunc := newBankMainChainFunc(2, 1000)
+
+	// the input is not a UTXO of the withdraw bank, though the amounts match
+	foreign := newBankMainChainFunc(1, 1000).utxos[0]
+	foreign.Input.Previous.TxID = common.Uint256{2}
+	txn := newTestConsolidateTx(t, []*store.AddressUTXO{mcFunc.utxos[0], foreign}, 100)
+	assert.Error(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+
+	// the same UTXO spent twice
+	txn = newTestConsolidateTx(t, []*store.AddressUTXO{mcFunc.utxos[0], mcFunc.utxos[0]}, 100)
+	assert.Error(t, checkConsolidateTransaction(txn, cfg, mcFunc))
+}
+
+func TestCheckConsolidateTransaction_Output(t *testing.T) {
+	cfg := &config.Configuration{ConsolidateMaxInputs: 3, ConsolidateFee: 100}
+	mcFunc := newBankMainChainFunc(2, 1000)
+
+	txn := newTestConsolidateTx(t, mcFunc.utxos, 100)
+	txn.Outputs[0].AssetID = common.Uint256{1}
+	assert.Equal(t, PenaltyFailedCheck, testPenalty(checkConsolidateTransaction(txn, cfg, mcFunc)))
+
+	txn = newTestConsolidateTx(t, mcFunc.utxos, 100)
+	txn.Outputs[0].OutputLock = 100
+	assert.Equal(t, PenaltyFailedCheck, testPenalty(checkConsolidateTransaction(txn, cfg, mcFunc)))
+
+	txn = newTestConsolidateTx(t, mcFunc.utxos, 100)
+	txn.LockTime = 100
+	assert.Equal(t, PenaltyFailedCheck, testPenalty(checkConsolidateTransaction(txn, cfg, mcFunc)))
+
+	txn = newTestConsolidateTx(t, mcFunc.utxos, 100)
+	programHash, _ := common.Uint168FromAddress(testAddress1)
+	txn.Outputs[0].ProgramHash = *programHash
+	assert.Equal(t, PenaltyFailedCheck, testPenalty(checkConsolidateTransaction(txn, cfg, mcFunc)))
+
+	// the failures depending on the config and the UTXOs known by this
+	// arbiter are not penalized
+	txn = newTestConsolidateTx(t, mcFunc.utxos, 101)
+	err := checkConsolidateTransaction(txn, cfg, mcFunc)
+	assert.Error(t, err)
+	assert.Equal(t, uint32(0), testPenalty(err))
+	foreign := newBankMainChainFunc(1, 1000).utxos[0]
+	foreign.Input.Previous.TxID = common.Uint256{2}
+	txn = newTestConsolidateTx(t, []*store.AddressUTXO{mcFunc.utxos[0], foreign}, 100)
+	err = checkConsolidateTransaction(txn, cfg, mcFunc)
+	assert.Error(t, err)
+	assert.Equal(t, uint32(0), testPenalty(err))
+}
+
+func TestCheckWithdrawTransaction_Malformed(t *testing.T) {
+	check := func(txn *types.Transaction) uint32 {
+		return testPenalty(checkWithdrawTransaction(txn, nil, nil, nil))
+	}
+
+	txn := newTestWithdrawTx(t, 0, []common.Uint256{{1}},
+		map[string]common.Fixed64{testAddress1: 1000})
+	txn.Payload = &payload.TransferAsset{}
+	assert.Equal(t, PenaltyFailedCheck, check(txn))
+
+	txn = newTestWithdrawTx(t, 0, []common.Uint256{{1}},
+		map[string]common.Fixed64{testAddress1: 1000})
+	txn.Payload.(*payload.WithdrawFromSideChain).GenesisBlockAddress = "invalid"
+	assert.Equal(t, PenaltyFailedCheck, check(txn))
+
+	txn = newTestWithdrawTx(t, 0, []common.Uint256{{1}},
+		map[string]common.Fixed64{testAddress1: 1000})
+	txn.Outputs[0].AssetID = common.Uint256{1}
+	assert.Equal(t, PenaltyFailedCheck, check(txn))
+
+	txn = newTestWithdrawTx(t, 0, []common.Uint256{{1}},
+		map[string]common.Fixed64{testAddress1: 1000})
+	txn.Outputs[0].OutputLock = 100
+	assert.Equal(t, PenaltyFailedCheck, check(txn))
+}
@@ -0,0 +1,188 @@
+package cs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// WithdrawFee is the fee of one withdraw output, amounts are in sela of main
+// chain.
+type WithdrawFee struct {
+	SideChainTxHash  common.Uint256
+	TargetAddress    string
+	Amount           common.Fixed64
+	CrossChainAmount common.Fixed64
+	Fee              common.Fixed64
+}
+
+// WithdrawProposalDryRun is a withdraw transaction built and verified locally
+// without being broadcast.
+type WithdrawProposalDryRun struct {
+	Transaction *types.Transaction
+	UTXOs       []*store.AddressUTXO
+
+	InputAmount  common.Fixed64
+	OutputAmount common.Fixed64
+	ChangeAmount common.Fixed64
+	Fee          common.Fixed64
+	Fees         []*WithdrawFee
+
+	// VerifyError is the error checkWithdrawTransaction returns, empty if
+	// the transaction passes the check.
+	VerifyError string
+	// PolicyError is the error of the signing policy, empty if the
+	// transaction is allowed.
+	PolicyError string
+}
+
+// WithdrawDryRun is the withdraw proposals of the side chain withdraw
+// transactions built and verified locally without being broadcast.
+type WithdrawDryRun struct {
+	Proposals []*WithdrawProposalDryRun
+	// Held are the side chain withdraw transactions waiting for approval of
+	// operator, they are not proposed.
+	Held []string
+	// Unpacked are the side chain withdraw transactions not packed, such as
+	// the UTXOs of withdraw bank can not cover them.
+	Unpacked []string
+	// Skipped are the side chain withdraw transactions not cached in db or
+	// withdrawing nothing, they are not proposed.
+	Skipped []string
+}
+
+// DryRunWithdraw builds the withdraw proposals of the side chain withdraw
+// transactions the same way the on duty arbiter does, then verifies them the
+// same way the other arbiters do, including the signing policy. Nothing is
+// broadcast, held or recorded.
+func DryRunWithdraw(currentArbitrator arbitrator.Arbitrator, policy *SigningPolicy,
+	genesisAddress string, txHashes []common.Uint256) (*WithdrawDryRun, error) {
+	if len(txHashes) == 0 {
+		return nil, errors.New("no side chain transaction")
+	}
+	sideChain, ok := currentArbitrator.GetSideChainManager().GetChain(genesisAddress)
+	if !ok || sideChain == nil {
+		return nil, errors.New("get side chain from genesis address failed")
+	}
+	exchangeRate, err := sideChain.GetExchangeRate()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, hash := range txHashes {
+		hashes = append(hashes, hash.String())
+	}
+	proposals, err := sideChain.DryRunWithdrawProposal(hashes)
+	if err != nil {
+		return nil, errors.New("create withdraw transaction failed: " + err.Error())
+	}
+
+	if policy == nil {
+		policy = NewSigningPolicy()
+	}
+	policy = policy.dryRun()
+	client := &DistributedNodeClient{Arbitrator: currentArbitrator, Policy: policy}
+	mainFunc := &arbitrator.MainChainFuncImpl{ParentArbitrator: currentArbitrator}
+	genesisProgramHash, err := common.Uint168FromAddress(genesisAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WithdrawDryRun{Held: proposals.Held, Unpacked: proposals.Unpacked}
+	proposed := make(map[string]struct{})
+	for _, txn := range proposals.Transactions {
+		withdrawPayload, ok := txn.Payload.(*payload.WithdrawFromSideChain)
+		if !ok {
+			return nil, errors.New("invalid payload of withdraw transaction")
+		}
+		for _, hash := range withdrawPayload.SideChainTransactionHashes {
+			proposed[hash.String()] = struct{}{}
+		}
+
+		proposal := &WithdrawProposalDryRun{Transaction: txn}
+		for _, input := range txn.Inputs {
+			utxo, ok := proposals.UTXOs[input.Previous]
+			if !ok {
+				return nil, errors.New("unknown input of withdraw transaction")
+			}
+			proposal.UTXOs = append(proposal.UTXOs, utxo)
+			proposal.InputAmount += *utxo.Amount
+		}
+		for _, output := range txn.Outputs {
+			if output.ProgramHash.IsEqual(*genesisProgramHash) {
+				proposal.ChangeAmount += output.Value
+			} else {
+				proposal.OutputAmount += output.Value
+			}
+		}
+		proposal.Fee = proposal.InputAmount - proposal.OutputAmount - proposal.ChangeAmount
+
+		withdrawTxs, err := getWithdrawTxs(currentArbitrator.GetDataStore().SideChainStore,
+			sideChain, genesisAddress, withdrawPayload.SideChainTransactionHashes)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range withdrawTxs {
+			for _, asset := range tx.WithdrawInfo.WithdrawAssets {
+				fee := &WithdrawFee{
+					SideChainTxHash: *tx.Txid,
+					TargetAddress:   asset.TargetAddress,
+				}
+				if fee.Amount, err = exchangeRate.ToMainChainAmount(*asset.Amount); err != nil {
+					return nil, err
+				}
+				if fee.CrossChainAmount, err = exchangeRate.ToMainChainAmount(*asset.CrossChainAmount); err != nil {
+					return nil, err
+				}
+				fee.Fee = fee.Amount - fee.CrossChainAmount
+				proposal.Fees = append(proposal.Fees, fee)
+			}
+		}
+
+		// verify as the other arbiters do before signing, the ones signed
+		// count into the daily volume of the copy of signing policy.
+		if err := checkWithdrawTransaction(txn, client, mainFunc, checkNotHeld); err != nil {
+			proposal.VerifyError = err.Error()
+		} else if err := policy.verify(withdrawPayload, txn, client, time.Now()); err != nil {
+			proposal.PolicyError = err.Error()
+		} else {
+			policy.record(txn, time.Now())
+		}
+		result.Proposals = append(result.Proposals, proposal)
+	}
+
+	for _, hash := range proposals.Held {
+		proposed[hash] = struct{}{}
+	}
+	for _, hash := range proposals.Unpacked {
+		proposed[hash] = struct{}{}
+	}
+	for _, hash := range hashes {
+		if _, ok := proposed[hash]; !ok {
+			result.Skipped = append(result.Skipped, hash)
+		}
+	}
+	return result, nil
+}
+
+// checkNotHeld refuses the side chain withdraw transactions waiting for
+// approval of operator, without marking them as held.
+func checkNotHeld(sideChain arbitrator.SideChain, txs []*base.WithdrawTx) error {
+	held, err := sideChain.GetHeldWithdrawTxs(txs)
+	if err != nil {
+		return err
+	}
+	if len(held) != 0 {
+		return fmt.Errorf("withdraw transactions %v wait for approval", held)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package cs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// dryRunSideChain serves the withdraw proposals created and the held ones,
+// holding withdraw transactions fails the test.
+type dryRunSideChain struct {
+	arbitrator.SideChain
+	t         *testing.T
+	rate      *base.ExchangeRate
+	proposals *arbitrator.WithdrawProposals
+	held      []string
+}
+
+func (sc *dryRunSideChain) GetExchangeRate() (*base.ExchangeRate, error) { return sc.rate, nil }
+
+func (sc *dryRunSideChain) DryRunWithdrawProposal(txnHashes []string) (*arbitrator.WithdrawProposals, error) {
+	return sc.proposals, nil
+}
+
+func (sc *dryRunSideChain) GetHeldWithdrawTxs(txs []*base.WithdrawTx) ([]string, error) {
+	var held []string
+	for _, tx := range txs {
+		for _, hash := range sc.held {
+			if tx.Txid.String() == hash {
+				held = append(held, hash)
+			}
+		}
+	}
+	return held, nil
+}
+
+func (sc *dryRunSideChain) CheckHeldWithdrawTxs(txs []*base.WithdrawTx) error {
+	sc.t.Error("withdraw transactions held by dry run")
+	return nil
+}
+
+type dryRunSideChainManager struct {
+	arbitrator.SideChainManager
+	sideChain arbitrator.SideChain
+}
+
+func (m *dryRunSideChainManager) GetChain(key string) (arbitrator.SideChain, bool) {
+	return m.sideChain, key == testGenesisAddress
+}
+
+type dryRunArbitrator struct {
+	arbitrator.Arbitrator
+	config    *config.Configuration
+	dataStore *store.DataStoreImpl
+	manager   arbitrator.SideChainManager
+}
+
+func (a *dryRunArbitrator) GetConfig() *config.Configuration { return a.config }
+
+func (a *dryRunArbitrator) GetDataStore() *store.DataStoreImpl { return a.dataStore }
+
+func (a *dryRunArbitrator) GetSideChainManager() arbitrator.SideChainManager { return a.manager }
+
+// newDryRunWithdrawTx stores a side chain withdraw transaction of 100 sela
+// paying 10 sela fee.
+func newDryRunWithdrawTx(t *testing.T, db store.DataStoreSideChain, id byte) common.Uint256 {
+	txid := common.Uint256{id}
+	amount, crossChainAmount := common.Fixed64(110), common.Fixed64(100)
+	tx := &base.WithdrawTx{
+		Txid: &txid,
+		WithdrawInfo: &base.WithdrawInfo{
+			WithdrawAssets: []*base.WithdrawAsset{{
+				TargetAddress:    testAddress1,
+				Amount:           &amount,
+				CrossChainAmount: &crossChainAmount,
+			}},
+		},
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, tx.Serialize(buf))
+	assert.NoError(t, db.AddSideChainTxs([]*base.SideChainTransaction{{
+		TransactionHash:     txid.String(),
+		GenesisBlockAddress: testGenesisAddress,
+		Transaction:         buf.Bytes(),
+	}}))
+	return txid
+}
+
+// newDryRunProposal spends a UTXO of 1000 sela to the side chain withdraw
+// transaction and the change.
+func newDryRunProposal(t *testing.T, index uint16, hash common.Uint256,
+	withdrawn common.Fixed64) (*types.Transaction, *store.AddressUTXO) {
+	amount := common.Fixed64(1000)
+	utxo := &store.AddressUTXO{
+		Input:               &types.Input{Previous: types.OutPoint{TxID: common.Uint256{1}, Index: index}},
+		Amount:              &amount,
+		GenesisBlockAddress: testGenesisAddress,
+	}
+	txn := newTestWithdrawTx(t, 0, []common.Uint256{hash},
+		map[string]common.Fixed64{testAddress1: withdrawn})
+	txn.Inputs = []*types.Input{utxo.Input}
+	txn.Outputs[1].Value = amount - withdrawn - 10
+	return txn, utxo
+}
+
+func TestDryRunWithdraw(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withdrawdryrun")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the main node answers the amount of each input
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id":      0,
+			"jsonrpc": "2.0",
+			"result":  common.Fixed64(1000).String(),
+		})
+		w.Write(data)
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	p, _ := strconv.Atoi(port)
+
+	rate, err := base.NewExchangeRate("1")
+	assert.NoError(t, err)
+	sideNode := &config.SideNodeConfig{GenesisBlockAddress: testGenesisAddress, ExchangeRate: rate}
+	dataStore, err := store.OpenDataStore(dir, []*config.SideNodeConfig{sideNode})
+	assert.NoError(t, err)
+	defer dataStore.Close()
+
+	hash1 := newDryRunWithdrawTx(t, dataStore.SideChainStore, 1)
+	hash2 := newDryRunWithdrawTx(t, dataStore.SideChainStore, 2)
+	hash3 := newDryRunWithdrawTx(t, dataStore.SideChainStore, 3)
+	hash4 := newDryRunWithdrawTx(t, dataStore.SideChainStore, 4)
+	proposal1, utxo1 := newDryRunProposal(t, 0, hash1, 100)
+	proposal2, utxo2 := newDryRunProposal(t, 1, hash2, 100)
+	proposal3, utxo3 := newDryRunProposal(t, 2, hash3, 90)
+	sideChain := &dryRunSideChain{
+		t:    t,
+		rate: rate,
+		proposals: &arbitrator.WithdrawProposals{
+			Transactions: []*types.Transaction{proposal1, proposal2, proposal3},
+			UTXOs: map[types.OutPoint]*store.AddressUTXO{
+				utxo1.Input.Previous: utxo1,
+				utxo2.Input.Previous: utxo2,
+				utxo3.Input.Previous: utxo3,
+			},
+			Held: []string{hash4.String()},
+		},
+	}
+	ar := &dryRunArbitrator{
+		config: &config.Configuration{
+			MainNode:      &config.MainNodeConfig{Rpc: &config.RpcConfig{IpAddress: host, HttpJsonPort: p}},
+			SideNodeList:  []*config.SideNodeConfig{sideNode},
+			SigningPolicy: config.SigningPolicy{DailyWithdrawLimit: 150},
+		},
+		dataStore: dataStore,
+		manager:   &dryRunSideChainManager{sideChain: sideChain},
+	}
+	policy := NewSigningPolicy()
+
+	unknown := common.Uint256{5}
+	result, err := DryRunWithdraw(ar, policy, testGenesisAddress,
+		[]common.Uint256{hash1, hash2, hash3, hash4, unknown})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(result.Proposals))
+	assert.Equal(t, []string{hash4.String()}, result.Held)
+	assert.Equal(t, []string{unknown.String()}, result.Skipped)
+
+	first := result.Proposals[0]
+	assert.Equal(t, "", first.VerifyError)
+	assert.Equal(t, "", first.PolicyError)
+	assert.Equal(t, common.Fixed64(1000), first.InputAmount)
+	assert.Equal(t, common.Fixed64(100), first.OutputAmount)
+	assert.Equal(t, common.Fixed64(890), first.ChangeAmount)
+	assert.Equal(t, common.Fixed64(10), first.Fee)
+	assert.Equal(t, 1, len(first.Fees))
+
+	// the first one counts into the daily limit of the second
+	assert.Equal(t, "", result.Proposals[1].VerifyError)
+	assert.NotEqual(t, "", result.Proposals[1].PolicyError)
+
+	// the output does not match the side chain withdraw transaction
+	assert.NotEqual(t, "", result.Proposals[2].VerifyError)
+
+	// neither the signing policy nor db is changed
+	assert.Equal(t, 0, len(policy.GetRejections()))
+	assert.Equal(t, common.Fixed64(0), policy.getVolume(testGenesisAddress, common.Uint256{}, time.Now()))
+	heldTxs, err := dataStore.SideChainStore.GetSideChainTxsByState(testGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(heldTxs))
+
+	// the held one is refused without being held
+	sideChain.held = []string{hash1.String()}
+	result, err = DryRunWithdraw(ar, policy, testGenesisAddress, []common.Uint256{hash1})
+	assert.NoError(t, err)
+	assert.Contains(t, result.Proposals[0].VerifyError, "wait for approval")
+	heldTxs, err = dataStore.SideChainStore.GetSideChainTxsByState(testGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(heldTxs))
+}
@@ -0,0 +1,145 @@
+package mainchain
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+const (
+	LargestFirst   = "largestfirst"
+	BranchAndBound = "branchandbound"
+	MinInputs      = "mininputs"
+
+	// maxBranchAndBoundTries is the count of branches visited before branch
+	// and bound gives up searching an exact match.
+	maxBranchAndBoundTries = 100000
+)
+
+var errNotEnoughToken = errors.New("available token is not enough")
+
+// CoinSelector selects UTXOs whose total amount is not less than target.
+type CoinSelector func(utxos []*store.AddressUTXO,
+	target common.Fixed64) ([]*store.AddressUTXO, error)
+
+var coinSelectors = map[string]CoinSelector{
+	LargestFirst:   SelectLargestFirst,
+	BranchAndBound: SelectBranchAndBound,
+	MinInputs:      SelectMinInputs,
+}
+
+// GetCoinSelector returns the coin selector of given strategy name.
+func GetCoinSelector(strategy string) (CoinSelector, bool) {
+	selector, ok := coinSelectors[strategy]
+	return selector, ok
+}
+
+// SelectLargestFirst selects UTXOs from the largest one until target is
+// covered.
+func SelectLargestFirst(utxos []*store.AddressUTXO,
+	target common.Fixed64) ([]*store.AddressUTXO, error) {
+	sorted := sortByAmountDesc(utxos)
+	var total common.Fixed64
+	for i, utxo := range sorted {
+		total += *utxo.Amount
+		if total >= target {
+			return sorted[:i+1], nil
+		}
+	}
+	return nil, errNotEnoughToken
+}
+
+// SelectMinInputs selects the fewest UTXOs covering target, and among them
+// the ones leaving the smallest change.
+func SelectMinInputs(utxos []*store.AddressUTXO,
+	target common.Fixed64) ([]*store.AddressUTXO, error) {
+	sorted := sortByAmountDesc(utxos)
+	largest, err := SelectLargestFirst(sorted, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the largest ones but the last, then replace the last one by the
+	// smallest UTXO still covering the remaining amount.
+	count := len(largest)
+	remain := target
+	for _, utxo := range largest[:count-1] {
+		remain -= *utxo.Amount
+	}
+	last := count - 1
+	for i := count; i < len(sorted); i++ {
+		if *sorted[i].Amount < remain {
+			break
+		}
+		last = i
+	}
+
+	result := make([]*store.AddressUTXO, 0, count)
+	result = append(result, largest[:count-1]...)
+	return append(result, sorted[last]), nil
+}
+
+// SelectBranchAndBound searches UTXOs whose total amount equals target, so
+// no change output is needed. It falls back to SelectMinInputs if no exact
+// match is found.
+func SelectBranchAndBound(utxos []*store.AddressUTXO,
+	target common.Fixed64) ([]*store.AddressUTXO, error) {
+	sorted := sortByAmountDesc(utxos)
+
+	// remains[i] is the total amount of sorted[i:]
+	remains := make([]common.Fixed64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remains[i] = remains[i+1] + *sorted[i].Amount
+	}
+	if remains[0] < target {
+		return nil, errNotEnoughToken
+	}
+
+	var best []int
+	var selected []int
+	tries := 0
+	var search func(index int, total common.Fixed64)
+	search = func(index int, total common.Fixed64) {
+		tries++
+		if best != nil || tries > maxBranchAndBoundTries {
+			return
+		}
+		if total == target {
+			best = append([]int{}, selected...)
+			return
+		}
+		if index == len(sorted) || total+remains[index] < target {
+			return
+		}
+
+		// include sorted[index] only if it does not exceed target
+		if total+*sorted[index].Amount <= target {
+			selected = append(selected, index)
+			search(index+1, total+*sorted[index].Amount)
+			selected = selected[:len(selected)-1]
+		}
+		search(index+1, total)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return SelectMinInputs(sorted, target)
+	}
+	result := make([]*store.AddressUTXO, 0, len(best))
+	for _, i := range best {
+		result = append(result, sorted[i])
+	}
+	return result, nil
+}
+
+func sortByAmountDesc(utxos []*store.AddressUTXO) []*store.AddressUTXO {
+	sorted := make([]*store.AddressUTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return *sorted[i].Amount > *sorted[j].Amount
+	})
+	return sorted
+}
@@ -0,0 +1,107 @@
+package mainchain
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUTXOs(amounts ...common.Fixed64) []*store.AddressUTXO {
+	var utxos []*store.AddressUTXO
+	for i, amount := range amounts {
+		a := amount
+		utxos = append(utxos, &store.AddressUTXO{
+			Input: &types.Input{
+				Previous: types.OutPoint{Index: uint16(i)},
+			},
+			Amount: &a,
+		})
+	}
+	return utxos
+}
+
+func amounts(utxos []*store.AddressUTXO) []common.Fixed64 {
+	var result []common.Fixed64
+	for _, utxo := range utxos {
+		result = append(result, *utxo.Amount)
+	}
+	return result
+}
+
+func TestSelectLargestFirst(t *testing.T) {
+	utxos := newUTXOs(1, 5, 3, 10, 2)
+
+	selected, err := SelectLargestFirst(utxos, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{10, 5}, amounts(selected))
+
+	selected, err = SelectLargestFirst(utxos, 21)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(selected))
+
+	_, err = SelectLargestFirst(utxos, 22)
+	assert.Error(t, err)
+
+	// the given UTXOs keep the order
+	assert.Equal(t, []common.Fixed64{1, 5, 3, 10, 2}, amounts(utxos))
+}
+
+func TestSelectMinInputs(t *testing.T) {
+	utxos := newUTXOs(1, 5, 3, 10, 2, 4)
+
+	// one input is enough, the smallest covering one is used
+	selected, err := SelectMinInputs(utxos, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{4}, amounts(selected))
+
+	// two inputs, 10 and the smallest covering the remaining 2
+	selected, err = SelectMinInputs(utxos, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{10, 2}, amounts(selected))
+
+	selected, err = SelectMinInputs(utxos, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(selected))
+
+	_, err = SelectMinInputs(utxos, 26)
+	assert.Error(t, err)
+}
+
+func TestSelectBranchAndBound(t *testing.T) {
+	utxos := newUTXOs(1, 5, 3, 10, 2, 4)
+
+	// exact match without change
+	selected, err := SelectBranchAndBound(utxos, 9)
+	assert.NoError(t, err)
+	var total common.Fixed64
+	for _, amount := range amounts(selected) {
+		total += amount
+	}
+	assert.Equal(t, common.Fixed64(9), total)
+
+	selected, err = SelectBranchAndBound(utxos, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(selected))
+
+	// no exact match, falls back to min inputs
+	utxos = newUTXOs(10, 20, 30)
+	selected, err = SelectBranchAndBound(utxos, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{30}, amounts(selected))
+
+	_, err = SelectBranchAndBound(utxos, 61)
+	assert.Error(t, err)
+}
+
+func TestGetCoinSelector(t *testing.T) {
+	for _, strategy := range []string{LargestFirst, BranchAndBound, MinInputs} {
+		_, ok := GetCoinSelector(strategy)
+		assert.True(t, ok)
+	}
+	_, ok := GetCoinSelector("unknown")
+	assert.False(t, ok)
+}
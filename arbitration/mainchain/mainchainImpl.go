@@ -4,11 +4,11 @@ import (
 	"errors"
 	"math/rand"
 	"strconv"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 	"github.com/elastos/Elastos.ELA.Arbiter/store"
@@ -24,24 +24,28 @@ type MainChainImpl struct {
 	*cs.DistributedNodeServer
 }
 
+// SyncMainChainCachedTxs sends the cached deposit transactions, the ones
+// failed before are sent by the retry schedule of RetryDepositTransactionsLoop,
+// not on every duty change.
 func (mc *MainChainImpl) SyncMainChainCachedTxs() error {
-	log.Info("[SyncMainChainCachedTxs] start")
-	defer log.Info("[SyncMainChainCachedTxs] end")
+	log.Deposit.Info("[SyncMainChainCachedTxs] start")
+	defer log.Deposit.Info("[SyncMainChainCachedTxs] end")
 
-	txs, err := store.DbCache.MainChainStore.GetAllMainChainTxs()
+	txs, err := mc.Arbitrator.GetDataStore().MainChainStore.GetMainChainTxsToSend(time.Now().Unix())
 	if err != nil {
 		return errors.New("[SyncMainChainCachedTxs]" + err.Error())
 	}
 
 	if len(txs) == 0 {
-		return errors.New("[SyncMainChainCachedTxs] No main chain tx in dbcache")
+		return errors.New("[SyncMainChainCachedTxs] No main chain tx to send in dbcache")
 	}
 
 	allSideChainTxHashes := make(map[arbitrator.SideChain][]string, 0)
 	for _, tx := range txs {
-		sc, ok := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(tx.GenesisBlockAddress)
+		sc, ok := mc.Arbitrator.GetSideChainManager().GetChain(tx.GenesisBlockAddress)
 		if !ok {
-			log.Warn("[SyncMainChainCachedTxs] Get side chain from genesis address failed")
+			log.Deposit.Warn("[SyncMainChainCachedTxs] Get side chain from genesis address failed",
+				log.Chain(tx.GenesisBlockAddress), log.TxHash(tx.TransactionHash))
 			continue
 		}
 
@@ -69,7 +73,8 @@ func (mc *MainChainImpl) SyncMainChainCachedTxs() error {
 func (mc *MainChainImpl) createAndSendDepositTransactionsInDB(sideChain arbitrator.SideChain, txHashes []string) {
 	receivedTxs, err := sideChain.GetExistDepositTransactions(txHashes)
 	if err != nil {
-		log.Warn("[SyncMainChainCachedTxs] Get exist deposit transactions failed, err:", err.Error())
+		log.Deposit.Warn("[SyncMainChainCachedTxs] Get exist deposit transactions failed",
+			log.Chain(sideChain.GetKey()), log.Err(err))
 		return
 	}
 	unsolvedTxs := base.SubstractTransactionHashes(txHashes, receivedTxs)
@@ -77,28 +82,34 @@ func (mc *MainChainImpl) createAndSendDepositTransactionsInDB(sideChain arbitrat
 	for i := 0; i < len(receivedTxs); i++ {
 		addresses = append(addresses, sideChain.GetKey())
 	}
-	err = store.DbCache.MainChainStore.RemoveMainChainTxs(receivedTxs, addresses)
+	err = mc.Arbitrator.GetDataStore().MainChainStore.RemoveMainChainTxs(receivedTxs, addresses)
 	if err != nil {
-		log.Warn("[SyncMainChainCachedTxs] Remove main chain txs failed, err:", err.Error())
+		log.Deposit.Warn("[SyncMainChainCachedTxs] Remove main chain txs failed",
+			log.Chain(sideChain.GetKey()), log.Err(err))
 	}
-	err = store.FinishedTxsDbCache.AddSucceedDepositTxs(receivedTxs, addresses)
+	err = mc.Arbitrator.GetFinishedTxsStore().AddSucceedDepositTxs(receivedTxs, addresses)
 	if err != nil {
-		log.Error("[SyncMainChainCachedTxs] Add succeed deposit transactions into finished db failed, err:", err.Error())
+		log.Deposit.Error("[SyncMainChainCachedTxs] Add succeed deposit transactions into finished db failed",
+			log.Chain(sideChain.GetKey()), log.Err(err))
 	}
 
-	spvTxs, err := store.DbCache.MainChainStore.GetMainChainTxsFromHashes(unsolvedTxs, sideChain.GetKey())
+	spvTxs, err := mc.Arbitrator.GetDataStore().MainChainStore.GetMainChainTxsFromHashes(unsolvedTxs, sideChain.GetKey())
 	if err != nil {
-		log.Error("[SyncMainChainCachedTxs] Get main chain txs from hashes failed, err:", err.Error())
+		log.Deposit.Error("[SyncMainChainCachedTxs] Get main chain txs from hashes failed",
+			log.Chain(sideChain.GetKey()), log.Err(err))
 		return
 	}
 
-	arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().SendDepositTransactions(spvTxs, sideChain.GetKey())
+	mc.Arbitrator.SendDepositTransactions(spvTxs, sideChain.GetKey())
 }
 
-func (mc *MainChainImpl) OnReceivedSignMsg(id peer2.PID, content []byte) {
+func (mc *MainChainImpl) OnReceivedSignMsg(id peer2.PID, content []byte) error {
 	if err := mc.ReceiveProposalFeedback(content); err != nil {
-		log.Error("[OnReceivedSignMsg] mainchain received distributed item message error: ", err)
+		log.Withdraw.Error("[OnReceivedSignMsg] mainchain received distributed item message error",
+			log.F("peer", id.String()), log.Err(err))
+		return err
 	}
+	return nil
 }
 
 func parseUserWithdrawTransactions(txs []*base.WithdrawTx) (
@@ -135,17 +146,25 @@ func (mc *MainChainImpl) CreateWithdrawTransaction(
 		if err != nil {
 			return nil, err
 		}
+		crossChainAmount, err := exchangeRate.ToMainChainAmount(*withdraw.CrossChainAmount)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := exchangeRate.ToMainChainAmount(*withdraw.Amount)
+		if err != nil {
+			return nil, err
+		}
 		txOutput := &types.Output{
 			AssetID:     common.Uint256(assetID),
 			ProgramHash: *programhash,
-			Value:       common.Fixed64(float64(*withdraw.CrossChainAmount) / exchangeRate),
+			Value:       crossChainAmount,
 			OutputLock:  0,
 		}
 		txOutputs = append(txOutputs, txOutput)
-		totalOutputAmount += common.Fixed64(float64(*withdraw.Amount) / exchangeRate)
+		totalOutputAmount += amount
 	}
 
-	availableUTXOs, err := mcFunc.GetWithdrawUTXOsByAmount(withdrawBank, totalOutputAmount)
+	availableUTXOs, err := mc.selectWithdrawUTXOs(withdrawBank, totalOutputAmount, mcFunc)
 	if err != nil {
 		return nil, err
 	}
@@ -181,7 +200,7 @@ func (mc *MainChainImpl) CreateWithdrawTransaction(
 	}
 
 	// Create redeem script
-	redeemScript, err := cs.CreateRedeemScript()
+	redeemScript, err := cs.CreateRedeemScript(mc.Arbitrator)
 	if err != nil {
 		return nil, err
 	}
@@ -214,41 +233,142 @@ func (mc *MainChainImpl) CreateWithdrawTransaction(
 	}, nil
 }
 
+// selectWithdrawUTXOs selects UTXOs of the withdraw bank to pay amount by
+// the configured coin selection strategy. Without a strategy, UTXOs returned
+// by the main node are used in order.
+func (mc *MainChainImpl) selectWithdrawUTXOs(withdrawBank string, amount common.Fixed64,
+	mcFunc arbitrator.MainChainFunc) ([]*store.AddressUTXO, error) {
+	strategy := mc.Arbitrator.GetConfig().CoinSelectionStrategy
+	if strategy == "" {
+		return mcFunc.GetWithdrawUTXOsByAmount(withdrawBank, amount)
+	}
+
+	selector, ok := GetCoinSelector(strategy)
+	if !ok {
+		log.Withdraw.Warn("unknown coin selection strategy", log.F("strategy", strategy))
+		return mcFunc.GetWithdrawUTXOsByAmount(withdrawBank, amount)
+	}
+	utxos, err := mcFunc.GetWithdrawUTXOs(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+	return selector(utxos, amount)
+}
+
+// CreateConsolidateTransaction creates a transaction sweeping the smallest
+// UTXOs of the withdraw bank into one, if the UTXOs count of the withdraw
+// bank exceeds ConsolidateUTXOThreshold. It returns nil if no need to.
+func (mc *MainChainImpl) CreateConsolidateTransaction(
+	sideChain arbitrator.SideChain, mcFunc arbitrator.MainChainFunc) (*types.Transaction, error) {
+	threshold := mc.Arbitrator.GetConfig().ConsolidateUTXOThreshold
+	if threshold <= 0 {
+		return nil, nil
+	}
+
+	withdrawBank := sideChain.GetKey()
+	utxos, err := mcFunc.GetWithdrawUTXOs(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+	if len(utxos) <= threshold {
+		return nil, nil
+	}
+	log.Withdraw.Info("[CreateConsolidateTransaction] consolidate withdraw bank", log.Chain(withdrawBank),
+		log.F("utxos", len(utxos)))
+
+	utxos = store.SortUTXOs(utxos)
+	maxInputs := mc.Arbitrator.GetConfig().ConsolidateMaxInputs
+	if maxInputs > 0 && len(utxos) > maxInputs {
+		utxos = utxos[:maxInputs]
+	}
+
+	var txInputs []*types.Input
+	var totalAmount common.Fixed64
+	for _, utxo := range utxos {
+		txInputs = append(txInputs, utxo.Input)
+		totalAmount += *utxo.Amount
+	}
+	fee := common.Fixed64(mc.Arbitrator.GetConfig().ConsolidateFee)
+	if totalAmount <= fee {
+		return nil, errors.New("UTXOs to consolidate are not enough to pay fee")
+	}
+
+	programHash, err := common.Uint168FromAddress(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+	txOutputs := []*types.Output{{
+		AssetID:     common.Uint256(base.SystemAssetId),
+		ProgramHash: *programHash,
+		Value:       totalAmount - fee,
+		OutputLock:  0,
+	}}
+
+	redeemScript, err := cs.CreateRedeemScript(mc.Arbitrator)
+	if err != nil {
+		return nil, err
+	}
+	chainHeight, err := mcFunc.GetMainNodeCurrentHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	// a withdraw transaction withdrawing nothing, so it is checked and signed
+	// by the same process of withdraw transactions.
+	txPayload := &payload.WithdrawFromSideChain{
+		BlockHeight:         chainHeight,
+		GenesisBlockAddress: withdrawBank,
+	}
+	p := &program.Program{Code: redeemScript}
+	txAttr := types.NewAttribute(types.Nonce, []byte(strconv.FormatInt(rand.Int63(), 10)))
+
+	return &types.Transaction{
+		TxType:     types.WithdrawFromSideChain,
+		Payload:    txPayload,
+		Attributes: []*types.Attribute{&txAttr},
+		Inputs:     txInputs,
+		Outputs:    txOutputs,
+		Programs:   []*program.Program{p},
+		LockTime:   uint32(0),
+	}, nil
+}
+
 func (mc *MainChainImpl) SyncChainData() uint32 {
 	chainHeight, currentHeight, needSync := mc.needSyncBlocks()
 	if !needSync {
-		log.Debug("No need sync, chain height:", chainHeight, "current height:", currentHeight)
+		log.Arbiter.Debug("[SyncChainData] no need sync",
+			log.F("chainheight", chainHeight), log.Height(currentHeight))
 		return currentHeight
 	}
-	log.Info("[arbitrator] Main chain height: ", chainHeight)
+	log.Arbiter.Info("[SyncChainData] main chain height", log.F("chainheight", chainHeight))
 	err := mc.updatePeers(chainHeight)
 	if err != nil {
-		log.Error("update peers failed", err.Error())
+		log.P2P.Error("[SyncChainData] update peers failed", log.F("chainheight", chainHeight), log.Err(err))
 	}
 
 	// Update wallet height
-	currentHeight = store.DbCache.MainChainStore.CurrentHeight(chainHeight)
+	currentHeight = mc.Arbitrator.GetDataStore().MainChainStore.CurrentHeight(chainHeight)
 
 	return currentHeight
 }
 
 func (mc *MainChainImpl) updatePeers(currentHeight uint32) error {
 	// Update active dpos peers
-	peers, err := rpc.GetActiveDposPeers(currentHeight)
+	peers, err := rpc.GetActiveDposPeers(currentHeight, mc.Arbitrator.GetConfig())
 	if err != nil {
 		return err
 	}
-	cs.P2PClientSingleton.UpdatePeers(peers)
+	mc.Network.UpdatePeers(peers)
 	return nil
 }
 
 func (mc *MainChainImpl) needSyncBlocks() (uint32, uint32, bool) {
-	chainHeight, err := rpc.GetCurrentHeight(config.Parameters.MainNode.Rpc)
+	chainHeight, err := rpc.GetCurrentHeight(mc.Arbitrator.GetConfig().MainNode.Rpc)
 	if err != nil {
 		return 0, 0, false
 	}
 
-	currentHeight := store.DbCache.MainChainStore.CurrentHeight(store.QueryHeightCode)
+	currentHeight := mc.Arbitrator.GetDataStore().MainChainStore.CurrentHeight(store.QueryHeightCode)
 
 	if currentHeight >= chainHeight {
 		return chainHeight, currentHeight, false
@@ -258,7 +378,7 @@ func (mc *MainChainImpl) needSyncBlocks() (uint32, uint32, bool) {
 }
 
 func (mc *MainChainImpl) containGenesisBlockAddress(address string) bool {
-	for _, node := range config.Parameters.SideNodeList {
+	for _, node := range mc.Arbitrator.GetConfig().SideNodeList {
 		if node.GenesisBlockAddress == address {
 			return true
 		}
@@ -268,7 +388,7 @@ func (mc *MainChainImpl) containGenesisBlockAddress(address string) bool {
 
 func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
 	//remove deposit transactions if exist on side chain
-	txs, err := store.DbCache.MainChainStore.GetAllMainChainTxs()
+	txs, err := mc.Arbitrator.GetDataStore().MainChainStore.GetAllMainChainTxs()
 	if err != nil {
 		return err
 	}
@@ -279,9 +399,10 @@ func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
 
 	allSideChainTxHashes := make(map[arbitrator.SideChain][]string, 0)
 	for _, tx := range txs {
-		sc, ok := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(tx.GenesisBlockAddress)
+		sc, ok := mc.Arbitrator.GetSideChainManager().GetChain(tx.GenesisBlockAddress)
 		if !ok {
-			log.Warn("[CheckAndRemoveDepositTransactionsFromDB] Get chain from genesis addres failed.")
+			log.Deposit.Warn("[CheckAndRemoveDepositTransactionsFromDB] Get chain from genesis address failed",
+				log.Chain(tx.GenesisBlockAddress), log.TxHash(tx.TransactionHash))
 			continue
 		}
 
@@ -302,38 +423,51 @@ func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
 	for k, v := range allSideChainTxHashes {
 		receivedTxs, err := k.GetExistDepositTransactions(v)
 		if err != nil {
-			log.Warn("[CheckAndRemoveDepositTransactionsFromDB] Get exist deposit transactions failed:", err.Error())
+			log.Deposit.Warn("[CheckAndRemoveDepositTransactionsFromDB] Get exist deposit transactions failed",
+				log.Chain(k.GetKey()), log.Err(err))
 			continue
 		}
 		finalGenesisAddresses := make([]string, 0)
 		for i := 0; i < len(receivedTxs); i++ {
 			finalGenesisAddresses = append(finalGenesisAddresses, k.GetKey())
 		}
-		err = store.DbCache.MainChainStore.RemoveMainChainTxs(receivedTxs, finalGenesisAddresses)
+		err = mc.Arbitrator.GetDataStore().MainChainStore.RemoveMainChainTxs(receivedTxs, finalGenesisAddresses)
 		if err != nil {
 			return err
 		}
-		err = store.FinishedTxsDbCache.AddSucceedDepositTxs(receivedTxs, finalGenesisAddresses)
+		err = mc.Arbitrator.GetFinishedTxsStore().AddSucceedDepositTxs(receivedTxs, finalGenesisAddresses)
 		if err != nil {
-			log.Error("[CheckAndRemoveDepositTransactionsFromDB] Add succeed deposit transactions into finished db failed")
+			log.Deposit.Error("[CheckAndRemoveDepositTransactionsFromDB] Add succeed deposit transactions into finished db failed",
+				log.Chain(k.GetKey()), log.Err(err))
 		}
 	}
 
 	return nil
 }
 
-func InitMainChain(ar arbitrator.Arbitrator) error {
+// InitMainChain sets the main chain of the arbitrator, proposals and feedback
+// are exchanged through network and proposals of others are checked against
+// policy before signing.
+func InitMainChain(ar arbitrator.Arbitrator, network *cs.ArbitratorsNetwork,
+	policy *cs.SigningPolicy) error {
 	currentArbitrator, ok := ar.(*arbitrator.ArbitratorImpl)
 	if !ok {
 		return errors.New("Unknown arbitrator type.")
 	}
 
-	mainChainServer := &MainChainImpl{&cs.DistributedNodeServer{}}
-	cs.P2PClientSingleton.AddMainchainListener(mainChainServer)
+	mainChainServer := &MainChainImpl{&cs.DistributedNodeServer{
+		Arbitrator: ar,
+		Network:    network,
+	}}
+	network.AddMainchainListener(mainChainServer)
 	currentArbitrator.SetMainChain(mainChainServer)
 
-	mainChainClient := &MainChainClientImpl{&cs.DistributedNodeClient{}}
-	cs.P2PClientSingleton.AddMainchainListener(mainChainClient)
+	mainChainClient := &MainChainClientImpl{&cs.DistributedNodeClient{
+		Arbitrator: ar,
+		Network:    network,
+		Policy:     policy,
+	}}
+	network.AddMainchainListener(mainChainClient)
 	currentArbitrator.SetMainChainClient(mainChainClient)
 
 	return nil
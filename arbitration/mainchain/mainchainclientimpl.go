@@ -11,8 +11,11 @@ type MainChainClientImpl struct {
 	*cs.DistributedNodeClient
 }
 
-func (client *MainChainClientImpl) OnReceivedSignMsg(id peer.PID, content []byte) {
+func (client *MainChainClientImpl) OnReceivedSignMsg(id peer.PID, content []byte) error {
 	if err := client.OnReceivedProposal(id, content); err != nil {
-		log.Error("[OnReceivedSignMsg] mainchain client received distributed item message error: ", err)
+		log.Withdraw.Error("[OnReceivedSignMsg] mainchain client received distributed item message error",
+			log.F("peer", id.String()), log.Err(err))
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,87 @@
+package sidechain
+
+import (
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// consolidationPendingBlocks is the count of main chain blocks a consolidate
+// transaction is pending for after proposed, withdraw transactions do not
+// spend the UTXOs of it meanwhile. A consolidate transaction not confirmed
+// by then is taken as failed.
+const consolidationPendingBlocks = 10
+
+// consolidation is a consolidate transaction proposed.
+type consolidation struct {
+	// height is the main chain height the transaction is proposed at.
+	height uint32
+	// utxos are the amounts of the UTXOs the transaction spends.
+	utxos map[types.OutPoint]common.Fixed64
+}
+
+// ConsolidateUTXOs proposes a sweep transaction of the withdraw bank if it
+// holds too many UTXOs. It is skipped while withdraw transactions or another
+// consolidate transaction are pending, so the sweep does not spend UTXOs
+// used by them. The withdraw transactions held for approval of operator are
+// not proposed, so they do not skip it.
+func (sc *SideChainImpl) ConsolidateUTXOs() {
+	sc.proposalMux.Lock()
+	defer sc.proposalMux.Unlock()
+
+	if len(sc.pendingConsolidationUTXOs()) > 0 {
+		return
+	}
+	sideChainStore := sc.ParentArbitrator.GetDataStore().SideChainStore
+	txHashes, _, err := sideChainStore.GetAllSideChainTxHashesAndHeights(sc.GetKey())
+	if err != nil {
+		return
+	}
+	heldTxs, err := sideChainStore.GetSideChainTxsByState(sc.GetKey(), store.WithdrawTxHeld)
+	if err != nil || len(txHashes) != len(heldTxs) {
+		return
+	}
+
+	mcFunc := newUnusedUTXOsFunc(&arbitrator.MainChainFuncImpl{ParentArbitrator: sc.ParentArbitrator})
+	tx, err := sc.ParentArbitrator.GetMainChain().CreateConsolidateTransaction(sc, mcFunc)
+	if err != nil {
+		log.Withdraw.Warn("[ConsolidateUTXOs] create consolidate transaction failed",
+			log.Chain(sc.GetKey()), log.Err(err))
+		return
+	}
+	if tx == nil {
+		return
+	}
+
+	c := &consolidation{
+		height: tx.Payload.(*payload.WithdrawFromSideChain).BlockHeight,
+		utxos:  make(map[types.OutPoint]common.Fixed64),
+	}
+	for _, input := range tx.Inputs {
+		if utxo, ok := mcFunc.utxos[input.Previous]; ok {
+			c.utxos[input.Previous] = *utxo.Amount
+		}
+	}
+	sc.consolidation = c
+	log.Withdraw.Info("[ConsolidateUTXOs] consolidate withdraw bank", log.Chain(sc.GetKey()),
+		log.TxHash(tx.Hash().String()), log.F("inputs", len(tx.Inputs)))
+	sc.ParentArbitrator.BroadcastWithdrawProposal(tx)
+}
+
+// pendingConsolidationUTXOs returns the UTXOs spent by the consolidate
+// transaction pending, it should be called with proposalMux held.
+func (sc *SideChainImpl) pendingConsolidationUTXOs() map[types.OutPoint]common.Fixed64 {
+	if sc.consolidation == nil {
+		return nil
+	}
+	height := sc.ParentArbitrator.GetDataStore().MainChainStore.CurrentHeight(store.QueryHeightCode)
+	if height >= sc.consolidation.height+consolidationPendingBlocks {
+		sc.consolidation = nil
+		return nil
+	}
+	return sc.consolidation.utxos
+}
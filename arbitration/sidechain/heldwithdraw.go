@@ -0,0 +1,182 @@
+package sidechain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// ApproveWithdrawTx approves the held withdraw transaction, it is proposed in
+// the next withdraw cycle. Approval is local, each arbiter only proposes and
+// signs the withdraw transactions approved by its own operator.
+func ApproveWithdrawTx(ar arbitrator.Arbitrator, txHash string) error {
+	if err := ar.GetDataStore().SideChainStore.ApproveSideChainTx(txHash); err != nil {
+		return err
+	}
+	log.Withdraw.Info("[ApproveWithdrawTx] withdraw transaction approved", log.TxHash(txHash))
+	return nil
+}
+
+// RejectWithdrawTx removes the held withdraw transaction and records it into
+// finished db as failed with the reason.
+func RejectWithdrawTx(ar arbitrator.Arbitrator, txHash string, reason string) error {
+	sideChainStore := ar.GetDataStore().SideChainStore
+	for _, node := range ar.GetConfig().SideNodeList {
+		heldTxs, err := sideChainStore.GetSideChainTxsByState(
+			node.GenesisBlockAddress, store.WithdrawTxHeld)
+		if err != nil {
+			return err
+		}
+		for _, tx := range heldTxs {
+			if tx.TransactionHash != txHash {
+				continue
+			}
+			err := ar.GetFinishedTxsStore().AddRejectedWithdrawTx(txHash,
+				tx.GenesisBlockAddress, tx.Transaction, reason)
+			if err != nil {
+				return errors.New("add rejected withdraw transaction into finished db failed: " + err.Error())
+			}
+			if err := sideChainStore.RemoveSideChainTxs([]string{txHash}); err != nil {
+				return errors.New("remove rejected withdraw transaction from db failed: " + err.Error())
+			}
+			log.Withdraw.Info("[RejectWithdrawTx] withdraw transaction rejected",
+				log.Chain(tx.GenesisBlockAddress), log.TxHash(txHash), log.F("reason", reason))
+			return nil
+		}
+	}
+	return errors.New("withdraw transaction " + txHash + " is not held")
+}
+
+// filterHeldWithdrawTxs holds the withdraw transactions withdrawing more than
+// HeldWithdrawThreshold until approved by operator, and returns the ones can
+// be proposed.
+func (sc *SideChainImpl) filterHeldWithdrawTxs(txs []*base.WithdrawTx) ([]*base.WithdrawTx, error) {
+	result, held, err := sc.splitHeldWithdrawTxs(txs)
+	if err != nil {
+		return nil, err
+	}
+	if err := sc.holdWithdrawTxs(held); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CheckHeldWithdrawTxs checks the withdraw transactions proposed by other
+// arbiters, the ones held by this arbiter are not signed until approved by
+// operator, as the ones proposed by this arbiter. Only the ones cached in db
+// are held and listed to operator, the ones got from the side node only are
+// refused until the side chain is synced to them, and held then.
+func (sc *SideChainImpl) CheckHeldWithdrawTxs(txs []*base.WithdrawTx) error {
+	_, held, err := sc.splitHeldWithdrawTxs(txs)
+	if err != nil {
+		return err
+	}
+	if len(held) == 0 {
+		return nil
+	}
+
+	sideChainStore := sc.ParentArbitrator.GetDataStore().SideChainStore
+	var stored, unsynced []string
+	for _, hash := range held {
+		ok, err := sideChainStore.HasSideChainTx(hash)
+		if err != nil {
+			return err
+		}
+		if ok {
+			stored = append(stored, hash)
+		} else {
+			unsynced = append(unsynced, hash)
+		}
+	}
+	if err := sc.holdWithdrawTxs(stored); err != nil {
+		return err
+	}
+	if len(unsynced) > 0 {
+		return fmt.Errorf("withdraw transactions %v wait for approval, %v "+
+			"wait for side chain synced", stored, unsynced)
+	}
+	return fmt.Errorf("withdraw transactions %v wait for approval", stored)
+}
+
+// GetHeldWithdrawTxs returns the hashes of the withdraw transactions waiting
+// for approval of operator, they are not marked as held in db.
+func (sc *SideChainImpl) GetHeldWithdrawTxs(txs []*base.WithdrawTx) ([]string, error) {
+	_, held, err := sc.splitHeldWithdrawTxs(txs)
+	return held, err
+}
+
+// splitHeldWithdrawTxs returns the withdraw transactions can be proposed, and
+// the hashes of the ones held, withdrawing more than HeldWithdrawThreshold and
+// not approved by operator.
+func (sc *SideChainImpl) splitHeldWithdrawTxs(txs []*base.WithdrawTx) ([]*base.WithdrawTx, []string, error) {
+	threshold := common.Fixed64(sc.ParentArbitrator.GetConfig().HeldWithdrawThreshold)
+	if threshold <= 0 {
+		return txs, nil, nil
+	}
+	rate, err := sc.GetExchangeRate()
+	if err != nil {
+		return nil, nil, err
+	}
+	approvedTxs, err := sc.ParentArbitrator.GetDataStore().SideChainStore.GetSideChainTxsByState(
+		sc.GetKey(), store.WithdrawTxApproved)
+	if err != nil {
+		return nil, nil, err
+	}
+	approved := make(map[string]struct{})
+	for _, tx := range approvedTxs {
+		approved[tx.TransactionHash] = struct{}{}
+	}
+
+	var result []*base.WithdrawTx
+	var held []string
+	for _, tx := range txs {
+		hash := tx.Txid.String()
+		if _, ok := approved[hash]; ok {
+			result = append(result, tx)
+			continue
+		}
+		amount, err := getWithdrawAmount(tx, rate)
+		if err != nil || amount > threshold {
+			held = append(held, hash)
+			continue
+		}
+		result = append(result, tx)
+	}
+	return result, held, nil
+}
+
+// holdWithdrawTxs marks the withdraw transactions cached as held, so they are
+// listed to operator for approval.
+func (sc *SideChainImpl) holdWithdrawTxs(held []string) error {
+	if len(held) == 0 {
+		return nil
+	}
+	if err := sc.ParentArbitrator.GetDataStore().SideChainStore.HoldSideChainTxs(held); err != nil {
+		return err
+	}
+	for _, hash := range held {
+		log.Withdraw.Info("[holdWithdrawTxs] withdraw transaction wait for approval",
+			log.Chain(sc.GetKey()), log.TxHash(hash))
+	}
+	return nil
+}
+
+// getWithdrawAmount returns the main chain amount withdrawn by the side chain
+// withdraw transaction.
+func getWithdrawAmount(tx *base.WithdrawTx, rate *base.ExchangeRate) (common.Fixed64, error) {
+	var total common.Fixed64
+	for _, asset := range tx.WithdrawInfo.WithdrawAssets {
+		amount, err := rate.ToMainChainAmount(*asset.CrossChainAmount)
+		if err != nil {
+			return 0, err
+		}
+		total += amount
+	}
+	return total, nil
+}
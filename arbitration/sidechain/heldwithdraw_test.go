@@ -0,0 +1,103 @@
+package sidechain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// heldArbitrator serves the config and the data store of a side chain.
+type heldArbitrator struct {
+	arbitrator.Arbitrator
+	config    *config.Configuration
+	dataStore *store.DataStoreImpl
+}
+
+func (a *heldArbitrator) GetConfig() *config.Configuration { return a.config }
+
+func (a *heldArbitrator) GetDataStore() *store.DataStoreImpl { return a.dataStore }
+
+func newHeldWithdrawTx(t *testing.T, id byte, amount common.Fixed64) (*base.WithdrawTx, *base.SideChainTransaction) {
+	txid := common.Uint256{id}
+	tx := &base.WithdrawTx{
+		Txid: &txid,
+		WithdrawInfo: &base.WithdrawInfo{
+			WithdrawAssets: []*base.WithdrawAsset{{
+				TargetAddress:    scanWithdrawAddress,
+				Amount:           &amount,
+				CrossChainAmount: &amount,
+			}},
+		},
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, tx.Serialize(buf))
+	return tx, &base.SideChainTransaction{
+		TransactionHash:     tx.Txid.String(),
+		GenesisBlockAddress: scanGenesisAddress,
+		Transaction:         buf.Bytes(),
+		BlockHeight:         10,
+	}
+}
+
+func TestSideChain_CheckHeldWithdrawTxs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heldwithdraw")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rate, err := base.NewExchangeRate("1")
+	assert.NoError(t, err)
+	sideNode := &config.SideNodeConfig{GenesisBlockAddress: scanGenesisAddress, ExchangeRate: rate}
+	dataStore, err := store.OpenDataStore(dir, []*config.SideNodeConfig{sideNode})
+	assert.NoError(t, err)
+	defer dataStore.Close()
+	sideChainStore := dataStore.SideChainStore
+
+	sc := &SideChainImpl{
+		Key: scanGenesisAddress,
+		ParentArbitrator: &heldArbitrator{
+			config: &config.Configuration{
+				HeldWithdrawThreshold: 1000,
+				SideNodeList:          []*config.SideNodeConfig{sideNode},
+			},
+			dataStore: dataStore,
+		},
+	}
+
+	small, smallStored := newHeldWithdrawTx(t, 1, 1000)
+	large, largeStored := newHeldWithdrawTx(t, 2, 1001)
+	assert.NoError(t, sideChainStore.AddSideChainTxs(
+		[]*base.SideChainTransaction{smallStored, largeStored}))
+	assert.NoError(t, sc.CheckHeldWithdrawTxs([]*base.WithdrawTx{small}))
+
+	// the large one is held and listed to operator
+	assert.Error(t, sc.CheckHeldWithdrawTxs([]*base.WithdrawTx{small, large}))
+	heldTxs, err := sideChainStore.GetSideChainTxsByState(scanGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(heldTxs))
+	assert.Equal(t, large.Txid.String(), heldTxs[0].TransactionHash)
+
+	// the one got from the side node only is refused but not held, it is
+	// held once synced from the side chain.
+	unsynced, unsyncedStored := newHeldWithdrawTx(t, 3, 1001)
+	assert.Error(t, sc.CheckHeldWithdrawTxs([]*base.WithdrawTx{unsynced}))
+	heldTxs, err = sideChainStore.GetSideChainTxsByState(scanGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(heldTxs))
+	assert.NoError(t, sideChainStore.AddSideChainTxs([]*base.SideChainTransaction{unsyncedStored}))
+	assert.Error(t, sc.CheckHeldWithdrawTxs([]*base.WithdrawTx{unsynced}))
+	heldTxs, err = sideChainStore.GetSideChainTxsByState(scanGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(heldTxs))
+
+	// approved ones are signed
+	assert.NoError(t, ApproveWithdrawTx(sc.ParentArbitrator, large.Txid.String()))
+	assert.NoError(t, sc.CheckHeldWithdrawTxs([]*base.WithdrawTx{small, large}))
+}
@@ -0,0 +1,167 @@
+package sidechain
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// RedriveWithdrawTx moves the failed withdraw transaction back into the
+// cached side chain transactions after verifying it on the side chain again,
+// so it is proposed in the next withdraw cycle. Every attempt is recorded
+// into the re-drive logs of finished db.
+func RedriveWithdrawTx(ar arbitrator.Arbitrator, txHash string, reason string) error {
+	genesisAddress, err := redriveWithdrawTx(ar, txHash)
+	redriveLog := &store.WithdrawRedriveLog{
+		TransactionHash:     txHash,
+		GenesisBlockAddress: genesisAddress,
+		Succeed:             err == nil,
+		Reason:              reason,
+	}
+	if err != nil {
+		redriveLog.Message = err.Error()
+	}
+	if logErr := ar.GetFinishedTxsStore().AddWithdrawRedriveLog(redriveLog); logErr != nil {
+		log.Withdraw.Error("[RedriveWithdrawTx] add re-drive log failed", log.TxHash(txHash), log.Err(logErr))
+	}
+	if err != nil {
+		log.Withdraw.Warn("[RedriveWithdrawTx] re-drive withdraw transaction failed", log.TxHash(txHash), log.Err(err))
+		return err
+	}
+	log.Withdraw.Info("[RedriveWithdrawTx] withdraw transaction re-driven", log.TxHash(txHash), log.F("reason", reason))
+	return nil
+}
+
+func redriveWithdrawTx(currentArbitrator arbitrator.Arbitrator, txHash string) (string, error) {
+	finishedTxsStore := currentArbitrator.GetFinishedTxsStore()
+	rejectedTxs, err := finishedTxsStore.GetRejectedWithdrawTxs()
+	if err != nil {
+		return "", err
+	}
+	for _, tx := range rejectedTxs {
+		if tx.TransactionHash == txHash {
+			return tx.GenesisBlockAddress, errors.New("withdraw transaction is rejected by operator")
+		}
+	}
+
+	succeed, txBytes, err := finishedTxsStore.GetWithdrawTxByHash(txHash)
+	if err != nil {
+		return "", errors.New("withdraw transaction is not failed")
+	}
+	if succeed {
+		return "", errors.New("withdraw transaction is succeed")
+	}
+	failedTx := new(types.Transaction)
+	if err := failedTx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return "", errors.New("invalid failed withdraw transaction: " + err.Error())
+	}
+	withdrawPayload, ok := failedTx.Payload.(*payload.WithdrawFromSideChain)
+	if !ok {
+		return "", errors.New("invalid failed withdraw transaction payload")
+	}
+	genesisAddress := withdrawPayload.GenesisBlockAddress
+
+	sideChain, ok := currentArbitrator.GetSideChainManager().GetChain(genesisAddress)
+	if !ok || sideChain == nil {
+		return genesisAddress, errors.New("unknown side chain " + genesisAddress)
+	}
+
+	// the withdraw transaction may be withdrawn by other arbiters
+	exist, err := rpc.GetExistWithdrawTransactions([]string{txHash},
+		currentArbitrator.GetConfig().MainNode.Rpc)
+	if err != nil {
+		return genesisAddress, errors.New("get exist withdraw transactions failed: " + err.Error())
+	}
+	if len(exist) != 0 {
+		return genesisAddress, errors.New("withdraw transaction has been withdrawn on main chain")
+	}
+
+	withdrawTx, err := getSideChainWithdrawTx(sideChain, txHash)
+	if err != nil {
+		return genesisAddress, err
+	}
+	buf := new(bytes.Buffer)
+	if err := withdrawTx.Serialize(buf); err != nil {
+		return genesisAddress, err
+	}
+	// the side chain height of the withdraw transaction is unknown, current
+	// height makes MinSourceTxAge of signing policy counts from re-drive.
+	height, err := sideChain.GetCurrentHeight()
+	if err != nil {
+		return genesisAddress, errors.New("get side chain height failed: " + err.Error())
+	}
+
+	// the finished db and the side chain db are separate databases, the
+	// failed record is removed first so a withdraw transaction is never both
+	// failed and cached. If it is not cached then, the failed record is put
+	// back, and if the arbiter stops in between, the withdraw transaction is
+	// found again by scanning the side chain as it is not finished.
+	if err := finishedTxsStore.RemoveFailedWithdrawTx(txHash); err != nil {
+		return genesisAddress, errors.New("remove withdraw transaction from finished db failed: " + err.Error())
+	}
+	err = currentArbitrator.GetDataStore().SideChainStore.AddSideChainTxs([]*base.SideChainTransaction{{
+		TransactionHash:     txHash,
+		GenesisBlockAddress: genesisAddress,
+		Transaction:         buf.Bytes(),
+		BlockHeight:         height,
+	}})
+	if err != nil {
+		if restoreErr := finishedTxsStore.AddFailedWithdrawTxs([]string{txHash}, txBytes); restoreErr != nil {
+			log.Withdraw.Error("[RedriveWithdrawTx] restore failed withdraw transaction failed",
+				log.Chain(genesisAddress), log.TxHash(txHash), log.Err(restoreErr))
+		}
+		return genesisAddress, errors.New("add withdraw transaction into db failed: " + err.Error())
+	}
+	return genesisAddress, nil
+}
+
+// getSideChainWithdrawTx gets the withdraw transaction from the side chain.
+func getSideChainWithdrawTx(sideChain arbitrator.SideChain, txHash string) (*base.WithdrawTx, error) {
+	txInfo, err := sideChain.GetWithdrawTransaction(txHash)
+	if err != nil {
+		return nil, errors.New("get withdraw transaction from side chain failed: " + err.Error())
+	}
+	txID, err := common.Uint256FromHexString(txInfo.TxID)
+	if err != nil || txID.String() != txHash {
+		return nil, errors.New("side chain returned invalid withdraw transaction")
+	}
+
+	var withdrawAssets []*base.WithdrawAsset
+	for _, asset := range txInfo.CrossChainAssets {
+		opAmount, err := common.StringToFixed64(asset.OutputAmount)
+		if err != nil {
+			return nil, errors.New("invalid output amount in side chain withdraw transaction")
+		}
+		csAmount, err := common.StringToFixed64(asset.CrossChainAmount)
+		if err != nil {
+			return nil, errors.New("invalid cross chain amount in side chain withdraw transaction")
+		}
+		if _, err := common.Uint168FromAddress(asset.CrossChainAddress); err != nil {
+			return nil, errors.New("invalid cross chain address in side chain withdraw transaction")
+		}
+		withdrawAssets = append(withdrawAssets, &base.WithdrawAsset{
+			TargetAddress:    asset.CrossChainAddress,
+			Amount:           opAmount,
+			CrossChainAmount: csAmount,
+		})
+	}
+	if len(withdrawAssets) == 0 {
+		return nil, errors.New("side chain transaction withdraws nothing")
+	}
+
+	return &base.WithdrawTx{
+		Txid: txID,
+		WithdrawInfo: &base.WithdrawInfo{
+			WithdrawAssets: withdrawAssets,
+		},
+	}, nil
+}
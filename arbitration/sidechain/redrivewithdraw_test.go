@@ -0,0 +1,156 @@
+package sidechain
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+// redriveMainNode answers the withdraw transactions withdrawn on main chain.
+type redriveMainNode struct {
+	exist []string
+}
+
+func (n *redriveMainNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":      0,
+		"jsonrpc": "2.0",
+		"result":  append(make([]string, 0), n.exist...),
+	})
+	w.Write(data)
+}
+
+// redriveSideChain serves the withdraw transactions of the side chain.
+type redriveSideChain struct {
+	arbitrator.SideChain
+}
+
+func (sc *redriveSideChain) GetWithdrawTransaction(txHash string) (*base.WithdrawTxInfo, error) {
+	return &base.WithdrawTxInfo{
+		TxID: txHash,
+		CrossChainAssets: []*base.WithdrawOutputInfo{{
+			CrossChainAddress: scanWithdrawAddress,
+			CrossChainAmount:  "1",
+			OutputAmount:      "1.0001",
+		}},
+	}, nil
+}
+
+func (sc *redriveSideChain) GetCurrentHeight() (uint32, error) { return 100, nil }
+
+type redriveArbitrator struct {
+	solvencyArbitrator
+	manager arbitrator.SideChainManager
+}
+
+func (a *redriveArbitrator) GetSideChainManager() arbitrator.SideChainManager { return a.manager }
+
+// addFailedWithdrawTx records a failed main chain withdraw transaction of the
+// side chain withdraw transaction.
+func addFailedWithdrawTx(t *testing.T, finishedTxs store.FinishedTransactionsDataStore, id byte) string {
+	txHash := common.Uint256{id}.String()
+	txn := &types.Transaction{
+		TxType:  types.WithdrawFromSideChain,
+		Payload: &payload.WithdrawFromSideChain{GenesisBlockAddress: scanGenesisAddress},
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, txn.Serialize(buf))
+	assert.NoError(t, finishedTxs.AddFailedWithdrawTxs([]string{txHash}, buf.Bytes()))
+	return txHash
+}
+
+func TestRedriveWithdrawTx(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redrivewithdraw")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mainNode := &redriveMainNode{}
+	server := httptest.NewServer(mainNode)
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	p, _ := strconv.Atoi(port)
+
+	sideNode := &config.SideNodeConfig{GenesisBlockAddress: scanGenesisAddress}
+	dataStore, err := store.OpenDataStore(dir, []*config.SideNodeConfig{sideNode})
+	assert.NoError(t, err)
+	defer dataStore.Close()
+	finishedTxs, err := store.OpenFinishedTxsDataStore(dir)
+	assert.NoError(t, err)
+	defer finishedTxs.Close()
+
+	ar := &redriveArbitrator{
+		solvencyArbitrator: solvencyArbitrator{
+			config: &config.Configuration{
+				MainNode:     &config.MainNodeConfig{Rpc: &config.RpcConfig{IpAddress: host, HttpJsonPort: p}},
+				SideNodeList: []*config.SideNodeConfig{sideNode},
+			},
+			dataStore:   dataStore,
+			finishedTxs: finishedTxs,
+		},
+		manager: &SideChainManagerImpl{SideChains: map[string]arbitrator.SideChain{
+			scanGenesisAddress: &redriveSideChain{},
+		}},
+	}
+	sideChainStore := dataStore.SideChainStore
+
+	// the failed one is cached again and no longer failed
+	failed := addFailedWithdrawTx(t, finishedTxs, 1)
+	assert.NoError(t, RedriveWithdrawTx(ar, failed, "retry"))
+	cached, err := sideChainStore.HasSideChainTx(failed)
+	assert.NoError(t, err)
+	assert.True(t, cached)
+	_, _, err = finishedTxs.GetWithdrawTxByHash(failed)
+	assert.Error(t, err)
+
+	// the one rejected by operator is not re-driven
+	rejected := common.Uint256{2}.String()
+	assert.NoError(t, finishedTxs.AddRejectedWithdrawTx(rejected, scanGenesisAddress, nil, "denied"))
+	assert.Error(t, RedriveWithdrawTx(ar, rejected, "retry"))
+	cached, err = sideChainStore.HasSideChainTx(rejected)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	// the one withdrawn on main chain by other arbiters is kept failed
+	withdrawn := addFailedWithdrawTx(t, finishedTxs, 3)
+	mainNode.exist = []string{withdrawn}
+	assert.Error(t, RedriveWithdrawTx(ar, withdrawn, "retry"))
+	cached, err = sideChainStore.HasSideChainTx(withdrawn)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+	succeed, _, err := finishedTxs.GetWithdrawTxByHash(withdrawn)
+	assert.NoError(t, err)
+	assert.False(t, succeed)
+
+	// every attempt is logged
+	logs, err := finishedTxs.GetWithdrawRedriveLogs()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(logs))
+	assert.True(t, logs[0].Succeed)
+	assert.False(t, logs[1].Succeed)
+	assert.False(t, logs[2].Succeed)
+
+	// the failed record is put back if the side chain db fails
+	mainNode.exist = nil
+	assert.NoError(t, dataStore.SideChainStore.Close())
+	assert.Error(t, RedriveWithdrawTx(ar, withdrawn, "retry"))
+	succeed, _, err = finishedTxs.GetWithdrawTxByHash(withdrawn)
+	assert.NoError(t, err)
+	assert.False(t, succeed)
+}
@@ -1,6 +1,7 @@
 package sidechain
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -24,6 +25,9 @@ type SideChainAccountMonitorImpl struct {
 
 	ParentArbitrator   arbitrator.Arbitrator
 	accountListenerMap map[string]base.AccountListener
+
+	rescanRequests map[string]uint32
+	rescanProgress map[string]*base.RescanProgress
 }
 
 func (monitor *SideChainAccountMonitorImpl) tryInit() {
@@ -75,98 +79,91 @@ func (monitor *SideChainAccountMonitorImpl) fireIllegalEvidenceFound(evidence *p
 	return item.OnIllegalEvidenceFound(evidence)
 }
 
-func (monitor *SideChainAccountMonitorImpl) SyncChainData(sideNode *config.SideNodeConfig) {
+func (monitor *SideChainAccountMonitorImpl) SyncChainData(ctx context.Context, sideNode *config.SideNodeConfig) {
 	for {
-		chainHeight, currentHeight, needSync := monitor.needSyncBlocks(sideNode.GenesisBlockAddress, sideNode.Rpc)
+		monitor.SyncFromSideNode(sideNode)
 
-		if needSync {
-			if currentHeight < sideNode.SyncStartHeight {
-				currentHeight = sideNode.SyncStartHeight
-			}
-			log.Info("[SyncSideChain] side chain:", sideNode.GenesisBlockAddress,
-				"current height:", currentHeight, " chain height:", chainHeight)
-			count := uint32(1)
-			for currentHeight < chainHeight {
-				if currentHeight >= 6 {
-					transactions, err := rpc.GetWithdrawTransactionByHeight(currentHeight+1-6, sideNode.Rpc)
-					if err != nil {
-						log.Error("get destroyed transaction at height:", currentHeight+1-6, "failed\n"+
-							"rpc:", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort, "\n"+
-							"error:", err)
-						break
-					}
-					monitor.processTransactions(transactions, sideNode.GenesisBlockAddress, currentHeight+1-6)
-				}
-
-				evidences, err := rpc.GetIllegalEvidenceByHeight(currentHeight+1, sideNode.Rpc)
-				if err != nil {
-					log.Error("get illegal evidence at height:", currentHeight+1, "failed\n"+
-						"rpc:", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort, "\n"+
-						"error:", err)
-					break
-				}
-
-				// process illegal evidences
-				for _, e := range evidences {
-					se, err := common.Uint256FromHexString(e.Evidence)
-					if err != nil {
-						log.Error("invalid evidence:", err.Error())
-						continue
-					}
-					sce, err := common.Uint256FromHexString(e.CompareEvidence)
-					if err != nil {
-						log.Error("invalid evidence:", err.Error())
-						continue
-					}
-					illegalSigner, err := common.HexStringToBytes(e.IllegalSigner)
-					if err != nil {
-						log.Error("invalid illegal signer:", err.Error())
-						continue
-					}
-
-					evidence := &payload.SidechainIllegalData{
-						IllegalType:         payload.IllegalDataType(e.IllegalType),
-						Height:              currentHeight + 1,
-						IllegalSigner:       illegalSigner,
-						Evidence:            payload.SidechainIllegalEvidence{*se},
-						CompareEvidence:     payload.SidechainIllegalEvidence{*sce},
-						GenesisBlockAddress: sideNode.GenesisBlockAddress,
-					}
-					if se.String() > sce.String() {
-						evidence.Evidence =
-							payload.SidechainIllegalEvidence{*sce}
-						evidence.CompareEvidence =
-							payload.SidechainIllegalEvidence{*se}
-					}
-
-					if err := monitor.fireIllegalEvidenceFound(
-						evidence); err != nil {
-						log.Error("fire illegal evidence found error:",
-							err.Error())
-					}
-				}
-				currentHeight++
-				count++
-				if count%sideChainHeightInterval == 0 {
-					currentHeight = store.DbCache.SideChainStore.CurrentSideHeight(sideNode.GenesisBlockAddress, currentHeight)
-					log.Info(" [SyncSideChain] Side chain [", sideNode.GenesisBlockAddress, "] height: ", currentHeight)
-				}
-			}
-			// Update wallet height
-			currentHeight = store.DbCache.SideChainStore.CurrentSideHeight(sideNode.GenesisBlockAddress, currentHeight)
-			log.Info(" [SyncSideChain] Side chain [", sideNode.GenesisBlockAddress, "] height: ", currentHeight)
-
-			if arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().IsOnDutyOfMain() {
-				sideChain, ok := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(sideNode.GenesisBlockAddress)
-				if ok {
-					sideChain.StartSideChainMining()
-					log.Info("[SyncSideChain] Start side chain mining, genesis address: [", sideNode.GenesisBlockAddress, "]")
-				}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * monitor.ParentArbitrator.GetConfig().SideChainMonitorScanInterval):
+		}
+	}
+}
+
+// SyncFromSideNode scans the blocks the side node has and the store has not
+// seen yet, once. SyncChainData calls it every scan interval.
+func (monitor *SideChainAccountMonitorImpl) SyncFromSideNode(sideNode *config.SideNodeConfig) {
+	monitor.startRequestedRescan(sideNode.GenesisBlockAddress)
+	chainHeight, currentHeight, needSync := monitor.needSyncBlocks(sideNode.GenesisBlockAddress, sideNode.Rpc)
+
+	if needSync {
+		if currentHeight < sideNode.SyncStartHeight {
+			currentHeight = sideNode.SyncStartHeight
+		}
+		log.Withdraw.Info("[SyncSideChain] sync side chain", log.Chain(sideNode.GenesisBlockAddress),
+			log.Height(currentHeight), log.F("chainheight", chainHeight))
+		currentHeight = monitor.scanHeights(sideNode, currentHeight, chainHeight)
+		// Update wallet height
+		currentHeight = monitor.ParentArbitrator.GetDataStore().SideChainStore.CurrentSideHeight(sideNode.GenesisBlockAddress, currentHeight)
+		log.Withdraw.Info("[SyncSideChain] side chain synced", log.Chain(sideNode.GenesisBlockAddress),
+			log.Height(currentHeight))
+		monitor.updateRescanProgress(sideNode.GenesisBlockAddress, currentHeight, chainHeight)
+
+		if monitor.ParentArbitrator.IsOnDutyOfMain() {
+			sideChain, ok := monitor.ParentArbitrator.GetSideChainManager().GetChain(sideNode.GenesisBlockAddress)
+			if ok {
+				sideChain.StartSideChainMining()
+				log.Auxpow.Info("[SyncSideChain] Start side chain mining", log.Chain(sideNode.GenesisBlockAddress))
 			}
+		}
+
+	} else if chainHeight != 0 {
+		monitor.updateRescanProgress(sideNode.GenesisBlockAddress, currentHeight, chainHeight)
+	}
+}
+
+func (monitor *SideChainAccountMonitorImpl) processIllegalEvidences(evidences []*base.SidechainIllegalDataInfo, genesisAddress string, blockHeight uint32) {
+	for _, e := range evidences {
+		se, err := common.Uint256FromHexString(e.Evidence)
+		if err != nil {
+			log.Arbiter.Error("[processIllegalEvidences] invalid evidence",
+				log.Chain(genesisAddress), log.Height(blockHeight), log.Err(err))
+			continue
+		}
+		sce, err := common.Uint256FromHexString(e.CompareEvidence)
+		if err != nil {
+			log.Arbiter.Error("[processIllegalEvidences] invalid compare evidence",
+				log.Chain(genesisAddress), log.Height(blockHeight), log.Err(err))
+			continue
+		}
+		illegalSigner, err := common.HexStringToBytes(e.IllegalSigner)
+		if err != nil {
+			log.Arbiter.Error("[processIllegalEvidences] invalid illegal signer",
+				log.Chain(genesisAddress), log.Height(blockHeight), log.Err(err))
+			continue
+		}
 
+		evidence := &payload.SidechainIllegalData{
+			IllegalType:         payload.IllegalDataType(e.IllegalType),
+			Height:              blockHeight,
+			IllegalSigner:       illegalSigner,
+			Evidence:            payload.SidechainIllegalEvidence{*se},
+			CompareEvidence:     payload.SidechainIllegalEvidence{*sce},
+			GenesisBlockAddress: genesisAddress,
+		}
+		if se.String() > sce.String() {
+			evidence.Evidence =
+				payload.SidechainIllegalEvidence{*sce}
+			evidence.CompareEvidence =
+				payload.SidechainIllegalEvidence{*se}
 		}
 
-		time.Sleep(time.Millisecond * config.Parameters.SideChainMonitorScanInterval)
+		if err := monitor.fireIllegalEvidenceFound(
+			evidence); err != nil {
+			log.Arbiter.Error("[processIllegalEvidences] fire illegal evidence found error",
+				log.Chain(genesisAddress), log.Height(blockHeight), log.Err(err))
+		}
 	}
 }
 
@@ -177,7 +174,7 @@ func (monitor *SideChainAccountMonitorImpl) needSyncBlocks(genesisBlockAddress s
 		return 0, 0, false
 	}
 
-	currentHeight := store.DbCache.SideChainStore.CurrentSideHeight(genesisBlockAddress, store.QueryHeightCode)
+	currentHeight := monitor.ParentArbitrator.GetDataStore().SideChainStore.CurrentSideHeight(genesisBlockAddress, store.QueryHeightCode)
 
 	if currentHeight >= chainHeight {
 		return chainHeight, currentHeight, false
@@ -189,15 +186,16 @@ func (monitor *SideChainAccountMonitorImpl) needSyncBlocks(genesisBlockAddress s
 func (monitor *SideChainAccountMonitorImpl) processTransactions(transactions []*base.WithdrawTxInfo, genesisAddress string, blockHeight uint32) {
 	var withdrawTxs []*base.WithdrawTx
 	for _, txn := range transactions {
+		logger := log.Withdraw.With(log.Chain(genesisAddress), log.TxHash(txn.TxID), log.Height(blockHeight))
 		txnBytes, err := common.HexStringToBytes(txn.TxID)
 		if err != nil {
-			log.Warn("Find output to destroy address, but transaction hash to transaction bytes failed")
+			logger.Warn("Find output to destroy address, but transaction hash to transaction bytes failed")
 			continue
 		}
 		reversedTxnBytes := common.BytesReverse(txnBytes)
 		hash, err := common.Uint256FromBytes(reversedTxnBytes)
 		if err != nil {
-			log.Warn("Find output to destroy address, but reversed transaction hash bytes to transaction hash failed")
+			logger.Warn("Find output to destroy address, but reversed transaction hash bytes to transaction hash failed")
 			continue
 		}
 
@@ -205,27 +203,27 @@ func (monitor *SideChainAccountMonitorImpl) processTransactions(transactions []*
 		for _, withdraw := range txn.CrossChainAssets {
 			opAmount, err := common.StringToFixed64(withdraw.OutputAmount)
 			if err != nil {
-				log.Warn("Find output to destroy address, but have invlaid corss chain output amount")
+				logger.Warn("Find output to destroy address, but have invalid cross chain output amount")
 				continue
 			}
 			csAmount, err := common.StringToFixed64(withdraw.CrossChainAmount)
 			if err != nil {
-				log.Warn("Find output to destroy address, but have invlaid corss chain amount")
+				logger.Warn("Find output to destroy address, but have invalid cross chain amount")
 				continue
 			}
 			programHash, err := common.Uint168FromAddress(withdraw.CrossChainAddress)
 			if err != nil {
-				log.Warn("invalid withdraw cross chain address:", withdraw.CrossChainAddress)
+				logger.Warn("invalid withdraw cross chain address", log.F("address", withdraw.CrossChainAddress))
 				continue
 			}
 			addr, err := programHash.ToAddress()
 			if err != nil || addr != withdraw.CrossChainAddress {
-				log.Warn("invalid withdraw cross chain address:", withdraw.CrossChainAddress)
+				logger.Warn("invalid withdraw cross chain address", log.F("address", withdraw.CrossChainAddress))
 				continue
 			}
 			if contract.PrefixType(programHash[0]) != contract.PrefixStandard &&
 				contract.PrefixType(programHash[0]) != contract.PrefixMultiSig {
-				log.Warn("invalid withdraw cross chain address:", withdraw.CrossChainAddress)
+				logger.Warn("invalid withdraw cross chain address", log.F("address", withdraw.CrossChainAddress))
 				continue
 			}
 
@@ -248,14 +246,20 @@ func (monitor *SideChainAccountMonitorImpl) processTransactions(transactions []*
 		}
 
 		reversedTxnHash := common.BytesToHexString(reversedTxnBytes)
-		if ok, err := store.DbCache.SideChainStore.HasSideChainTx(reversedTxnHash); err != nil || !ok {
-			withdrawTxs = append(withdrawTxs, withdrawTx)
+		if ok, err := monitor.ParentArbitrator.GetDataStore().SideChainStore.HasSideChainTx(reversedTxnHash); err == nil && ok {
+			continue
+		}
+		// withdraw transactions finished before are met again when rescan
+		if ok, err := monitor.ParentArbitrator.GetFinishedTxsStore().HasWithdrawTx(reversedTxnHash); err == nil && ok {
+			continue
 		}
+		withdrawTxs = append(withdrawTxs, withdrawTx)
 	}
 	if len(withdrawTxs) != 0 {
 		err := monitor.fireUTXOChanged(withdrawTxs, genesisAddress, blockHeight)
 		if err != nil {
-			log.Error("[fireUTXOChanged] err:", err.Error())
+			log.Withdraw.Error("[fireUTXOChanged] add withdraw transactions failed", log.Chain(genesisAddress),
+				log.Height(blockHeight), log.Err(err))
 		}
 	}
 }
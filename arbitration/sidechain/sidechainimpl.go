@@ -19,11 +19,22 @@ import (
 	"github.com/elastos/Elastos.ELA/elanet/pact"
 )
 
+// existTxsQuerySize is the count of transaction hashes queried in one request
+// of GetExistWithdrawTransactions.
+const existTxsQuerySize = 1000
+
 type SideChainImpl struct {
 	mux sync.Mutex
-
-	Key           string
-	CurrentConfig *config.SideNodeConfig
+	// proposalMux serializes the withdraw and consolidate proposals, so they
+	// do not spend the same UTXOs.
+	proposalMux   sync.Mutex
+	consolidation *consolidation
+
+	Key              string
+	CurrentConfig    *config.SideNodeConfig
+	ParentArbitrator arbitrator.Arbitrator
+	// AuxPow sends the side chain pow transactions.
+	AuxPow *sideauxpow.SideAuxPow
 }
 
 func (sc *SideChainImpl) GetKey() string {
@@ -34,7 +45,7 @@ func (sc *SideChainImpl) getCurrentConfig() *config.SideNodeConfig {
 	sc.mux.Lock()
 	defer sc.mux.Unlock()
 	if sc.CurrentConfig == nil {
-		for _, sideConfig := range config.Parameters.SideNodeList {
+		for _, sideConfig := range sc.ParentArbitrator.GetConfig().SideNodeList {
 			if sc.GetKey() == sideConfig.GenesisBlockAddress {
 				sc.CurrentConfig = sideConfig
 				break
@@ -44,13 +55,13 @@ func (sc *SideChainImpl) getCurrentConfig() *config.SideNodeConfig {
 	return sc.CurrentConfig
 }
 
-func (sc *SideChainImpl) GetExchangeRate() (float64, error) {
+func (sc *SideChainImpl) GetExchangeRate() (*base.ExchangeRate, error) {
 	con := sc.getCurrentConfig()
 	if con == nil {
-		return 0, errors.New("get exchange rate failed, side chain has no config")
+		return nil, errors.New("get exchange rate failed, side chain has no config")
 	}
-	if sc.getCurrentConfig().ExchangeRate <= 0 {
-		return 0, errors.New("get exchange rate failed, invalid exchange rate")
+	if sc.getCurrentConfig().ExchangeRate == nil {
+		return nil, errors.New("get exchange rate failed, invalid exchange rate")
 	}
 
 	return sc.getCurrentConfig().ExchangeRate, nil
@@ -65,17 +76,19 @@ func (sc *SideChainImpl) GetBlockByHeight(height uint32) (*base.BlockInfo, error
 }
 
 func (sc *SideChainImpl) SendTransaction(txHash *common.Uint256) (rpc.Response, error) {
-	log.Info("[Rpc-sendtransactioninfo] Deposit transaction to side chain：", sc.CurrentConfig.Rpc.IpAddress, ":", sc.CurrentConfig.Rpc.HttpJsonPort)
+	logger := log.Deposit.With(log.Chain(sc.GetKey()), log.TxHash(txHash.String()))
+	logger.Info("[Rpc-sendtransactioninfo] Deposit transaction to side chain",
+		log.F("ip", sc.CurrentConfig.Rpc.IpAddress), log.F("port", sc.CurrentConfig.Rpc.HttpJsonPort))
 	response, err := rpc.CallAndUnmarshalResponse("sendrechargetransaction", rpc.Param("txid", txHash.String()), sc.CurrentConfig.Rpc)
 	if err != nil {
 		return rpc.Response{}, err
 	}
-	log.Info("[Rpc-sendtransactioninfo] Deposit transaction finished")
 
 	if response.Error != nil {
-		log.Info("response: ", response.Error.Message)
+		logger.Info("[Rpc-sendtransactioninfo] Deposit transaction finished",
+			log.F("code", response.Code), log.F("message", response.Error.Message))
 	} else {
-		log.Info("response:", response)
+		logger.Info("[Rpc-sendtransactioninfo] Deposit transaction finished", log.F("result", response.Result))
 	}
 
 	return response, nil
@@ -94,7 +107,8 @@ func (sc *SideChainImpl) OnUTXOChanged(withdrawTxs []*base.WithdrawTx, blockHeig
 	for _, withdrawTx := range withdrawTxs {
 		buf := new(bytes.Buffer)
 		if err := withdrawTx.Serialize(buf); err != nil {
-			log.Error("[OnUTXOChanged] received withdrawTx, but is invalid tx,", err.Error())
+			log.Withdraw.Error("[OnUTXOChanged] received withdrawTx, but is invalid tx",
+				log.Chain(sc.GetKey()), log.TxHash(withdrawTx.Txid.String()), log.Err(err))
 			continue
 		}
 
@@ -106,38 +120,71 @@ func (sc *SideChainImpl) OnUTXOChanged(withdrawTxs []*base.WithdrawTx, blockHeig
 		})
 	}
 
-	if err := store.DbCache.SideChainStore.AddSideChainTxs(txs); err != nil {
+	if err := sc.ParentArbitrator.GetDataStore().SideChainStore.AddSideChainTxs(txs); err != nil {
 		return err
 	}
+	sc.addSolvencyFlows(withdrawTxs)
 
-	log.Info("[OnUTXOChanged] find ", len(txs), "withdraw transaction, add into db cache")
+	log.Withdraw.Info("[OnUTXOChanged] find withdraw transactions, add into db cache",
+		log.Chain(sc.GetKey()), log.Height(blockHeight), log.F("count", len(txs)))
+	for _, tx := range txs {
+		log.Withdraw.Debug("[OnUTXOChanged] add withdraw transaction into db cache",
+			log.Chain(sc.GetKey()), log.TxHash(tx.TransactionHash), log.Height(blockHeight))
+	}
 	return nil
 }
 
+// addSolvencyFlows records the amounts to be released for the withdraw
+// transactions, the bridge solvency is reconciled by them.
+func (sc *SideChainImpl) addSolvencyFlows(withdrawTxs []*base.WithdrawTx) {
+	rate, err := sc.GetExchangeRate()
+	if err != nil {
+		log.Withdraw.Warn("[OnUTXOChanged] add solvency flows failed", log.Chain(sc.GetKey()), log.Err(err))
+		return
+	}
+	var flows []*store.SolvencyFlow
+	for _, withdrawTx := range withdrawTxs {
+		amount, err := base.GetWithdrawAmount(withdrawTx, rate)
+		if err != nil {
+			log.Withdraw.Warn("[OnUTXOChanged] get withdraw amount failed", log.Chain(sc.GetKey()),
+				log.TxHash(withdrawTx.Txid.String()), log.Err(err))
+			continue
+		}
+		flows = append(flows, &store.SolvencyFlow{
+			TransactionHash:     withdrawTx.Txid.String(),
+			GenesisBlockAddress: sc.GetKey(),
+			Amount:              amount,
+		})
+	}
+	if err := sc.ParentArbitrator.GetFinishedTxsStore().AddSolvencyFlows(flows); err != nil {
+		log.Withdraw.Warn("[OnUTXOChanged] add solvency flows failed", log.Chain(sc.GetKey()), log.Err(err))
+	}
+}
+
 func (sc *SideChainImpl) OnIllegalEvidenceFound(evidence *payload.SidechainIllegalData) error {
-	arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().BroadcastSidechainIllegalData(evidence)
+	sc.ParentArbitrator.BroadcastSidechainIllegalData(evidence)
 	return nil
 }
 
 func (sc *SideChainImpl) StartSideChainMining() {
-	if sc.CurrentConfig.PowChain {
-		log.Info("[OnDutyChanged] Start side chain mining: genesis address [", sc.Key, "]")
-		sideauxpow.StartSideChainMining(sc.CurrentConfig)
+	if sc.CurrentConfig.IsPowChain() {
+		log.Auxpow.Info("[OnDutyChanged] Start side chain mining", log.Chain(sc.Key))
+		sc.AuxPow.StartSideChainMining(sc.CurrentConfig)
 	} else {
-		log.Debug("[StartSideChainMining] side chain is not pow chain, no need to mining")
+		log.Auxpow.Debug("[StartSideChainMining] side chain is not pow chain, no need to mining", log.Chain(sc.Key))
 	}
 }
 
 func (sc *SideChainImpl) SubmitAuxpow(genesishash string, blockhash string, submitauxpow string) error {
-	return sideauxpow.SubmitAuxpow(genesishash, blockhash, submitauxpow)
+	return sc.AuxPow.SubmitAuxpow(genesishash, blockhash, submitauxpow)
 }
 
 func (sc *SideChainImpl) UpdateLastNotifySideMiningHeight(genesisBlockHash common.Uint256) {
-	sideauxpow.UpdateLastNotifySideMiningHeight(genesisBlockHash)
+	sc.AuxPow.UpdateLastNotifySideMiningHeight(genesisBlockHash)
 }
 
 func (sc *SideChainImpl) UpdateLastSubmitAuxpowHeight(genesisBlockHash common.Uint256) {
-	sideauxpow.UpdateLastSubmitAuxpowHeight(genesisBlockHash)
+	sc.AuxPow.UpdateLastSubmitAuxpowHeight(genesisBlockHash)
 }
 
 func (sc *SideChainImpl) GetExistDepositTransactions(txs []string) ([]string, error) {
@@ -162,61 +209,105 @@ func (sc *SideChainImpl) CheckIllegalEvidence(evidence *base.SidechainIllegalDat
 }
 
 func (sc *SideChainImpl) SendCachedWithdrawTxs() {
-	log.Info("[SendCachedWithdrawTxs] start")
-	defer log.Info("[SendCachedWithdrawTxs] end")
+	logger := log.Withdraw.With(log.Chain(sc.GetKey()))
+	logger.Info("[SendCachedWithdrawTxs] start")
+	defer logger.Info("[SendCachedWithdrawTxs] end")
 
-	txHashes, blockHeights, err := store.DbCache.SideChainStore.GetAllSideChainTxHashesAndHeights(sc.GetKey())
+	txHashes, blockHeights, err := sc.ParentArbitrator.GetDataStore().SideChainStore.GetAllSideChainTxHashesAndHeights(sc.GetKey())
 	if err != nil {
-		log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
+		logger.Error("[SendCachedWithdrawTxs] get cached withdraw transactions failed", log.Err(err))
 		return
 	}
 
 	if len(txHashes) == 0 {
-		log.Info("No cached withdraw transaction need to send")
+		logger.Info("No cached withdraw transaction need to send")
 		return
 	}
 
-	if len(txHashes) > config.Parameters.MaxTxsPerWithdrawTx {
-		txHashes = txHashes[:config.Parameters.MaxTxsPerWithdrawTx]
-	}
-
-	receivedTxs, err := rpc.GetExistWithdrawTransactions(txHashes)
-	if err != nil {
-		log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
-		return
+	var receivedTxs []string
+	for start := 0; start < len(txHashes); start += existTxsQuerySize {
+		end := start + existTxsQuerySize
+		if end > len(txHashes) {
+			end = len(txHashes)
+		}
+		received, err := rpc.GetExistWithdrawTransactions(txHashes[start:end],
+			sc.ParentArbitrator.GetConfig().MainNode.Rpc)
+		if err != nil {
+			logger.Error("[SendCachedWithdrawTxs] get exist withdraw transactions failed", log.Err(err))
+			return
+		}
+		receivedTxs = append(receivedTxs, received...)
 	}
 
 	unsolvedTxs, _ := base.SubstractTransactionHashesAndBlockHeights(txHashes, blockHeights, receivedTxs)
 	if len(unsolvedTxs) != 0 {
 		err := sc.CreateAndBroadcastWithdrawProposal(unsolvedTxs)
 		if err != nil {
-			log.Error("[ReceiveSendLastArbiterUsedUtxos] CreateAndBroadcastWithdrawProposal failed")
+			logger.Error("[SendCachedWithdrawTxs] CreateAndBroadcastWithdrawProposal failed", log.Err(err))
 		}
 	}
 
 	if len(receivedTxs) != 0 {
-		err = store.DbCache.SideChainStore.RemoveSideChainTxs(receivedTxs)
+		err = sc.ParentArbitrator.GetDataStore().SideChainStore.RemoveSideChainTxs(receivedTxs)
 		if err != nil {
-			log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
+			logger.Error("[SendCachedWithdrawTxs] remove received withdraw transactions failed", log.Err(err))
 			return
 		}
 
-		err = store.FinishedTxsDbCache.AddSucceedWithdrawTxs(receivedTxs)
+		err = sc.ParentArbitrator.GetFinishedTxsStore().AddSucceedWithdrawTxs(receivedTxs)
 		if err != nil {
-			log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
+			logger.Error("[SendCachedWithdrawTxs] add succeed withdraw transactions failed", log.Err(err))
 			return
 		}
 	}
 }
 
 func (sc *SideChainImpl) CreateAndBroadcastWithdrawProposal(txnHashes []string) error {
-	unsolvedTransactions, err := store.DbCache.SideChainStore.GetSideChainTxsFromHashes(txnHashes)
+	sc.proposalMux.Lock()
+	defer sc.proposalMux.Unlock()
+
+	currentArbitrator := sc.ParentArbitrator
+	proposals, err := sc.createWithdrawProposals(txnHashes,
+		&arbitrator.MainChainFuncImpl{ParentArbitrator: currentArbitrator}, false)
 	if err != nil {
-		return err
+		return errors.New("[CreateAndBroadcastWithdrawProposal] " + err.Error())
 	}
 
-	if len(unsolvedTransactions) == 0 {
-		return nil
+	for _, wTx := range proposals.Transactions {
+		log.Withdraw.Info("[CreateAndBroadcastWithdrawProposal] broadcast withdraw proposal",
+			log.Chain(sc.GetKey()), log.Proposal(wTx.Hash().String()))
+		currentArbitrator.BroadcastWithdrawProposal(wTx)
+	}
+	if len(proposals.Transactions) != 0 {
+		log.Withdraw.Info("[CreateAndBroadcastWithdrawProposal] withdraw proposals broadcast",
+			log.Chain(sc.GetKey()), log.F("proposals", len(proposals.Transactions)),
+			log.F("remaining", len(proposals.Unpacked)))
+	}
+
+	return nil
+}
+
+// DryRunWithdrawProposal creates the withdraw proposals of the side chain
+// withdraw transactions the same way CreateAndBroadcastWithdrawProposal does,
+// but the ones waiting for approval are not held and nothing is broadcast.
+func (sc *SideChainImpl) DryRunWithdrawProposal(txnHashes []string) (*arbitrator.WithdrawProposals, error) {
+	sc.proposalMux.Lock()
+	defer sc.proposalMux.Unlock()
+
+	return sc.createWithdrawProposals(txnHashes,
+		&arbitrator.MainChainFuncImpl{ParentArbitrator: sc.ParentArbitrator}, true)
+}
+
+// createWithdrawProposals packs the cached side chain withdraw transactions
+// not held into withdraw transactions, the UTXOs spent by the consolidate
+// transaction pending are not spent. The held ones are marked in db unless it
+// is a dry run. It should be called with proposalMux held.
+func (sc *SideChainImpl) createWithdrawProposals(txnHashes []string, mcFunc arbitrator.MainChainFunc,
+	dryRun bool) (*arbitrator.WithdrawProposals, error) {
+	result := &arbitrator.WithdrawProposals{}
+	unsolvedTransactions, err := sc.ParentArbitrator.GetDataStore().SideChainStore.GetSideChainTxsFromHashes(txnHashes)
+	if err != nil {
+		return nil, err
 	}
 
 	targetTransactions := make([]*base.WithdrawTx, 0)
@@ -226,32 +317,36 @@ func (sc *SideChainImpl) CreateAndBroadcastWithdrawProposal(txnHashes []string)
 		}
 	}
 
-	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
-
-	var wTx *types.Transaction
-	var targetIndex int
-	for i := 0; i < len(targetTransactions); {
-		i += 100
-		targetIndex = len(targetTransactions)
-		if targetIndex > i {
-			targetIndex = i
-		}
-
-		tx := currentArbitrator.CreateWithdrawTransaction(
-			targetTransactions[:targetIndex], sc, &arbitrator.MainChainFuncImpl{})
-		if tx == nil {
-			continue
-		}
-		if tx.GetSize() < int(pact.MaxBlockContextSize) {
-			wTx = tx
-		}
+	if dryRun {
+		targetTransactions, result.Held, err = sc.splitHeldWithdrawTxs(targetTransactions)
+	} else {
+		targetTransactions, err = sc.filterHeldWithdrawTxs(targetTransactions)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(targetTransactions) == 0 {
+		return result, nil
 	}
 
-	if wTx == nil {
-		return errors.New("[CreateAndBroadcastWithdrawProposal] failed")
+	currentArbitrator := sc.ParentArbitrator
+	build := func(withdrawTxs []*base.WithdrawTx, mcFunc arbitrator.MainChainFunc) *types.Transaction {
+		return currentArbitrator.CreateWithdrawTransaction(withdrawTxs, sc, mcFunc)
+	}
+	packer := newWithdrawPacker(build, mcFunc,
+		currentArbitrator.GetConfig().MaxTxsPerWithdrawTx, int(pact.MaxBlockContextSize))
+	for op, amount := range sc.pendingConsolidationUTXOs() {
+		packer.mcFunc.reserve(op, amount)
+	}
+	wTxs, packed := packer.pack(targetTransactions)
+	if len(wTxs) == 0 {
+		return nil, errors.New("create withdraw transaction failed")
 	}
-	currentArbitrator.BroadcastWithdrawProposal(wTx)
-	log.Info("[CreateAndBroadcastWithdrawProposal] transactions count: ", targetIndex)
 
-	return nil
+	result.Transactions = wTxs
+	result.UTXOs = packer.mcFunc.utxos
+	for _, tx := range targetTransactions[packed:] {
+		result.Unpacked = append(result.Unpacked, tx.Txid.String())
+	}
+	return result, nil
 }
@@ -1,5 +1,20 @@
 package sidechain
 
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
 //import (
 //	"bytes"
 //	"errors"
@@ -174,3 +189,86 @@ package sidechain
 //
 //	return result, nil
 //}
+
+// proposalArbitrator builds withdraw transactions by mockWithdrawBuilder.
+type proposalArbitrator struct {
+	heldArbitrator
+}
+
+func (a *proposalArbitrator) CreateWithdrawTransaction(withdrawTxs []*base.WithdrawTx,
+	sideChain arbitrator.SideChain, mcFunc arbitrator.MainChainFunc) *types.Transaction {
+	return mockWithdrawBuilder(withdrawTxs, mcFunc)
+}
+
+func TestSideChain_CreateWithdrawProposals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withdrawproposals")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rate, err := base.NewExchangeRate("1")
+	assert.NoError(t, err)
+	sideNode := &config.SideNodeConfig{GenesisBlockAddress: scanGenesisAddress, ExchangeRate: rate}
+	dataStore, err := store.OpenDataStore(dir, []*config.SideNodeConfig{sideNode})
+	assert.NoError(t, err)
+	defer dataStore.Close()
+	sideChainStore := dataStore.SideChainStore
+
+	sc := &SideChainImpl{
+		Key: scanGenesisAddress,
+		ParentArbitrator: &proposalArbitrator{heldArbitrator{
+			config: &config.Configuration{
+				HeldWithdrawThreshold: 150,
+				MaxTxsPerWithdrawTx:   2,
+				SideNodeList:          []*config.SideNodeConfig{sideNode},
+			},
+			dataStore: dataStore,
+		}},
+	}
+
+	var hashes []string
+	var stored []*base.SideChainTransaction
+	for i, amount := range []common.Fixed64{100, 100, 200, 100, 100} {
+		tx, s := newHeldWithdrawTx(t, byte(i+1), amount)
+		hashes = append(hashes, tx.Txid.String())
+		stored = append(stored, s)
+	}
+	assert.NoError(t, sideChainStore.AddSideChainTxs(stored))
+
+	// the UTXO spent by the consolidate transaction pending is not spent
+	mcFunc := &mockMainChainFunc{utxos: newMockUTXOs(4, 100)}
+	reserved := mcFunc.utxos[0]
+	sc.consolidation = &consolidation{
+		utxos: map[types.OutPoint]common.Fixed64{reserved.Input.Previous: *reserved.Amount},
+	}
+
+	// the dry run holds nothing, the rest UTXOs cover the first proposal
+	// only.
+	proposals, err := sc.createWithdrawProposals(hashes, mcFunc, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{hashes[2]}, proposals.Held)
+	assert.Equal(t, 1, len(proposals.Transactions))
+	assert.Equal(t, 2, len(proposals.Transactions[0].Outputs))
+	assert.Equal(t, []string{hashes[3], hashes[4]}, proposals.Unpacked)
+	for _, tx := range proposals.Transactions {
+		for _, input := range tx.Inputs {
+			assert.NotEqual(t, reserved.Input.Previous, input.Previous)
+			_, ok := proposals.UTXOs[input.Previous]
+			assert.True(t, ok)
+		}
+	}
+	heldTxs, err := sideChainStore.GetSideChainTxsByState(scanGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(heldTxs))
+
+	// the proposal holds the large one, and packs the same way
+	withdrawProposals, err := sc.createWithdrawProposals(hashes, mcFunc, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(withdrawProposals.Held))
+	assert.Equal(t, len(proposals.Transactions), len(withdrawProposals.Transactions))
+	for i, tx := range proposals.Transactions {
+		assert.Equal(t, tx.Hash(), withdrawProposals.Transactions[i].Hash())
+	}
+	heldTxs, err = sideChainStore.GetSideChainTxsByState(scanGenesisAddress, store.WithdrawTxHeld)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(heldTxs))
+	assert.Equal(t, hashes[2], heldTxs[0].TransactionHash)
+}
@@ -2,13 +2,13 @@ package sidechain
 
 import (
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
-	"github.com/elastos/Elastos.ELA.Arbiter/store"
+	"github.com/elastos/Elastos.ELA.Arbiter/sideauxpow"
 )
 
 type SideChainManagerImpl struct {
-	SideChains map[string]arbitrator.SideChain
+	ParentArbitrator arbitrator.Arbitrator
+	SideChains       map[string]arbitrator.SideChain
 }
 
 func (sideManager *SideChainManagerImpl) AddChain(key string, chain arbitrator.SideChain) {
@@ -35,25 +35,26 @@ func (sideManager *SideChainManagerImpl) StartSideChainMining() {
 }
 
 func (sideManager *SideChainManagerImpl) CheckAndRemoveWithdrawTransactionsFromDB() error {
-	txHashes, err := store.DbCache.SideChainStore.GetAllSideChainTxHashes()
+	txHashes, err := sideManager.ParentArbitrator.GetDataStore().SideChainStore.GetAllSideChainTxHashes()
 	if err != nil {
 		return err
 	}
 	if len(txHashes) == 0 {
 		return nil
 	}
-	receivedTxs, err := rpc.GetExistWithdrawTransactions(txHashes)
+	receivedTxs, err := rpc.GetExistWithdrawTransactions(txHashes,
+		sideManager.ParentArbitrator.GetConfig().MainNode.Rpc)
 	if err != nil {
 		return err
 	}
 
 	if len(receivedTxs) != 0 {
-		err = store.DbCache.SideChainStore.RemoveSideChainTxs(receivedTxs)
+		err = sideManager.ParentArbitrator.GetDataStore().SideChainStore.RemoveSideChainTxs(receivedTxs)
 		if err != nil {
 			return err
 		}
 
-		err = store.FinishedTxsDbCache.AddSucceedWithdrawTxs(receivedTxs)
+		err = sideManager.ParentArbitrator.GetFinishedTxsStore().AddSucceedWithdrawTxs(receivedTxs)
 		if err != nil {
 			return err
 		}
@@ -62,20 +63,22 @@ func (sideManager *SideChainManagerImpl) CheckAndRemoveWithdrawTransactionsFromD
 	return nil
 }
 
-func Init() {
-	currentArbitrator, ok := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().(*arbitrator.ArbitratorImpl)
-	if !ok {
-		return
+// NewSideChainManager creates the manager of the side chains configured for
+// the arbitrator, side chain pow transactions are sent by auxPow.
+func NewSideChainManager(ar arbitrator.Arbitrator, auxPow *sideauxpow.SideAuxPow) *SideChainManagerImpl {
+	sideChainManager := &SideChainManagerImpl{
+		ParentArbitrator: ar,
+		SideChains:       make(map[string]arbitrator.SideChain),
 	}
-
-	sideChainManager := &SideChainManagerImpl{SideChains: make(map[string]arbitrator.SideChain)}
-	for _, sideConfig := range config.Parameters.SideNodeList {
+	for _, sideConfig := range ar.GetConfig().SideNodeList {
 		side := &SideChainImpl{
-			Key:           sideConfig.GenesisBlockAddress,
-			CurrentConfig: sideConfig,
+			Key:              sideConfig.GenesisBlockAddress,
+			CurrentConfig:    sideConfig,
+			ParentArbitrator: ar,
+			AuxPow:           auxPow,
 		}
 
 		sideChainManager.AddChain(sideConfig.GenesisBlockAddress, side)
 	}
-	currentArbitrator.SetSideChainManager(sideChainManager)
+	return sideChainManager
 }
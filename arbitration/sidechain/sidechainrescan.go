@@ -0,0 +1,102 @@
+package sidechain
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+// RescanSideChain rewinds the monitor of the side chain to the given height,
+// heights after it will be scanned again by the next sync round. Withdraw
+// transactions already recorded are skipped, so a rescan is safe to repeat.
+func (monitor *SideChainAccountMonitorImpl) RescanSideChain(genesisAddress string, height uint32) error {
+	var found bool
+	for _, node := range monitor.ParentArbitrator.GetConfig().SideNodeList {
+		if node.GenesisBlockAddress == genesisAddress {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("unknown side chain genesis address " + genesisAddress)
+	}
+
+	monitor.mux.Lock()
+	defer monitor.mux.Unlock()
+	if monitor.rescanRequests == nil {
+		monitor.rescanRequests = make(map[string]uint32)
+		monitor.rescanProgress = make(map[string]*base.RescanProgress)
+	}
+	monitor.rescanRequests[genesisAddress] = height
+	monitor.rescanProgress[genesisAddress] = &base.RescanProgress{
+		StartHeight:   height,
+		CurrentHeight: height,
+	}
+	log.Withdraw.Info("[RescanSideChain] rescan side chain", log.Chain(genesisAddress), log.Height(height))
+	return nil
+}
+
+// GetRescanProgress returns the progress of the last rescan of the side chain.
+func (monitor *SideChainAccountMonitorImpl) GetRescanProgress(genesisAddress string) (*base.RescanProgress, bool) {
+	monitor.mux.Lock()
+	defer monitor.mux.Unlock()
+
+	progress, ok := monitor.rescanProgress[genesisAddress]
+	if !ok {
+		return nil, false
+	}
+	p := *progress
+	return &p, true
+}
+
+// rescanRequested returns if a rescan of the side chain is waiting to start.
+func (monitor *SideChainAccountMonitorImpl) rescanRequested(genesisAddress string) bool {
+	monitor.mux.Lock()
+	defer monitor.mux.Unlock()
+
+	_, ok := monitor.rescanRequests[genesisAddress]
+	return ok
+}
+
+// startRequestedRescan rewinds the stored height of the side chain if a rescan
+// has been requested.
+func (monitor *SideChainAccountMonitorImpl) startRequestedRescan(genesisAddress string) {
+	monitor.mux.Lock()
+	defer monitor.mux.Unlock()
+
+	height, ok := monitor.rescanRequests[genesisAddress]
+	if !ok {
+		return
+	}
+	delete(monitor.rescanRequests, genesisAddress)
+
+	progress := monitor.rescanProgress[genesisAddress]
+	if err := monitor.ParentArbitrator.GetDataStore().SideChainStore.SetCurrentSideHeight(genesisAddress, height); err != nil {
+		log.Withdraw.Error("[RescanSideChain] set side chain height failed", log.Chain(genesisAddress), log.Err(err))
+		progress.Error = err.Error()
+		progress.Finished = true
+	}
+}
+
+// updateRescanProgress records the scanned height of a running rescan.
+func (monitor *SideChainAccountMonitorImpl) updateRescanProgress(genesisAddress string, currentHeight, chainHeight uint32) {
+	monitor.mux.Lock()
+	defer monitor.mux.Unlock()
+
+	progress, ok := monitor.rescanProgress[genesisAddress]
+	if !ok || progress.Finished {
+		return
+	}
+	if _, ok := monitor.rescanRequests[genesisAddress]; ok {
+		return
+	}
+	if progress.TargetHeight == 0 {
+		progress.TargetHeight = chainHeight
+	}
+	progress.CurrentHeight = currentHeight
+	if currentHeight >= progress.TargetHeight {
+		progress.Finished = true
+		log.Withdraw.Info("[RescanSideChain] rescan finished", log.Chain(genesisAddress), log.Height(currentHeight))
+	}
+}
@@ -0,0 +1,135 @@
+package sidechain
+
+import (
+	"context"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+)
+
+const (
+	// sideChainBatchSize is the count of heights fetched in one batch request.
+	sideChainBatchSize uint32 = 100
+
+	// defaultSyncWindowSize is the count of heights fetched concurrently when
+	// the side node config does not set SyncWindowSize.
+	defaultSyncWindowSize uint32 = 1000
+
+	// withdrawConfirmations is the count of blocks a withdraw transaction
+	// need to be confirmed on side chain before processed.
+	withdrawConfirmations uint32 = 6
+)
+
+// scanResult is the fetched side chain data of heights in (from, to].
+type scanResult struct {
+	from      uint32
+	to        uint32
+	withdraws [][]*base.WithdrawTxInfo
+	evidences [][]*base.SidechainIllegalDataInfo
+	err       error
+}
+
+// scanHeights fetches side chain data of heights in (currentHeight,
+// chainHeight] by a bounded pipeline of batch requests, and applies the
+// results in height order. Progress is persisted only for heights whose
+// results are fully applied, the last applied height is returned.
+func (monitor *SideChainAccountMonitorImpl) scanHeights(
+	sideNode *config.SideNodeConfig, currentHeight, chainHeight uint32) uint32 {
+	window := sideNode.SyncWindowSize
+	if window == 0 {
+		window = defaultSyncWindowSize
+	}
+	batchSize := sideChainBatchSize
+	if window < batchSize {
+		batchSize = window
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// every pending channel is a batch in flight, the capacity of the queue
+	// bounds the count of heights fetched concurrently to the window size.
+	pending := make(chan chan *scanResult, window/batchSize)
+	go func() {
+		defer close(pending)
+		for from := currentHeight; from < chainHeight; {
+			to := from + batchSize
+			if to > chainHeight {
+				to = chainHeight
+			}
+			result := make(chan *scanResult, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func(from, to uint32) {
+				result <- monitor.fetchHeights(ctx, sideNode, from, to)
+			}(from, to)
+			from = to
+		}
+	}()
+
+	lastLogged := currentHeight
+	for result := range pending {
+		r := <-result
+		if r.err != nil {
+			log.Withdraw.Error("[SyncSideChain] get side chain data failed", log.Chain(sideNode.GenesisBlockAddress),
+				log.Height(r.from+1), log.F("ip", sideNode.Rpc.IpAddress), log.F("port", sideNode.Rpc.HttpJsonPort),
+				log.Err(r.err))
+			break
+		}
+
+		monitor.applyHeights(sideNode.GenesisBlockAddress, r)
+		currentHeight = monitor.ParentArbitrator.GetDataStore().SideChainStore.CurrentSideHeight(
+			sideNode.GenesisBlockAddress, r.to)
+		monitor.updateRescanProgress(sideNode.GenesisBlockAddress, currentHeight, chainHeight)
+		if monitor.rescanRequested(sideNode.GenesisBlockAddress) {
+			log.Withdraw.Info("[SyncSideChain] stop scan for rescan request", log.Chain(sideNode.GenesisBlockAddress))
+			break
+		}
+		if currentHeight-lastLogged >= sideChainHeightInterval {
+			lastLogged = currentHeight
+			log.Withdraw.Info("[SyncSideChain] side chain synced", log.Chain(sideNode.GenesisBlockAddress),
+				log.Height(currentHeight))
+		}
+	}
+
+	return currentHeight
+}
+
+func (monitor *SideChainAccountMonitorImpl) fetchHeights(ctx context.Context,
+	sideNode *config.SideNodeConfig, from, to uint32) *scanResult {
+	var withdrawHeights, evidenceHeights []uint32
+	for h := from + 1; h <= to; h++ {
+		if h > withdrawConfirmations {
+			withdrawHeights = append(withdrawHeights, h-withdrawConfirmations)
+		}
+		evidenceHeights = append(evidenceHeights, h)
+	}
+
+	withdraws, evidences, err := rpc.GetWithdrawTxsAndEvidencesByHeights(
+		ctx, withdrawHeights, evidenceHeights, sideNode.Rpc)
+	return &scanResult{
+		from:      from,
+		to:        to,
+		withdraws: withdraws,
+		evidences: evidences,
+		err:       err,
+	}
+}
+
+func (monitor *SideChainAccountMonitorImpl) applyHeights(
+	genesisAddress string, r *scanResult) {
+	withdraws := r.withdraws
+	for i, height := 0, r.from+1; height <= r.to; i, height = i+1, height+1 {
+		if height > withdrawConfirmations {
+			monitor.processTransactions(withdraws[0], genesisAddress,
+				height-withdrawConfirmations)
+			withdraws = withdraws[1:]
+		}
+		monitor.processIllegalEvidences(r.evidences[i], genesisAddress, height)
+	}
+}
@@ -0,0 +1,262 @@
+package sidechain
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	scanGenesisAddress  = "XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ"
+	scanWithdrawAddress = "EbgLkYci91V9VMzyBnCs2kLYVuXHfCTkd6"
+)
+
+// scanSideNode is a side node serving a withdraw transaction in every block,
+// by batch requests or, if noBatch is set, by single requests only. Blocks
+// of lower heights are answered slower, so batches complete out of order.
+type scanSideNode struct {
+	mux     sync.Mutex
+	height  uint32
+	noBatch bool
+	batches int
+}
+
+type scanRequest struct {
+	ID     int64             `json:"id"`
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+func (n *scanSideNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var requests []scanRequest
+	if err := json.Unmarshal(body, &requests); err == nil {
+		n.mux.Lock()
+		n.batches++
+		noBatch := n.noBatch
+		n.mux.Unlock()
+		if noBatch {
+			w.Write([]byte(`{"id":null,"jsonrpc":"2.0","result":null,"error":{"code":-32700,"message":"invalid request"}}`))
+			return
+		}
+		n.delay(requests[0])
+		var responses []map[string]interface{}
+		for _, req := range requests {
+			responses = append(responses, n.answer(req))
+		}
+		data, _ := json.Marshal(responses)
+		w.Write(data)
+		return
+	}
+	var req scanRequest
+	json.Unmarshal(body, &req)
+	n.delay(req)
+	data, _ := json.Marshal(n.answer(req))
+	w.Write(data)
+}
+
+func (n *scanSideNode) answer(req scanRequest) map[string]interface{} {
+	n.mux.Lock()
+	chainHeight := n.height
+	n.mux.Unlock()
+
+	resp := map[string]interface{}{"id": req.ID, "jsonrpc": "2.0"}
+	height, _ := strconv.Atoi(req.Params["height"])
+	switch req.Method {
+	case "getblockcount":
+		resp["result"] = chainHeight + 1
+	case "getwithdrawtransactionsbyheight":
+		resp["result"] = []*base.WithdrawTxInfo{scanWithdraw(uint32(height))}
+	case "getillegalevidencebyheight":
+		resp["result"] = []*base.SidechainIllegalDataInfo{}
+	default:
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+	return resp
+}
+
+// delay answers the requests of lower heights slower.
+func (n *scanSideNode) delay(req scanRequest) {
+	n.mux.Lock()
+	chainHeight := n.height
+	n.mux.Unlock()
+
+	if height, err := strconv.Atoi(req.Params["height"]); err == nil {
+		time.Sleep(time.Duration(chainHeight-uint32(height)) * 100 * time.Microsecond)
+	}
+}
+
+func (n *scanSideNode) setHeight(height uint32) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.height = height
+}
+
+func (n *scanSideNode) batchCount() int {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.batches
+}
+
+func scanWithdraw(height uint32) *base.WithdrawTxInfo {
+	hash := common.Hash([]byte("withdraw " + strconv.Itoa(int(height))))
+	return &base.WithdrawTxInfo{
+		TxID: common.BytesToHexString(hash.Bytes()),
+		CrossChainAssets: []*base.WithdrawOutputInfo{{
+			CrossChainAddress: scanWithdrawAddress,
+			CrossChainAmount:  "0.9",
+			OutputAmount:      "1",
+		}},
+	}
+}
+
+// scanArbitrator serves the stores of the monitor, and is never on duty.
+type scanArbitrator struct {
+	arbitrator.Arbitrator
+	dataStore   *store.DataStoreImpl
+	finishedTxs store.FinishedTransactionsDataStore
+}
+
+func (a *scanArbitrator) GetDataStore() *store.DataStoreImpl { return a.dataStore }
+
+func (a *scanArbitrator) GetFinishedTxsStore() store.FinishedTransactionsDataStore {
+	return a.finishedTxs
+}
+
+func (a *scanArbitrator) IsOnDutyOfMain() bool { return false }
+
+// scanListener records the heights withdraw transactions are found at.
+type scanListener struct {
+	base.AccountListener
+	heights []uint32
+}
+
+func (l *scanListener) GetAccountAddress() string { return scanGenesisAddress }
+
+func (l *scanListener) OnUTXOChanged(withdrawTxs []*base.WithdrawTx, blockHeight uint32) error {
+	l.heights = append(l.heights, blockHeight)
+	return nil
+}
+
+func (l *scanListener) OnIllegalEvidenceFound(evidence *payload.SidechainIllegalData) error {
+	return nil
+}
+
+func newScanSideNode(t *testing.T, height uint32) (*scanSideNode, *config.SideNodeConfig, func()) {
+	node := &scanSideNode{height: height}
+	server := httptest.NewServer(node)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	p, _ := strconv.Atoi(port)
+	sideNode := &config.SideNodeConfig{
+		Rpc:                 &config.RpcConfig{IpAddress: host, HttpJsonPort: p},
+		GenesisBlockAddress: scanGenesisAddress,
+	}
+	return node, sideNode, server.Close
+}
+
+// openScanMonitor opens the stores in dir and returns a monitor on them.
+func openScanMonitor(t *testing.T, dir string, sideNode *config.SideNodeConfig) (
+	*SideChainAccountMonitorImpl, *scanListener, func()) {
+	dataStore, err := store.OpenDataStore(dir, []*config.SideNodeConfig{sideNode})
+	assert.NoError(t, err)
+	finishedTxs, err := store.OpenFinishedTxsDataStore(dir)
+	assert.NoError(t, err)
+
+	listener := &scanListener{}
+	monitor := &SideChainAccountMonitorImpl{ParentArbitrator: &scanArbitrator{
+		dataStore:   dataStore,
+		finishedTxs: finishedTxs,
+	}}
+	monitor.AddListener(listener)
+	return monitor, listener, func() {
+		dataStore.Close()
+		finishedTxs.Close()
+	}
+}
+
+func scanHeightsRange(from, to uint32) []uint32 {
+	var heights []uint32
+	for h := from; h <= to; h++ {
+		heights = append(heights, h)
+	}
+	return heights
+}
+
+func TestSideChainAccountMonitor_ScanInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidechainscanner")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, sideNode, closeNode := newScanSideNode(t, 350)
+	defer closeNode()
+	monitor, listener, closeMonitor := openScanMonitor(t, dir, sideNode)
+	defer closeMonitor()
+
+	// the batches of 100 heights are fetched concurrently and complete in
+	// reverse order, withdraws are applied in height order still.
+	monitor.SyncFromSideNode(sideNode)
+	assert.Equal(t, scanHeightsRange(1, 350-withdrawConfirmations), listener.heights)
+	assert.Equal(t, uint32(350), monitor.ParentArbitrator.GetDataStore().
+		SideChainStore.CurrentSideHeight(scanGenesisAddress, store.QueryHeightCode))
+}
+
+func TestSideChainAccountMonitor_ScanResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidechainscanner")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	node, sideNode, closeNode := newScanSideNode(t, 20)
+	defer closeNode()
+
+	monitor, listener, closeMonitor := openScanMonitor(t, dir, sideNode)
+	monitor.SyncFromSideNode(sideNode)
+	assert.Equal(t, scanHeightsRange(1, 20-withdrawConfirmations), listener.heights)
+	closeMonitor()
+
+	// the progress is kept across restarts, only the new blocks are scanned.
+	node.setHeight(30)
+	monitor, listener, closeMonitor = openScanMonitor(t, dir, sideNode)
+	defer closeMonitor()
+	monitor.SyncFromSideNode(sideNode)
+	assert.Equal(t, scanHeightsRange(20-withdrawConfirmations+1, 30-withdrawConfirmations),
+		listener.heights)
+}
+
+func TestSideChainAccountMonitor_ScanWithoutBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidechainscanner")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	node, sideNode, closeNode := newScanSideNode(t, 20)
+	defer closeNode()
+	node.noBatch = true
+	monitor, listener, closeMonitor := openScanMonitor(t, dir, sideNode)
+	defer closeMonitor()
+
+	// the node answers batch requests by an error, the heights are fetched
+	// by single requests instead.
+	monitor.SyncFromSideNode(sideNode)
+	assert.Equal(t, scanHeightsRange(1, 20-withdrawConfirmations), listener.heights)
+	batches := node.batchCount()
+	assert.True(t, batches > 0)
+
+	// the node is not sent batch requests any more.
+	node.setHeight(30)
+	monitor.SyncFromSideNode(sideNode)
+	assert.Equal(t, scanHeightsRange(1, 30-withdrawConfirmations), listener.heights)
+	assert.Equal(t, batches, node.batchCount())
+}
@@ -0,0 +1,265 @@
+package sidechain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/metrics"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// SolvencyReport is the last reconciliation of the ELA locked in the genesis
+// address of a side chain and the amounts owed by it, amounts are in sela of
+// main chain.
+//
+// Side nodes do not serve the cross chain supply of side chain, so it is
+// counted by the arbiter: the bridge is taken as solvent when a side chain
+// is reconciled the first time, and the supply then is the baseline. Since
+// then the supply is increased by the deposit transactions found on main
+// chain and minted on side chain, and decreased by the withdraw transactions
+// found on side chain.
+type SolvencyReport struct {
+	GenesisAddress string
+	Time           time.Time
+
+	// MainChainLocked is the amount of UTXOs of the genesis address.
+	MainChainLocked common.Fixed64
+
+	// SideChainSupply is the cross chain supply of the side chain.
+	SideChainSupply common.Fixed64
+
+	// PendingDeposits are locked on main chain but not minted on side chain.
+	PendingDeposits common.Fixed64
+
+	// DeadLetterDeposits are locked on main chain but failed to be minted on
+	// side chain, they are minted if re-driven.
+	DeadLetterDeposits common.Fixed64
+
+	// PendingWithdraws are burned on side chain but not released on main
+	// chain.
+	PendingWithdraws common.Fixed64
+
+	// FailedWithdraws are burned on side chain but failed on main chain, they
+	// are released if re-driven.
+	FailedWithdraws common.Fixed64
+
+	// RejectedWithdraws are burned on side chain but rejected by operator,
+	// they stay locked on main chain.
+	RejectedWithdraws common.Fixed64
+
+	// Delta is MainChainLocked minus all the other amounts, it is zero if the
+	// bridge is solvent.
+	Delta common.Fixed64
+	Alert bool
+	Error string
+}
+
+// SolvencyReconciler reconciles the side chains of an arbitrator and keeps
+// the last report of each.
+type SolvencyReconciler struct {
+	ParentArbitrator arbitrator.Arbitrator
+
+	mux     sync.Mutex
+	reports map[string]*SolvencyReport
+}
+
+func NewSolvencyReconciler(ar arbitrator.Arbitrator) *SolvencyReconciler {
+	return &SolvencyReconciler{
+		ParentArbitrator: ar,
+		reports:          make(map[string]*SolvencyReport),
+	}
+}
+
+// ReconcileLoop reconciles each side chain periodically, an alert is raised
+// if the delta of a side chain exceeds SolvencyTolerance.
+func (s *SolvencyReconciler) ReconcileLoop(ctx context.Context) {
+	cfg := s.ParentArbitrator.GetConfig()
+	if cfg.SolvencyCheckInterval <= 0 {
+		log.Solvency.Info("[SolvencyReconcileLoop] solvency reconciliation disabled")
+		return
+	}
+	for {
+		for _, node := range cfg.SideNodeList {
+			report := s.reconcileSideChain(node)
+			s.publishSolvencyReport(report)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * cfg.SolvencyCheckInterval):
+		}
+	}
+}
+
+// GetReports returns the last reports of the side chains in the order of
+// configuration.
+func (s *SolvencyReconciler) GetReports() []*SolvencyReport {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var reports []*SolvencyReport
+	for _, node := range s.ParentArbitrator.GetConfig().SideNodeList {
+		if report, ok := s.reports[node.GenesisBlockAddress]; ok {
+			r := *report
+			reports = append(reports, &r)
+		}
+	}
+	return reports
+}
+
+func (s *SolvencyReconciler) reconcileSideChain(node *config.SideNodeConfig) *SolvencyReport {
+	report := &SolvencyReport{
+		GenesisAddress: node.GenesisBlockAddress,
+		Time:           time.Now(),
+	}
+	if err := s.collectSolvencyAmounts(node, report); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.reconcile(common.Fixed64(s.ParentArbitrator.GetConfig().SolvencyTolerance))
+	return report
+}
+
+func (r *SolvencyReport) reconcile(tolerance common.Fixed64) {
+	r.Delta = r.MainChainLocked - r.SideChainSupply - r.PendingDeposits - r.DeadLetterDeposits -
+		r.PendingWithdraws - r.FailedWithdraws - r.RejectedWithdraws
+	r.Alert = r.Delta > tolerance || r.Delta < -tolerance
+}
+
+func (s *SolvencyReconciler) collectSolvencyAmounts(node *config.SideNodeConfig, report *SolvencyReport) error {
+	if node.ExchangeRate == nil {
+		return errors.New("side chain has no exchange rate")
+	}
+
+	utxos, err := rpc.GetUnspentUtxo([]string{node.GenesisBlockAddress}, s.ParentArbitrator.GetConfig().MainNode.Rpc)
+	if err != nil {
+		return errors.New("get genesis address utxos failed: " + err.Error())
+	}
+	for _, utxo := range utxos {
+		amount, err := common.StringToFixed64(utxo.Amount)
+		if err != nil {
+			return err
+		}
+		report.MainChainLocked += *amount
+	}
+
+	dataStore := s.ParentArbitrator.GetDataStore()
+	deposits, err := dataStore.MainChainStore.GetAllMainChainTxs()
+	if err != nil {
+		return err
+	}
+	for _, deposit := range deposits {
+		if deposit.GenesisBlockAddress != node.GenesisBlockAddress {
+			continue
+		}
+		amount, err := base.GetDepositAmount(deposit.Transaction, node.GenesisBlockAddress)
+		if err != nil {
+			return err
+		}
+		report.PendingDeposits += amount
+	}
+
+	finishedTxsStore := s.ParentArbitrator.GetFinishedTxsStore()
+	deadLetters, err := finishedTxsStore.GetDeadLetterDepositTxs()
+	if err != nil {
+		return err
+	}
+	for _, deadLetter := range deadLetters {
+		if deadLetter.GenesisBlockAddress != node.GenesisBlockAddress {
+			continue
+		}
+		amount, err := base.GetDepositAmount(deadLetter.Transaction, node.GenesisBlockAddress)
+		if err != nil {
+			return err
+		}
+		report.DeadLetterDeposits += amount
+	}
+
+	hashes, _, err := dataStore.SideChainStore.GetAllSideChainTxHashesAndHeights(node.GenesisBlockAddress)
+	if err != nil {
+		return err
+	}
+	if len(hashes) != 0 {
+		withdraws, err := dataStore.SideChainStore.GetSideChainTxsFromHashes(hashes)
+		if err != nil {
+			return err
+		}
+		for _, withdraw := range withdraws {
+			amount, err := base.GetWithdrawAmount(withdraw, node.ExchangeRate)
+			if err != nil {
+				return err
+			}
+			report.PendingWithdraws += amount
+		}
+	}
+
+	flows, err := finishedTxsStore.GetSolvencyFlows(node.GenesisBlockAddress)
+	if err != nil {
+		return err
+	}
+	report.FailedWithdraws = flows.Failed
+	report.RejectedWithdraws = flows.Rejected
+
+	baseline, ok, err := finishedTxsStore.GetSolvencyBaseline(node.GenesisBlockAddress)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// the baseline makes the delta of the first reconciliation zero.
+		baseline = report.MainChainLocked - flows.Deposited + flows.Withdrawn -
+			report.PendingWithdraws - report.FailedWithdraws - report.RejectedWithdraws
+		if err := finishedTxsStore.AddSolvencyBaseline(node.GenesisBlockAddress, baseline); err != nil {
+			return err
+		}
+	}
+	report.SideChainSupply = baseline + flows.Deposited - flows.Withdrawn -
+		report.PendingDeposits - report.DeadLetterDeposits
+	return nil
+}
+
+func (s *SolvencyReconciler) publishSolvencyReport(report *SolvencyReport) {
+	s.mux.Lock()
+	s.reports[report.GenesisAddress] = report
+	s.mux.Unlock()
+
+	prefix := "solvency." + report.GenesisAddress + "."
+	if report.Error != "" {
+		log.Solvency.Warn("[SolvencyReconcileLoop] reconcile side chain failed",
+			log.Chain(report.GenesisAddress), log.F("err", report.Error))
+		metrics.AddCounter(prefix+"errors", 1)
+		return
+	}
+	metrics.SetGauge(prefix+"mainchainlocked", int64(report.MainChainLocked))
+	metrics.SetGauge(prefix+"sidechainsupply", int64(report.SideChainSupply))
+	metrics.SetGauge(prefix+"pendingdeposits", int64(report.PendingDeposits))
+	metrics.SetGauge(prefix+"deadletterdeposits", int64(report.DeadLetterDeposits))
+	metrics.SetGauge(prefix+"pendingwithdraws", int64(report.PendingWithdraws))
+	metrics.SetGauge(prefix+"failedwithdraws", int64(report.FailedWithdraws))
+	metrics.SetGauge(prefix+"rejectedwithdraws", int64(report.RejectedWithdraws))
+	metrics.SetGauge(prefix+"delta", int64(report.Delta))
+	if report.Alert {
+		metrics.SetGauge(prefix+"alert", 1)
+		metrics.AddCounter("solvency.alerts", 1)
+		log.Solvency.Error("[SolvencyReconcileLoop] ALERT side chain drift",
+			log.Chain(report.GenesisAddress), log.F("drift", report.Delta),
+			log.F("mainchainlocked", report.MainChainLocked),
+			log.F("sidechainsupply", report.SideChainSupply),
+			log.F("pendingdeposits", report.PendingDeposits),
+			log.F("deadletterdeposits", report.DeadLetterDeposits),
+			log.F("pendingwithdraws", report.PendingWithdraws),
+			log.F("failedwithdraws", report.FailedWithdraws),
+			log.F("rejectedwithdraws", report.RejectedWithdraws))
+	} else {
+		metrics.SetGauge(prefix+"alert", 0)
+		log.Solvency.Info("[SolvencyReconcileLoop] side chain reconciled",
+			log.Chain(report.GenesisAddress), log.F("drift", report.Delta))
+	}
+}
@@ -0,0 +1,209 @@
+package sidechain
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolvencyReport_Reconcile(t *testing.T) {
+	report := &SolvencyReport{
+		MainChainLocked:    1000,
+		SideChainSupply:    700,
+		PendingDeposits:    150,
+		DeadLetterDeposits: 60,
+		PendingWithdraws:   50,
+		FailedWithdraws:    30,
+		RejectedWithdraws:  10,
+	}
+	report.reconcile(0)
+	assert.Equal(t, 0, int(report.Delta))
+	assert.False(t, report.Alert)
+
+	// more locked than owed
+	report.MainChainLocked = 1010
+	report.reconcile(10)
+	assert.Equal(t, 10, int(report.Delta))
+	assert.False(t, report.Alert)
+	report.reconcile(9)
+	assert.True(t, report.Alert)
+
+	// less locked than owed
+	report.MainChainLocked = 980
+	report.reconcile(10)
+	assert.Equal(t, -20, int(report.Delta))
+	assert.True(t, report.Alert)
+}
+
+// solvencyMainNode serves the UTXO of the locked amount of the genesis
+// address by listunspent.
+type solvencyMainNode struct {
+	mux    sync.Mutex
+	locked common.Fixed64
+}
+
+func (n *solvencyMainNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mux.Lock()
+	locked := n.locked
+	n.mux.Unlock()
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":      0,
+		"jsonrpc": "2.0",
+		"result": []base.UTXOInfo{{
+			Address: scanGenesisAddress,
+			Amount:  locked.String(),
+		}},
+	})
+	w.Write(data)
+}
+
+func (n *solvencyMainNode) setLocked(locked common.Fixed64) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.locked = locked
+}
+
+// solvencyArbitrator serves the config and the stores of the reconciler.
+type solvencyArbitrator struct {
+	arbitrator.Arbitrator
+	config      *config.Configuration
+	dataStore   *store.DataStoreImpl
+	finishedTxs store.FinishedTransactionsDataStore
+}
+
+func (a *solvencyArbitrator) GetConfig() *config.Configuration { return a.config }
+
+func (a *solvencyArbitrator) GetDataStore() *store.DataStoreImpl { return a.dataStore }
+
+func (a *solvencyArbitrator) GetFinishedTxsStore() store.FinishedTransactionsDataStore {
+	return a.finishedTxs
+}
+
+func newSolvencyDeposit(t *testing.T, amount common.Fixed64) *base.MainChainTransaction {
+	programHash, err := common.Uint168FromAddress(scanGenesisAddress)
+	assert.NoError(t, err)
+	tx := &types.Transaction{
+		TxType:  types.TransferCrossChainAsset,
+		Payload: &payload.TransferCrossChainAsset{},
+		Outputs: []*types.Output{{ProgramHash: *programHash, Value: amount}},
+	}
+	return &base.MainChainTransaction{
+		TransactionHash:     tx.Hash().String(),
+		GenesisBlockAddress: scanGenesisAddress,
+		Transaction:         tx,
+		Proof:               &bloom.MerkleProof{},
+	}
+}
+
+func TestSolvencyReconciler_Reconcile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solvency")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mainNode := &solvencyMainNode{locked: 1000}
+	server := httptest.NewServer(mainNode)
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	p, _ := strconv.Atoi(port)
+
+	rate, err := base.NewExchangeRate("1")
+	assert.NoError(t, err)
+	sideNode := &config.SideNodeConfig{GenesisBlockAddress: scanGenesisAddress, ExchangeRate: rate}
+	dataStore, err := store.OpenDataStore(dir, []*config.SideNodeConfig{sideNode})
+	assert.NoError(t, err)
+	defer dataStore.Close()
+	finishedTxs, err := store.OpenFinishedTxsDataStore(dir)
+	assert.NoError(t, err)
+	defer finishedTxs.Close()
+
+	reconciler := NewSolvencyReconciler(&solvencyArbitrator{
+		config: &config.Configuration{
+			MainNode:          &config.MainNodeConfig{Rpc: &config.RpcConfig{IpAddress: host, HttpJsonPort: p}},
+			SideNodeList:      []*config.SideNodeConfig{sideNode},
+			SolvencyTolerance: 10,
+		},
+		dataStore:   dataStore,
+		finishedTxs: finishedTxs,
+	})
+	reconcile := func(supply, delta common.Fixed64) *SolvencyReport {
+		report := reconciler.reconcileSideChain(sideNode)
+		assert.Equal(t, "", report.Error)
+		assert.Equal(t, supply, report.SideChainSupply)
+		assert.Equal(t, delta, report.Delta)
+		return report
+	}
+
+	// the bridge is taken as solvent at the first reconciliation
+	reconcile(1000, 0)
+
+	// a deposit locked on main chain and not minted yet
+	deposit := newSolvencyDeposit(t, 200)
+	_, err = dataStore.MainChainStore.AddMainChainTxs([]*base.MainChainTransaction{deposit})
+	assert.NoError(t, err)
+	assert.NoError(t, finishedTxs.AddSolvencyFlows([]*store.SolvencyFlow{{
+		TransactionHash:     deposit.TransactionHash,
+		GenesisBlockAddress: scanGenesisAddress,
+		Deposit:             true,
+		Amount:              200,
+	}}))
+	mainNode.setLocked(1200)
+	report := reconcile(1000, 0)
+	assert.Equal(t, common.Fixed64(200), report.PendingDeposits)
+
+	// the deposit is dead lettered, it is not minted and still owed
+	assert.NoError(t, finishedTxs.AddDeadLetterDepositTx(&store.DeadLetterDepositTx{
+		TransactionHash:     deposit.TransactionHash,
+		GenesisBlockAddress: scanGenesisAddress,
+		Transaction:         deposit.Transaction,
+		Proof:               deposit.Proof,
+	}))
+	assert.NoError(t, dataStore.MainChainStore.RemoveMainChainTxs(
+		[]string{deposit.TransactionHash}, []string{scanGenesisAddress}))
+	report = reconcile(1000, 0)
+	assert.Equal(t, common.Fixed64(0), report.PendingDeposits)
+	assert.Equal(t, common.Fixed64(200), report.DeadLetterDeposits)
+
+	// a withdraw burned on side chain and not released yet
+	withdraw, withdrawStored := newHeldWithdrawTx(t, 1, 100)
+	assert.NoError(t, dataStore.SideChainStore.AddSideChainTxs(
+		[]*base.SideChainTransaction{withdrawStored}))
+	assert.NoError(t, finishedTxs.AddSolvencyFlows([]*store.SolvencyFlow{{
+		TransactionHash:     withdraw.Txid.String(),
+		GenesisBlockAddress: scanGenesisAddress,
+		Amount:              100,
+	}}))
+	report = reconcile(900, 0)
+	assert.Equal(t, common.Fixed64(100), report.PendingWithdraws)
+
+	// the withdraw is rejected by signers, it stays locked and owed
+	assert.NoError(t, finishedTxs.AddRejectedWithdrawTx(withdraw.Txid.String(), scanGenesisAddress,
+		withdrawStored.Transaction, "too large"))
+	assert.NoError(t, dataStore.SideChainStore.RemoveSideChainTxs([]string{withdraw.Txid.String()}))
+	report = reconcile(900, 0)
+	assert.Equal(t, common.Fixed64(0), report.PendingWithdraws)
+	assert.Equal(t, common.Fixed64(100), report.RejectedWithdraws)
+	assert.False(t, report.Alert)
+
+	// ELA leaves the genesis address without a withdraw
+	mainNode.setLocked(1150)
+	report = reconcile(900, -50)
+	assert.True(t, report.Alert)
+}
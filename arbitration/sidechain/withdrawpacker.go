@@ -0,0 +1,163 @@
+package sidechain
+
+import (
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/crypto"
+)
+
+// withdrawBuilder creates a main chain withdraw transaction of the side
+// chain withdraw transactions, it returns nil if failed.
+type withdrawBuilder func(withdrawTxs []*base.WithdrawTx,
+	mcFunc arbitrator.MainChainFunc) *types.Transaction
+
+// withdrawPacker splits side chain withdraw transactions into main chain
+// withdraw transactions, each one is bounded by count and size, and spends
+// UTXOs not spent by the others.
+type withdrawPacker struct {
+	build   withdrawBuilder
+	mcFunc  *unusedUTXOsFunc
+	maxTxs  int
+	maxSize int
+}
+
+func newWithdrawPacker(build withdrawBuilder, mcFunc arbitrator.MainChainFunc,
+	maxTxs int, maxSize int) *withdrawPacker {
+	return &withdrawPacker{
+		build:   build,
+		mcFunc:  newUnusedUTXOsFunc(mcFunc),
+		maxTxs:  maxTxs,
+		maxSize: maxSize,
+	}
+}
+
+// pack creates withdraw transactions of the side chain withdraw transactions
+// in order, it stops at the first one can not be packed. The packed count of
+// side chain withdraw transactions is returned.
+func (p *withdrawPacker) pack(withdrawTxs []*base.WithdrawTx) ([]*types.Transaction, int) {
+	var txs []*types.Transaction
+	var packed int
+	for packed < len(withdrawTxs) {
+		tx, count := p.packOne(withdrawTxs[packed:])
+		if tx == nil {
+			break
+		}
+		for _, input := range tx.Inputs {
+			p.mcFunc.use(input.Previous)
+		}
+		txs = append(txs, tx)
+		packed += count
+	}
+	return txs, packed
+}
+
+// packOne creates a withdraw transaction of as many leading side chain
+// withdraw transactions as the size allows.
+func (p *withdrawPacker) packOne(withdrawTxs []*base.WithdrawTx) (*types.Transaction, int) {
+	count := len(withdrawTxs)
+	if p.maxTxs > 0 && count > p.maxTxs {
+		count = p.maxTxs
+	}
+	for count > 0 {
+		tx := p.build(withdrawTxs[:count], p.mcFunc)
+		if tx == nil {
+			return nil, 0
+		}
+		size := estimateSignedSize(tx)
+		if size <= p.maxSize {
+			return tx, count
+		}
+
+		// shrink by the size ratio, at least by one
+		shrunk := int(int64(count) * int64(p.maxSize) / int64(size))
+		if shrunk >= count {
+			shrunk = count - 1
+		}
+		log.Withdraw.Info("[withdrawPacker] transaction size exceeds, shrink side chain transactions",
+			log.F("size", size), log.F("max", p.maxSize), log.F("count", count), log.F("shrunk", shrunk))
+		count = shrunk
+	}
+	return nil, 0
+}
+
+// estimateSignedSize returns the size of the transaction after signed by all
+// signers of its redeem script.
+func estimateSignedSize(tx *types.Transaction) int {
+	size := tx.GetSize()
+	for _, p := range tx.Programs {
+		signers := len(p.Code) / (crypto.PublicKeyScriptLength - 1)
+		size += signers * crypto.SignatureScriptLength
+	}
+	return size
+}
+
+// unusedUTXOsFunc hides UTXOs spent by the transactions packed before.
+type unusedUTXOsFunc struct {
+	arbitrator.MainChainFunc
+
+	// utxos are all UTXOs ever returned.
+	utxos map[types.OutPoint]*store.AddressUTXO
+	used  map[types.OutPoint]common.Fixed64
+}
+
+func newUnusedUTXOsFunc(mcFunc arbitrator.MainChainFunc) *unusedUTXOsFunc {
+	return &unusedUTXOsFunc{
+		MainChainFunc: mcFunc,
+		utxos:         make(map[types.OutPoint]*store.AddressUTXO),
+		used:          make(map[types.OutPoint]common.Fixed64),
+	}
+}
+
+func (f *unusedUTXOsFunc) use(op types.OutPoint) {
+	var amount common.Fixed64
+	if utxo, ok := f.utxos[op]; ok {
+		amount = *utxo.Amount
+	}
+	f.used[op] = amount
+}
+
+// reserve hides the UTXO of the amount spent by a transaction not packed by
+// the packer, such as a consolidate transaction pending.
+func (f *unusedUTXOsFunc) reserve(op types.OutPoint, amount common.Fixed64) {
+	f.used[op] = amount
+}
+
+func (f *unusedUTXOsFunc) GetWithdrawUTXOsByAmount(withdrawBank string,
+	amount common.Fixed64) ([]*store.AddressUTXO, error) {
+	// ask for the amount of used UTXOs more, so the unused ones returned still
+	// cover the amount.
+	requested := amount
+	for _, usedAmount := range f.used {
+		requested += usedAmount
+	}
+	utxos, err := f.MainChainFunc.GetWithdrawUTXOsByAmount(withdrawBank, requested)
+	if err != nil {
+		return nil, err
+	}
+	return f.filter(utxos), nil
+}
+
+func (f *unusedUTXOsFunc) GetWithdrawUTXOs(withdrawBank string) ([]*store.AddressUTXO, error) {
+	utxos, err := f.MainChainFunc.GetWithdrawUTXOs(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+	return f.filter(utxos), nil
+}
+
+func (f *unusedUTXOsFunc) filter(utxos []*store.AddressUTXO) []*store.AddressUTXO {
+	var result []*store.AddressUTXO
+	for _, utxo := range utxos {
+		if _, ok := f.used[utxo.Input.Previous]; ok {
+			continue
+		}
+		f.utxos[utxo.Input.Previous] = utxo
+		result = append(result, utxo)
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package sidechain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.Init(".", 5, 0, 0)
+}
+
+type mockMainChainFunc struct {
+	utxos     []*store.AddressUTXO
+	requested []common.Fixed64
+}
+
+func (f *mockMainChainFunc) GetWithdrawUTXOsByAmount(withdrawBank string,
+	amount common.Fixed64) ([]*store.AddressUTXO, error) {
+	f.requested = append(f.requested, amount)
+	var result []*store.AddressUTXO
+	var total common.Fixed64
+	for _, utxo := range f.utxos {
+		if total >= amount {
+			break
+		}
+		total += *utxo.Amount
+		result = append(result, utxo)
+	}
+	return result, nil
+}
+
+func (f *mockMainChainFunc) GetWithdrawUTXOs(withdrawBank string) ([]*store.AddressUTXO, error) {
+	return f.utxos, nil
+}
+
+func (f *mockMainChainFunc) GetMainNodeCurrentHeight() (uint32, error) {
+	return 0, nil
+}
+
+func (f *mockMainChainFunc) GetAmountByInputs(inputs []*types.Input) (common.Fixed64, error) {
+	return 0, errors.New("not supported")
+}
+
+func newMockUTXOs(count int, amount common.Fixed64) []*store.AddressUTXO {
+	var utxos []*store.AddressUTXO
+	for i := 0; i < count; i++ {
+		a := amount
+		utxos = append(utxos, &store.AddressUTXO{
+			Input: &types.Input{
+				Previous: types.OutPoint{Index: uint16(i)},
+			},
+			Amount: &a,
+		})
+	}
+	return utxos
+}
+
+func newMockWithdrawTxs(count int, amount common.Fixed64) []*base.WithdrawTx {
+	var txs []*base.WithdrawTx
+	for i := 0; i < count; i++ {
+		txs = append(txs, &base.WithdrawTx{
+			WithdrawInfo: &base.WithdrawInfo{
+				WithdrawAssets: []*base.WithdrawAsset{
+					{CrossChainAmount: &amount},
+				},
+			},
+		})
+	}
+	return txs
+}
+
+// mockWithdrawBuilder spends UTXOs covering the total amount, and creates one
+// output for each side chain withdraw transaction.
+func mockWithdrawBuilder(withdrawTxs []*base.WithdrawTx,
+	mcFunc arbitrator.MainChainFunc) *types.Transaction {
+	var total common.Fixed64
+	for _, tx := range withdrawTxs {
+		total += *tx.WithdrawInfo.WithdrawAssets[0].CrossChainAmount
+	}
+	utxos, err := mcFunc.GetWithdrawUTXOsByAmount("", total)
+	if err != nil {
+		return nil
+	}
+
+	tx := &types.Transaction{
+		TxType:  types.WithdrawFromSideChain,
+		Payload: &payload.WithdrawFromSideChain{},
+	}
+	var available common.Fixed64
+	for _, utxo := range utxos {
+		if available >= total {
+			break
+		}
+		available += *utxo.Amount
+		tx.Inputs = append(tx.Inputs, utxo.Input)
+	}
+	if available < total {
+		return nil
+	}
+	for _, withdrawTx := range withdrawTxs {
+		tx.Outputs = append(tx.Outputs, &types.Output{
+			Value: *withdrawTx.WithdrawInfo.WithdrawAssets[0].CrossChainAmount,
+		})
+	}
+	return tx
+}
+
+func TestWithdrawPacker_Pack(t *testing.T) {
+	mcFunc := &mockMainChainFunc{utxos: newMockUTXOs(10, 100)}
+	packer := newWithdrawPacker(mockWithdrawBuilder, mcFunc, 3, 1000000)
+
+	txs, packed := packer.pack(newMockWithdrawTxs(7, 100))
+	assert.Equal(t, 7, packed)
+	assert.Equal(t, 3, len(txs))
+	assert.Equal(t, 3, len(txs[0].Outputs))
+	assert.Equal(t, 3, len(txs[1].Outputs))
+	assert.Equal(t, 1, len(txs[2].Outputs))
+
+	// inputs of the transactions are disjoint
+	spent := make(map[types.OutPoint]struct{})
+	for _, tx := range txs {
+		for _, input := range tx.Inputs {
+			_, ok := spent[input.Previous]
+			assert.False(t, ok)
+			spent[input.Previous] = struct{}{}
+		}
+	}
+	assert.Equal(t, 7, len(spent))
+
+	// the amount of used UTXOs is requested more
+	assert.Equal(t, []common.Fixed64{300, 600, 700}, mcFunc.requested)
+}
+
+func TestWithdrawPacker_PackBySize(t *testing.T) {
+	// the size allows three side chain withdraw transactions at most
+	sample := mockWithdrawBuilder(newMockWithdrawTxs(3, 100),
+		&mockMainChainFunc{utxos: newMockUTXOs(10, 100)})
+	maxSize := estimateSignedSize(sample)
+
+	mcFunc := &mockMainChainFunc{utxos: newMockUTXOs(10, 100)}
+	packer := newWithdrawPacker(mockWithdrawBuilder, mcFunc, 0, maxSize)
+	txs, packed := packer.pack(newMockWithdrawTxs(6, 100))
+	assert.Equal(t, 6, packed)
+	for _, tx := range txs {
+		assert.True(t, estimateSignedSize(tx) <= maxSize)
+		assert.True(t, len(tx.Outputs) <= 3)
+	}
+}
+
+func TestWithdrawPacker_NotEnoughUTXOs(t *testing.T) {
+	mcFunc := &mockMainChainFunc{utxos: newMockUTXOs(4, 100)}
+	packer := newWithdrawPacker(mockWithdrawBuilder, mcFunc, 3, 1000000)
+
+	// the second transaction can not be covered, only the first is packed
+	txs, packed := packer.pack(newMockWithdrawTxs(6, 100))
+	assert.Equal(t, 1, len(txs))
+	assert.Equal(t, 3, packed)
+}
+
+func TestWithdrawPacker_ReservedUTXOs(t *testing.T) {
+	mcFunc := &mockMainChainFunc{utxos: newMockUTXOs(10, 100)}
+	packer := newWithdrawPacker(mockWithdrawBuilder, mcFunc, 3, 1000000)
+
+	// the UTXOs spent by a consolidate transaction pending are not spent
+	reserved := make(map[types.OutPoint]struct{})
+	for _, utxo := range mcFunc.utxos[:4] {
+		packer.mcFunc.reserve(utxo.Input.Previous, *utxo.Amount)
+		reserved[utxo.Input.Previous] = struct{}{}
+	}
+	txs, packed := packer.pack(newMockWithdrawTxs(6, 100))
+	assert.Equal(t, 6, packed)
+	for _, tx := range txs {
+		for _, input := range tx.Inputs {
+			_, ok := reserved[input.Previous]
+			assert.False(t, ok)
+		}
+	}
+
+	// the rest UTXOs can not cover more
+	_, packed = packer.pack(newMockWithdrawTxs(1, 100))
+	assert.Equal(t, 0, packed)
+}
@@ -0,0 +1,413 @@
+// Package audit keeps an append-only log of the signatures produced by the
+// arbiter. Each entry records what was signed, when, for which proposer and
+// under which policy decision, and is chained to the previous entry by hash,
+// so modifying, removing or reordering entries is detected by Verify.
+//
+// Removing the last entries leaves a valid chain, so it is not detected by the
+// log itself. The sequence and hash of the last entry are logged when the log
+// is opened and returned by Head, comparing them with a copy kept out of the
+// arbiter, such as the node log or a monitor polling verifyauditlog, detects
+// it.
+//
+// The log of an arbiter is handed to the signing code of the arbiter, which
+// records to it by RecordSignature and RecordTx. A signature failed to be
+// recorded is discarded by the signing code rather than sent, so every
+// signature leaving the arbiter has an entry in the log.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/crypto"
+)
+
+// Types of the contents signed.
+const (
+	TypeWithdrawProposal = "withdrawproposal"
+	TypeIllegalEvidence  = "illegalevidence"
+	TypeSideChainPow     = "sidechainpow"
+	TypeSideChainPowTx   = "sidechainpowtx"
+	TypeDivideTx         = "dividetx"
+	TypeHandshake        = "handshake"
+	TypeStatus           = "status"
+)
+
+// Policy decisions the contents are signed under.
+const (
+	// DecisionProposer is of the contents proposed by the arbiter itself.
+	DecisionProposer = "proposer"
+	// DecisionApproved is of the proposals approved by the signing policy.
+	DecisionApproved = "approved"
+	// DecisionUnchecked is of the contents no policy applies to.
+	DecisionUnchecked = "unchecked"
+)
+
+// FileName is the name of the audit log in the data directory.
+const FileName = "audit.log"
+
+// DefaultPath is the path of the audit log in the default data directory.
+var DefaultPath = filepath.Join(config.DataPath, config.DataDir, FileName)
+
+// ErrClosed is returned when recording to a closed log.
+var ErrClosed = errors.New("audit log closed")
+
+// Entry is the record of a signature.
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// ContentHash is the sha256 hash of the data signed in hex.
+	ContentHash string `json:"contenthash"`
+	// Summary is the decoded content, such as the transaction hash.
+	Summary map[string]string `json:"summary"`
+	// Proposer is the public key of the arbiter proposed the content in hex.
+	Proposer string `json:"proposer"`
+	Decision string `json:"decision"`
+	// PrevHash is the hash of the previous entry, empty for the first one.
+	PrevHash string `json:"prevhash"`
+	Hash     string `json:"hash"`
+}
+
+// hash returns the hash of the entry chained to PrevHash.
+func (e *Entry) hash() string {
+	buf := new(bytes.Buffer)
+	common.WriteVarString(buf, e.PrevHash)
+	common.WriteUint64(buf, e.Seq)
+	common.WriteUint64(buf, uint64(e.Time.UnixNano()))
+	common.WriteVarString(buf, e.Type)
+	common.WriteVarString(buf, e.ContentHash)
+	keys := make([]string, 0, len(e.Summary))
+	for key := range e.Summary {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	common.WriteVarUint(buf, uint64(len(keys)))
+	for _, key := range keys {
+		common.WriteVarString(buf, key)
+		common.WriteVarString(buf, e.Summary[key])
+	}
+	common.WriteVarString(buf, e.Proposer)
+	common.WriteVarString(buf, e.Decision)
+
+	hash := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+// Log is an audit log appended to a file, an entry per line in json.
+type Log struct {
+	mux  sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+	last string
+}
+
+// Open opens the audit log of path, the file is created if not exists.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{path: path, file: file}
+	if err := l.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	log.Info("[audit] audit log opened, last entry:", l.seq, "hash:", l.last)
+	return l, nil
+}
+
+// recover loads the last entry of the log. A torn last line left by a crash
+// while appending is moved into the file of path with suffix ".torn" and
+// removed from the log, a complete last entry only missing the line end is
+// kept.
+func (l *Log) recover() error {
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(l.file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		complete := data[len(data)-1] == '\n'
+		e := new(Entry)
+		if decodeErr := json.Unmarshal(data, e); decodeErr != nil {
+			if complete {
+				if _, err := reader.Peek(1); err != io.EOF {
+					return fmt.Errorf("line %d: %s", line, decodeErr)
+				}
+			}
+			return l.quarantine(offset, data)
+		}
+		l.seq, l.last = e.Seq, e.Hash
+		if !complete {
+			log.Warn("[audit] last entry of audit log not ended, entry:", e.Seq)
+			_, err := l.file.Write([]byte{'\n'})
+			return err
+		}
+		offset += int64(len(data))
+	}
+}
+
+// quarantine moves the torn tail of the log from offset into the file of
+// path with suffix ".torn".
+func (l *Log) quarantine(offset int64, data []byte) error {
+	torn, err := os.OpenFile(l.path+".torn", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer torn.Close()
+	if _, err := torn.Write(data); err != nil {
+		return err
+	}
+	if err := torn.Sync(); err != nil {
+		return err
+	}
+	if err := l.file.Truncate(offset); err != nil {
+		return err
+	}
+	log.Warn("[audit] torn last line of audit log moved to", l.path+".torn",
+		"after entry:", l.seq, "bytes:", len(data))
+	return l.file.Sync()
+}
+
+// Record appends the entry to the log, the sequence, time and hashes of the
+// entry are set by Record.
+func (l *Log) Record(e *Entry) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.file == nil {
+		return ErrClosed
+	}
+
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UTC()
+	e.PrevHash = l.last
+	e.Hash = e.hash()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return nil
+}
+
+// Head returns the sequence and hash of the last entry of the log.
+func (l *Log) Head() (uint64, string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.seq, l.last
+}
+
+// Query filters the entries of the log.
+type Query struct {
+	// Type and Proposer match all entries if empty.
+	Type     string
+	Proposer string
+	// From is the sequence the entries start from.
+	From uint64
+	// Count is the max count of entries returned, 0 for no limit.
+	Count int
+}
+
+// Query returns the entries matching q in order.
+func (l *Log) Query(q Query) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	err := l.read(func(e *Entry) error {
+		if q.Count > 0 && len(entries) >= q.Count {
+			return io.EOF
+		}
+		if e.Seq < q.From || (q.Type != "" && e.Type != q.Type) ||
+			(q.Proposer != "" && e.Proposer != q.Proposer) {
+			return nil
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// Verify checks the hash chain of the log, it returns the count of entries
+// verified.
+func (l *Log) Verify() (uint64, error) {
+	v := new(verifier)
+	err := l.read(v.verify)
+	return v.count, err
+}
+
+func (l *Log) read(fn func(e *Entry) error) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.file == nil {
+		return ErrClosed
+	}
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return scan(file, fn)
+}
+
+// Close closes the log, it is safe to be called more than once.
+func (l *Log) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Verify checks the hash chain of the audit log of path, it returns the
+// count of entries verified.
+func Verify(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	v := new(verifier)
+	err = scan(file, v.verify)
+	return v.count, err
+}
+
+type verifier struct {
+	count uint64
+	last  string
+}
+
+func (v *verifier) verify(e *Entry) error {
+	if e.Seq != v.count+1 {
+		return fmt.Errorf("entry %d: expect sequence %d", e.Seq, v.count+1)
+	}
+	if e.PrevHash != v.last {
+		return fmt.Errorf("entry %d: previous hash mismatch", e.Seq)
+	}
+	if e.Hash != e.hash() {
+		return fmt.Errorf("entry %d: hash mismatch", e.Seq)
+	}
+	v.count, v.last = e.Seq, e.Hash
+	return nil
+}
+
+// scan decodes the entries of r in order until fn returns an error, io.EOF
+// returned by fn stops scanning without error.
+func scan(r io.Reader, fn func(e *Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		e := new(Entry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		if err := fn(e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// PublicKey returns the public key in hex as the proposer of entries.
+func PublicKey(pk *crypto.PublicKey) string {
+	if pk == nil {
+		return ""
+	}
+	buf, err := pk.EncodePoint(true)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// TxSummary returns the summary of a transaction signed, the hash, the count
+// of outputs and the amount of them.
+func TxSummary(tx *types.Transaction) map[string]string {
+	var amount common.Fixed64
+	for _, output := range tx.Outputs {
+		amount += output.Value
+	}
+	return map[string]string{
+		"txhash":  tx.Hash().String(),
+		"outputs": strconv.Itoa(len(tx.Outputs)),
+		"amount":  amount.String(),
+	}
+}
+
+// RecordSignature records the signature of content to the log. The caller
+// should discard the signature if the record fails, so the log has no gap of
+// signatures sent. Nothing is recorded to a nil log.
+func (l *Log) RecordSignature(typ string, content []byte, summary map[string]string, proposer, decision string) error {
+	if l == nil {
+		return nil
+	}
+	hash := sha256.Sum256(content)
+	err := l.Record(&Entry{
+		Type:        typ,
+		ContentHash: hex.EncodeToString(hash[:]),
+		Summary:     summary,
+		Proposer:    proposer,
+		Decision:    decision,
+	})
+	if err != nil {
+		return errors.New("record " + typ + " signature to audit log failed: " + err.Error())
+	}
+	return nil
+}
+
+// RecordTx records the signature of the transaction to the log, the fields of
+// extra are added to the summary of the transaction.
+func (l *Log) RecordTx(typ string, tx *types.Transaction, extra map[string]string, proposer, decision string) error {
+	if l == nil {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	if err := tx.SerializeUnsigned(buf); err != nil {
+		return err
+	}
+	summary := TxSummary(tx)
+	for key, value := range extra {
+		summary[key] = value
+	}
+	return l.RecordSignature(typ, buf.Bytes(), summary, proposer, decision)
+}
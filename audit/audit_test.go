@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.Init(".", 5, 0, 0)
+}
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data", "audit.log")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Record(&Entry{Type: TypeWithdrawProposal, ContentHash: "01",
+		Summary: map[string]string{"txhash": "a1", "chain": "XKUh"}, Proposer: "02ab",
+		Decision: DecisionProposer}))
+	assert.NoError(t, l.Record(&Entry{Type: TypeHandshake, ContentHash: "02", Proposer: "02ab",
+		Decision: DecisionUnchecked}))
+	assert.NoError(t, l.Close())
+	assert.Equal(t, ErrClosed, l.Record(&Entry{}))
+
+	// the chain continues after reopening
+	l, err = Open(path)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.NoError(t, l.Record(&Entry{Type: TypeWithdrawProposal, ContentHash: "03", Proposer: "03cd",
+		Decision: DecisionApproved}))
+
+	count, err := l.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	entries, err := l.Query(Query{Type: TypeWithdrawProposal})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, uint64(1), entries[0].Seq)
+	assert.Equal(t, "a1", entries[0].Summary["txhash"])
+	assert.Equal(t, entries[0].Hash, mustQuery(t, l, Query{From: 2})[0].PrevHash)
+
+	entries = mustQuery(t, l, Query{Proposer: "03cd"})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, uint64(3), entries[0].Seq)
+	assert.Len(t, mustQuery(t, l, Query{From: 2, Count: 1}), 1)
+}
+
+func TestLog_RecordSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := Open(filepath.Join(dir, "audit.log"))
+	assert.NoError(t, err)
+	assert.NoError(t, l.RecordSignature(TypeHandshake, []byte{1}, nil, "02ab", DecisionUnchecked))
+
+	// the failure is returned to discard the signature
+	assert.NoError(t, l.Close())
+	assert.Error(t, l.RecordSignature(TypeHandshake, []byte{2}, nil, "02ab", DecisionUnchecked))
+
+	// nothing is recorded without a log
+	var nilLog *Log
+	assert.NoError(t, nilLog.RecordSignature(TypeHandshake, []byte{3}, nil, "02ab", DecisionUnchecked))
+}
+
+func mustQuery(t *testing.T, l *Log, q Query) []*Entry {
+	entries, err := l.Query(q)
+	assert.NoError(t, err)
+	return entries
+}
+
+func TestVerify_Tampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	for _, decision := range []string{DecisionProposer, DecisionApproved, DecisionUnchecked} {
+		assert.NoError(t, l.Record(&Entry{Type: TypeStatus, Decision: decision}))
+	}
+	assert.NoError(t, l.Close())
+
+	count, err := Verify(path)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	// modified entry
+	modified := bytes.Replace(data, []byte(DecisionApproved), []byte(DecisionProposer), 1)
+	assert.NoError(t, ioutil.WriteFile(path, modified, 0600))
+	count, err = Verify(path)
+	assert.EqualError(t, err, "entry 2: hash mismatch")
+	assert.Equal(t, uint64(1), count)
+
+	// removed entry
+	removed := append(append([]byte{}, lines[0]...), lines[2]...)
+	assert.NoError(t, ioutil.WriteFile(path, removed, 0600))
+	_, err = Verify(path)
+	assert.EqualError(t, err, "entry 3: expect sequence 2")
+}
+
+func TestOpen_TornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	for _, decision := range []string{DecisionProposer, DecisionApproved} {
+		assert.NoError(t, l.Record(&Entry{Type: TypeStatus, Decision: decision}))
+	}
+	assert.NoError(t, l.Close())
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	// torn last line is quarantined and the chain continues
+	torn := append(append([]byte{}, data...), lines[1][:20]...)
+	assert.NoError(t, ioutil.WriteFile(path, torn, 0600))
+	l, err = Open(path)
+	assert.NoError(t, err)
+	seq, _ := l.Head()
+	assert.Equal(t, uint64(2), seq)
+	assert.NoError(t, l.Record(&Entry{Type: TypeStatus, Decision: DecisionUnchecked}))
+	count, err := l.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+	assert.NoError(t, l.Close())
+	quarantined, err := ioutil.ReadFile(path + ".torn")
+	assert.NoError(t, err)
+	assert.Equal(t, lines[1][:20], quarantined)
+
+	// complete last entry without line end is kept
+	assert.NoError(t, ioutil.WriteFile(path, bytes.TrimSuffix(data, []byte("\n")), 0600))
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Record(&Entry{Type: TypeStatus, Decision: DecisionUnchecked}))
+	count, err = l.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+	assert.NoError(t, l.Close())
+
+	// corrupted entry before the last one is not recovered
+	corrupted := append(append(append([]byte{}, lines[0][:20]...), '\n'), lines[1]...)
+	assert.NoError(t, ioutil.WriteFile(path, corrupted, 0600))
+	_, err = Open(path)
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -38,6 +39,21 @@ type RpcConfiguration struct {
 	User        string   `json:"User"`
 	Pass        string   `json:"Pass"`
 	WhiteIPList []string `json:"WhiteIPList"`
+	// EnablePprof serves the profiles of net/http/pprof at /debug/pprof/ to
+	// the clients authenticated by User and Pass.
+	EnablePprof bool `json:"EnablePprof"`
+}
+
+// SigningPolicy is the local policy checked before signing withdraw proposals
+// of other arbiters, amounts are in sela of main chain and zero means no
+// limit.
+type SigningPolicy struct {
+	MaxWithdrawOutputAmount int      `json:"MaxWithdrawOutputAmount"`
+	MaxWithdrawTxAmount     int      `json:"MaxWithdrawTxAmount"`
+	DailyWithdrawLimit      int      `json:"DailyWithdrawLimit"`
+	AllowedAddresses        []string `json:"AllowedAddresses"`
+	DeniedAddresses         []string `json:"DeniedAddresses"`
+	MinSourceTxAge          uint32   `json:"MinSourceTxAge"`
 }
 
 type Configuration struct {
@@ -56,6 +72,11 @@ type Configuration struct {
 	SPVPrintLevel uint8         `json:"SPVPrintLevel"`
 	MaxLogsSize   int64         `json:"MaxLogsSize"`
 	MaxPerLogSize int64         `json:"MaxPerLogSize"`
+	// LogFormat is the format of logs, "text" or "json".
+	LogFormat string `json:"LogFormat"`
+	// LogLevels are the print levels of the log modules, the modules not
+	// listed follow PrintLevel, except spv following SPVPrintLevel.
+	LogLevels map[string]uint8 `json:"LogLevels"`
 
 	SideChainMonitorScanInterval time.Duration    `json:"SideChainMonitorScanInterval"`
 	ClearTransactionInterval     time.Duration    `json:"ClearTransactionInterval"`
@@ -69,9 +90,30 @@ type Configuration struct {
 	NewP2PProtocolVersionHeight  uint64           `json:"NewP2PProtocolVersionHeight"`
 	DPOSNodeCrossChainHeight     uint32           `json:"DPOSNodeCrossChainHeight"`
 	MaxTxsPerWithdrawTx          int              `json:"MaxTxsPerWithdrawTx"`
+	CoinSelectionStrategy        string           `json:"CoinSelectionStrategy"`
+	ConsolidateUTXOThreshold     int              `json:"ConsolidateUTXOThreshold"`
+	ConsolidateMaxInputs         int              `json:"ConsolidateMaxInputs"`
+	ConsolidateFee               int              `json:"ConsolidateFee"`
+	HeldWithdrawThreshold        int              `json:"HeldWithdrawThreshold"`
+	SolvencyCheckInterval        time.Duration    `json:"SolvencyCheckInterval"`
+	SolvencyTolerance            int              `json:"SolvencyTolerance"`
+	DepositRetryBaseDelay        time.Duration    `json:"DepositRetryBaseDelay"`
+	DepositRetryMaxDelay         time.Duration    `json:"DepositRetryMaxDelay"`
+	DepositRetryMaxAttempts      int              `json:"DepositRetryMaxAttempts"`
+	DepositRateLimit             int              `json:"DepositRateLimit"`
+	TakeoverPendingBlocks        uint32           `json:"TakeoverPendingBlocks"`
+	StatusBroadcastInterval      time.Duration    `json:"StatusBroadcastInterval"`
+	EnableStatusBroadcast        bool             `json:"EnableStatusBroadcast"`
+	PeerBanThreshold             uint32           `json:"PeerBanThreshold"`
+	PeerBanDuration              time.Duration    `json:"PeerBanDuration"`
+	PeerMessageRateLimit         int              `json:"PeerMessageRateLimit"`
+	P2PQueueCapacity             int              `json:"P2PQueueCapacity"`
+	P2PVerifyWorkers             int              `json:"P2PVerifyWorkers"`
+	ShutdownTimeout              time.Duration    `json:"ShutdownTimeout"`
 	OriginCrossChainArbiters     []string         `json:"OriginCrossChainArbiters"`
 	CRCCrossChainArbiters        []string         `json:"CRCCrossChainArbiters"`
 	RpcConfiguration             RpcConfiguration `json:"RpcConfiguration"`
+	SigningPolicy                SigningPolicy    `json:"SigningPolicy"`
 	DPoSNetAddress               string           `json:"DPoSNetAddress"`
 	WalletPath                   string           `json:"WalletPath"`
 }
@@ -94,14 +136,21 @@ type MainNodeConfig struct {
 type SideNodeConfig struct {
 	Rpc *RpcConfig `json:"Rpc"`
 
-	ExchangeRate        float64 `json:"ExchangeRate"`
-	GenesisBlockAddress string  `json:"GenesisBlockAddress"`
-	GenesisBlock        string  `json:"GenesisBlock"`
-	KeystoreFile        string  `json:"KeystoreFile"`
-	MiningAddr          string  `json:"MiningAddr"`
-	PayToAddr           string  `json:"PayToAddr"`
-	PowChain            bool    `json:"PowChain"`
-	SyncStartHeight     uint32  `json:"SyncStartHeight"`
+	ExchangeRate        *base.ExchangeRate `json:"ExchangeRate"`
+	GenesisBlockAddress string             `json:"GenesisBlockAddress"`
+	GenesisBlock        string             `json:"GenesisBlock"`
+	KeystoreFile        string             `json:"KeystoreFile"`
+	MiningAddr          string             `json:"MiningAddr"`
+	PayToAddr           string             `json:"PayToAddr"`
+	PowChain            *bool              `json:"PowChain"`
+	SyncStartHeight     uint32             `json:"SyncStartHeight"`
+	SyncWindowSize      uint32             `json:"SyncWindowSize"`
+}
+
+// IsPowChain returns if the side chain is merged mined, side nodes not
+// setting PowChain are.
+func (c *SideNodeConfig) IsPowChain() bool {
+	return c.PowChain == nil || *c.PowChain
 }
 
 type ConfigFile struct {
@@ -112,8 +161,8 @@ type configParams struct {
 	*Configuration
 }
 
-func GetRpcConfig(genesisBlockHash string) (*RpcConfig, bool) {
-	for _, node := range Parameters.SideNodeList {
+func (c *Configuration) GetRpcConfig(genesisBlockHash string) (*RpcConfig, bool) {
+	for _, node := range c.SideNodeList {
 		if node.GenesisBlock == genesisBlockHash {
 			return node.Rpc, true
 		}
@@ -121,9 +170,9 @@ func GetRpcConfig(genesisBlockHash string) (*RpcConfig, bool) {
 	return nil, false
 }
 
-func GetSpvChainParams() *elacfg.Params {
+func (c *Configuration) GetSpvChainParams() *elacfg.Params {
 	var params *elacfg.Params
-	switch strings.ToLower(Parameters.ActiveNet) {
+	switch strings.ToLower(c.ActiveNet) {
 	case "testnet", "test":
 		params = elacfg.DefaultParams.TestNet()
 
@@ -134,7 +183,7 @@ func GetSpvChainParams() *elacfg.Params {
 		params = &elacfg.DefaultParams
 	}
 
-	mncfg := Parameters.MainNode
+	mncfg := c.MainNode
 	if mncfg.Magic != 0 {
 		params.Magic = mncfg.Magic
 	}
@@ -150,14 +199,14 @@ func GetSpvChainParams() *elacfg.Params {
 	if mncfg.DefaultPort != 0 {
 		params.DefaultPort = mncfg.DefaultPort
 	}
-	if Parameters.CRClaimDPOSNodeStartHeight > 0 {
-		params.CRClaimDPOSNodeStartHeight = Parameters.CRClaimDPOSNodeStartHeight
+	if c.CRClaimDPOSNodeStartHeight > 0 {
+		params.CRClaimDPOSNodeStartHeight = c.CRClaimDPOSNodeStartHeight
 	}
-	if Parameters.NewP2PProtocolVersionHeight > 0 {
-		params.NewP2PProtocolVersionHeight = Parameters.NewP2PProtocolVersionHeight
+	if c.NewP2PProtocolVersionHeight > 0 {
+		params.NewP2PProtocolVersionHeight = c.NewP2PProtocolVersionHeight
 	}
-	if Parameters.DPOSNodeCrossChainHeight > 0 {
-		params.DPOSNodeCrossChainHeight = Parameters.DPOSNodeCrossChainHeight
+	if c.DPOSNodeCrossChainHeight > 0 {
+		params.DPOSNodeCrossChainHeight = c.DPOSNodeCrossChainHeight
 	}
 	params.DNSSeeds = nil
 	return params
@@ -192,16 +241,6 @@ func Initialize() {
 		os.Exit(1)
 	}
 
-	for _, side := range config.ConfigFile.SideNodeList {
-		side.PowChain = true
-	}
-
-	e = json.Unmarshal(file, &config)
-	if e != nil {
-		fmt.Printf("Unmarshal json file erro %v", e)
-		os.Exit(1)
-	}
-
 	//Parameters.Configuration = &(config.ConfigFile)
 
 	var out bytes.Buffer
@@ -221,25 +260,88 @@ func Initialize() {
 		return
 	}
 
-	for _, node := range Parameters.SideNodeList {
+	if err := setGenesisAddresses(Parameters.SideNodeList); err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+}
+
+// Default returns a copy of the default configuration of the net, "mainnet",
+// "testnet" or "regnet".
+func Default(activeNet string) (*Configuration, error) {
+	var config ConfigFile
+	switch strings.ToLower(activeNet) {
+	case "testnet", "test":
+		config = testnet
+	case "regnet", "reg":
+		config = regnet
+	default:
+		config = mainnet
+	}
+
+	cfg, err := copyConfiguration(&config.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ActiveNet = activeNet
+	return cfg, nil
+}
+
+// copyConfiguration returns a deep copy of cfg, the configs of nodes are
+// shared by pointers.
+func copyConfiguration(cfg *Configuration) (*Configuration, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var c Configuration
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Prepare checks cfg and returns a copy of it to run an arbiter by, it is
+// used in place of Initialize by the arbiters not configured by config.json.
+// Genesis blocks of side nodes are in the same format of config.json, and are
+// converted the same as Initialize, cfg is not changed.
+func Prepare(cfg *Configuration) (*Configuration, error) {
+	if cfg.MainNode == nil {
+		return nil, errors.New("need to set main node in config")
+	}
+	if cfg.SideNodeList == nil {
+		return nil, errors.New("need to set side node list in config")
+	}
+	c, err := copyConfiguration(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := setGenesisAddresses(c.SideNodeList); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setGenesisAddresses reverses the genesis block hashes of side nodes and
+// sets their genesis addresses.
+func setGenesisAddresses(nodes []*SideNodeConfig) error {
+	for _, node := range nodes {
 		genesisBytes, err := common.HexStringToBytes(node.GenesisBlock)
 		if err != nil {
-			fmt.Printf("Side node genesis block hash error: %v\n", e)
-			return
+			return fmt.Errorf("side node genesis block hash error: %v", err)
 		}
 		reversedGenesisBytes := common.BytesReverse(genesisBytes)
 		reversedGenesisStr := common.BytesToHexString(reversedGenesisBytes)
 		genesisBlockHash, err := common.Uint256FromHexString(reversedGenesisStr)
 		if err != nil {
-			fmt.Printf("Side node genesis block hash reverse error: %v\n", e)
-			return
+			return fmt.Errorf("side node genesis block hash reverse error: %v", err)
 		}
 		address, err := base.GetGenesisAddress(*genesisBlockHash)
 		if err != nil {
-			fmt.Printf("Side node genesis block hash to address error: %v\n", e)
-			return
+			return fmt.Errorf("side node genesis block hash to address error: %v", err)
 		}
 		node.GenesisBlockAddress = address
 		node.GenesisBlock = reversedGenesisStr
 	}
+	return nil
 }
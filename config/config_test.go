@@ -21,7 +21,7 @@ func TestGetRpcConfig(t *testing.T) {
 	}
 
 	for _, node := range Parameters.SideNodeList {
-		rpcConfig, ok := GetRpcConfig(node.GenesisBlock)
+		rpcConfig, ok := Parameters.GetRpcConfig(node.GenesisBlock)
 		if !ok {
 			t.Errorf("Can not find node by : [%s]", node.GenesisBlock)
 		}
@@ -30,7 +30,7 @@ func TestGetRpcConfig(t *testing.T) {
 		}
 	}
 
-	rpcConfig, ok := GetRpcConfig("168db7dedf19f584cd9acfc6062bb04a92ad1b7d34aed69905d4361728761a7c")
+	rpcConfig, ok := Parameters.GetRpcConfig("168db7dedf19f584cd9acfc6062bb04a92ad1b7d34aed69905d4361728761a7c")
 	if !ok {
 		t.Errorf("Can not find node by : [%s]", "168db7dedf19f584cd9acfc6062bb04a92ad1b7d34aed69905d4361728761a7c")
 	}
@@ -38,3 +38,63 @@ func TestGetRpcConfig(t *testing.T) {
 		t.Error("Found wrong config")
 	}
 }
+
+func TestDefault(t *testing.T) {
+	cfg, err := Default("regnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ActiveNet != "regnet" || cfg.HttpJsonPort != regnet.ConfigFile.HttpJsonPort {
+		t.Error("Wrong default config")
+	}
+
+	// the defaults are not changed by the copy
+	cfg.MainNode.Rpc.HttpJsonPort++
+	if regnet.ConfigFile.MainNode.Rpc.HttpJsonPort == cfg.MainNode.Rpc.HttpJsonPort {
+		t.Error("Default config shared with the copy")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	cfg, err := Default("regnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MainNode = nil
+	if _, err := Prepare(cfg); err == nil {
+		t.Error("Prepared config without main node")
+	}
+
+	cfg, _ = Default("regnet")
+	powChain := false
+	cfg.SideNodeList = []*SideNodeConfig{{
+		GenesisBlock: "56be936978c261b2e649d58dbfaf3f23d4a868274f5522cd2adb4308a955c4a3",
+	}, {
+		GenesisBlock: "56be936978c261b2e649d58dbfaf3f23d4a868274f5522cd2adb4308a955c4a3",
+		PowChain:     &powChain,
+	}}
+	// prepared twice the same as once, cfg is not changed
+	for i := 0; i < 2; i++ {
+		prepared, err := Prepare(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prepared == cfg {
+			t.Error("Config prepared without copy")
+		}
+		node := prepared.SideNodeList[0]
+		if node.GenesisBlock != "a3c455a90843db2acd22554f2768a8d4233fafbf8dd549e6b261c2786993be56" {
+			t.Errorf("Wrong genesis block: [%s]", node.GenesisBlock)
+		}
+		if node.GenesisBlockAddress == "" {
+			t.Error("Genesis address not set")
+		}
+		if !node.IsPowChain() || prepared.SideNodeList[1].IsPowChain() {
+			t.Error("Wrong pow chain")
+		}
+	}
+	if cfg.SideNodeList[0].GenesisBlock != "56be936978c261b2e649d58dbfaf3f23d4a868274f5522cd2adb4308a955c4a3" ||
+		cfg.SideNodeList[0].GenesisBlockAddress != "" {
+		t.Error("Config changed by Prepare")
+	}
+}
@@ -13,12 +13,28 @@ var (
 			SyncInterval:                 1000,
 			SideChainMonitorScanInterval: 1000,
 			ClearTransactionInterval:     60000,
+			SolvencyCheckInterval:        600000,
+			SolvencyTolerance:            100000000,
+			DepositRetryBaseDelay:        10000,
+			DepositRetryMaxDelay:         3600000,
+			DepositRetryMaxAttempts:      20,
+			DepositRateLimit:             50,
+			TakeoverPendingBlocks:        10,
+			StatusBroadcastInterval:      60000,
+			PeerBanThreshold:             100,
+			PeerBanDuration:              3600000,
+			PeerMessageRateLimit:         100,
+			P2PQueueCapacity:             10000,
+			P2PVerifyWorkers:             4,
+			ShutdownTimeout:              30000,
 			MinOutbound:                  3,
 			MaxConnections:               8,
 			SideAuxPowFee:                50000,
 			MinThreshold:                 1000000,
 			DepositAmount:                1000000,
 			MaxTxsPerWithdrawTx:          1000,
+			ConsolidateMaxInputs:         100,
+			ConsolidateFee:               10000,
 			MainNode: &MainNodeConfig{
 				SpvSeedList: []string{
 					"127.0.0.1:22338",
@@ -83,12 +99,28 @@ var (
 			SyncInterval:                 1000,
 			SideChainMonitorScanInterval: 1000,
 			ClearTransactionInterval:     60000,
+			SolvencyCheckInterval:        600000,
+			SolvencyTolerance:            100000000,
+			DepositRetryBaseDelay:        10000,
+			DepositRetryMaxDelay:         3600000,
+			DepositRetryMaxAttempts:      20,
+			DepositRateLimit:             50,
+			TakeoverPendingBlocks:        10,
+			StatusBroadcastInterval:      60000,
+			PeerBanThreshold:             100,
+			PeerBanDuration:              3600000,
+			PeerMessageRateLimit:         100,
+			P2PQueueCapacity:             10000,
+			P2PVerifyWorkers:             4,
+			ShutdownTimeout:              30000,
 			MinOutbound:                  3,
 			MaxConnections:               8,
 			SideAuxPowFee:                50000,
 			MinThreshold:                 1000000,
 			DepositAmount:                1000000,
 			MaxTxsPerWithdrawTx:          1000,
+			ConsolidateMaxInputs:         100,
+			ConsolidateFee:               10000,
 			MainNode: &MainNodeConfig{
 				SpvSeedList: []string{
 					"127.0.0.1:21338",
@@ -154,12 +186,28 @@ var (
 			SyncInterval:                 1000,
 			SideChainMonitorScanInterval: 1000,
 			ClearTransactionInterval:     60000,
+			SolvencyCheckInterval:        600000,
+			SolvencyTolerance:            100000000,
+			DepositRetryBaseDelay:        10000,
+			DepositRetryMaxDelay:         3600000,
+			DepositRetryMaxAttempts:      20,
+			DepositRateLimit:             50,
+			TakeoverPendingBlocks:        10,
+			StatusBroadcastInterval:      60000,
+			PeerBanThreshold:             100,
+			PeerBanDuration:              3600000,
+			PeerMessageRateLimit:         100,
+			P2PQueueCapacity:             10000,
+			P2PVerifyWorkers:             4,
+			ShutdownTimeout:              30000,
 			MinOutbound:                  3,
 			MaxConnections:               8,
 			SideAuxPowFee:                50000,
 			MinThreshold:                 1000000,
 			DepositAmount:                1000000,
 			MaxTxsPerWithdrawTx:          1000,
+			ConsolidateMaxInputs:         100,
+			ConsolidateFee:               10000,
 			MainNode: &MainNodeConfig{
 				SpvSeedList: []string{
 					"127.0.0.1:20338",
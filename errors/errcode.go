@@ -9,6 +9,7 @@ const (
 	InvalidMethod           ErrCode = 42001
 	InvalidParams           ErrCode = 42002
 	InvalidToken            ErrCode = 42003
+	AccessDenied            ErrCode = 42004
 	InvalidTransaction      ErrCode = 43001
 	UnknownTransaction      ErrCode = 44001
 	UnknownBlock            ErrCode = 44003
@@ -21,6 +22,7 @@ var ErrMap = map[ErrCode]string{
 	InvalidMethod:           "Invalid method",
 	InvalidParams:           "Invalid Params",
 	InvalidToken:            "Verify token error",
+	AccessDenied:            "Access denied",
 	InvalidTransaction:      "Invalid transaction",
 	UnknownTransaction:      "Unknown Transaction",
 	UnknownBlock:            "Unknown Block",
@@ -0,0 +1,126 @@
+// Package lifecycle runs the loops of an arbiter under a shared context and
+// shuts the arbiter down in order on SIGINT or SIGTERM.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+// ErrStopTimeout is returned by Stop if the steps do not finish in time.
+var ErrStopTimeout = errors.New("stop timeout")
+
+type step struct {
+	name string
+	stop func() error
+}
+
+// Manager runs the loops under a context cancelled by Stop, and then runs the
+// stop steps in the order added.
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	loops  sync.WaitGroup
+
+	mux   sync.Mutex
+	steps []*step
+
+	timeout  time.Duration
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// NewManager creates a manager whose Stop gives up after timeout, 0 for no
+// limit.
+func NewManager(timeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// Context returns the context cancelled when stopping.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go runs the loop in a new goroutine, the loop should return once the
+// context is done.
+func (m *Manager) Go(loop func(ctx context.Context)) {
+	m.loops.Add(1)
+	go func() {
+		defer m.loops.Done()
+		loop(m.ctx)
+	}()
+}
+
+// Wait waits for the loops started by Go to return.
+func (m *Manager) Wait() error {
+	m.loops.Wait()
+	return nil
+}
+
+// OnStop adds the step run by Stop after the steps added before.
+func (m *Manager) OnStop(name string, stop func() error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.steps = append(m.steps, &step{name: name, stop: stop})
+}
+
+// Stop cancels the context and runs the stop steps in order, it is safe to
+// be called more than once. Errors of steps are logged and the following
+// steps still run. If the timeout is reached, the remaining steps are
+// skipped and ErrStopTimeout is returned.
+func (m *Manager) Stop() error {
+	m.stopOnce.Do(func() {
+		m.stopErr = m.stop()
+	})
+	return m.stopErr
+}
+
+func (m *Manager) stop() error {
+	m.cancel()
+
+	var deadline <-chan time.Time
+	if m.timeout > 0 {
+		timer := time.NewTimer(m.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	m.mux.Lock()
+	steps := m.steps
+	m.mux.Unlock()
+	for _, s := range steps {
+		log.Info("[Stop] stopping", s.name)
+		done := make(chan error, 1)
+		go func(s *step) {
+			done <- s.stop()
+		}(s)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Warn("[Stop] stop", s.name, "failed:", err)
+			}
+		case <-deadline:
+			log.Error("[Stop] timeout while stopping", s.name)
+			return ErrStopTimeout
+		}
+	}
+	log.Info("[Stop] stopped")
+	return nil
+}
+
+// WaitSignal blocks until SIGINT or SIGTERM is received, and returns it.
+func WaitSignal() os.Signal {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	return <-sigChan
+}
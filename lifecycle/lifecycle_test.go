@@ -0,0 +1,73 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logDir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(logDir, 5, 0, 0)
+
+	code := m.Run()
+	os.RemoveAll(logDir)
+	os.Exit(code)
+}
+
+func TestManager_Stop(t *testing.T) {
+	m := NewManager(time.Second)
+	var order []string
+	loopDone := false
+	m.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		loopDone = true
+	})
+	m.OnStop("first", func() error {
+		order = append(order, "first")
+		return errors.New("first failed")
+	})
+	m.OnStop("loops", m.Wait)
+	m.OnStop("second", func() error {
+		assert.True(t, loopDone)
+		order = append(order, "second")
+		return nil
+	})
+
+	assert.NoError(t, m.Stop())
+	assert.Equal(t, []string{"first", "second"}, order)
+	assert.Error(t, m.Context().Err())
+
+	// stopped only once
+	assert.NoError(t, m.Stop())
+	assert.Equal(t, []string{"first", "second"}, order)
+}
+
+func TestManager_StopTimeout(t *testing.T) {
+	m := NewManager(20 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	skipped := true
+	m.OnStop("blocked", func() error {
+		<-block
+		return nil
+	})
+	m.OnStop("skipped", func() error {
+		skipped = false
+		return nil
+	})
+
+	assert.Equal(t, ErrStopTimeout, m.Stop())
+	assert.True(t, skipped)
+}
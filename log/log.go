@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/elastos/Elastos.ELA/utils/elalog"
 )
@@ -74,8 +75,10 @@ func levelName(level uint8) string {
 }
 
 type Logger struct {
-	level  uint8 // The log print level
+	level  uint32 // The log print level, accessed atomically
 	logger *log.Logger
+	// raw writes the entries in json format, which carry their own time.
+	raw *log.Logger
 }
 
 func NewLogger(outputPath string, level uint8, maxPerLogSizeMb, maxLogsSizeMb int64) *Logger {
@@ -89,12 +92,13 @@ func NewLogger(outputPath string, level uint8, maxPerLogSizeMb, maxLogsSizeMb in
 		logsFolderSize = maxLogsSizeMb * MBSize
 	}
 
-	writer := elalog.NewFileWriter(outputPath, perLogFileSize, logsFolderSize)
+	writer := io.MultiWriter(os.Stdout,
+		elalog.NewFileWriter(outputPath, perLogFileSize, logsFolderSize))
 
 	return &Logger{
-		level: level,
-		logger: log.New(io.MultiWriter(os.Stdout, writer), "",
-			log.Ldate|log.Lmicroseconds),
+		level:  uint32(level),
+		logger: log.New(writer, "", log.Ldate|log.Lmicroseconds),
+		raw:    log.New(writer, "", 0),
 	}
 }
 
@@ -103,11 +107,21 @@ func Init(outputPath string, level uint8, maxPerLogSizeMb, maxLogsSizeMb int64)
 }
 
 func (l *Logger) SetPrintLevel(level uint8) {
-	l.level = level
+	atomic.StoreUint32(&l.level, uint32(level))
+}
+
+// PrintLevel returns the print level of the logger.
+func (l *Logger) PrintLevel() uint8 {
+	return uint8(atomic.LoadUint32(&l.level))
 }
 
 func (l *Logger) Output(level uint8, a ...interface{}) {
-	if l.level <= level {
+	if l.PrintLevel() <= level {
+		if currentFormat() == JSONFormat {
+			msg := fmt.Sprintln(a...)
+			l.outputJSON(level, "", msg[:len(msg)-1], nil)
+			return
+		}
 		gidStr := strconv.FormatUint(GetGID(), 10)
 		a = append([]interface{}{levelName(level), "GID", gidStr + ","}, a...)
 		l.logger.Output(calldepth, fmt.Sprintln(a...))
@@ -115,14 +129,18 @@ func (l *Logger) Output(level uint8, a ...interface{}) {
 }
 
 func (l *Logger) Outputf(level uint8, format string, v ...interface{}) {
-	if l.level <= level {
+	if l.PrintLevel() <= level {
+		if currentFormat() == JSONFormat {
+			l.outputJSON(level, "", fmt.Sprintf(format, v...), nil)
+			return
+		}
 		v = append([]interface{}{levelName(level), "GID", GetGID()}, v...)
 		l.logger.Output(calldepth, fmt.Sprintf("%s %s %d, "+format+"\n", v...))
 	}
 }
 
 func (l *Logger) Debug(a ...interface{}) {
-	if l.level > debugLog {
+	if l.PrintLevel() > debugLog {
 		return
 	}
 
@@ -138,7 +156,7 @@ func (l *Logger) Debug(a ...interface{}) {
 }
 
 func (l *Logger) Debugf(format string, a ...interface{}) {
-	if l.level > debugLog {
+	if l.PrintLevel() > debugLog {
 		return
 	}
 
@@ -170,7 +188,7 @@ func (l *Logger) Warnf(format string, a ...interface{}) {
 }
 
 func (l *Logger) Error(a ...interface{}) {
-	if l.level <= errorLog {
+	if l.PrintLevel() <= errorLog {
 		l.Output(errorLog, a...)
 	}
 }
@@ -230,3 +248,8 @@ func Fatalf(format string, a ...interface{}) {
 func SetPrintLevel(level uint8) {
 	logger.SetPrintLevel(level)
 }
+
+// PrintLevel returns the print level of the default logger.
+func PrintLevel() uint8 {
+	return logger.PrintLevel()
+}
@@ -0,0 +1,409 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/utils/elalog"
+)
+
+// Names of the modules having their own log levels.
+const (
+	ModuleSPV      = "spv"
+	ModuleP2P      = "p2p"
+	ModuleDeposit  = "deposit"
+	ModuleWithdraw = "withdraw"
+	ModuleAuxpow   = "auxpow"
+	ModuleRPC      = "rpc"
+	ModuleArbiter  = "arbiter"
+	ModuleStore    = "store"
+	ModuleSolvency = "solvency"
+)
+
+// Loggers of the modules, a module logs through the default logger and at
+// its level until SetOutput or SetLevel is called.
+var (
+	SPV      = newModule(ModuleSPV)
+	P2P      = newModule(ModuleP2P)
+	Deposit  = newModule(ModuleDeposit)
+	Withdraw = newModule(ModuleWithdraw)
+	Auxpow   = newModule(ModuleAuxpow)
+	RPC      = newModule(ModuleRPC)
+	Arbiter  = newModule(ModuleArbiter)
+	Store    = newModule(ModuleStore)
+	Solvency = newModule(ModuleSolvency)
+)
+
+// Format is the format of log entries.
+type Format uint32
+
+const (
+	// TextFormat writes an entry per line as "msg key=value ...".
+	TextFormat Format = iota
+	// JSONFormat writes an entry per line as a json object.
+	JSONFormat
+)
+
+var format uint32
+
+func currentFormat() Format {
+	return Format(atomic.LoadUint32(&format))
+}
+
+// SetFormat sets the format of all loggers by name, "text" or "json". An
+// empty name stands for "text".
+func SetFormat(name string) error {
+	switch strings.ToLower(name) {
+	case "", "text":
+		atomic.StoreUint32(&format, uint32(TextFormat))
+	case "json":
+		atomic.StoreUint32(&format, uint32(JSONFormat))
+	default:
+		return errors.New("unknown log format " + name)
+	}
+	return nil
+}
+
+// Field is a key-value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Chain is the field of the genesis block address of a side chain.
+func Chain(genesisAddress string) Field {
+	return Field{Key: "chain", Value: genesisAddress}
+}
+
+// TxHash is the field of a transaction hash.
+func TxHash(hash string) Field {
+	return Field{Key: "txhash", Value: hash}
+}
+
+// Proposal is the field of the hash of a withdraw proposal.
+func Proposal(hash string) Field {
+	return Field{Key: "proposal", Value: hash}
+}
+
+// Height is the field of a block height.
+func Height(height uint32) Field {
+	return Field{Key: "height", Value: height}
+}
+
+// Err is the field of an error.
+func Err(err error) Field {
+	return Field{Key: "err", Value: err}
+}
+
+type module struct {
+	name string
+	// level is the print level of the module, -1 to follow the output logger.
+	level int32
+	// traceUntil is the time in unix nanoseconds until which the module logs
+	// at debug level regardless of its level.
+	traceUntil int64
+	output     atomic.Value
+}
+
+var (
+	modulesMux sync.Mutex
+	modules    = make(map[string]*module)
+)
+
+func newModule(name string) *Module {
+	modulesMux.Lock()
+	defer modulesMux.Unlock()
+	m := &module{name: name, level: -1}
+	modules[name] = m
+	return &Module{module: m}
+}
+
+// Modules returns the names of the modules in order.
+func Modules() []string {
+	modulesMux.Lock()
+	defer modulesMux.Unlock()
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetModuleLevel sets the print level of the module of name.
+func SetModuleLevel(name string, level uint8) error {
+	modulesMux.Lock()
+	m, ok := modules[name]
+	modulesMux.Unlock()
+	if !ok {
+		return errors.New("unknown log module " + name)
+	}
+	if level > disableLog {
+		return errors.New("invalid log level " + strconv.Itoa(int(level)))
+	}
+	atomic.StoreInt32(&m.level, int32(level))
+	return nil
+}
+
+// ModuleLevels returns the print levels in effect of the modules by name.
+func ModuleLevels() map[string]uint8 {
+	modulesMux.Lock()
+	defer modulesMux.Unlock()
+	levels := make(map[string]uint8, len(modules))
+	for name, m := range modules {
+		levels[name] = (&Module{module: m}).Level()
+	}
+	return levels
+}
+
+// Module is the logger of a module, writing structured entries of a message
+// and fields.
+type Module struct {
+	*module
+	fields []Field
+}
+
+// With returns a logger of the module adding fields to every entry.
+func (m *Module) With(fields ...Field) *Module {
+	all := make([]Field, 0, len(m.fields)+len(fields))
+	all = append(all, m.fields...)
+	return &Module{module: m.module, fields: append(all, fields...)}
+}
+
+// SetOutput makes the module log through l instead of the default logger.
+func (m *Module) SetOutput(l *Logger) {
+	m.output.Store(l)
+}
+
+// SetLevel sets the print level of the module.
+func (m *Module) SetLevel(level uint8) {
+	atomic.StoreInt32(&m.level, int32(level))
+}
+
+// Level returns the print level in effect of the module, which is debug
+// level while tracing.
+func (m *Module) Level() uint8 {
+	if m.Tracing() {
+		return debugLog
+	}
+	if level := atomic.LoadInt32(&m.level); level >= 0 {
+		return uint8(level)
+	}
+	if l := m.logger(); l != nil {
+		return l.PrintLevel()
+	}
+	return disableLog
+}
+
+// Trace makes the module log at debug level for the duration d, a zero
+// duration stops tracing.
+func (m *Module) Trace(d time.Duration) {
+	var until int64
+	if d > 0 {
+		until = time.Now().Add(d).UnixNano()
+	}
+	atomic.StoreInt64(&m.traceUntil, until)
+}
+
+// Tracing returns if the module is tracing.
+func (m *Module) Tracing() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&m.traceUntil)
+}
+
+// TracingUntil returns the time until which the module is tracing, the zero
+// time if it is not tracing.
+func (m *Module) TracingUntil() time.Time {
+	if !m.Tracing() {
+		return time.Time{}
+	}
+	return time.Unix(0, atomic.LoadInt64(&m.traceUntil))
+}
+
+func (m *Module) logger() *Logger {
+	if l, ok := m.output.Load().(*Logger); ok {
+		return l
+	}
+	return logger
+}
+
+func (m *Module) Debug(msg string, fields ...Field) {
+	m.Output(debugLog, msg, fields...)
+}
+
+func (m *Module) Info(msg string, fields ...Field) {
+	m.Output(infoLog, msg, fields...)
+}
+
+func (m *Module) Warn(msg string, fields ...Field) {
+	m.Output(warnLog, msg, fields...)
+}
+
+func (m *Module) Error(msg string, fields ...Field) {
+	m.Output(errorLog, msg, fields...)
+}
+
+func (m *Module) Fatal(msg string, fields ...Field) {
+	m.Output(fatalLog, msg, fields...)
+}
+
+// Output writes an entry of msg and fields at level, entries are dropped
+// before the logger is initialized.
+func (m *Module) Output(level uint8, msg string, fields ...Field) {
+	l := m.logger()
+	if l == nil || level < m.Level() {
+		return
+	}
+	if len(m.fields) > 0 {
+		fields = append(m.fields[:len(m.fields):len(m.fields)], fields...)
+	}
+
+	if currentFormat() == JSONFormat {
+		l.outputJSON(level, m.name, msg, fields)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(levelName(level))
+	buf.WriteString(" GID ")
+	buf.WriteString(strconv.FormatUint(GetGID(), 10))
+	buf.WriteString(", [")
+	buf.WriteString(m.name)
+	buf.WriteString("] ")
+	buf.WriteString(msg)
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		buf.WriteString(textValue(f.Value))
+	}
+	buf.WriteByte('\n')
+	l.logger.Output(calldepth, buf.String())
+}
+
+func textValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var jsonLevels = []string{
+	debugLog: "debug",
+	infoLog:  "info",
+	warnLog:  "warn",
+	errorLog: "error",
+	fatalLog: "fatal",
+}
+
+func (l *Logger) outputJSON(level uint8, module, msg string, fields []Field) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONField(&buf, "time", time.Now().Format(time.RFC3339Nano))
+	if int(level) < len(jsonLevels) {
+		writeJSONField(&buf, "level", jsonLevels[level])
+	} else {
+		writeJSONField(&buf, "level", level)
+	}
+	writeJSONField(&buf, "gid", GetGID())
+	if module != "" {
+		writeJSONField(&buf, "module", module)
+	}
+	writeJSONField(&buf, "msg", msg)
+	for _, f := range fields {
+		writeJSONField(&buf, f.Key, f.Value)
+	}
+	buf.WriteString("}\n")
+	l.raw.Output(calldepth, buf.String())
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	if buf.Len() > 1 {
+		buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
+
+// ElaLogger returns the module as an elalog.Logger, to make the packages of
+// ELA and SPV log through the module.
+func (m *Module) ElaLogger() elalog.Logger {
+	return elaLogger{m}
+}
+
+type elaLogger struct {
+	m *Module
+}
+
+func (l elaLogger) Debugf(format string, params ...interface{}) {
+	l.m.Output(debugLog, fmt.Sprintf(format, params...))
+}
+
+func (l elaLogger) Infof(format string, params ...interface{}) {
+	l.m.Output(infoLog, fmt.Sprintf(format, params...))
+}
+
+func (l elaLogger) Warnf(format string, params ...interface{}) {
+	l.m.Output(warnLog, fmt.Sprintf(format, params...))
+}
+
+func (l elaLogger) Errorf(format string, params ...interface{}) {
+	l.m.Output(errorLog, fmt.Sprintf(format, params...))
+}
+
+func (l elaLogger) Fatalf(format string, params ...interface{}) {
+	l.m.Output(fatalLog, fmt.Sprintf(format, params...))
+}
+
+func (l elaLogger) Debug(v ...interface{}) {
+	l.m.Output(debugLog, fmt.Sprint(v...))
+}
+
+func (l elaLogger) Info(v ...interface{}) {
+	l.m.Output(infoLog, fmt.Sprint(v...))
+}
+
+func (l elaLogger) Warn(v ...interface{}) {
+	l.m.Output(warnLog, fmt.Sprint(v...))
+}
+
+func (l elaLogger) Error(v ...interface{}) {
+	l.m.Output(errorLog, fmt.Sprint(v...))
+}
+
+func (l elaLogger) Fatal(v ...interface{}) {
+	l.m.Output(fatalLog, fmt.Sprint(v...))
+}
+
+func (l elaLogger) Level() elalog.Level {
+	return elalog.Level(l.m.Level())
+}
+
+func (l elaLogger) SetLevel(level elalog.Level) {
+	l.m.SetLevel(uint8(level))
+}
@@ -0,0 +1,113 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/utils/elalog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestModule(buf *bytes.Buffer, level uint8) *Module {
+	m := &Module{module: &module{name: "test", level: -1}}
+	m.SetOutput(&Logger{
+		level:  uint32(level),
+		logger: log.New(buf, "", 0),
+		raw:    log.New(buf, "", 0),
+	})
+	return m
+}
+
+func TestModule_Text(t *testing.T) {
+	var buf bytes.Buffer
+	m := newTestModule(&buf, infoLog)
+
+	m.With(Chain("XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ")).Info("deposit sent",
+		TxHash("a1b2"), Height(100), F("reason", "not on duty"))
+	line := buf.String()
+	assert.Contains(t, line, "[test] deposit sent chain=XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ "+
+		"txhash=a1b2 height=100 reason=\"not on duty\"\n")
+
+	buf.Reset()
+	m.Debug("filtered")
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestModule_JSON(t *testing.T) {
+	assert.NoError(t, SetFormat("json"))
+	defer SetFormat("text")
+
+	var buf bytes.Buffer
+	m := newTestModule(&buf, debugLog)
+	m.With(Proposal("c3d4")).Warn("proposal rejected", Height(7), Err(errors.New("failed")))
+
+	entry := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "test", entry["module"])
+	assert.Equal(t, "proposal rejected", entry["msg"])
+	assert.Equal(t, "c3d4", entry["proposal"])
+	assert.Equal(t, float64(7), entry["height"])
+	assert.Equal(t, "failed", entry["err"])
+	assert.True(t, strings.HasSuffix(buf.String(), "}\n"))
+
+	assert.Error(t, SetFormat("xml"))
+}
+
+func TestModule_Level(t *testing.T) {
+	var buf bytes.Buffer
+	m := newTestModule(&buf, infoLog)
+	assert.Equal(t, infoLog, m.Level())
+
+	m.SetLevel(errorLog)
+	m.Warn("filtered")
+	assert.Equal(t, 0, buf.Len())
+	m.ElaLogger().Errorf("height %d", 10)
+	assert.Contains(t, buf.String(), "[test] height 10")
+	assert.Equal(t, elalog.LevelError, m.ElaLogger().Level())
+
+	defer atomic.StoreInt32(&Deposit.level, -1)
+	assert.NoError(t, SetModuleLevel(ModuleDeposit, warnLog))
+	assert.Equal(t, warnLog, Deposit.Level())
+	assert.Error(t, SetModuleLevel("unknown", warnLog))
+	assert.Error(t, SetModuleLevel(ModuleDeposit, disableLog+1))
+}
+
+func TestModule_Trace(t *testing.T) {
+	var buf bytes.Buffer
+	m := newTestModule(&buf, warnLog)
+	assert.False(t, m.Tracing())
+	assert.True(t, m.TracingUntil().IsZero())
+
+	m.Trace(time.Minute)
+	assert.True(t, m.Tracing())
+	assert.False(t, m.TracingUntil().IsZero())
+	m.Debug("traced")
+	assert.Contains(t, buf.String(), "[test] traced")
+
+	buf.Reset()
+	m.Trace(0)
+	assert.False(t, m.Tracing())
+	m.Debug("filtered")
+	assert.Equal(t, 0, buf.Len())
+
+	m.Trace(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.False(t, m.Tracing())
+	assert.Equal(t, warnLog, m.Level())
+}
+
+func TestModuleLevels(t *testing.T) {
+	defer atomic.StoreInt32(&Withdraw.level, -1)
+	assert.NoError(t, SetModuleLevel(ModuleWithdraw, fatalLog))
+	levels := ModuleLevels()
+	assert.Len(t, levels, len(Modules()))
+	assert.Equal(t, fatalLog, levels[ModuleWithdraw])
+}
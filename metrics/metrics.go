@@ -0,0 +1,57 @@
+// Package metrics keeps the runtime metrics of arbiter. Metrics are published
+// through expvar under the name "arbiter", and returned by the getmetrics rpc.
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+var (
+	mux     sync.Mutex
+	metrics = expvar.NewMap("arbiter")
+)
+
+// SetGauge sets the metric to the value.
+func SetGauge(name string, value int64) {
+	getInt(name).Set(value)
+}
+
+// AddCounter adds delta to the metric.
+func AddCounter(name string, delta int64) {
+	getInt(name).Add(delta)
+}
+
+// Get returns the value of the metric, zero if it is never set.
+func Get(name string) int64 {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// Snapshot returns the values of all metrics.
+func Snapshot() map[string]int64 {
+	snapshot := make(map[string]int64)
+	metrics.Do(func(kv expvar.KeyValue) {
+		if v, ok := kv.Value.(*expvar.Int); ok {
+			snapshot[kv.Key] = v.Value()
+		}
+	})
+	return snapshot
+}
+
+func getInt(name string) *expvar.Int {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	metrics.Set(name, v)
+	return v
+}
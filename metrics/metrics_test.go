@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	assert.Equal(t, int64(0), Get("test.gauge"))
+
+	SetGauge("test.gauge", 10)
+	SetGauge("test.gauge", -5)
+	assert.Equal(t, int64(-5), Get("test.gauge"))
+
+	AddCounter("test.counter", 1)
+	AddCounter("test.counter", 2)
+	assert.Equal(t, int64(3), Get("test.counter"))
+
+	snapshot := Snapshot()
+	assert.Equal(t, int64(-5), snapshot["test.gauge"])
+	assert.Equal(t, int64(3), snapshot["test.counter"])
+}
@@ -0,0 +1,429 @@
+package servers
+
+import (
+	"bytes"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/sidechain"
+	"github.com/elastos/Elastos.ELA.Arbiter/errors"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+func (s *Service) RescanSideChain(param Params) map[string]interface{} {
+	address, resp := genesisAddressFromParam(param)
+	if resp != nil {
+		return resp
+	}
+	height, ok := param.Uint("height")
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "need a uint parameter named height")
+	}
+	if s == nil || s.SideChainMonitor == nil {
+		return ResponsePack(errors.InternalError, "side chain monitor not started")
+	}
+
+	err := s.SideChainMonitor.RescanSideChain(address, height)
+	if err != nil {
+		return ResponsePack(errors.InvalidParams, err.Error())
+	}
+	progress, _ := s.SideChainMonitor.GetRescanProgress(address)
+	return ResponsePack(errors.Success, progress)
+}
+
+func (s *Service) GetSideChainRescanProgress(param Params) map[string]interface{} {
+	address, resp := genesisAddressFromParam(param)
+	if resp != nil {
+		return resp
+	}
+	if s == nil || s.SideChainMonitor == nil {
+		return ResponsePack(errors.InternalError, "side chain monitor not started")
+	}
+
+	progress, ok := s.SideChainMonitor.GetRescanProgress(address)
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "side chain has not been rescanned")
+	}
+	return ResponsePack(errors.Success, progress)
+}
+
+func (s *Service) RescanMainChain(param Params) map[string]interface{} {
+	height, ok := param.Uint("height")
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "need a uint parameter named height")
+	}
+	if s == nil || s.Arbitrator == nil {
+		return ResponsePack(errors.InternalError, "arbitrator not started")
+	}
+
+	if err := s.Arbitrator.RescanMainChain(height); err != nil {
+		return ResponsePack(errors.InvalidParams, err.Error())
+	}
+	progress, _ := s.Arbitrator.GetMainChainRescanProgress()
+	return ResponsePack(errors.Success, progress)
+}
+
+func (s *Service) GetMainChainRescanProgress(param Params) map[string]interface{} {
+	if s == nil || s.Arbitrator == nil {
+		return ResponsePack(errors.InternalError, "arbitrator not started")
+	}
+	progress, ok := s.Arbitrator.GetMainChainRescanProgress()
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "main chain has not been rescanned")
+	}
+	return ResponsePack(errors.Success, progress)
+}
+
+func (s *Service) GetHeldWithdrawTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	type withdrawAsset struct {
+		TargetAddress    string `json:"targetaddress"`
+		Amount           string `json:"amount"`
+		CrossChainAmount string `json:"crosschainamount"`
+	}
+	type heldWithdrawTx struct {
+		TxID           string          `json:"txid"`
+		GenesisAddress string          `json:"genesisaddress"`
+		BlockHeight    uint32          `json:"blockheight"`
+		WithdrawAssets []withdrawAsset `json:"withdrawassets"`
+	}
+
+	result := make([]heldWithdrawTx, 0)
+	for _, node := range s.Arbitrator.GetConfig().SideNodeList {
+		txs, err := s.Arbitrator.GetDataStore().SideChainStore.GetSideChainTxsByState(
+			node.GenesisBlockAddress, store.WithdrawTxHeld)
+		if err != nil {
+			return ResponsePack(errors.InternalError, "get held withdraw transactions failed")
+		}
+		for _, tx := range txs {
+			withdrawTx := new(base.WithdrawTx)
+			if err := withdrawTx.Deserialize(bytes.NewReader(tx.Transaction)); err != nil {
+				return ResponsePack(errors.InternalError, "invalid held withdraw transaction "+tx.TransactionHash)
+			}
+			held := heldWithdrawTx{
+				TxID:           tx.TransactionHash,
+				GenesisAddress: tx.GenesisBlockAddress,
+				BlockHeight:    tx.BlockHeight,
+			}
+			for _, asset := range withdrawTx.WithdrawInfo.WithdrawAssets {
+				held.WithdrawAssets = append(held.WithdrawAssets, withdrawAsset{
+					TargetAddress:    asset.TargetAddress,
+					Amount:           asset.Amount.String(),
+					CrossChainAmount: asset.CrossChainAmount.String(),
+				})
+			}
+			result = append(result, held)
+		}
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) ApproveWithdrawTx(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	txID, ok := param.String("txid")
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "need a string parameter named txid")
+	}
+
+	if err := sidechain.ApproveWithdrawTx(s.Arbitrator, txID); err != nil {
+		return ResponsePack(errors.InvalidParams, err.Error())
+	}
+	return ResponsePack(errors.Success, true)
+}
+
+func (s *Service) RejectWithdrawTx(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	txID, ok := param.String("txid")
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "need a string parameter named txid")
+	}
+	reason, ok := param.String("reason")
+	if !ok || reason == "" {
+		return ResponsePack(errors.InvalidParams, "need a string parameter named reason")
+	}
+
+	if err := sidechain.RejectWithdrawTx(s.Arbitrator, txID, reason); err != nil {
+		return ResponsePack(errors.InvalidParams, err.Error())
+	}
+	return ResponsePack(errors.Success, true)
+}
+
+func (s *Service) GetRejectedWithdrawTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	txs, err := s.Arbitrator.GetFinishedTxsStore().GetRejectedWithdrawTxs()
+	if err != nil {
+		return ResponsePack(errors.InternalError, "get rejected withdraw transactions from finished dbcache failed")
+	}
+	type rejectedWithdrawTx struct {
+		TxID           string `json:"txid"`
+		GenesisAddress string `json:"genesisaddress"`
+		Reason         string `json:"reason"`
+		RecordTime     string `json:"recordtime"`
+	}
+	result := make([]rejectedWithdrawTx, 0, len(txs))
+	for _, tx := range txs {
+		result = append(result, rejectedWithdrawTx{
+			TxID:           tx.TransactionHash,
+			GenesisAddress: tx.GenesisBlockAddress,
+			Reason:         tx.Reason,
+			RecordTime:     tx.RecordTime,
+		})
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) RedriveWithdrawTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	txIDs, ok := param.ArrayString("txids")
+	if !ok || len(txIDs) == 0 {
+		return ResponsePack(errors.InvalidParams, "need a string array parameter named txids")
+	}
+	reason, ok := param.String("reason")
+	if !ok || reason == "" {
+		return ResponsePack(errors.InvalidParams, "need a string parameter named reason")
+	}
+
+	type redriveResult struct {
+		TxID    string `json:"txid"`
+		Succeed bool   `json:"succeed"`
+		Error   string `json:"error"`
+	}
+	result := make([]redriveResult, 0, len(txIDs))
+	for _, txID := range txIDs {
+		r := redriveResult{TxID: txID, Succeed: true}
+		if err := sidechain.RedriveWithdrawTx(s.Arbitrator, txID, reason); err != nil {
+			r.Succeed = false
+			r.Error = err.Error()
+		}
+		result = append(result, r)
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) GetWithdrawRedriveLogs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	logs, err := s.Arbitrator.GetFinishedTxsStore().GetWithdrawRedriveLogs()
+	if err != nil {
+		return ResponsePack(errors.InternalError, "get withdraw re-drive logs from finished dbcache failed")
+	}
+	type withdrawRedriveLog struct {
+		TxID           string `json:"txid"`
+		GenesisAddress string `json:"genesisaddress"`
+		Succeed        bool   `json:"succeed"`
+		Reason         string `json:"reason"`
+		Message        string `json:"message"`
+		RecordTime     string `json:"recordtime"`
+	}
+	result := make([]withdrawRedriveLog, 0, len(logs))
+	for _, l := range logs {
+		result = append(result, withdrawRedriveLog{
+			TxID:           l.TransactionHash,
+			GenesisAddress: l.GenesisBlockAddress,
+			Succeed:        l.Succeed,
+			Reason:         l.Reason,
+			Message:        l.Message,
+			RecordTime:     l.RecordTime,
+		})
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) DryRunWithdraw(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	address, resp := genesisAddressFromParam(param)
+	if resp != nil {
+		return resp
+	}
+	txIDs, ok := param.ArrayString("txids")
+	if !ok || len(txIDs) == 0 {
+		return ResponsePack(errors.InvalidParams, "need a string array parameter named txids")
+	}
+	var txHashes []common.Uint256
+	for _, txID := range txIDs {
+		hash, err := common.Uint256FromHexString(txID)
+		if err != nil {
+			return ResponsePack(errors.InvalidParams, "invalid txid "+txID)
+		}
+		txHashes = append(txHashes, *hash)
+	}
+
+	dryRun, err := cs.DryRunWithdraw(s.Arbitrator, s.SigningPolicy, address, txHashes)
+	if err != nil {
+		return ResponsePack(errors.InvalidParams, err.Error())
+	}
+
+	type input struct {
+		TxID   string `json:"txid"`
+		VOut   uint16 `json:"vout"`
+		Amount string `json:"amount"`
+	}
+	type output struct {
+		Address string `json:"address"`
+		Value   string `json:"value"`
+	}
+	type fee struct {
+		TxID             string `json:"txid"`
+		TargetAddress    string `json:"targetaddress"`
+		Amount           string `json:"amount"`
+		CrossChainAmount string `json:"crosschainamount"`
+		Fee              string `json:"fee"`
+	}
+	type proposal struct {
+		TxID                       string   `json:"txid"`
+		RawTransaction             string   `json:"rawtransaction"`
+		BlockHeight                uint32   `json:"blockheight"`
+		GenesisAddress             string   `json:"genesisaddress"`
+		SideChainTransactionHashes []string `json:"sidechaintransactionhashes"`
+		Inputs                     []input  `json:"inputs"`
+		Outputs                    []output `json:"outputs"`
+		InputAmount                string   `json:"inputamount"`
+		OutputAmount               string   `json:"outputamount"`
+		ChangeAmount               string   `json:"changeamount"`
+		Fee                        string   `json:"fee"`
+		Fees                       []fee    `json:"fees"`
+		VerifyError                string   `json:"verifyerror"`
+		PolicyError                string   `json:"policyerror"`
+	}
+	type withdrawDryRun struct {
+		Proposals []proposal `json:"proposals"`
+		Held      []string   `json:"held"`
+		Unpacked  []string   `json:"unpacked"`
+		Skipped   []string   `json:"skipped"`
+	}
+
+	result := withdrawDryRun{
+		Proposals: make([]proposal, 0),
+		Held:      append(make([]string, 0), dryRun.Held...),
+		Unpacked:  append(make([]string, 0), dryRun.Unpacked...),
+		Skipped:   append(make([]string, 0), dryRun.Skipped...),
+	}
+	for _, p := range dryRun.Proposals {
+		txn := p.Transaction
+		buf := new(bytes.Buffer)
+		if err := txn.Serialize(buf); err != nil {
+			return ResponsePack(errors.InternalError, "serialize withdraw transaction failed")
+		}
+		r := proposal{
+			TxID:           txn.Hash().String(),
+			RawTransaction: common.BytesToHexString(buf.Bytes()),
+			InputAmount:    p.InputAmount.String(),
+			OutputAmount:   p.OutputAmount.String(),
+			ChangeAmount:   p.ChangeAmount.String(),
+			Fee:            p.Fee.String(),
+			VerifyError:    p.VerifyError,
+			PolicyError:    p.PolicyError,
+		}
+		if wp, ok := txn.Payload.(*payload.WithdrawFromSideChain); ok {
+			r.BlockHeight = wp.BlockHeight
+			r.GenesisAddress = wp.GenesisBlockAddress
+			for _, hash := range wp.SideChainTransactionHashes {
+				r.SideChainTransactionHashes = append(r.SideChainTransactionHashes, hash.String())
+			}
+		}
+		for _, utxo := range p.UTXOs {
+			r.Inputs = append(r.Inputs, input{
+				TxID:   utxo.Input.Previous.TxID.String(),
+				VOut:   utxo.Input.Previous.Index,
+				Amount: utxo.Amount.String(),
+			})
+		}
+		for _, o := range txn.Outputs {
+			address, err := o.ProgramHash.ToAddress()
+			if err != nil {
+				return ResponsePack(errors.InternalError, "invalid output of withdraw transaction")
+			}
+			r.Outputs = append(r.Outputs, output{
+				Address: address,
+				Value:   o.Value.String(),
+			})
+		}
+		for _, f := range p.Fees {
+			r.Fees = append(r.Fees, fee{
+				TxID:             f.SideChainTxHash.String(),
+				TargetAddress:    f.TargetAddress,
+				Amount:           f.Amount.String(),
+				CrossChainAmount: f.CrossChainAmount.String(),
+				Fee:              f.Fee.String(),
+			})
+		}
+		result.Proposals = append(result.Proposals, r)
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) GetDeadLetterDepositTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	txs, err := s.Arbitrator.GetFinishedTxsStore().GetDeadLetterDepositTxs()
+	if err != nil {
+		return ResponsePack(errors.InternalError, "get dead letter deposit transactions from finished dbcache failed")
+	}
+	type deadLetterDepositTx struct {
+		TxID           string `json:"txid"`
+		GenesisAddress string `json:"genesisaddress"`
+		Attempts       uint32 `json:"attempts"`
+		ErrorCode      int64  `json:"errorcode"`
+		ErrorMessage   string `json:"errormessage"`
+		RecordTime     string `json:"recordtime"`
+	}
+	result := make([]deadLetterDepositTx, 0, len(txs))
+	for _, tx := range txs {
+		result = append(result, deadLetterDepositTx{
+			TxID:           tx.TransactionHash,
+			GenesisAddress: tx.GenesisBlockAddress,
+			Attempts:       tx.Attempts,
+			ErrorCode:      tx.ErrorCode,
+			ErrorMessage:   tx.ErrorMessage,
+			RecordTime:     tx.RecordTime,
+		})
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) RedriveDepositTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	address, resp := genesisAddressFromParam(param)
+	if resp != nil {
+		return resp
+	}
+	txIDs, ok := param.ArrayString("txids")
+	if !ok || len(txIDs) == 0 {
+		return ResponsePack(errors.InvalidParams, "need a string array parameter named txids")
+	}
+
+	type redriveResult struct {
+		TxID    string `json:"txid"`
+		Succeed bool   `json:"succeed"`
+		Error   string `json:"error"`
+	}
+	result := make([]redriveResult, 0, len(txIDs))
+	for _, txID := range txIDs {
+		r := redriveResult{TxID: txID, Succeed: true}
+		if err := s.Arbitrator.RedriveDepositTx(txID, address); err != nil {
+			r.Succeed = false
+			r.Error = err.Error()
+		}
+		result = append(result, r)
+	}
+	return ResponsePack(errors.Success, result)
+}
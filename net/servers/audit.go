@@ -0,0 +1,59 @@
+package servers
+
+import (
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/errors"
+)
+
+const (
+	// defaultAuditEntries is the count of audit entries returned if count is
+	// not given.
+	defaultAuditEntries = 100
+
+	// maxAuditEntries is the max count of audit entries returned at a time.
+	maxAuditEntries = 1000
+)
+
+func (s *Service) GetAuditLog(param Params) map[string]interface{} {
+	if s == nil || s.AuditLog == nil {
+		return ResponsePack(errors.InternalError, "audit log not opened")
+	}
+	query := audit.Query{Count: defaultAuditEntries}
+	query.Type, _ = param.String("type")
+	query.Proposer, _ = param.String("proposer")
+	if from, ok := param.Uint("from"); ok {
+		query.From = uint64(from)
+	}
+	if count, ok := param.Uint("count"); ok {
+		if count == 0 || count > maxAuditEntries {
+			return ResponsePack(errors.InvalidParams, "count should be in 1 to 1000")
+		}
+		query.Count = int(count)
+	}
+
+	entries, err := s.AuditLog.Query(query)
+	if err != nil {
+		return ResponsePack(errors.InternalError, "query audit log failed: "+err.Error())
+	}
+	return ResponsePack(errors.Success, entries)
+}
+
+func (s *Service) VerifyAuditLog(param Params) map[string]interface{} {
+	if s == nil || s.AuditLog == nil {
+		return ResponsePack(errors.InternalError, "audit log not opened")
+	}
+	type verifyResult struct {
+		Verified uint64 `json:"verified"`
+		LastSeq  uint64 `json:"lastseq"`
+		LastHash string `json:"lasthash"`
+		Error    string `json:"error"`
+	}
+
+	count, err := s.AuditLog.Verify()
+	result := verifyResult{Verified: count}
+	result.LastSeq, result.LastHash = s.AuditLog.Head()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return ResponsePack(errors.Success, result)
+}
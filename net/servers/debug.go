@@ -0,0 +1,74 @@
+package servers
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/errors"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+// defaultLogModule stands for the default logger in the interfaces of log
+// levels.
+const defaultLogModule = "default"
+
+// maxLogLevel is the level disabling logs.
+const maxLogLevel = 5
+
+// maxTraceSeconds limits the time window of tracing p2p messages.
+const maxTraceSeconds = 3600
+
+func GetLogLevels(param Params) map[string]interface{} {
+	type logLevels struct {
+		Default uint8            `json:"default"`
+		Modules map[string]uint8 `json:"modules"`
+		// TraceP2PUntil is the unix time p2p messages are traced until, 0 if
+		// they are not traced.
+		TraceP2PUntil int64 `json:"tracep2puntil"`
+	}
+
+	result := logLevels{
+		Default: log.PrintLevel(),
+		Modules: log.ModuleLevels(),
+	}
+	if until := log.P2P.TracingUntil(); !until.IsZero() {
+		result.TraceP2PUntil = until.Unix()
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func SetLogLevel(param Params) map[string]interface{} {
+	level, ok := param.Uint("level")
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "need a uint parameter named level")
+	}
+	if level > maxLogLevel {
+		return ResponsePack(errors.InvalidParams, "level should be in 0 to 5")
+	}
+	module, _ := param.String("module")
+
+	if module == "" || module == defaultLogModule {
+		log.SetPrintLevel(uint8(level))
+	} else if err := log.SetModuleLevel(module, uint8(level)); err != nil {
+		return ResponsePack(errors.InvalidParams, err.Error())
+	}
+	log.Info("[SetLogLevel] log level changed, module:", module, "level:", level)
+	return ResponsePack(errors.Success, true)
+}
+
+func TraceP2P(param Params) map[string]interface{} {
+	seconds, ok := param.Uint("seconds")
+	if !ok {
+		return ResponsePack(errors.InvalidParams, "need a uint parameter named seconds")
+	}
+	if seconds > maxTraceSeconds {
+		return ResponsePack(errors.InvalidParams, "seconds should not be greater than 3600")
+	}
+
+	log.P2P.Trace(time.Duration(seconds) * time.Second)
+	log.Info("[TraceP2P] trace p2p messages, seconds:", seconds)
+	var until int64
+	if seconds > 0 {
+		until = log.P2P.TracingUntil().Unix()
+	}
+	return ResponsePack(errors.Success, until)
+}
@@ -0,0 +1,41 @@
+package httpjsonrpc
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+// handlePprof registers the profiles of net/http/pprof at /debug/pprof/ of
+// mux, they are only served to the allowed clients authenticated by the
+// rpc user and password of conf. Profiles taking time such as cpu profile
+// and trace are limited by the write timeout of the rpc server.
+func handlePprof(mux *http.ServeMux, conf *config.RpcConfiguration) {
+	mux.HandleFunc("/debug/pprof/", checkPprof(conf, pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", checkPprof(conf, pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", checkPprof(conf, pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", checkPprof(conf, pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", checkPprof(conf, pprof.Trace))
+}
+
+func checkPprof(conf *config.RpcConfiguration, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !clientAllowed(conf, r) {
+			log.RPC.Warn("HTTP Client ip is not allowed", log.F("remote", r.RemoteAddr))
+			http.Error(w, "Client ip is not allowd", http.StatusForbidden)
+			return
+		}
+		if !adminEnabled(conf) {
+			http.Error(w, "rpc user and password not configured", http.StatusForbidden)
+			return
+		}
+		if !checkAuth(conf, r) {
+			http.Error(w, "client authenticate failed", http.StatusUnauthorized)
+			return
+		}
+		log.RPC.Info("serve pprof", log.F("remote", r.RemoteAddr), log.F("path", r.URL.Path))
+		handler(w, r)
+	}
+}
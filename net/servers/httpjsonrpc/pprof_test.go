@@ -0,0 +1,38 @@
+package httpjsonrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlePprof(t *testing.T) {
+	defer InitConf(testConf.RpcConfiguration)
+	mux := http.NewServeMux()
+	handlePprof(mux, &testConf.RpcConfiguration)
+
+	get := func(remote, user, pass string) int {
+		r := httptest.NewRequest("GET", "/debug/pprof/cmdline", nil)
+		r.RemoteAddr = remote
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// refused without rpc user and password
+	InitConf(config.RpcConfiguration{})
+	assert.Equal(t, http.StatusForbidden, get("127.0.0.1:1234", "", ""))
+
+	InitConf(config.RpcConfiguration{User: "user", Pass: "pass"})
+	assert.Equal(t, http.StatusForbidden, get("10.0.0.1:1234", "user", "pass"))
+	assert.Equal(t, http.StatusUnauthorized, get("127.0.0.1:1234", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("127.0.0.1:1234", "user", "wrong"))
+	assert.Equal(t, http.StatusOK, get("127.0.0.1:1234", "user", "pass"))
+}
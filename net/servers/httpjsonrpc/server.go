@@ -19,26 +19,75 @@ import (
 	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
 )
 
-//an instance of the multiplexer
-var mainMux map[string]func(servers.Params) map[string]interface{}
-
-func StartRPCServer(pServer *http.Server) {
-	mainMux = make(map[string]func(servers.Params) map[string]interface{})
-
-	mainMux["submitcomplain"] = servers.SubmitComplain
-	mainMux["getcomplainstatus"] = servers.GetComplainStatus
-	mainMux["getinfo"] = servers.GetInfo
-	mainMux["getsidemininginfo"] = servers.GetSideMiningInfo
-	mainMux["getmainchainblockheight"] = servers.GetMainChainBlockHeight
-	mainMux["getsidechainblockheight"] = servers.GetSideChainBlockHeight
-	mainMux["getfinisheddeposittxs"] = servers.GetFinishedDepositTxs
-	mainMux["getfinishedwithdrawtxs"] = servers.GetFinishedWithdrawTxs
+// rpcMux maps the methods to the functions answering them.
+type rpcMux map[string]func(servers.Params) map[string]interface{}
+
+// adminMethods are the methods changing state of arbiter, they are only
+// served when rpc user and password are configured.
+var adminMethods = map[string]struct{}{
+	"rescansidechain":    {},
+	"rescanmainchain":    {},
+	"approvewithdrawtx":  {},
+	"rejectwithdrawtx":   {},
+	"dryrunwithdraw":     {},
+	"redrivewithdrawtxs": {},
+	"redrivedeposittxs":  {},
+	"setloglevel":        {},
+	"tracep2p":           {},
+}
+
+// newMux returns the multiplexer of the interfaces, the ones depending on the
+// components of the arbiter are answered by service.
+func newMux(service *servers.Service) rpcMux {
+	mainMux := make(rpcMux)
+
+	mainMux["submitcomplain"] = service.SubmitComplain
+	mainMux["getcomplainstatus"] = service.GetComplainStatus
+	mainMux["getinfo"] = service.GetInfo
+	mainMux["getsidemininginfo"] = service.GetSideMiningInfo
+	mainMux["getmainchainblockheight"] = service.GetMainChainBlockHeight
+	mainMux["getsidechainblockheight"] = service.GetSideChainBlockHeight
+	mainMux["getfinisheddeposittxs"] = service.GetFinishedDepositTxs
+	mainMux["getfinishedwithdrawtxs"] = service.GetFinishedWithdrawTxs
 	mainMux["getgitversion"] = servers.GetGitVersion
-	mainMux["getspvheight"] = servers.GetSPVHeight
-	mainMux["getarbiterpeersinfo"] = servers.GetArbiterPeersInfo
+	mainMux["getspvheight"] = service.GetSPVHeight
+	mainMux["getarbiterpeersinfo"] = service.GetArbiterPeersInfo
+	mainMux["getarbiterpeerscores"] = service.GetArbiterPeerScores
+	mainMux["getsigningpolicyrejections"] = service.GetSigningPolicyRejections
+	mainMux["getsolvencyreports"] = service.GetSolvencyReports
+	mainMux["getmetrics"] = servers.GetMetrics
+
+	// admin interfaces
+	mainMux["rescansidechain"] = service.RescanSideChain
+	mainMux["getsidechainrescanprogress"] = service.GetSideChainRescanProgress
+	mainMux["rescanmainchain"] = service.RescanMainChain
+	mainMux["getmainchainrescanprogress"] = service.GetMainChainRescanProgress
+	mainMux["getheldwithdrawtxs"] = service.GetHeldWithdrawTxs
+	mainMux["approvewithdrawtx"] = service.ApproveWithdrawTx
+	mainMux["rejectwithdrawtx"] = service.RejectWithdrawTx
+	mainMux["getrejectedwithdrawtxs"] = service.GetRejectedWithdrawTxs
+	mainMux["dryrunwithdraw"] = service.DryRunWithdraw
+	mainMux["redrivewithdrawtxs"] = service.RedriveWithdrawTxs
+	mainMux["getwithdrawredrivelogs"] = service.GetWithdrawRedriveLogs
+	mainMux["getdeadletterdeposittxs"] = service.GetDeadLetterDepositTxs
+	mainMux["redrivedeposittxs"] = service.RedriveDepositTxs
+	mainMux["getloglevels"] = servers.GetLogLevels
+	mainMux["setloglevel"] = servers.SetLogLevel
+	mainMux["tracep2p"] = servers.TraceP2P
+	mainMux["getauditlog"] = service.GetAuditLog
+	mainMux["verifyauditlog"] = service.VerifyAuditLog
+
+	return mainMux
+}
 
+// StartRPCServer serves the interfaces on the http json port of cfg until
+// pServer is shut down.
+func StartRPCServer(pServer *http.Server, cfg *config.Configuration, service *servers.Service) {
 	rpcServeMux := http.NewServeMux()
-	rpcServeMux.HandleFunc("/", Handle)
+	rpcServeMux.HandleFunc("/", Handler(&cfg.RpcConfiguration, service))
+	if cfg.RpcConfiguration.EnablePprof {
+		handlePprof(rpcServeMux, &cfg.RpcConfiguration)
+	}
 	if pServer == nil {
 		pServer = &http.Server{}
 	}
@@ -48,14 +97,14 @@ func StartRPCServer(pServer *http.Server) {
 		pServer.WriteTimeout = 15 * time.Second
 	}
 
-	listerner, err := net.Listen("tcp4", ":"+strconv.Itoa(config.Parameters.HttpJsonPort))
+	listerner, err := net.Listen("tcp4", ":"+strconv.Itoa(cfg.HttpJsonPort))
 	if err != nil {
-		log.Fatal("Listen error: ", err.Error())
+		log.RPC.Fatal("Listen error", log.F("port", cfg.HttpJsonPort), log.Err(err))
 		return
 	}
 	err = pServer.Serve(listerner)
-	if err != nil {
-		log.Warnf("StartRPCServer : %v", err.Error())
+	if err != nil && err != http.ErrServerClosed {
+		log.RPC.Warn("StartRPCServer error", log.Err(err))
 	}
 }
 
@@ -67,29 +116,38 @@ func Stop(s *http.Server) error {
 	return fmt.Errorf("server not started")
 }
 
-//this is the funciton that should be called in order to answer an rpc call
-//should be registered like "http.AddMethod("/", httpjsonrpc.Handle)"
-func Handle(w http.ResponseWriter, r *http.Request) {
-	isClientAllowed := clientAllowed(r)
+// Handler returns the function answering rpc calls by the interfaces of
+// service, clients are allowed and authenticated by conf. It should be
+// registered like "http.HandleFunc("/", httpjsonrpc.Handler(conf, service))"
+func Handler(conf *config.RpcConfiguration, service *servers.Service) http.HandlerFunc {
+	mainMux := newMux(service)
+	return func(w http.ResponseWriter, r *http.Request) {
+		handle(conf, mainMux, w, r)
+	}
+}
+
+func handle(conf *config.RpcConfiguration, mainMux rpcMux, w http.ResponseWriter, r *http.Request) {
+	isClientAllowed := clientAllowed(conf, r)
 	if !isClientAllowed {
-		log.Warn("HTTP Client ip is not allowd")
+		log.RPC.Warn("HTTP Client ip is not allowed", log.F("remote", r.RemoteAddr))
 		http.Error(w, "Client ip is not allowd", http.StatusForbidden)
 		return
 	}
 	//JSON RPC commands should be POSTs
 	if r.Method != "POST" {
-		log.Warn("HTTP JSON RPC Handle - Method!=\"POST\"")
+		log.RPC.Warn("HTTP JSON RPC Handle - Method!=\"POST\"", log.F("remote", r.RemoteAddr),
+			log.F("method", r.Method))
 		http.Error(w, "JSON RPC protocol only allows POST method", http.StatusMethodNotAllowed)
 		return
 	}
 
 	//check if there is Request Body to read
 	if r.Body == nil {
-		log.Warn("HTTP JSON RPC Handle - Request body is nil")
+		log.RPC.Warn("HTTP JSON RPC Handle - Request body is nil", log.F("remote", r.RemoteAddr))
 		return
 	}
 
-	isCheckAuthOk := checkAuth(r)
+	isCheckAuthOk := checkAuth(conf, r)
 	if !isCheckAuthOk {
 		//log.Warn("client authenticate failed")
 		http.Error(w, "client authenticate failed", http.StatusUnauthorized)
@@ -99,30 +157,36 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	//read the body of the request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Error("HTTP JSON RPC Handle - ioutil.ReadAll: ", err)
+		log.RPC.Error("HTTP JSON RPC Handle - ioutil.ReadAll failed", log.F("remote", r.RemoteAddr), log.Err(err))
 		return
 	}
 	request := make(map[string]interface{})
 	err = json.Unmarshal(body, &request)
 	if err != nil {
-		log.Error("HTTP JSON RPC Handle - json.Unmarshal: ", err)
+		log.RPC.Error("HTTP JSON RPC Handle - json.Unmarshal failed", log.F("remote", r.RemoteAddr), log.Err(err))
 		return
 	}
 
 	//get the corresponding function
-	function, method, ok := checkMethod(request)
+	function, method, ok := checkMethod(mainMux, request)
 
 	if !ok {
 		Error(w, errors.InvalidMethod, method)
 		return
 	}
 
+	if !checkAdmin(conf, r, request["method"].(string)) {
+		Error(w, errors.AccessDenied, request["method"])
+		return
+	}
+
 	params, ok := checkParams(request)
 	if !ok {
 		Error(w, errors.InvalidParams, method)
 		return
 	}
 
+	log.RPC.Debug("HTTP JSON RPC Handle", log.F("remote", r.RemoteAddr), log.F("method", method))
 	response := function(params)
 	var data []byte
 	if response["Error"] != errors.ErrCode(0) {
@@ -148,8 +212,7 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func checkAuth(r *http.Request) bool {
-	tempRpcConf := config.Parameters.RpcConfiguration
+func checkAuth(tempRpcConf *config.RpcConfiguration, r *http.Request) bool {
 	if (tempRpcConf.User == tempRpcConf.Pass) && (len(tempRpcConf.User) == 0) {
 		return true
 	}
@@ -173,12 +236,26 @@ func checkAuth(r *http.Request) bool {
 	return false
 }
 
-func clientAllowed(r *http.Request) bool {
-	log.Debugf("clientAllowed RpcConfiguration %v", config.Parameters.RpcConfiguration)
+// checkAdmin returns if the method is allowed to be called, admin methods
+// need the user and password configured and the request authenticated by
+// them.
+func checkAdmin(conf *config.RpcConfiguration, r *http.Request, method string) bool {
+	if _, ok := adminMethods[method]; !ok {
+		return true
+	}
+	return adminEnabled(conf) && checkAuth(conf, r)
+}
+
+// adminEnabled returns if rpc user and password are configured.
+func adminEnabled(tempRpcConf *config.RpcConfiguration) bool {
+	return len(tempRpcConf.User) != 0 || len(tempRpcConf.Pass) != 0
+}
+
+func clientAllowed(conf *config.RpcConfiguration, r *http.Request) bool {
 	//this ipAbbr  may be  ::1 when request is localhost
 	ipAbbr, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		log.Errorf("RemoteAddr clientAllowed SplitHostPort failure %s \n", r.RemoteAddr)
+		log.RPC.Error("clientAllowed SplitHostPort failure", log.F("remote", r.RemoteAddr), log.Err(err))
 		return false
 
 	}
@@ -186,7 +263,7 @@ func clientAllowed(r *http.Request) bool {
 	remoteIp := net.ParseIP(ipAbbr)
 
 	if remoteIp == nil {
-		log.Errorf("clientAllowed ParseIP ipAbbr %s failure  \n", ipAbbr)
+		log.RPC.Error("clientAllowed ParseIP failure", log.F("remote", r.RemoteAddr))
 		return false
 	}
 
@@ -195,7 +272,7 @@ func clientAllowed(r *http.Request) bool {
 		return true
 	}
 
-	for _, cfgIp := range config.Parameters.RpcConfiguration.WhiteIPList {
+	for _, cfgIp := range conf.WhiteIPList {
 		//WhiteIPList have 0.0.0.0  allow all ip in
 		if cfgIp == "0.0.0.0" {
 			return true
@@ -208,7 +285,7 @@ func clientAllowed(r *http.Request) bool {
 	return false
 }
 
-func checkMethod(request map[string]interface{}) (func(servers.Params) map[string]interface{}, interface{}, bool) {
+func checkMethod(mainMux rpcMux, request map[string]interface{}) (func(servers.Params) map[string]interface{}, interface{}, bool) {
 	method := request["method"]
 	if method == nil {
 		return nil, method, false
@@ -241,7 +318,7 @@ func checkParams(request map[string]interface{}) (map[string]interface{}, bool)
 
 func Error(w http.ResponseWriter, code errors.ErrCode, method interface{}) {
 	//if the function does not exist
-	log.Warn("HTTP JSON RPC Handle - No function to call for ", method)
+	log.RPC.Warn("HTTP JSON RPC Handle - request refused", log.F("method", method), log.F("code", code))
 	data, _ := json.Marshal(map[string]interface{}{
 		"jsonpc": "2.0",
 		"code":   code,
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA/utils/test"
+
+	"github.com/stretchr/testify/assert"
 )
 
 //if bRunServer is true .run server for every testcase
@@ -24,6 +29,8 @@ var (
 	clientAuthUser string
 	clientAuthPass string
 	pServer        *http.Server
+	// testConf is the configuration the rpc server of tests runs by.
+	testConf = &config.Configuration{HttpJsonPort: 20336}
 )
 
 func initUrl() {
@@ -45,11 +52,18 @@ func initUrl() {
 func isRunServer() bool {
 	return bRunServer
 }
-func init() {
-
-	log.Init("./Elastos", 1, 0, 0)
+func TestMain(m *testing.M) {
+	logDir, err := ioutil.TempDir("", "httpjsonrpc")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(logDir, 1, 0, 0)
 	initUrl()
 	initReqObject()
+
+	code := m.Run()
+	os.RemoveAll(logDir)
+	os.Exit(code)
 }
 
 func InitNewServer(conf config.RpcConfiguration) {
@@ -167,7 +181,7 @@ func Wait() {
 	}
 }
 func InitConf(conf config.RpcConfiguration) {
-	config.Parameters.RpcConfiguration = conf
+	testConf.RpcConfiguration = conf
 }
 func TestServer_NotInitRpcConf(t *testing.T) {
 
@@ -182,7 +196,7 @@ func TestServer_NotInitRpcConf(t *testing.T) {
 	}
 	InitNewServer(svrConf)
 	if isRunServer() {
-		go StartRPCServer(pServer)
+		go StartRPCServer(pServer, testConf, nil)
 	}
 
 	urlLoopBackNoAuthTest := func(url string, withAuthorization bool, expectStatus int, t *testing.T) {
@@ -241,7 +255,7 @@ func TestServer_WithUserPassNoIp(t *testing.T) {
 	InitNewServer(svrConf)
 
 	if isRunServer() {
-		go StartRPCServer(pServer)
+		go StartRPCServer(pServer, testConf, nil)
 	}
 
 	urlLocalhostWithAuthTest := func(url string, withAuthorization bool, expectStatus int, t *testing.T) {
@@ -333,7 +347,7 @@ func TestServer_NoUserPassWithIp(t *testing.T) {
 	InitNewServer(svrConf)
 
 	if isRunServer() {
-		go StartRPCServer(pServer)
+		go StartRPCServer(pServer, testConf, nil)
 	}
 
 	urlLocalhostNoAuthTest := func(url string, withAuthorization bool, expectStatus int, t *testing.T) {
@@ -393,7 +407,7 @@ func TestServer_WithUserPassWithIp(t *testing.T) {
 	InitNewServer(svrConf)
 
 	if isRunServer() {
-		go StartRPCServer(pServer)
+		go StartRPCServer(pServer, testConf, nil)
 	}
 
 	urlLoopbackWithAuthTest := func(url string, withAuthorization bool, expectStatus int, t *testing.T) {
@@ -452,7 +466,7 @@ func TestServer_WithIp0000(t *testing.T) {
 	InitNewServer(svrConf)
 
 	if isRunServer() {
-		go StartRPCServer(pServer)
+		go StartRPCServer(pServer, testConf, nil)
 	}
 	urlNotLoopbackWithAuthTest := func(url string, withAuthorization bool, expectStatus int, t *testing.T) {
 		clientAuthUser = svrConf.User
@@ -496,3 +510,25 @@ func TestServer_WithIp0000(t *testing.T) {
 
 	Wait()
 }
+
+func TestCheckAdmin(t *testing.T) {
+	defer InitConf(testConf.RpcConfiguration)
+
+	request := func(user, pass string) *http.Request {
+		r := httptest.NewRequest("POST", "/", nil)
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		return r
+	}
+
+	// refused without rpc user and password
+	InitConf(config.RpcConfiguration{})
+	assert.False(t, checkAdmin(&testConf.RpcConfiguration, request("", ""), "rescanmainchain"))
+	assert.True(t, checkAdmin(&testConf.RpcConfiguration, request("", ""), "getinfo"))
+
+	InitConf(config.RpcConfiguration{User: "user", Pass: "pass"})
+	assert.False(t, checkAdmin(&testConf.RpcConfiguration, request("", ""), "rescanmainchain"))
+	assert.False(t, checkAdmin(&testConf.RpcConfiguration, request("user", "wrong"), "rescanmainchain"))
+	assert.True(t, checkAdmin(&testConf.RpcConfiguration, request("user", "pass"), "rescanmainchain"))
+}
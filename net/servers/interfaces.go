@@ -4,22 +4,21 @@ import (
 	"encoding/hex"
 	"time"
 
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/complain"
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/errors"
-	"github.com/elastos/Elastos.ELA.Arbiter/sideauxpow"
-	"github.com/elastos/Elastos.ELA.Arbiter/store"
+	"github.com/elastos/Elastos.ELA.Arbiter/metrics"
 
 	"github.com/elastos/Elastos.ELA/common"
 )
 
-func SubmitComplain(param Params) map[string]interface{} {
+func (s *Service) SubmitComplain(param Params) map[string]interface{} {
 	if !checkParam(param, "fromaddress", "transactionhash") {
 		return ResponsePack(errors.InvalidParams, "")
 	}
+	if s == nil || s.ComplainSolver == nil {
+		return ResponsePack(errors.InternalError, "complain solver not started")
+	}
 
 	transactionHash := param["transactionhash"].(string)
 	txHashBytes, _ := common.HexStringToBytes(transactionHash)
@@ -35,22 +34,25 @@ func SubmitComplain(param Params) map[string]interface{} {
 		blockHashItem = ""
 	}
 
-	content, err := complain.ComplainSolver.AcceptComplain(fromAddress, blockHashItem.(string), *txHash)
+	content, err := s.ComplainSolver.AcceptComplain(fromAddress, blockHashItem.(string), *txHash)
 	if err != nil {
 		return ResponsePack(errors.InvalidTransaction, "")
 	}
 
-	if err = complain.ComplainSolver.BroadcastComplainSolving(content); err != nil {
+	if err = s.ComplainSolver.BroadcastComplainSolving(content); err != nil {
 		return ResponsePack(errors.InternalError, "")
 	}
 
 	return ResponsePack(errors.Success, "")
 }
 
-func GetComplainStatus(param Params) map[string]interface{} {
+func (s *Service) GetComplainStatus(param Params) map[string]interface{} {
 	if !checkParam(param, "transactionhash") {
 		return ResponsePack(errors.InvalidParams, "")
 	}
+	if s == nil || s.ComplainSolver == nil {
+		return ResponsePack(errors.InternalError, "complain solver not started")
+	}
 
 	transactionHash := param["transactionhash"].(string)
 	txHashBytes, _ := common.HexStringToBytes(transactionHash)
@@ -60,7 +62,7 @@ func GetComplainStatus(param Params) map[string]interface{} {
 		return ResponsePack(errors.InvalidParams, "")
 	}
 
-	return ResponsePack(errors.Success, complain.ComplainSolver.GetComplainStatus(*txHash))
+	return ResponsePack(errors.Success, s.ComplainSolver.GetComplainStatus(*txHash))
 }
 
 func checkParam(param map[string]interface{}, keys ...string) bool {
@@ -84,7 +86,11 @@ func checkParam(param map[string]interface{}, keys ...string) bool {
 	return true
 }
 
-func GetInfo(param Params) map[string]interface{} {
+func (s *Service) GetInfo(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	cfg := s.Arbitrator.GetConfig()
 	Info := struct {
 		Version                      uint32        `json:"version"`
 		SideChainMonitorScanInterval time.Duration `json:"SideChainMonitorScanInterval"`
@@ -95,19 +101,22 @@ func GetInfo(param Params) map[string]interface{} {
 		MinThreshold                 int           `json:"MinThreshold"`
 		DepositAmount                int           `json:"DepositAmount"`
 	}{
-		Version:                      config.Parameters.Version,
-		SideChainMonitorScanInterval: config.Parameters.SideChainMonitorScanInterval,
-		ClearTransactionInterval:     config.Parameters.ClearTransactionInterval,
-		MinOutbound:                  config.Parameters.MinOutbound,
-		MaxConnections:               config.Parameters.MaxConnections,
-		SideAuxPowFee:                config.Parameters.SideAuxPowFee,
-		MinThreshold:                 config.Parameters.MinThreshold,
-		DepositAmount:                config.Parameters.DepositAmount,
+		Version:                      cfg.Version,
+		SideChainMonitorScanInterval: cfg.SideChainMonitorScanInterval,
+		ClearTransactionInterval:     cfg.ClearTransactionInterval,
+		MinOutbound:                  cfg.MinOutbound,
+		MaxConnections:               cfg.MaxConnections,
+		SideAuxPowFee:                cfg.SideAuxPowFee,
+		MinThreshold:                 cfg.MinThreshold,
+		DepositAmount:                cfg.DepositAmount,
 	}
 	return ResponsePack(errors.Success, &Info)
 }
 
-func GetSideMiningInfo(param Params) map[string]interface{} {
+func (s *Service) GetSideMiningInfo(param Params) map[string]interface{} {
+	if s == nil || s.AuxPow == nil {
+		return ResponsePack(errors.InternalError, "side aux pow not started")
+	}
 	genesisBlockHashStr, ok := param.String("hash")
 	if !ok {
 		return ResponsePack(errors.InvalidParams, "need a string parameter named hash")
@@ -122,15 +131,15 @@ func GetSideMiningInfo(param Params) map[string]interface{} {
 	if err != nil {
 		return ResponsePack(errors.InvalidParams, "invalid genesis block hash")
 	}
-	lastSendSideMiningHeight, ok := sideauxpow.GetLastSendSideMiningHeight(genesisBlockHash)
+	lastSendSideMiningHeight, ok := s.AuxPow.GetLastSendSideMiningHeight(genesisBlockHash)
 	if !ok {
 		return ResponsePack(errors.InvalidParams, "genesis block hash not matched")
 	}
-	lastNotifySideMiningHeight, ok := sideauxpow.GetLastNotifySideMiningHeight(genesisBlockHash)
+	lastNotifySideMiningHeight, ok := s.AuxPow.GetLastNotifySideMiningHeight(genesisBlockHash)
 	if !ok {
 		return ResponsePack(errors.InvalidParams, "genesis block hash not matched")
 	}
-	lastSubmitAuxpowHeight, ok := sideauxpow.GetLastSubmitAuxpowHeight(genesisBlockHash)
+	lastSubmitAuxpowHeight, ok := s.AuxPow.GetLastSubmitAuxpowHeight(genesisBlockHash)
 	if !ok {
 		return ResponsePack(errors.InvalidParams, "genesis block hash not matched")
 	}
@@ -146,39 +155,58 @@ func GetSideMiningInfo(param Params) map[string]interface{} {
 	return ResponsePack(errors.Success, &Info)
 }
 
-func GetMainChainBlockHeight(param Params) map[string]interface{} {
-	return ResponsePack(errors.Success, store.DbCache.MainChainStore.CurrentHeight(0))
+func (s *Service) GetMainChainBlockHeight(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	return ResponsePack(errors.Success, s.Arbitrator.GetDataStore().MainChainStore.CurrentHeight(0))
+}
+
+func (s *Service) GetSideChainBlockHeight(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
+	address, resp := genesisAddressFromParam(param)
+	if resp != nil {
+		return resp
+	}
+
+	return ResponsePack(errors.Success, s.Arbitrator.GetDataStore().SideChainStore.CurrentSideHeight(address, 0))
 }
 
-func GetSideChainBlockHeight(param Params) map[string]interface{} {
+// genesisAddressFromParam returns the genesis address of the side chain whose
+// genesis block hash is the parameter named hash, or the error response.
+func genesisAddressFromParam(param Params) (string, map[string]interface{}) {
 	genesisBlockHashStr, ok := param.String("hash")
 	if !ok {
-		return ResponsePack(errors.InvalidParams, "need a string parameter named hash")
+		return "", ResponsePack(errors.InvalidParams, "need a string parameter named hash")
 	}
 	genesisBlockHashBytes, err := common.HexStringToBytes(genesisBlockHashStr)
 	if err != nil {
-		return ResponsePack(errors.InvalidParams, "invalid genesis block hash")
+		return "", ResponsePack(errors.InvalidParams, "invalid genesis block hash")
 	}
 	reversedGenesisBlockHashBytes := common.BytesReverse(genesisBlockHashBytes)
 	reversedGenesisBlockHashStr := common.BytesToHexString(reversedGenesisBlockHashBytes)
 	genesisBlockHash, err := common.Uint256FromHexString(reversedGenesisBlockHashStr)
 	if err != nil {
-		return ResponsePack(errors.InvalidParams, "invalid genesis block hash")
+		return "", ResponsePack(errors.InvalidParams, "invalid genesis block hash")
 	}
 	address, err := base.GetGenesisAddress(*genesisBlockHash)
 	if err != nil {
-		return ResponsePack(errors.InvalidParams, "invalid genesis block hash")
+		return "", ResponsePack(errors.InvalidParams, "invalid genesis block hash")
 	}
-
-	return ResponsePack(errors.Success, store.DbCache.SideChainStore.CurrentSideHeight(address, 0))
+	return address, nil
 }
 
-func GetFinishedDepositTxs(param Params) map[string]interface{} {
+func (s *Service) GetFinishedDepositTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
 	succeed, ok := param.Bool("succeed")
 	if !ok {
 		return ResponsePack(errors.InvalidParams, "need a bool parameter named succeed")
 	}
-	txHashes, genesisAddresses, err := store.FinishedTxsDbCache.GetDepositTxs(succeed)
+	txHashes, genesisAddresses, err := s.Arbitrator.GetFinishedTxsStore().GetDepositTxs(succeed)
 	if err != nil {
 		return ResponsePack(errors.InvalidParams, "get deposit transactions from finished dbcache failed")
 	}
@@ -201,12 +229,15 @@ func GetFinishedDepositTxs(param Params) map[string]interface{} {
 	return ResponsePack(errors.Success, &depositTxs)
 }
 
-func GetFinishedWithdrawTxs(param Params) map[string]interface{} {
+func (s *Service) GetFinishedWithdrawTxs(param Params) map[string]interface{} {
+	if resp := s.checkArbitrator(); resp != nil {
+		return resp
+	}
 	succeed, ok := param.Bool("succeed")
 	if !ok {
 		return ResponsePack(errors.InvalidParams, "need a bool parameter named succeed")
 	}
-	txHashes, err := store.FinishedTxsDbCache.GetWithdrawTxs(succeed)
+	txHashes, err := s.Arbitrator.GetFinishedTxsStore().GetWithdrawTxs(succeed)
 	if err != nil {
 		return ResponsePack(errors.InvalidParams, "get withdraw transactions from finished dbcache failed")
 	}
@@ -223,28 +254,154 @@ func GetGitVersion(param Params) map[string]interface{} {
 	return ResponsePack(errors.Success, config.Version)
 }
 
-func GetSPVHeight(param Params) map[string]interface{} {
-	bestHeader, err := arbitrator.SpvService.HeaderStore().GetBest()
+func (s *Service) GetSPVHeight(param Params) map[string]interface{} {
+	if s == nil || s.Arbitrator == nil || s.Arbitrator.GetSpvService() == nil {
+		return ResponsePack(errors.InternalError, "spv service not started")
+	}
+	bestHeader, err := s.Arbitrator.GetSpvService().HeaderStore().GetBest()
 	if err != nil {
 		return ResponsePack(errors.InternalError, "get spv best header failed")
 	}
 	return ResponsePack(errors.Success, bestHeader.Height)
 }
 
-func GetArbiterPeersInfo(params Params) map[string]interface{} {
+func (s *Service) GetSolvencyReports(param Params) map[string]interface{} {
+	if s == nil || s.Solvency == nil {
+		return ResponsePack(errors.InternalError, "solvency reconciler not started")
+	}
+	type solvencyReport struct {
+		GenesisAddress     string `json:"genesisaddress"`
+		Time               int64  `json:"time"`
+		MainChainLocked    string `json:"mainchainlocked"`
+		SideChainSupply    string `json:"sidechainsupply"`
+		PendingDeposits    string `json:"pendingdeposits"`
+		DeadLetterDeposits string `json:"deadletterdeposits"`
+		PendingWithdraws   string `json:"pendingwithdraws"`
+		FailedWithdraws    string `json:"failedwithdraws"`
+		RejectedWithdraws  string `json:"rejectedwithdraws"`
+		Delta              string `json:"delta"`
+		Alert              bool   `json:"alert"`
+		Error              string `json:"error,omitempty"`
+	}
+	result := make([]solvencyReport, 0)
+	for _, r := range s.Solvency.GetReports() {
+		result = append(result, solvencyReport{
+			GenesisAddress:     r.GenesisAddress,
+			Time:               r.Time.Unix(),
+			MainChainLocked:    r.MainChainLocked.String(),
+			SideChainSupply:    r.SideChainSupply.String(),
+			PendingDeposits:    r.PendingDeposits.String(),
+			DeadLetterDeposits: r.DeadLetterDeposits.String(),
+			PendingWithdraws:   r.PendingWithdraws.String(),
+			FailedWithdraws:    r.FailedWithdraws.String(),
+			RejectedWithdraws:  r.RejectedWithdraws.String(),
+			Delta:              r.Delta.String(),
+			Alert:              r.Alert,
+			Error:              r.Error,
+		})
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func GetMetrics(param Params) map[string]interface{} {
+	return ResponsePack(errors.Success, metrics.Snapshot())
+}
+
+func (s *Service) GetSigningPolicyRejections(param Params) map[string]interface{} {
+	if s == nil || s.SigningPolicy == nil {
+		return ResponsePack(errors.InternalError, "signing policy not loaded")
+	}
+	return ResponsePack(errors.Success, s.SigningPolicy.GetRejections())
+}
+
+func (s *Service) GetArbiterPeersInfo(params Params) map[string]interface{} {
+	if s == nil || s.Network == nil {
+		return ResponsePack(errors.InternalError, "arbiter network not started")
+	}
+	type sideChainHeight struct {
+		GenesisBlockAddress string `json:"genesisblockaddress"`
+		Height              uint32 `json:"height"`
+	}
+	type peerStatus struct {
+		Version          string            `json:"version"`
+		MainChainHeight  uint32            `json:"mainchainheight"`
+		SideChainHeights []sideChainHeight `json:"sidechainheights"`
+		OnDutyArbiter    string            `json:"ondutyarbiter"`
+		ArbitersCount    uint32            `json:"arbiterscount"`
+		ArbitersHash     string            `json:"arbitershash"`
+		SameArbiters     bool              `json:"samearbiters"`
+		PendingDeposits  uint32            `json:"pendingdeposits"`
+		PendingWithdraws uint32            `json:"pendingwithdraws"`
+		Timestamp        int64             `json:"timestamp"`
+		ReceivedTime     int64             `json:"receivedtime"`
+	}
 	type peerInfo struct {
-		PublicKey string `json:"publickey"`
-		IP        string `json:"ip"`
-		ConnState string `json:"connstate"`
+		PublicKey string      `json:"publickey"`
+		IP        string      `json:"ip"`
+		ConnState string      `json:"connstate"`
+		Status    *peerStatus `json:"status,omitempty"`
 	}
-	peers := cs.P2PClientSingleton.DumpArbiterPeersInfo()
+	arbitersHash := s.Network.CurrentArbitersHash()
+	peers := s.Network.DumpArbiterPeersInfo()
 	result := make([]peerInfo, 0)
 	for _, p := range peers {
-		result = append(result, peerInfo{
+		info := peerInfo{
 			PublicKey: hex.EncodeToString(p.PID[:]),
 			IP:        p.Addr,
 			ConnState: p.State.String(),
-		})
+		}
+		if ps, ok := s.Network.GetPeerStatus(p.PID); ok {
+			status := &peerStatus{
+				Version:          ps.Version,
+				MainChainHeight:  ps.MainChainHeight,
+				SideChainHeights: make([]sideChainHeight, 0, len(ps.SideChainHeights)),
+				OnDutyArbiter:    ps.OnDutyArbiter,
+				ArbitersCount:    ps.ArbitersCount,
+				ArbitersHash:     ps.ArbitersHash.String(),
+				SameArbiters:     ps.ArbitersHash.IsEqual(arbitersHash),
+				PendingDeposits:  ps.PendingDeposits,
+				PendingWithdraws: ps.PendingWithdraws,
+				Timestamp:        ps.Timestamp,
+				ReceivedTime:     ps.ReceivedTime.Unix(),
+			}
+			for _, h := range ps.SideChainHeights {
+				status.SideChainHeights = append(status.SideChainHeights, sideChainHeight{
+					GenesisBlockAddress: h.GenesisBlockAddress,
+					Height:              h.Height,
+				})
+			}
+			info.Status = status
+		}
+		result = append(result, info)
+	}
+	return ResponsePack(errors.Success, result)
+}
+
+func (s *Service) GetArbiterPeerScores(params Params) map[string]interface{} {
+	if s == nil || s.Network == nil {
+		return ResponsePack(errors.InternalError, "arbiter network not started")
+	}
+	type peerScore struct {
+		PublicKey   string `json:"publickey"`
+		Score       uint32 `json:"score"`
+		LastReason  string `json:"lastreason"`
+		Banned      bool   `json:"banned"`
+		BannedUntil int64  `json:"banneduntil"`
+		BanCount    uint32 `json:"bancount"`
+	}
+	result := make([]peerScore, 0)
+	for _, ps := range s.Network.DumpPeerScores() {
+		score := peerScore{
+			PublicKey:  hex.EncodeToString(ps.PID[:]),
+			Score:      ps.Score,
+			LastReason: ps.LastReason,
+			Banned:     ps.Banned,
+			BanCount:   ps.BanCount,
+		}
+		if !ps.BannedUntil.IsZero() {
+			score.BannedUntil = ps.BannedUntil.Unix()
+		}
+		result = append(result, score)
 	}
 	return ResponsePack(errors.Success, result)
 }
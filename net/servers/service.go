@@ -0,0 +1,33 @@
+package servers
+
+import (
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/sidechain"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/errors"
+	"github.com/elastos/Elastos.ELA.Arbiter/sideauxpow"
+)
+
+// Service serves the interfaces depending on the components of an arbiter,
+// the components not set are answered as not started.
+type Service struct {
+	Arbitrator       arbitrator.Arbitrator
+	Network          *cs.ArbitratorsNetwork
+	SigningPolicy    *cs.SigningPolicy
+	ComplainSolver   base.ComplainSolving
+	SideChainMonitor *sidechain.SideChainAccountMonitorImpl
+	Solvency         *sidechain.SolvencyReconciler
+	AuxPow           *sideauxpow.SideAuxPow
+	AuditLog         *audit.Log
+}
+
+// checkArbitrator returns the response of the interfaces depending on the
+// arbitrator if it is not set, or nil.
+func (s *Service) checkArbitrator() map[string]interface{} {
+	if s == nil || s.Arbitrator == nil {
+		return ResponsePack(errors.InternalError, "arbitrator not started")
+	}
+	return nil
+}
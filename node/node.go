@@ -0,0 +1,307 @@
+// Package node wires the components of an arbiter together. A Node owns the
+// components and hands them explicitly to the ones depending on them, such
+// as the arbiters network, the signing policy, the spv service and the rpc
+// interfaces.
+//
+// The configuration, the arbitrator group, the data stores and the audit log
+// are owned by the Node too, and the data of a Node is kept in its DataDir, so
+// more than one Node may run in a process in different data directories and
+// ports. The logs are not owned by a Node, all Nodes of a process write to the
+// global loggers of the log package configured by ConfigureLogs.
+package node
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/mainchain"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/sidechain"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/lifecycle"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers/httpjsonrpc"
+	"github.com/elastos/Elastos.ELA.Arbiter/sideauxpow"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA.SPV/interface"
+	"github.com/elastos/Elastos.ELA/account"
+	"github.com/elastos/Elastos.ELA/dpos/p2p"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+)
+
+// DefaultDataDir is the data directory of the arbiter run by main.
+var DefaultDataDir = filepath.Join(config.DataPath, config.DataDir)
+
+// ConfigureLogs sets the log format and the levels of log modules by cfg, and
+// makes the spv module and the p2p network of ELA log through the spv and p2p
+// modules. It should be called after log.Init. The loggers are global to the
+// process, the nodes of a process share the configuration applied last.
+func ConfigureLogs(cfg *config.Configuration) error {
+	if err := log.SetFormat(cfg.LogFormat); err != nil {
+		return err
+	}
+	log.SPV.SetLevel(cfg.SPVPrintLevel)
+	for name, level := range cfg.LogLevels {
+		if err := log.SetModuleLevel(name, level); err != nil {
+			return err
+		}
+	}
+
+	_interface.UseLogger(log.SPV.ElaLogger())
+	p2p.UseLogger(log.P2P.ElaLogger())
+	return nil
+}
+
+// Node is an arbiter and the components it depends on.
+type Node struct {
+	Config *config.Configuration
+	// DataDir is the directory of the data stores, the audit log, the spv
+	// module and the p2p network.
+	DataDir          string
+	Client           *account.Client
+	DataStore        *store.DataStoreImpl
+	FinishedTxsStore store.FinishedTransactionsDataStore
+	AuditLog         *audit.Log
+	ArbitratorGroup  *arbitrator.ArbitratorGroupImpl
+	Arbitrator       arbitrator.Arbitrator
+	Network          *cs.ArbitratorsNetwork
+	SigningPolicy    *cs.SigningPolicy
+	// ComplainSolver solves complains submitted by submitcomplain, the
+	// interfaces of complains are refused while it is nil.
+	ComplainSolver   base.ComplainSolving
+	SideChainMonitor *sidechain.SideChainAccountMonitorImpl
+	Solvency         *sidechain.SolvencyReconciler
+	AuxPow           *sideauxpow.SideAuxPow
+	RPCServer        *http.Server
+	Lifecycle        *lifecycle.Manager
+}
+
+// New creates the node of the arbiter configured by cfg and signing by
+// client, the data of the node is kept in dataDir.
+func New(cfg *config.Configuration, dataDir string, client *account.Client) *Node {
+	group := arbitrator.NewArbitratorGroup(cfg, dataDir, client)
+	ar := group.GetCurrentArbitrator()
+	auxPow := sideauxpow.New(ar, client)
+	ar.(*arbitrator.ArbitratorImpl).SetSideChainManager(
+		sidechain.NewSideChainManager(ar, auxPow))
+
+	return &Node{
+		Config:          cfg,
+		DataDir:         dataDir,
+		Client:          client,
+		ArbitratorGroup: group,
+		Arbitrator:      ar,
+		SigningPolicy:   cs.NewSigningPolicy(),
+		Solvency:        sidechain.NewSolvencyReconciler(ar),
+		AuxPow:          auxPow,
+		Lifecycle: lifecycle.NewManager(
+			time.Millisecond * cfg.ShutdownTimeout),
+	}
+}
+
+// Service returns the service of the rpc interfaces depending on the
+// components of the node.
+func (n *Node) Service() *servers.Service {
+	return &servers.Service{
+		Arbitrator:       n.Arbitrator,
+		Network:          n.Network,
+		SigningPolicy:    n.SigningPolicy,
+		ComplainSolver:   n.ComplainSolver,
+		SideChainMonitor: n.SideChainMonitor,
+		Solvency:         n.Solvency,
+		AuxPow:           n.AuxPow,
+		AuditLog:         n.AuditLog,
+	}
+}
+
+// Open opens the data stores and the p2p network not set and wires the
+// components of the node, without starting any of them. Simulations call it
+// in place of Start and drive the arbiter step by step. The opened
+// components are closed by Stop, even if Open fails.
+func (n *Node) Open() error {
+	lc := n.Lifecycle
+	lc.OnStop("rpc server", func() error {
+		if n.RPCServer == nil {
+			return nil
+		}
+		return httpjsonrpc.Stop(n.RPCServer)
+	})
+	lc.OnStop("loops", lc.Wait)
+	// finish deposit transactions being sent
+	lc.OnStop("deposit pools", func() error {
+		n.Arbitrator.StopDepositPools()
+		return nil
+	})
+	// finish withdraw transactions being sent
+	lc.OnStop("p2p network", func() error {
+		if n.Network == nil {
+			return nil
+		}
+		return n.Network.Stop()
+	})
+	lc.OnStop("spv module", func() error {
+		n.Arbitrator.StopSpvModule()
+		return nil
+	})
+	lc.OnStop("audit log", func() error {
+		if n.AuditLog == nil {
+			return nil
+		}
+		return n.AuditLog.Close()
+	})
+	lc.OnStop("finished transactions database", func() error {
+		if n.FinishedTxsStore == nil {
+			return nil
+		}
+		return n.FinishedTxsStore.Close()
+	})
+	lc.OnStop("database", func() error {
+		if n.DataStore == nil {
+			return nil
+		}
+		return n.DataStore.Close()
+	})
+
+	log.Info("1. Init chain utxo cache.")
+	storeDir := filepath.Join(n.DataDir, config.ArbiterDir)
+	if n.DataStore == nil {
+		dataStore, err := store.OpenDataStore(storeDir, n.Config.SideNodeList)
+		if err != nil {
+			return err
+		}
+		n.DataStore = dataStore
+	}
+	if err := n.SigningPolicy.Load(n.DataStore.SideChainStore); err != nil {
+		return err
+	}
+
+	log.Info("2. Init finished transaction cache.")
+	if n.FinishedTxsStore == nil {
+		finishedDataStore, err := store.OpenFinishedTxsDataStore(storeDir)
+		if err != nil {
+			return err
+		}
+		n.FinishedTxsStore = finishedDataStore
+	}
+
+	log.Info("3. Open signature audit log.")
+	if n.AuditLog == nil {
+		auditLog, err := audit.Open(filepath.Join(n.DataDir, audit.FileName))
+		if err != nil {
+			return err
+		}
+		n.AuditLog = auditLog
+	}
+	n.Arbitrator.(*arbitrator.ArbitratorImpl).SetStores(
+		n.DataStore, n.FinishedTxsStore, n.AuditLog)
+
+	log.Info("4. Init arbitrator P2P networks.")
+	if err := n.initP2P(); err != nil {
+		return err
+	}
+
+	n.setSideChainAccountMonitor()
+	return nil
+}
+
+// Start opens the node, starts the networks, the spv module and the rpc
+// server, and runs the loops of the arbiter in background. The started
+// components are stopped by Stop, even if Start fails.
+func (n *Node) Start() error {
+	if err := n.Open(); err != nil {
+		return err
+	}
+	lc := n.Lifecycle
+
+	log.Info("5. Start arbitrator P2P networks.")
+	if err := n.Network.Start(); err != nil {
+		return err
+	}
+
+	log.Info("6. Start side chain monitor.")
+	for _, node := range n.Config.SideNodeList {
+		sideNode := node
+		lc.Go(func(ctx context.Context) {
+			n.SideChainMonitor.SyncChainData(ctx, sideNode)
+		})
+	}
+
+	log.Info("7. Init configurations.")
+	if err := n.ArbitratorGroup.InitArbitrators(); err != nil {
+		return err
+	}
+
+	log.Info("8. Start arbitrator spv module.")
+	if err := n.Arbitrator.StartSpvModule(); err != nil {
+		return err
+	}
+
+	log.Info("9. Start arbitrator group monitor.")
+	lc.Go(n.ArbitratorGroup.SyncLoop)
+
+	log.Info("10. Start servers.")
+	n.RPCServer = new(http.Server)
+	go httpjsonrpc.StartRPCServer(n.RPCServer, n.Config, n.Service())
+
+	log.Info("11. Start check and remove cross chain transactions from db.")
+	lc.Go(n.Arbitrator.CheckAndRemoveCrossChainTransactionsFromDBLoop)
+
+	log.Info("12. Start side chain account divide.")
+	lc.Go(n.AuxPow.SidechainAccountDivide)
+
+	log.Info("13. Start bridge solvency reconciliation.")
+	lc.Go(n.Solvency.ReconcileLoop)
+
+	log.Info("14. Start retrying failed deposit transactions.")
+	lc.Go(n.Arbitrator.RetryDepositTransactionsLoop)
+
+	log.Info("15. Start takeover watchdog.")
+	lc.Go(n.Arbitrator.TakeoverWatchdogLoop)
+
+	log.Info("16. Start broadcasting arbiter status.")
+	lc.Go(n.Network.BroadcastStatusLoop)
+
+	return nil
+}
+
+// Stop stops accepting rpc requests and the loops, finishes the cross chain
+// transactions being sent, and stops the networks, the spv module and the
+// databases in order, in ShutdownTimeout.
+func (n *Node) Stop() error {
+	return n.Lifecycle.Stop()
+}
+
+func (n *Node) initP2P() error {
+	pk, err := n.Arbitrator.GetPublicKey().EncodePoint(true)
+	if err != nil {
+		return err
+	}
+
+	if n.Network == nil {
+		var id peer.PID
+		copy(id[:], pk)
+		n.Network, err = cs.NewArbitratorsNetwork(id, n.Arbitrator, n.DataDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	//register p2p client listener
+	return mainchain.InitMainChain(n.Arbitrator, n.Network, n.SigningPolicy)
+}
+
+func (n *Node) setSideChainAccountMonitor() {
+	monitor := &sidechain.SideChainAccountMonitorImpl{ParentArbitrator: n.Arbitrator}
+	n.SideChainMonitor = monitor
+
+	for _, side := range n.Arbitrator.GetSideChainManager().GetAllChains() {
+		monitor.AddListener(side)
+	}
+}
@@ -0,0 +1,316 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+const (
+	// DefaultRequestTimeout is the deadline applied to a call when the
+	// caller's context has none.
+	DefaultRequestTimeout = time.Minute
+
+	// DefaultMaxRetries is the number of extra attempts made for idempotent
+	// methods after the first one failed.
+	DefaultMaxRetries = 3
+
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+
+	maxIdleConnsPerHost = 16
+	idleConnTimeout     = 90 * time.Second
+)
+
+// idempotentMethods lists the node methods that only read chain state, so
+// they can be sent again safely if a previous attempt failed.
+var idempotentMethods = map[string]struct{}{
+	"getblockcount":                   {},
+	"getblockbyheight":                {},
+	"getblock":                        {},
+	"getwithdrawtransactionsbyheight": {},
+	"getillegalevidencebyheight":      {},
+	"checkillegalevidence":            {},
+	"getwithdrawtransaction":          {},
+	"getexistwithdrawtransactions":    {},
+	"getexistdeposittransactions":     {},
+	"getutxosbyamount":                {},
+	"getamountbyinputs":               {},
+	"listunspent":                     {},
+	"getarbitratorgroupbyheight":      {},
+	"getcrcpeersinfo":                 {},
+	"getcrosschainpeersinfo":          {},
+}
+
+// IsIdempotent returns if the given method may be retried.
+func IsIdempotent(method string) bool {
+	_, ok := idempotentMethods[method]
+	return ok
+}
+
+// DefaultClient is the client used by the package level helpers.
+var DefaultClient = NewClient(DefaultMaxRetries, DefaultMinBackoff, DefaultMaxBackoff)
+
+// Client is a reusable JSON-RPC client for ELA main and side nodes. It keeps
+// a pooled transport so connections are shared between calls.
+type Client struct {
+	httpClient *http.Client
+	// noBatch keeps the addresses of the nodes not serving batch requests,
+	// which are sent the requests of batches one by one.
+	noBatch sync.Map
+
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// BatchElem is one request of a batch call, Result is filled with the
+// response result and Error with the response error of the request.
+type BatchElem struct {
+	Method string
+	Params map[string]interface{}
+
+	Result interface{}
+	Error  error
+}
+
+type request struct {
+	ID      int64                  `json:"id"`
+	Version string                 `json:"jsonrpc"`
+	Method  string                 `json:"method"`
+	Params  map[string]interface{} `json:"params"`
+}
+
+// httpError indicates the node answered with a non 200 status code.
+type httpError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpError) Error() string {
+	return "rpc server response " + e.Status
+}
+
+func NewClient(maxRetries int, minBackoff, maxBackoff time.Duration) *Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          maxIdleConnsPerHost * 4,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &Client{
+		httpClient: &http.Client{Transport: transport},
+		maxRetries: maxRetries,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// CallContext sends one request to the node, the context carries the
+// deadline of the whole call including retries.
+func (c *Client) CallContext(ctx context.Context, method string,
+	params map[string]interface{}, config *config.RpcConfig) ([]byte, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.send(ctx, IsIdempotent(method), data, config)
+}
+
+// BatchCallContext sends all requests in one round trip. The returned error
+// only reports transport failures, per request errors are set on the
+// elements themselves. Nodes not serving batch requests are sent the
+// requests one by one instead.
+func (c *Client) BatchCallContext(ctx context.Context, batch []*BatchElem,
+	config *config.RpcConfig) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if _, ok := c.noBatch.Load(nodeAddress(config)); ok {
+		return c.callEach(ctx, batch, config)
+	}
+
+	retryable := true
+	requests := make([]request, 0, len(batch))
+	for i, elem := range batch {
+		requests = append(requests, request{
+			ID:      int64(i),
+			Version: "2.0",
+			Method:  elem.Method,
+			Params:  elem.Params,
+		})
+		retryable = retryable && IsIdempotent(elem.Method)
+	}
+	data, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.send(ctx, retryable, data, config)
+	if err != nil {
+		return err
+	}
+
+	var responses []Response
+	if err := json.Unmarshal(body, &responses); err != nil {
+		// nodes not serving batch requests answer the array by one error.
+		var resp Response
+		if json.Unmarshal(body, &resp) != nil || resp.Error == nil {
+			return errors.New("invalid batch response: " + err.Error())
+		}
+		log.RPC.Warn("node does not serve batch requests, send them one by one",
+			log.F("address", nodeAddress(config)), log.F("error", resp.Error.Message))
+		c.noBatch.Store(nodeAddress(config), struct{}{})
+		return c.callEach(ctx, batch, config)
+	}
+
+	answered := make([]bool, len(batch))
+	for _, resp := range responses {
+		if resp.ID < 0 || resp.ID >= int64(len(batch)) {
+			continue
+		}
+		elem := batch[resp.ID]
+		answered[resp.ID] = true
+		if resp.Error != nil {
+			elem.Error = errors.New(resp.Error.Message)
+			continue
+		}
+		elem.Result = resp.Result
+	}
+	for i, ok := range answered {
+		if !ok {
+			batch[i].Error = errors.New("missing response of batch request " +
+				batch[i].Method)
+		}
+	}
+
+	return nil
+}
+
+// callEach sends the requests of the batch one by one, and sets the results
+// and errors on the elements the same as BatchCallContext.
+func (c *Client) callEach(ctx context.Context, batch []*BatchElem,
+	config *config.RpcConfig) error {
+	for _, elem := range batch {
+		body, err := c.CallContext(ctx, elem.Method, elem.Params, config)
+		if err != nil {
+			return err
+		}
+		var resp Response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			elem.Error = errors.New("invalid response of request " +
+				elem.Method + ": " + err.Error())
+			continue
+		}
+		if resp.Error != nil {
+			elem.Error = errors.New(resp.Error.Message)
+			continue
+		}
+		elem.Result = resp.Result
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, retryable bool, data []byte,
+	config *config.RpcConfig) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	address := nodeAddress(config)
+	backoff := c.minBackoff
+	for attempt := 0; ; attempt++ {
+		body, err := c.post(ctx, address, config.User, config.Pass, data)
+		if err == nil {
+			return body, nil
+		}
+		if !retryable || attempt >= c.maxRetries || !isTemporary(err) {
+			return nil, err
+		}
+
+		log.RPC.Debug("POST request failed, retry later", log.F("address", address),
+			log.F("backoff", backoff), log.F("attempt", attempt+1), log.Err(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+func (c *Client) post(ctx context.Context, address string, user string,
+	pass string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", address, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	auth := user + ":" + pass
+	basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+	req.Header.Set("Authorization", basicAuth)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.RPC.Debug("POST request failed", log.F("address", address), log.Err(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError ||
+		resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &httpError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	return body, nil
+}
+
+// nodeAddress returns the http address of the node.
+func nodeAddress(config *config.RpcConfig) string {
+	return "http://" + config.IpAddress + ":" + strconv.Itoa(config.HttpJsonPort)
+}
+
+// isTemporary reports if a failed attempt is worth to be sent again.
+func isTemporary(err error) bool {
+	switch e := err.(type) {
+	case *httpError:
+		return true
+	case *url.Error:
+		return e.Err != context.Canceled && e.Err != context.DeadlineExceeded
+	case net.Error:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.Init(".", 5, 0, 0)
+}
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *config.RpcConfig) {
+	server := httptest.NewServer(handler)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	p, _ := strconv.Atoi(port)
+	return server, &config.RpcConfig{IpAddress: host, HttpJsonPort: p}
+}
+
+func TestClient_RetryIdempotent(t *testing.T) {
+	var count int32
+	server, cfg := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":0,"jsonrpc":"2.0","result":10,"error":null}`))
+	})
+	defer server.Close()
+
+	client := NewClient(3, time.Millisecond, 10*time.Millisecond)
+	body, err := client.CallContext(context.Background(), "getblockcount", nil, cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"result":10`)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+
+	// not idempotent methods are sent only once.
+	atomic.StoreInt32(&count, 0)
+	_, err = client.CallContext(context.Background(), "sendrawtransaction", nil, cfg)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestClient_ContextDeadline(t *testing.T) {
+	server, cfg := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+
+	client := NewClient(100, 50*time.Millisecond, time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.CallContext(ctx, "getblockcount", nil, cfg)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestClient_BatchCall(t *testing.T) {
+	server, cfg := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var requests []request
+		assert.NoError(t, json.Unmarshal(body, &requests))
+
+		// answer in reverse order to check responses are matched by id.
+		var responses []map[string]interface{}
+		for i := len(requests) - 1; i >= 0; i-- {
+			resp := map[string]interface{}{"id": requests[i].ID, "jsonrpc": "2.0"}
+			if requests[i].Method == "unknown" {
+				resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+			} else {
+				resp["result"] = requests[i].Params["height"]
+			}
+			responses = append(responses, resp)
+		}
+		data, _ := json.Marshal(responses)
+		w.Write(data)
+	})
+	defer server.Close()
+
+	batch := []*BatchElem{
+		{Method: "getwithdrawtransactionsbyheight", Params: Param("height", 1)},
+		{Method: "unknown", Params: Param("height", 2)},
+		{Method: "getillegalevidencebyheight", Params: Param("height", 3)},
+	}
+	client := NewClient(0, time.Millisecond, time.Millisecond)
+	assert.NoError(t, client.BatchCallContext(context.Background(), batch, cfg))
+	assert.Equal(t, "1", batch[0].Result)
+	assert.NoError(t, batch[0].Error)
+	assert.Error(t, batch[1].Error)
+	assert.Equal(t, "3", batch[2].Result)
+}
+
+func TestClient_BatchCallFallback(t *testing.T) {
+	var batches, calls int32
+	server, cfg := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			// the node does not serve batch requests.
+			atomic.AddInt32(&batches, 1)
+			w.Write([]byte(`{"id":null,"jsonrpc":"2.0","result":null,"error":{"code":-32700,"message":"invalid request"}}`))
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		if req.Method == "unknown" {
+			w.Write([]byte(`{"id":0,"jsonrpc":"2.0","result":null,"error":{"code":-32601,"message":"method not found"}}`))
+			return
+		}
+		data, _ := json.Marshal(map[string]interface{}{"id": 0, "jsonrpc": "2.0", "result": req.Params["height"]})
+		w.Write(data)
+	})
+	defer server.Close()
+
+	newBatch := func() []*BatchElem {
+		return []*BatchElem{
+			{Method: "getwithdrawtransactionsbyheight", Params: Param("height", 1)},
+			{Method: "unknown", Params: Param("height", 2)},
+			{Method: "getillegalevidencebyheight", Params: Param("height", 3)},
+		}
+	}
+	client := NewClient(0, time.Millisecond, time.Millisecond)
+	batch := newBatch()
+	assert.NoError(t, client.BatchCallContext(context.Background(), batch, cfg))
+	assert.Equal(t, "1", batch[0].Result)
+	assert.NoError(t, batch[0].Error)
+	assert.EqualError(t, batch[1].Error, "method not found")
+	assert.Equal(t, "3", batch[2].Result)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&batches))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// the node is not sent batch requests any more.
+	batch = newBatch()
+	assert.NoError(t, client.BatchCallContext(context.Background(), batch, cfg))
+	assert.Equal(t, "3", batch[2].Result)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&batches))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
@@ -2,16 +2,11 @@ package rpc
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"errors"
-	"io"
-	"io/ioutil"
-	"net/http"
+	"fmt"
 	"sort"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
@@ -39,9 +34,9 @@ type ArbitratorGroupInfo struct {
 	Arbitrators           []string
 }
 
-func GetActiveDposPeers(height uint32) (result []peer.PID, err error) {
-	if height+1 < config.Parameters.CRCOnlyDPOSHeight {
-		for _, a := range config.Parameters.OriginCrossChainArbiters {
+func GetActiveDposPeers(height uint32, cfg *config.Configuration) (result []peer.PID, err error) {
+	if height+1 < cfg.CRCOnlyDPOSHeight {
+		for _, a := range cfg.OriginCrossChainArbiters {
 			var id peer.PID
 			pk, err := common.HexStringToBytes(a)
 			if err != nil {
@@ -55,9 +50,9 @@ func GetActiveDposPeers(height uint32) (result []peer.PID, err error) {
 		return result, nil
 	}
 
-	if height+1 >= config.Parameters.CRCOnlyDPOSHeight &&
-		height < config.Parameters.CRClaimDPOSNodeStartHeight {
-		for _, a := range config.Parameters.CRCCrossChainArbiters {
+	if height+1 >= cfg.CRCOnlyDPOSHeight &&
+		height < cfg.CRClaimDPOSNodeStartHeight {
+		for _, a := range cfg.CRCCrossChainArbiters {
 			var id peer.PID
 			pk, err := common.HexStringToBytes(a)
 			if err != nil {
@@ -72,13 +67,13 @@ func GetActiveDposPeers(height uint32) (result []peer.PID, err error) {
 	}
 
 	var rpcMethod string
-	if height < config.Parameters.DPOSNodeCrossChainHeight {
+	if height < cfg.DPOSNodeCrossChainHeight {
 		rpcMethod = "getcrcpeersinfo"
 	} else {
 		rpcMethod = "getcrosschainpeersinfo"
 	}
 	resp, err := CallAndUnmarshal(rpcMethod, nil,
-		config.Parameters.MainNode.Rpc)
+		cfg.MainNode.Rpc)
 	if err != nil {
 		return nil, err
 	}
@@ -106,30 +101,30 @@ func GetActiveDposPeers(height uint32) (result []peer.PID, err error) {
 	return result, nil
 }
 
-func GetArbitratorGroupInfoByHeight(height uint32) (*ArbitratorGroupInfo, error) {
+func GetArbitratorGroupInfoByHeight(height uint32, cfg *config.Configuration) (*ArbitratorGroupInfo, error) {
 	groupInfo := &ArbitratorGroupInfo{
 		Arbitrators: make([]string, 0),
 	}
-	if height+1 < config.Parameters.CRCOnlyDPOSHeight {
-		for _, a := range config.Parameters.OriginCrossChainArbiters {
+	if height+1 < cfg.CRCOnlyDPOSHeight {
+		for _, a := range cfg.OriginCrossChainArbiters {
 			groupInfo.Arbitrators = append(groupInfo.Arbitrators, a)
 		}
 		groupInfo.OnDutyArbitratorIndex = int(height) % len(groupInfo.Arbitrators)
 		return groupInfo, nil
 	}
 
-	if height+1 >= config.Parameters.CRCOnlyDPOSHeight &&
-		height < config.Parameters.CRClaimDPOSNodeStartHeight {
-		for _, a := range config.Parameters.CRCCrossChainArbiters {
+	if height+1 >= cfg.CRCOnlyDPOSHeight &&
+		height < cfg.CRClaimDPOSNodeStartHeight {
+		for _, a := range cfg.CRCCrossChainArbiters {
 			groupInfo.Arbitrators = append(groupInfo.Arbitrators, a)
 		}
 		sort.Strings(groupInfo.Arbitrators)
-		groupInfo.OnDutyArbitratorIndex = int(height-config.Parameters.CRCOnlyDPOSHeight+1) % len(groupInfo.Arbitrators)
+		groupInfo.OnDutyArbitratorIndex = int(height-cfg.CRCOnlyDPOSHeight+1) % len(groupInfo.Arbitrators)
 		return groupInfo, nil
 	}
 
 	resp, err := CallAndUnmarshal("getarbitratorgroupbyheight",
-		Param("height", height), config.Parameters.MainNode.Rpc)
+		Param("height", height), cfg.MainNode.Rpc)
 	if err != nil {
 		return nil, err
 	}
@@ -190,10 +185,11 @@ func GetWithdrawTransactionByHeight(height uint32, config *config.RpcConfig) ([]
 	}
 	txs := make([]*base.WithdrawTxInfo, 0)
 	if err = Unmarshal(&resp, &txs); err != nil {
-		log.Error("[GetWithdrawTransactionByHeight] received invalid response")
+		log.RPC.Error("[GetWithdrawTransactionByHeight] received invalid response", log.Height(height), log.Err(err))
 		return nil, err
 	}
-	log.Debug("[GetWithdrawTransactionByHeight] len transactions:", len(txs), "transactions:", txs)
+	log.RPC.Debug("[GetWithdrawTransactionByHeight] received withdraw transactions", log.Height(height),
+		log.F("count", len(txs)))
 
 	return txs, nil
 }
@@ -205,13 +201,67 @@ func GetIllegalEvidenceByHeight(height uint32, config *config.RpcConfig) ([]*bas
 	}
 	evidences := make([]*base.SidechainIllegalDataInfo, 0)
 	if err = Unmarshal(&resp, &evidences); err != nil {
-		log.Error("[GetIllegalEvidenceByHeight] received invalid response")
+		log.RPC.Error("[GetIllegalEvidenceByHeight] received invalid response", log.Height(height), log.Err(err))
 		return nil, err
 	}
 
 	return evidences, nil
 }
 
+// GetWithdrawTxsAndEvidencesByHeights fetches the withdraw transactions of
+// withdrawHeights and the illegal evidences of evidenceHeights in one batch
+// request, results are returned in the same order as the given heights.
+func GetWithdrawTxsAndEvidencesByHeights(ctx context.Context, withdrawHeights,
+	evidenceHeights []uint32, config *config.RpcConfig) (
+	[][]*base.WithdrawTxInfo, [][]*base.SidechainIllegalDataInfo, error) {
+	batch := make([]*BatchElem, 0, len(withdrawHeights)+len(evidenceHeights))
+	for _, height := range withdrawHeights {
+		batch = append(batch, &BatchElem{
+			Method: "getwithdrawtransactionsbyheight",
+			Params: Param("height", height),
+		})
+	}
+	for _, height := range evidenceHeights {
+		batch = append(batch, &BatchElem{
+			Method: "getillegalevidencebyheight",
+			Params: Param("height", height),
+		})
+	}
+	if err := DefaultClient.BatchCallContext(ctx, batch, config); err != nil {
+		return nil, nil, err
+	}
+
+	withdraws := make([][]*base.WithdrawTxInfo, 0, len(withdrawHeights))
+	for i, elem := range batch[:len(withdrawHeights)] {
+		if elem.Error != nil {
+			return nil, nil, fmt.Errorf("get withdraw transactions at "+
+				"height %d failed: %s", withdrawHeights[i], elem.Error)
+		}
+		txs := make([]*base.WithdrawTxInfo, 0)
+		if err := Unmarshal(&elem.Result, &txs); err != nil {
+			log.RPC.Error("[GetWithdrawTxsAndEvidencesByHeights] received invalid response", log.Err(err))
+			return nil, nil, err
+		}
+		withdraws = append(withdraws, txs)
+	}
+
+	evidences := make([][]*base.SidechainIllegalDataInfo, 0, len(evidenceHeights))
+	for i, elem := range batch[len(withdrawHeights):] {
+		if elem.Error != nil {
+			return nil, nil, fmt.Errorf("get illegal evidences at "+
+				"height %d failed: %s", evidenceHeights[i], elem.Error)
+		}
+		es := make([]*base.SidechainIllegalDataInfo, 0)
+		if err := Unmarshal(&elem.Result, &es); err != nil {
+			log.RPC.Error("[GetWithdrawTxsAndEvidencesByHeights] received invalid response", log.Err(err))
+			return nil, nil, err
+		}
+		evidences = append(evidences, es)
+	}
+
+	return withdraws, evidences, nil
+}
+
 func CheckIllegalEvidence(evidence *base.SidechainIllegalDataInfo, config *config.RpcConfig) (bool, error) {
 	param := map[string]interface{}{"evidence": evidence}
 	resp, err := CallAndUnmarshal("checkillegalevidence", param, config)
@@ -220,7 +270,7 @@ func CheckIllegalEvidence(evidence *base.SidechainIllegalDataInfo, config *confi
 	}
 	result := false
 	if err = Unmarshal(&resp, &result); err != nil {
-		log.Error("[CheckIllegalEvidence] received invalid response")
+		log.RPC.Error("[CheckIllegalEvidence] received invalid response", log.Err(err))
 		return false, err
 	}
 
@@ -247,11 +297,11 @@ func GetTransactionInfoByHash(transactionHash string, config *config.RpcConfig)
 	return tx, nil
 }
 
-func GetExistWithdrawTransactions(txs []string) ([]string, error) {
+func GetExistWithdrawTransactions(txs []string, config *config.RpcConfig) ([]string, error) {
 	parameter := make(map[string]interface{})
 	parameter["txs"] = txs
 	result, err := CallAndUnmarshal("getexistwithdrawtransactions",
-		parameter, config.Parameters.MainNode.Rpc)
+		parameter, config)
 	if err != nil {
 		return nil, err
 	}
@@ -336,48 +386,20 @@ func GetUnspentUtxo(addresses []string, config *config.RpcConfig) ([]base.UTXOIn
 	return utxoInfos, nil
 }
 
-func post(url string, contentType string, user string, pass string, body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, err
-	}
-	auth := user + ":" + pass
-	basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
-	req.Header.Set("Authorization", basicAuth)
-	req.Header.Set("Content-Type", contentType)
-
-	client := *http.DefaultClient
-	client.Timeout = time.Minute
-	return client.Do(req)
-}
-
 func Call(method string, params map[string]interface{}, config *config.RpcConfig) ([]byte, error) {
-	url := "http://" + config.IpAddress + ":" + strconv.Itoa(config.HttpJsonPort)
-	data, err := json.Marshal(map[string]interface{}{
-		"method": method,
-		"params": params,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := post(url, "application/json", config.User, config.Pass, strings.NewReader(string(data)))
-	if err != nil {
-		log.Debug("POST requset err:", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	return CallContext(context.Background(), method, params, config)
+}
 
-	return body, nil
+func CallContext(ctx context.Context, method string, params map[string]interface{}, config *config.RpcConfig) ([]byte, error) {
+	return DefaultClient.CallContext(ctx, method, params, config)
 }
 
 func CallAndUnmarshal(method string, params map[string]interface{}, config *config.RpcConfig) (interface{}, error) {
-	body, err := Call(method, params, config)
+	return CallAndUnmarshalContext(context.Background(), method, params, config)
+}
+
+func CallAndUnmarshalContext(ctx context.Context, method string, params map[string]interface{}, config *config.RpcConfig) (interface{}, error) {
+	body, err := CallContext(ctx, method, params, config)
 	if err != nil {
 		return nil, err
 	}
@@ -395,7 +417,11 @@ func CallAndUnmarshal(method string, params map[string]interface{}, config *conf
 }
 
 func CallAndUnmarshalResponse(method string, params map[string]interface{}, config *config.RpcConfig) (Response, error) {
-	body, err := Call(method, params, config)
+	return CallAndUnmarshalResponseContext(context.Background(), method, params, config)
+}
+
+func CallAndUnmarshalResponseContext(ctx context.Context, method string, params map[string]interface{}, config *config.RpcConfig) (Response, error) {
+	body, err := CallContext(ctx, method, params, config)
 	if err != nil {
 		return Response{}, err
 	}
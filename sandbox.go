@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/simulation/fakenode"
+
+	"github.com/elastos/Elastos.ELA/account"
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// sandboxBlockInterval is the interval the fake main and side nodes of the
+// sandbox produce blocks.
+const sandboxBlockInterval = 10 * time.Second
+
+// sandbox is the fake main and side nodes the arbiter runs against in sandbox
+// mode, they listen on the rpc addresses of the nodes in config.
+type sandbox struct {
+	mainNode  *fakenode.MainNode
+	sideNodes []*fakenode.SideNode
+	quit      chan struct{}
+}
+
+// rpcAddress returns the listen address of the rpc config.
+func rpcAddress(rpcConfig *config.RpcConfig) string {
+	return net.JoinHostPort(rpcConfig.IpAddress, strconv.Itoa(rpcConfig.HttpJsonPort))
+}
+
+// startSandbox starts the fake main node and side nodes of cfg. The arbiter
+// of client is the only arbiter on duty besides CRCCrossChainArbiters, and
+// the nodes produce an empty block every sandboxBlockInterval. The spv
+// service of the main chain has no peers to sync from, deposits are not
+// found in sandbox mode.
+func startSandbox(cfg *config.Configuration, client *account.Client) (*sandbox, error) {
+	s := &sandbox{quit: make(chan struct{})}
+
+	publicKey, err := client.GetMainAccount().PublicKey.EncodePoint(true)
+	if err != nil {
+		return nil, err
+	}
+	arbiters := []string{common.BytesToHexString(publicKey)}
+	for _, arbiter := range cfg.CRCCrossChainArbiters {
+		if arbiter != arbiters[0] {
+			arbiters = append(arbiters, arbiter)
+		}
+	}
+
+	s.mainNode = fakenode.NewMainNode()
+	s.mainNode.SetAuth(cfg.MainNode.Rpc.User, cfg.MainNode.Rpc.Pass)
+	s.mainNode.SetArbitrators(arbiters, 0)
+	s.mainNode.SetCrossChainArbiters(arbiters)
+	s.mainNode.AddBlock()
+	if err := s.mainNode.Listen(rpcAddress(cfg.MainNode.Rpc)); err != nil {
+		return nil, err
+	}
+	log.Info("[Sandbox] fake main node listen on", rpcAddress(cfg.MainNode.Rpc))
+
+	for _, sideNode := range cfg.SideNodeList {
+		node := fakenode.NewSideNode()
+		node.SetAuth(sideNode.Rpc.User, sideNode.Rpc.Pass)
+		if err := node.Listen(rpcAddress(sideNode.Rpc)); err != nil {
+			s.stop()
+			return nil, err
+		}
+		s.sideNodes = append(s.sideNodes, node)
+		log.Info("[Sandbox] fake side node of", sideNode.GenesisBlockAddress,
+			"listen on", rpcAddress(sideNode.Rpc))
+	}
+
+	go s.produceBlocks()
+	return s, nil
+}
+
+func (s *sandbox) produceBlocks() {
+	ticker := time.NewTicker(sandboxBlockInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mainNode.AddBlock()
+			for _, node := range s.sideNodes {
+				node.AddBlock(nil, nil)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// stop stops producing blocks and closes the fake nodes.
+func (s *sandbox) stop() {
+	close(s.quit)
+	s.mainNode.Close()
+	for _, node := range s.sideNodes {
+		node.Close()
+	}
+}
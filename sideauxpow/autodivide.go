@@ -2,11 +2,11 @@ package sideauxpow
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"time"
 
-	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
-	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 
@@ -21,14 +21,14 @@ type SideChainPowAccount struct {
 	availableBalance common.Fixed64
 }
 
-func checkSideChainPowAccounts(addresses []string, minThreshold int) ([]*SideChainPowAccount, error) {
+func (p *SideAuxPow) checkSideChainPowAccounts(addresses []string, minThreshold int) ([]*SideChainPowAccount, error) {
 	var warnAddresses []*SideChainPowAccount
-	currentHeight := arbitrator.ArbitratorGroupSingleton.GetCurrentHeight()
+	currentHeight := p.arbitrator.GetArbitratorGroup().GetCurrentHeight()
 	for _, addr := range addresses {
 		available := common.Fixed64(0)
 		locked := common.Fixed64(0)
 		programHash, _ := common.Uint168FromAddress(addr)
-		UTXOs, err := GetAddressUTXOs(programHash)
+		UTXOs, err := GetAddressUTXOs(programHash, p.arbitrator.GetConfig().MainNode.Rpc)
 		if err != nil {
 			return nil, errors.New("get " + addr + " UTXOs failed")
 		}
@@ -49,26 +49,23 @@ func checkSideChainPowAccounts(addresses []string, minThreshold int) ([]*SideCha
 	}
 
 	if len(warnAddresses) > 0 {
-		var warningStr string
 		for _, sideChainPowAccount := range warnAddresses {
-			warningStr += sideChainPowAccount.Address
-			warningStr += ": "
-			warningStr += sideChainPowAccount.availableBalance.String()
-			warningStr += " "
+			log.Auxpow.Info("Warning side chain mining account",
+				log.F("address", sideChainPowAccount.Address),
+				log.F("balance", sideChainPowAccount.availableBalance.String()))
 		}
 
-		log.Info("Warning side chain mining account: ", warningStr)
-
 		return warnAddresses, nil
 	}
 
 	return nil, nil
 }
 
-func divideTransfer(name string, outputs []*Transfer) error {
+func (p *SideAuxPow) divideTransfer(name string, outputs []*Transfer) error {
 	// create transaction
+	cfg := p.arbitrator.GetConfig()
 	fee := common.Fixed64(100000)
-	mainAccount:= client.GetMainAccount()
+	mainAccount := p.client.GetMainAccount()
 
 	from := mainAccount.Address
 	script := mainAccount.RedeemScript
@@ -76,58 +73,67 @@ func divideTransfer(name string, outputs []*Transfer) error {
 	txType := types.TransferAsset
 	txPayload := &payload.TransferAsset{}
 	txn, err := createTransaction(txType, txPayload, from, &fee, script,
-		uint32(0), arbitrator.ArbitratorGroupSingleton.GetCurrentHeight(), outputs...)
+		uint32(0), p.arbitrator.GetArbitratorGroup().GetCurrentHeight(), cfg.MainNode.Rpc, outputs...)
 	if err != nil {
 		return errors.New("create divide transaction failed: " + err.Error())
 	}
 
-	txnSigned, err := client.Sign(txn)
+	txnSigned, err := p.client.Sign(txn)
+	if err != nil {
+		return err
+	}
+	err = p.arbitrator.GetAuditLog().RecordTx(audit.TypeDivideTx, txnSigned, nil,
+		audit.PublicKey(mainAccount.PublicKey), audit.DecisionUnchecked)
 	if err != nil {
 		return err
 	}
 	program := txnSigned.Programs[0]
 	haveSign, needSign, _ := crypto.GetSignStatus(program.Code, program.Parameter)
-	log.Debug("Divide transaction successfully signed: ", haveSign, needSign)
+	log.Auxpow.Debug("Divide transaction successfully signed", log.TxHash(txnSigned.Hash().String()),
+		log.F("signs", haveSign), log.F("required", needSign))
 
 	buf := new(bytes.Buffer)
 	txn.Serialize(buf)
 	content := common.BytesToHexString(buf.Bytes())
 
 	// send transaction
-	result, err := rpc.CallAndUnmarshal("sendrawtransaction", rpc.Param("data", content), config.Parameters.MainNode.Rpc)
+	result, err := rpc.CallAndUnmarshal("sendrawtransaction", rpc.Param("data", content), cfg.MainNode.Rpc)
 	if err != nil {
 		return err
 	}
-	log.Debug("Send divide transaction: ", result)
+	log.Auxpow.Debug("Send divide transaction", log.TxHash(txnSigned.Hash().String()), log.F("result", result))
 
 	return nil
 }
 
-func SidechainAccountDivide() {
+func (p *SideAuxPow) SidechainAccountDivide(ctx context.Context) {
+	cfg := p.arbitrator.GetConfig()
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-time.After(time.Second * 60):
 			miningAddresses := make([]string, 0)
-			for _, sideNode := range config.Parameters.SideNodeList {
-				if !sideNode.PowChain {
+			for _, sideNode := range cfg.SideNodeList {
+				if !sideNode.IsPowChain() {
 					continue
 				}
 				miningAddresses = append(miningAddresses, sideNode.MiningAddr)
 			}
-			warningAccounts, err := checkSideChainPowAccounts(miningAddresses, config.Parameters.MinThreshold)
+			warningAccounts, err := p.checkSideChainPowAccounts(miningAddresses, cfg.MinThreshold)
 			if err != nil {
-				log.Error("Check side chain pow err", err)
+				log.Auxpow.Error("Check side chain pow failed", log.Err(err))
 			}
 			if len(warningAccounts) > 0 {
 				var outputs []*Transfer
-				amount := common.Fixed64(config.Parameters.DepositAmount)
+				amount := common.Fixed64(cfg.DepositAmount)
 				for _, warningAccount := range warningAccounts {
 					outputs = append(outputs, &Transfer{
 						Address: warningAccount.Address,
 						Amount:  &amount,
 					})
 				}
-				divideTransfer(config.Parameters.WalletPath, outputs)
+				p.divideTransfer(cfg.WalletPath, outputs)
 			}
 		}
 	}
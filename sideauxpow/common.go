@@ -23,13 +23,13 @@ type UTXO struct {
 	LockTime uint32
 }
 
-func GetAddressUTXOs(programHash *common.Uint168) ([]*UTXO, error) {
+func GetAddressUTXOs(programHash *common.Uint168, mainNodeRpc *config.RpcConfig) ([]*UTXO, error) {
 	address, err := programHash.ToAddress()
 	if err != nil {
 		return nil, err
 	}
 
-	utxoInfos, err := rpc.GetUnspentUtxo([]string{address}, config.Parameters.MainNode.Rpc)
+	utxoInfos, err := rpc.GetUnspentUtxo([]string{address}, mainNodeRpc)
 	if err != nil {
 		return nil, err
 	}
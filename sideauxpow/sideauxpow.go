@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"sync"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
@@ -18,46 +20,61 @@ import (
 	"github.com/elastos/Elastos.ELA/crypto"
 )
 
-var (
+// SideAuxPow sends the side chain pow transactions of an arbitrator, and
+// keeps the main chain heights side mining was last sent, notified and
+// submitted at.
+type SideAuxPow struct {
+	arbitrator arbitrator.Arbitrator
+	client     *account.Client
+
 	lock                          sync.RWMutex
-	client                        *account.Client
 	lastSendSideMiningHeightMap   map[common.Uint256]uint32
 	lastNotifySideMiningHeightMap map[common.Uint256]uint32
 	lastSubmitAuxpowHeightMap     map[common.Uint256]uint32
-)
+}
 
-func GetLastSendSideMiningHeight(genesisBlockHash *common.Uint256) (uint32, bool) {
-	lock.RLock()
-	defer lock.RUnlock()
-	height, ok := lastSendSideMiningHeightMap[*genesisBlockHash]
+func New(ar arbitrator.Arbitrator, client *account.Client) *SideAuxPow {
+	return &SideAuxPow{
+		arbitrator:                    ar,
+		client:                        client,
+		lastSendSideMiningHeightMap:   make(map[common.Uint256]uint32),
+		lastNotifySideMiningHeightMap: make(map[common.Uint256]uint32),
+		lastSubmitAuxpowHeightMap:     make(map[common.Uint256]uint32),
+	}
+}
+
+func (p *SideAuxPow) GetLastSendSideMiningHeight(genesisBlockHash *common.Uint256) (uint32, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	height, ok := p.lastSendSideMiningHeightMap[*genesisBlockHash]
 	return height, ok
 }
 
-func GetLastNotifySideMiningHeight(genesisBlockHash *common.Uint256) (uint32, bool) {
-	lock.RLock()
-	defer lock.RUnlock()
-	height, ok := lastNotifySideMiningHeightMap[*genesisBlockHash]
+func (p *SideAuxPow) GetLastNotifySideMiningHeight(genesisBlockHash *common.Uint256) (uint32, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	height, ok := p.lastNotifySideMiningHeightMap[*genesisBlockHash]
 	return height, ok
 }
 
-func GetLastSubmitAuxpowHeight(genesisBlockHash *common.Uint256) (uint32, bool) {
-	lock.RLock()
-	defer lock.RUnlock()
-	height, ok := lastSubmitAuxpowHeightMap[*genesisBlockHash]
+func (p *SideAuxPow) GetLastSubmitAuxpowHeight(genesisBlockHash *common.Uint256) (uint32, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	height, ok := p.lastSubmitAuxpowHeightMap[*genesisBlockHash]
 	return height, ok
 
 }
 
-func UpdateLastNotifySideMiningHeight(genesisBlockHash common.Uint256) {
-	lock.Lock()
-	defer lock.Unlock()
-	lastNotifySideMiningHeightMap[genesisBlockHash] = arbitrator.ArbitratorGroupSingleton.GetCurrentHeight()
+func (p *SideAuxPow) UpdateLastNotifySideMiningHeight(genesisBlockHash common.Uint256) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lastNotifySideMiningHeightMap[genesisBlockHash] = p.arbitrator.GetArbitratorGroup().GetCurrentHeight()
 }
 
-func UpdateLastSubmitAuxpowHeight(genesisBlockHash common.Uint256) {
-	lock.Lock()
-	defer lock.Unlock()
-	lastSubmitAuxpowHeightMap[genesisBlockHash] = arbitrator.ArbitratorGroupSingleton.GetCurrentHeight()
+func (p *SideAuxPow) UpdateLastSubmitAuxpowHeight(genesisBlockHash common.Uint256) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lastSubmitAuxpowHeightMap[genesisBlockHash] = p.arbitrator.GetArbitratorGroup().GetCurrentHeight()
 }
 
 func unmarshal(result interface{}, target interface{}) error {
@@ -72,19 +89,20 @@ func unmarshal(result interface{}, target interface{}) error {
 	return nil
 }
 
-func sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
-	log.Info("[sideChainPowTransfer] start")
+func (p *SideAuxPow) sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
+	logger := log.Auxpow.With(log.Chain(sideNode.GenesisBlockAddress))
+	logger.Info("[sideChainPowTransfer] start")
 
 	if sideNode.PayToAddr == "" {
 		return errors.New("[sideChainPowTransfer] has no side aux pow paytoaddr")
 	}
 	resp, err := rpc.CallAndUnmarshal("createauxblock", rpc.Param("paytoaddress", sideNode.PayToAddr), sideNode.Rpc)
 	if err != nil {
-		log.Errorf("[sideChainPowTransfer] create aux block failed: %s", err)
+		logger.Error("[sideChainPowTransfer] create aux block failed", log.Err(err))
 		return err
 	}
 	if resp == nil {
-		log.Info("[sideChainPowTransfer] create auxblock, nil ")
+		logger.Info("[sideChainPowTransfer] create auxblock, nil")
 		return nil
 	}
 
@@ -111,7 +129,8 @@ func sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
 	sideGenesisHash, _ := common.Uint256FromBytes(sideGenesisHashData)
 	sideBlockHash, _ := common.Uint256FromBytes(sideBlockHashData)
 
-	log.Info("sideGenesisHash:", sideGenesisHash, "sideBlockHash:", sideBlockHash)
+	logger = logger.With(log.Height(sideAuxBlock.Height), log.F("blockhash", sideBlockHash.String()))
+	logger.Info("[sideChainPowTransfer] create aux block", log.F("genesis", sideGenesisHash.String()))
 	// Create payload
 	txPayload := &payload.SideChainPow{
 		BlockHeight:     sideAuxBlock.Height,
@@ -121,16 +140,27 @@ func sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
 
 	buf := new(bytes.Buffer)
 	txPayload.Serialize(buf, payload.SideChainPowVersion)
-	txPayload.Signature, err = arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().Sign(buf.Bytes()[0:68])
+	currentArbitrator := p.arbitrator
+	cfg := currentArbitrator.GetConfig()
+	txPayload.Signature, err = currentArbitrator.Sign(buf.Bytes()[0:68])
+	if err != nil {
+		return err
+	}
+	proposer := audit.PublicKey(currentArbitrator.GetPublicKey())
+	err = currentArbitrator.GetAuditLog().RecordSignature(audit.TypeSideChainPow, buf.Bytes()[0:68], map[string]string{
+		"chain":     sideNode.GenesisBlockAddress,
+		"blockhash": sideBlockHash.String(),
+		"height":    strconv.FormatUint(uint64(sideAuxBlock.Height), 10),
+	}, proposer, audit.DecisionUnchecked)
 	if err != nil {
 		return err
 	}
 
 	// create transaction
-	if config.Parameters.SideAuxPowFee <= 0 {
+	if cfg.SideAuxPowFee <= 0 {
 		return errors.New("[sideChainPowTransfer] invalid side aux pow fee")
 	}
-	fee := common.Fixed64(config.Parameters.SideAuxPowFee)
+	fee := common.Fixed64(cfg.SideAuxPowFee)
 
 	if sideNode.MiningAddr == "" {
 		return errors.New("[sideChainPowTransfer] get side chain mining address failed:" + sideNode.MiningAddr)
@@ -141,7 +171,7 @@ func sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
 		return errors.New("[sideChainPowTransfer] invalid miningAddr")
 	}
 	codeHash := programHash.ToCodeHash()
-	miningAccount := client.GetAccountByCodeHash(codeHash)
+	miningAccount := p.client.GetAccountByCodeHash(codeHash)
 	if miningAccount == nil {
 		return errors.New("[sideChainPowTransfer] not found miningAddr in keystore")
 	}
@@ -150,18 +180,24 @@ func sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
 	script := miningAccount.RedeemScript
 
 	txn, err := createAuxpowTransaction(txType, txPayload, from, &fee, script,
-		arbitrator.ArbitratorGroupSingleton.GetCurrentHeight())
+		currentArbitrator.GetArbitratorGroup().GetCurrentHeight(), cfg.MainNode.Rpc)
 	if err != nil {
 		return errors.New("[sideChainPowTransfer] create transaction failed: " + err.Error())
 	}
 
-	txnSigned, err := client.Sign(txn)
+	txnSigned, err := p.client.Sign(txn)
+	if err != nil {
+		return err
+	}
+	err = currentArbitrator.GetAuditLog().RecordTx(audit.TypeSideChainPowTx, txnSigned,
+		map[string]string{"chain": sideNode.GenesisBlockAddress}, proposer, audit.DecisionUnchecked)
 	if err != nil {
 		return err
 	}
 	program := txnSigned.Programs[0]
 	haveSign, needSign, _ := crypto.GetSignStatus(program.Code, program.Parameter)
-	log.Debug("[sideChainPowTransfer] transaction successfully signed: ", haveSign, needSign)
+	logger.Debug("[sideChainPowTransfer] transaction successfully signed",
+		log.TxHash(txn.Hash().String()), log.F("signs", haveSign), log.F("required", needSign))
 
 	sideChainPowBuf := new(bytes.Buffer)
 	txn.Serialize(sideChainPowBuf)
@@ -169,31 +205,26 @@ func sideChainPowTransfer(sideNode *config.SideNodeConfig) error {
 	// log.Debug("Raw Sidemining transaction: ", content)
 
 	// send transaction
-	result, err := rpc.CallAndUnmarshal("sendrawtransaction", rpc.Param("data", content), config.Parameters.MainNode.Rpc)
+	result, err := rpc.CallAndUnmarshal("sendrawtransaction", rpc.Param("data", content), cfg.MainNode.Rpc)
 	if err != nil {
 		return errors.New("[SendSideChainMining] sendrawtransaction failed: " + err.Error())
 	}
-	log.Info("[SendSideChainMining] End send Sidemining transaction:  genesis address [", sideNode.GenesisBlockAddress, "], result: ", result)
+	logger.Info("[SendSideChainMining] End send Sidemining transaction",
+		log.TxHash(txn.Hash().String()), log.F("result", result))
 
-	lock.Lock()
-	defer lock.Unlock()
-	lastSendSideMiningHeightMap[*sideGenesisHash] =
-		arbitrator.ArbitratorGroupSingleton.GetCurrentHeight()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lastSendSideMiningHeightMap[*sideGenesisHash] =
+		currentArbitrator.GetArbitratorGroup().GetCurrentHeight()
 
-	log.Info("[sideChainPowTransfer] end")
+	logger.Info("[sideChainPowTransfer] end")
 	return nil
 }
 
-func StartSideChainMining(sideNode *config.SideNodeConfig) {
-	err := sideChainPowTransfer(sideNode)
+func (p *SideAuxPow) StartSideChainMining(sideNode *config.SideNodeConfig) {
+	err := p.sideChainPowTransfer(sideNode)
 	if err != nil {
-		log.Warn(err)
+		log.Auxpow.Warn("[StartSideChainMining] side chain pow transfer failed",
+			log.Chain(sideNode.GenesisBlockAddress), log.Err(err))
 	}
 }
-
-func Init(c *account.Client) {
-	client = c
-	lastSendSideMiningHeightMap = make(map[common.Uint256]uint32)
-	lastNotifySideMiningHeightMap = make(map[common.Uint256]uint32)
-	lastSubmitAuxpowHeightMap = make(map[common.Uint256]uint32)
-}
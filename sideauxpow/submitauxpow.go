@@ -8,11 +8,9 @@ import (
 	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
 )
 
-func SubmitAuxpow(genesishash string, blockhash string, submitauxpow string) error {
-	log.Info("submitsideauxblock")
-
+func (p *SideAuxPow) SubmitAuxpow(genesishash string, blockhash string, submitauxpow string) error {
 	var sideNode *config.SideNodeConfig
-	for _, node := range config.Parameters.SideNodeList {
+	for _, node := range p.arbitrator.GetConfig().SideNodeList {
 		if node.GenesisBlock == genesishash {
 			sideNode = node
 		}
@@ -25,15 +23,17 @@ func SubmitAuxpow(genesishash string, blockhash string, submitauxpow string) err
 	params["blockhash"] = blockhash
 	params["sideauxpow"] = submitauxpow
 
-	log.Info("[SubmitAuxpow] Submit auxblock sideNode.Rpc：", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort)
+	logger := log.Auxpow.With(log.Chain(sideNode.GenesisBlockAddress), log.F("blockhash", blockhash))
+	logger.Info("[SubmitAuxpow] Submit auxblock", log.F("ip", sideNode.Rpc.IpAddress),
+		log.F("port", sideNode.Rpc.HttpJsonPort))
 	resp, err := rpc.CallAndUnmarshal("submitsideauxblock", params, sideNode.Rpc)
 	if err != nil {
 		return err
 	}
 	if resp != nil {
-		log.Info("[SubmitAuxpow] Submit auxblock resp: ", resp)
+		logger.Info("[SubmitAuxpow] Submit auxblock succeed", log.F("result", resp))
 	} else {
-		log.Warn("submitauxblock but resp is nil, sideNode.Rpc:", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort)
+		logger.Warn("[SubmitAuxpow] Submit auxblock but resp is nil")
 	}
 	return nil
 }
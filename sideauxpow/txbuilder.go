@@ -8,13 +8,14 @@ import (
 	"strconv"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
 
 	"github.com/elastos/Elastos.ELA/common"
 	"github.com/elastos/Elastos.ELA/core/contract/program"
 	"github.com/elastos/Elastos.ELA/core/types"
 )
 
-func createTransaction(txType types.TxType, txPayload types.Payload, fromAddress string, fee *common.Fixed64, redeemScript []byte, lockedUntil uint32, currentHeight uint32, outputs ...*Transfer) (*types.Transaction, error) {
+func createTransaction(txType types.TxType, txPayload types.Payload, fromAddress string, fee *common.Fixed64, redeemScript []byte, lockedUntil uint32, currentHeight uint32, mainNodeRpc *config.RpcConfig, outputs ...*Transfer) (*types.Transaction, error) {
 	// Check if output is valid
 	if len(outputs) == 0 {
 		return nil, errors.New("[Wallet], Invalid transaction target")
@@ -44,7 +45,7 @@ func createTransaction(txType types.TxType, txPayload types.Payload, fromAddress
 		txOutputs = append(txOutputs, txOutput)
 	}
 	// Get spender's UTXOs
-	UTXOs, err := GetAddressUTXOs(spender)
+	UTXOs, err := GetAddressUTXOs(spender, mainNodeRpc)
 	if err != nil {
 		return nil, errors.New("[Wallet], Get spender's UTXOs failed")
 	}
@@ -119,7 +120,7 @@ func removeLockedUTXOs(utxos []*UTXO, currentHeight uint32) []*UTXO {
 	return availableUTXOs
 }
 
-func createAuxpowTransaction(txType types.TxType, txPayload types.Payload, fromAddress string, fee *common.Fixed64, redeemScript []byte, currentHeight uint32) (*types.Transaction, error) {
+func createAuxpowTransaction(txType types.TxType, txPayload types.Payload, fromAddress string, fee *common.Fixed64, redeemScript []byte, currentHeight uint32, mainNodeRpc *config.RpcConfig) (*types.Transaction, error) {
 	// Check if from address is valid
 	spender, err := common.Uint168FromAddress(fromAddress)
 	if err != nil {
@@ -131,7 +132,7 @@ func createAuxpowTransaction(txType types.TxType, txPayload types.Payload, fromA
 	totalOutputAmount += *fee                 // Add transaction fee
 
 	// Get spender's UTXOs
-	UTXOs, err := GetAddressUTXOs(spender)
+	UTXOs, err := GetAddressUTXOs(spender, mainNodeRpc)
 	if err != nil {
 		return nil, errors.New("[Wallet], Get spender's UTXOs failed")
 	}
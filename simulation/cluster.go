@@ -0,0 +1,426 @@
+package simulation
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/audit"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/node"
+	"github.com/elastos/Elastos.ELA.Arbiter/simulation/fakenode"
+
+	"github.com/elastos/Elastos.ELA.SPV/interface"
+	"github.com/elastos/Elastos.ELA/account"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/dpos/p2p"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+)
+
+const (
+	// maxRunRounds is the max rounds Run delivers and processes messages, to
+	// stop scenarios sending messages endlessly.
+	maxRunRounds = 1000
+
+	// runTimeout is how long RunUntil waits for the arbiters, which propose
+	// withdraw transactions and send deposit transactions in goroutines of
+	// their own.
+	runTimeout = 10 * time.Second
+
+	// runInterval is the interval RunUntil runs the cluster at.
+	runInterval = 10 * time.Millisecond
+
+	// sideGenesisBlock is the genesis block hash of the side chain of the
+	// cluster, in the format of config.json.
+	sideGenesisBlock = "56be936978c261b2e649d58dbfaf3f23d4a868274f5522cd2adb4308a955c4a3"
+
+	// keystorePassword is the password of the keystores of the arbiters.
+	keystorePassword = "simulation"
+)
+
+// Cluster is a group of arbiters of a main chain and a side chain. The
+// arbiters are nodes the same as the ones run by main, backed by fakenode
+// main and side nodes and connected by an in-memory network. Messages are
+// delivered and processed only by Run, and blocks are synced only by Sync,
+// so the scenarios run step by step.
+type Cluster struct {
+	Network  *Network
+	MainNode *fakenode.MainNode
+	SideNode *fakenode.SideNode
+	Nodes    []*Node
+	// GenesisAddress is the genesis block address of the side chain, the
+	// address of the withdraw bank and of deposits to the side chain.
+	GenesisAddress string
+
+	onDutyIndex int
+
+	mux sync.Mutex
+	// depositTxs are the deposit transactions by the heights of the main
+	// chain blocks they are confirmed in.
+	depositTxs map[uint32][]*types.Transaction
+}
+
+// NewCluster creates a cluster of count arbiters with keys derived from their
+// indexes, the data of the arbiters is kept in dir. All of them are online
+// and synced to the first block, the first arbiter is on duty.
+func NewCluster(dir string, count int) (*Cluster, error) {
+	if count <= 0 {
+		return nil, errors.New("invalid count of arbiters")
+	}
+	c := &Cluster{
+		Network:    NewNetwork(),
+		MainNode:   fakenode.NewMainNode(),
+		SideNode:   fakenode.NewSideNode(),
+		depositTxs: make(map[uint32][]*types.Transaction),
+	}
+	c.MainNode.Start()
+	c.SideNode.Start()
+
+	var clients []*account.Client
+	var publicKeys []string
+	for i := 0; i < count; i++ {
+		client, err := newClient(filepath.Join(nodeDir(dir, i), "keystore.dat"), i)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		pk, err := client.GetMainAccount().PublicKey.EncodePoint(true)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		clients = append(clients, client)
+		publicKeys = append(publicKeys, common.BytesToHexString(pk))
+	}
+	c.MainNode.SetArbitrators(publicKeys, c.onDutyIndex)
+	c.MainNode.SetCrossChainArbiters(publicKeys)
+	c.MainNode.AddBlock()
+
+	cfg, err := c.config()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	for i, client := range clients {
+		n, err := c.newNode(cfg, nodeDir(dir, i), i, client)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.Nodes = append(c.Nodes, n)
+	}
+	c.GenesisAddress = c.Nodes[0].Config.SideNodeList[0].GenesisBlockAddress
+
+	if err := c.Sync(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func nodeDir(dir string, index int) string {
+	return filepath.Join(dir, "node"+strconv.Itoa(index))
+}
+
+// newClient creates the keystore of the arbiter of the index at path, with
+// the private key derived from the index.
+func newClient(path string, index int) (*account.Client, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	seed := sha256.Sum256([]byte("simulation arbiter " + strconv.Itoa(index)))
+	acc, err := account.NewAccountWithPrivateKey(seed[:])
+	if err != nil {
+		return nil, err
+	}
+	return account.CreateFromAccount(path, []byte(keystorePassword), acc)
+}
+
+// config returns the config the arbiters are prepared by.
+func (c *Cluster) config() (*config.Configuration, error) {
+	cfg, err := config.Default("regnet")
+	if err != nil {
+		return nil, err
+	}
+	exchangeRate, err := base.NewExchangeRate("1")
+	if err != nil {
+		return nil, err
+	}
+	powChain := false
+
+	cfg.MainNode.Rpc = c.MainNode.RpcConfig()
+	cfg.SideNodeList = []*config.SideNodeConfig{{
+		Rpc:          c.SideNode.RpcConfig(),
+		ExchangeRate: exchangeRate,
+		GenesisBlock: sideGenesisBlock,
+		PowChain:     &powChain,
+	}}
+	// the arbiters of the main node connect each other and sign by 2/3+1 of
+	// them from the first block on.
+	cfg.CRCOnlyDPOSHeight = 1
+	cfg.CRClaimDPOSNodeStartHeight = 1
+	cfg.DPOSNodeCrossChainHeight = 1
+	cfg.PeerBanThreshold = 100
+	cfg.PeerBanDuration = 3600000
+	return cfg, nil
+}
+
+// newNode creates the arbiter of the index on the in-memory network and a
+// scripted spv service, and opens it without starting its loops. A new spv
+// service is created every time the spv module is started.
+func (c *Cluster) newNode(cfg *config.Configuration, dataDir string, index int,
+	client *account.Client) (*Node, error) {
+	cfg, err := config.Prepare(cfg)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		Node:   node.New(cfg, dataDir, client),
+		Index:  index,
+		online: true,
+		missed: make(map[common.Uint256]struct{}),
+	}
+	pk, err := client.GetMainAccount().PublicKey.EncodePoint(true)
+	if err != nil {
+		return nil, err
+	}
+	copy(n.PID[:], pk)
+	n.PublicKey = common.BytesToHexString(pk)
+
+	var server p2p.Server
+	n.Network, err = cs.NewArbitratorsNetworkWithServer(n.PID, n.Arbitrator, dataDir,
+		func(cfg *p2p.Config) (p2p.Server, error) {
+			server, err = c.Network.NewServer(cfg)
+			return server, err
+		})
+	if err != nil {
+		return nil, err
+	}
+	if err := n.Open(); err != nil {
+		n.Stop()
+		return nil, err
+	}
+	server.Start()
+
+	err = n.Arbitrator.(*arbitrator.ArbitratorImpl).StartSpvModuleWithService(
+		func(cfg *_interface.Config) (_interface.SPVService, error) {
+			spv, err := newSpvService(c, n, cfg.DataDir)
+			if err != nil {
+				return nil, err
+			}
+			n.spvMux.Lock()
+			n.spv = spv
+			n.spvMux.Unlock()
+			return spv, nil
+		})
+	if err != nil {
+		n.Stop()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Close stops the arbiters and the main and side nodes.
+func (c *Cluster) Close() {
+	for _, n := range c.Nodes {
+		n.Stop()
+	}
+	c.MainNode.Close()
+	c.SideNode.Close()
+}
+
+// Threshold returns the count of signatures a withdraw transaction needs.
+func (c *Cluster) Threshold() int {
+	return len(c.Nodes)*2/3 + 1
+}
+
+// OnDuty returns the on duty arbiter of the main node.
+func (c *Cluster) OnDuty() *Node {
+	return c.Nodes[c.onDutyIndex]
+}
+
+// Rotate moves on duty to the next arbiter by a new main chain block, and
+// syncs the online arbiters to it.
+func (c *Cluster) Rotate() error {
+	c.onDutyIndex = (c.onDutyIndex + 1) % len(c.Nodes)
+	var publicKeys []string
+	for _, n := range c.Nodes {
+		publicKeys = append(publicKeys, n.PublicKey)
+	}
+	c.MainNode.SetArbitrators(publicKeys, c.onDutyIndex)
+	c.MainNode.AddBlock()
+	return c.Sync()
+}
+
+// SetOnline takes the arbiter online or offline. Offline arbiters neither
+// send nor receive messages, and are not synced, they are notified of the
+// deposits in the blocks missed by the sync after they are back.
+func (c *Cluster) SetOnline(n *Node, online bool) {
+	n.online = online
+	c.Network.SetOnline(n.PID, online)
+}
+
+// Sync makes the online arbiters sync the blocks of the side node and then
+// the ones of the main node, as their monitors and spv modules do every
+// interval. Arbiters becoming on duty start to process the cached cross chain
+// transactions.
+func (c *Cluster) Sync() error {
+	for _, n := range c.Nodes {
+		if !n.online {
+			continue
+		}
+		for _, sideNode := range n.Config.SideNodeList {
+			n.SideChainMonitor.SyncFromSideNode(sideNode)
+		}
+		if err := n.ArbitratorGroup.SyncFromMainNode(); err != nil {
+			return err
+		}
+		n.syncSpv()
+	}
+	return nil
+}
+
+// Watchdog makes the online arbiters take over the cross chain transactions
+// pending too long, as their takeover watchdogs do on every main chain block.
+func (c *Cluster) Watchdog() {
+	for _, n := range c.Nodes {
+		if n.online {
+			n.Arbitrator.(*arbitrator.ArbitratorImpl).TakeoverPendingTxs()
+		}
+	}
+}
+
+// Deposit adds a main chain block confirming the deposit transaction and
+// makes the online arbiters sync it, as their spv modules do. The spv modules
+// of the arbiters of missedBy miss the transaction once, the same as one not
+// matched by the bloom filter. It returns the height of the block.
+func (c *Cluster) Deposit(tx *types.Transaction, missedBy ...*Node) uint32 {
+	height := c.MainNode.AddBlock()
+	c.mux.Lock()
+	c.depositTxs[height] = append(c.depositTxs[height], tx)
+	for _, n := range missedBy {
+		n.missed[tx.Hash()] = struct{}{}
+	}
+	c.mux.Unlock()
+
+	for _, n := range c.Nodes {
+		if n.online {
+			n.syncSpv()
+		}
+	}
+	return height
+}
+
+// deposits returns the deposit transactions confirmed in the main chain block
+// of the height.
+func (c *Cluster) deposits(height uint32) []*types.Transaction {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]*types.Transaction(nil), c.depositTxs[height]...)
+}
+
+// missed returns if the spv module of the arbiter misses the transaction, it
+// is missed only once.
+func (c *Cluster) missed(n *Node, tx *types.Transaction) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := n.missed[tx.Hash()]; !ok {
+		return false
+	}
+	delete(n.missed, tx.Hash())
+	return true
+}
+
+// Run delivers and processes messages until none is left, and returns the
+// count of rounds.
+func (c *Cluster) Run() (int, error) {
+	for round := 0; round < maxRunRounds; round++ {
+		count := c.Network.Deliver()
+		for _, n := range c.Nodes {
+			count += n.Network.ProcessQueued()
+		}
+		if count == 0 {
+			return round, nil
+		}
+	}
+	return maxRunRounds, errors.New("messages are not settled in " +
+		strconv.Itoa(maxRunRounds) + " rounds")
+}
+
+// RunUntil runs the cluster until done returns true. Arbiters propose
+// withdraw transactions and send deposit transactions in goroutines of their
+// own, so the cluster is run again every runInterval, up to runTimeout.
+func (c *Cluster) RunUntil(done func() bool) error {
+	deadline := time.Now().Add(runTimeout)
+	for {
+		if _, err := c.Run(); err != nil {
+			return err
+		}
+		if done() {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("cluster is not done in " + runTimeout.String())
+		}
+		time.Sleep(runInterval)
+	}
+}
+
+// Node is an arbiter of the cluster.
+type Node struct {
+	*node.Node
+	Index     int
+	PID       peer.PID
+	PublicKey string
+
+	online bool
+	// missed are the deposit transactions the spv module misses.
+	missed map[common.Uint256]struct{}
+
+	spvMux sync.Mutex
+	spv    *spvService
+}
+
+// syncSpv makes the spv module sync the main node.
+func (n *Node) syncSpv() {
+	n.spvMux.Lock()
+	spv := n.spv
+	n.spvMux.Unlock()
+	spv.sync()
+}
+
+// Proposals returns the hashes of the withdraw proposals the arbiter
+// proposed, the earliest first.
+func (n *Node) Proposals() ([]string, error) {
+	return n.withdrawProposals(audit.DecisionProposer)
+}
+
+// Approved returns the hashes of the withdraw proposals the arbiter approved
+// and signed, the earliest first.
+func (n *Node) Approved() ([]string, error) {
+	return n.withdrawProposals(audit.DecisionApproved)
+}
+
+// withdrawProposals returns the hashes of the withdraw proposals audited by
+// the decision.
+func (n *Node) withdrawProposals(decision string) ([]string, error) {
+	entries, err := n.AuditLog.Query(audit.Query{Type: audit.TypeWithdrawProposal})
+	if err != nil {
+		return nil, err
+	}
+	var proposals []string
+	for _, e := range entries {
+		if e.Decision == decision {
+			proposals = append(proposals, e.Summary["proposal"])
+		}
+	}
+	return proposals, nil
+}
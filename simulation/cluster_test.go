@@ -0,0 +1,428 @@
+package simulation
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// withdrawConfirmations is the count of blocks the monitors wait for a withdraw
+// transaction to be confirmed by.
+const withdrawConfirmations = 6
+
+func TestMain(m *testing.M) {
+	logDir, err := ioutil.TempDir("", "simulation")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(logDir, 5, 0, 0)
+
+	code := m.Run()
+	os.RemoveAll(logDir)
+	os.Exit(code)
+}
+
+// newTestCluster creates a cluster of count arbiters in a temporary
+// directory, the returned function closes the cluster and removes the
+// directory.
+func newTestCluster(t *testing.T, count int) (*Cluster, func()) {
+	dir, err := ioutil.TempDir("", "cluster")
+	assert.NoError(t, err)
+	c, err := NewCluster(dir, count)
+	if !assert.NoError(t, err) {
+		os.RemoveAll(dir)
+		t.FailNow()
+	}
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func run(t *testing.T, c *Cluster) {
+	_, err := c.Run()
+	assert.NoError(t, err)
+}
+
+// addWithdraw adds a side chain block of the withdraw transaction of the
+// index to the first arbiter, confirmed by empty blocks, and a UTXO of the
+// withdraw bank to pay it. It returns the hash of the withdraw transaction.
+func addWithdraw(t *testing.T, c *Cluster, index int) common.Uint256 {
+	hash := common.Hash([]byte("withdraw " + strconv.Itoa(index)))
+	c.SideNode.AddBlock([]*base.WithdrawTxInfo{{
+		TxID: common.ToReversedString(hash),
+		CrossChainAssets: []*base.WithdrawOutputInfo{{
+			CrossChainAddress: c.Nodes[0].Client.GetMainAccount().Address,
+			CrossChainAmount:  "0.9",
+			OutputAmount:      "1",
+		}},
+	}}, nil)
+	for i := 0; i < withdrawConfirmations; i++ {
+		c.SideNode.AddBlock(nil, nil)
+	}
+	c.MainNode.AddUTXO(base.UTXOInfo{
+		Txid:    common.ToReversedString(common.Hash([]byte("utxo " + strconv.Itoa(index)))),
+		Address: c.GenesisAddress,
+		Amount:  "10",
+	})
+	return hash
+}
+
+// depositTx returns a deposit transaction of the index to the side chain.
+func depositTx(t *testing.T, c *Cluster, index int) *types.Transaction {
+	programHash, err := common.Uint168FromAddress(c.GenesisAddress)
+	assert.NoError(t, err)
+	nonce := types.NewAttribute(types.Nonce, []byte("deposit "+strconv.Itoa(index)))
+	return &types.Transaction{
+		TxType:     types.TransferCrossChainAsset,
+		Payload:    &payload.TransferCrossChainAsset{},
+		Attributes: []*types.Attribute{&nonce},
+		Outputs: []*types.Output{{
+			AssetID:     common.Uint256(base.SystemAssetId),
+			ProgramHash: *programHash,
+			Value:       common.Fixed64(100000000),
+		}},
+	}
+}
+
+// waitForTransactions runs the cluster until the main node accepts count
+// transactions.
+func waitForTransactions(t *testing.T, c *Cluster, count int) []*types.Transaction {
+	assert.NoError(t, c.RunUntil(func() bool {
+		return len(c.MainNode.Transactions()) >= count
+	}))
+	txs := c.MainNode.Transactions()
+	assert.Equal(t, count, len(txs))
+	return txs
+}
+
+// waitForProposals runs the cluster until the arbiter proposes count withdraw
+// proposals, and returns them.
+func waitForProposals(t *testing.T, c *Cluster, n *Node, count int) []string {
+	var proposals []string
+	assert.NoError(t, c.RunUntil(func() bool {
+		proposals, _ = n.Proposals()
+		return len(proposals) >= count
+	}))
+	run(t, c)
+	return proposals
+}
+
+// waitForCachedDeposits runs the cluster until the online arbiters cache
+// count deposit transactions.
+func waitForCachedDeposits(t *testing.T, c *Cluster, count int) {
+	assert.NoError(t, c.RunUntil(func() bool {
+		for _, n := range c.Nodes {
+			if !n.online {
+				continue
+			}
+			hashes, _, err := n.DataStore.MainChainStore.GetAllMainChainTxHashes()
+			if err != nil || len(hashes) < count {
+				return false
+			}
+		}
+		return true
+	}))
+}
+
+func approvedBy(t *testing.T, c *Cluster, proposal string) int {
+	count := 0
+	for _, n := range c.Nodes {
+		approved, err := n.Approved()
+		assert.NoError(t, err)
+		for _, p := range approved {
+			if p == proposal {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestCluster_Deposit(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+
+	tx := depositTx(t, c, 1)
+	c.Deposit(tx)
+	assert.NoError(t, c.RunUntil(func() bool {
+		return len(c.SideNode.Deposits()) == 1
+	}))
+	assert.Equal(t, []common.Uint256{tx.Hash()}, c.SideNode.Deposits())
+	// only the on duty arbiter recharges the side chain
+	assert.Equal(t, 1, len(c.SideNode.Requests("sendrechargetransaction")))
+}
+
+func TestCluster_Withdraw(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+	assert.Equal(t, 3, c.Threshold())
+
+	hash := addWithdraw(t, c, 1)
+	assert.NoError(t, c.Sync())
+	// withdraw transactions are proposed by the arbiter becoming on duty
+	assert.NoError(t, c.Rotate())
+	txs := waitForTransactions(t, c, 1)
+
+	withdraw, ok := txs[0].Payload.(*payload.WithdrawFromSideChain)
+	assert.True(t, ok)
+	assert.Equal(t, c.GenesisAddress, withdraw.GenesisBlockAddress)
+	assert.Equal(t, []common.Uint256{hash}, withdraw.SideChainTransactionHashes)
+	assert.Equal(t, c.Threshold()*crypto.SignatureScriptLength, len(txs[0].Programs[0].Parameter))
+
+	proposals, err := c.OnDuty().Proposals()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{txs[0].Hash().String()}, proposals)
+	assert.Equal(t, len(c.Nodes)-1, approvedBy(t, c, proposals[0]))
+	assert.Equal(t, 0, c.Network.Dropped())
+}
+
+func TestCluster_WithdrawAuditFailed(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+
+	addWithdraw(t, c, 1)
+	assert.NoError(t, c.Sync())
+	assert.NoError(t, c.Rotate())
+
+	// two of the arbiters can not audit, their signatures are discarded and
+	// the proposal does not reach the threshold
+	var audited []*Node
+	for _, n := range c.Nodes {
+		if n == c.OnDuty() || len(audited) == 1 {
+			audited = append(audited, n)
+			continue
+		}
+		assert.NoError(t, n.AuditLog.Close())
+	}
+	proposals := waitForProposals(t, c, c.OnDuty(), 1)
+	run(t, c)
+	assert.Equal(t, 0, len(c.MainNode.Transactions()))
+	approved, err := audited[1].Approved()
+	assert.NoError(t, err)
+	assert.Equal(t, proposals, approved)
+}
+
+func TestCluster_OnDutyRotation(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+
+	for i := 1; i <= len(c.Nodes); i++ {
+		hash := addWithdraw(t, c, i)
+		assert.NoError(t, c.Rotate())
+		assert.Equal(t, c.Nodes[i%len(c.Nodes)], c.OnDuty())
+
+		txs := waitForTransactions(t, c, i)
+		withdraw := txs[i-1].Payload.(*payload.WithdrawFromSideChain)
+		assert.Equal(t, []common.Uint256{hash}, withdraw.SideChainTransactionHashes)
+		proposals, err := c.OnDuty().Proposals()
+		assert.NoError(t, err)
+		assert.Contains(t, proposals, txs[i-1].Hash().String())
+	}
+
+	// proposals of the arbiter no longer on duty are refused
+	previous := c.OnDuty()
+	hash := addWithdraw(t, c, len(c.Nodes)+1)
+	assert.NoError(t, c.Rotate())
+	previousProposals, err := previous.Proposals()
+	assert.NoError(t, err)
+	sideChain, ok := previous.Arbitrator.GetSideChainManager().GetChain(c.GenesisAddress)
+	assert.True(t, ok)
+	sideChain.SendCachedWithdrawTxs()
+	proposals := waitForProposals(t, c, previous, len(previousProposals)+1)
+	assert.Equal(t, 0, approvedBy(t, c, proposals[len(proposals)-1]))
+
+	// and the one on duty completes them
+	txs := waitForTransactions(t, c, len(c.Nodes)+1)
+	withdraw := txs[len(txs)-1].Payload.(*payload.WithdrawFromSideChain)
+	assert.Equal(t, []common.Uint256{hash}, withdraw.SideChainTransactionHashes)
+}
+
+func TestCluster_ArbiterOffline(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+
+	// three of four arbiters still reach agreement
+	c.SetOnline(c.Nodes[3], false)
+	addWithdraw(t, c, 1)
+	assert.NoError(t, c.Rotate())
+	txs := waitForTransactions(t, c, 1)
+	assert.Equal(t, c.Threshold()*crypto.SignatureScriptLength, len(txs[0].Programs[0].Parameter))
+
+	// two of four arbiters do not
+	c.SetOnline(c.Nodes[0], false)
+	hash := addWithdraw(t, c, 2)
+	assert.NoError(t, c.Rotate())
+	proposals := waitForProposals(t, c, c.OnDuty(), 1)
+	assert.Equal(t, 1, approvedBy(t, c, proposals[0]))
+	assert.Equal(t, 1, len(c.MainNode.Transactions()))
+
+	// the arbiter on duty next completes it after they are back
+	c.SetOnline(c.Nodes[0], true)
+	c.SetOnline(c.Nodes[3], true)
+	assert.NoError(t, c.Rotate())
+	txs = waitForTransactions(t, c, 2)
+	withdraw := txs[1].Payload.(*payload.WithdrawFromSideChain)
+	assert.Equal(t, []common.Uint256{hash}, withdraw.SideChainTransactionHashes)
+}
+
+func TestCluster_DepositOnDutyOffline(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+
+	c.SetOnline(c.OnDuty(), false)
+	tx := depositTx(t, c, 1)
+	c.Deposit(tx)
+	waitForCachedDeposits(t, c, 1)
+	assert.Equal(t, 0, len(c.SideNode.Deposits()))
+
+	// the arbiter on duty next sends the cached deposit transaction
+	assert.NoError(t, c.Rotate())
+	assert.NoError(t, c.RunUntil(func() bool {
+		return len(c.SideNode.Deposits()) == 1
+	}))
+	assert.Equal(t, []common.Uint256{tx.Hash()}, c.SideNode.Deposits())
+}
+
+func TestCluster_RescanMainChain(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+
+	// the spv module of the arbiter on duty misses the deposit transaction
+	onDuty := c.OnDuty()
+	tx := depositTx(t, c, 1)
+	height := c.Deposit(tx, onDuty)
+	assert.NoError(t, c.RunUntil(func() bool {
+		for _, n := range c.Nodes {
+			hashes, _, err := n.DataStore.MainChainStore.GetAllMainChainTxHashes()
+			if n != onDuty && (err != nil || len(hashes) == 0) {
+				return false
+			}
+		}
+		return true
+	}))
+	assert.Equal(t, 0, len(c.SideNode.Deposits()))
+
+	// and finds it by a rescan from the height of it
+	assert.NoError(t, onDuty.Arbitrator.RescanMainChain(height))
+	assert.NoError(t, c.RunUntil(func() bool {
+		return len(c.SideNode.Deposits()) == 1
+	}))
+	assert.Equal(t, []common.Uint256{tx.Hash()}, c.SideNode.Deposits())
+
+	assert.NoError(t, c.RunUntil(func() bool {
+		progress, ok := onDuty.Arbitrator.GetMainChainRescanProgress()
+		return ok && progress.Finished
+	}))
+	progress, _ := onDuty.Arbitrator.GetMainChainRescanProgress()
+	assert.Equal(t, "", progress.Error)
+	assert.Equal(t, c.MainNode.Height(), progress.CurrentHeight)
+}
+
+func TestCluster_StatusGossip(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 3)
+	defer closeCluster()
+	for _, n := range c.Nodes {
+		assert.NoError(t, n.Network.BroadcastStatus())
+	}
+	run(t, c)
+
+	for _, n := range c.Nodes {
+		for _, other := range c.Nodes {
+			status, ok := n.Network.GetPeerStatus(other.PID)
+			if n == other {
+				assert.False(t, ok)
+				continue
+			}
+			assert.True(t, ok)
+			assert.Equal(t, config.NodePrefix+config.Version, status.Version)
+			assert.Equal(t, c.MainNode.Height(), status.MainChainHeight)
+			assert.Equal(t, c.OnDuty().PublicKey, status.OnDutyArbiter)
+			assert.Equal(t, uint32(len(c.Nodes)), status.ArbitersCount)
+		}
+	}
+}
+
+func TestCluster_MisbehavingArbiter(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+	bad := c.Nodes[3]
+
+	// undecodable items ban the arbiter after reaching the threshold
+	for i := 0; i < 5; i++ {
+		bad.Network.BroadcastMessage(&cs.DistributedItemMessage{Content: []byte{1, 2, 3}})
+		run(t, c)
+	}
+	for _, n := range c.Nodes[:3] {
+		scores := n.Network.DumpPeerScores()
+		assert.Equal(t, 1, len(scores))
+		assert.Equal(t, bad.PID, scores[0].PID)
+		assert.True(t, scores[0].Banned)
+	}
+
+	// the others still reach agreement without the banned arbiter
+	addWithdraw(t, c, 1)
+	assert.NoError(t, c.Rotate())
+	txs := waitForTransactions(t, c, 1)
+	proposals, err := c.OnDuty().Proposals()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{txs[0].Hash().String()}, proposals)
+	approved, err := bad.Approved()
+	assert.NoError(t, err)
+	assert.Empty(t, approved)
+}
+
+func TestCluster_WithdrawTakeover(t *testing.T) {
+	c, closeCluster := newTestCluster(t, 4)
+	defer closeCluster()
+	pendingBlocks := c.Nodes[0].Config.TakeoverPendingBlocks
+	assert.True(t, pendingBlocks > withdrawConfirmations)
+
+	// the arbiter on duty stalls, and the last arbiter is offline while the
+	// withdraw transaction is packed
+	onDuty := c.OnDuty()
+	next := c.Nodes[(onDuty.Index+1)%len(c.Nodes)]
+	late := c.Nodes[(onDuty.Index+3)%len(c.Nodes)]
+	c.SetOnline(onDuty, false)
+	c.SetOnline(late, false)
+	hash := addWithdraw(t, c, 1)
+	assert.NoError(t, c.Sync())
+
+	// not pending long enough
+	c.Watchdog()
+	run(t, c)
+	proposals, err := next.Proposals()
+	assert.NoError(t, err)
+	assert.Empty(t, proposals)
+
+	// the watchdog of the next arbiter takes over after the side chain
+	// blocks, the late arbiter judges it by the same blocks and signs it
+	c.SetOnline(late, true)
+	for i := uint32(withdrawConfirmations); i < pendingBlocks; i++ {
+		c.SideNode.AddBlock(nil, nil)
+	}
+	assert.NoError(t, c.Sync())
+	c.Watchdog()
+	txs := waitForTransactions(t, c, 1)
+	withdraw := txs[0].Payload.(*payload.WithdrawFromSideChain)
+	assert.Equal(t, []common.Uint256{hash}, withdraw.SideChainTransactionHashes)
+
+	proposals, err = next.Proposals()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{txs[0].Hash().String()}, proposals)
+	approved, err := late.Approved()
+	assert.NoError(t, err)
+	assert.Equal(t, proposals, approved)
+}
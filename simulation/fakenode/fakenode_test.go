@@ -0,0 +1,304 @@
+package fakenode
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAddress = "XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ"
+
+func TestMain(m *testing.M) {
+	logDir, err := ioutil.TempDir("", "fakenode")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(logDir, 5, 0, 0)
+
+	code := m.Run()
+	os.RemoveAll(logDir)
+	os.Exit(code)
+}
+
+func newTestMainNode(t *testing.T) *MainNode {
+	node := NewMainNode()
+	node.Start()
+	return node
+}
+
+// mainConfig returns the config of an arbiter of the main node.
+func mainConfig(node *MainNode) *config.Configuration {
+	return &config.Configuration{
+		MainNode: &config.MainNodeConfig{Rpc: node.RpcConfig()},
+	}
+}
+
+func newTestSideNode() *SideNode {
+	node := NewSideNode()
+	node.Start()
+	return node
+}
+
+func withdrawTx(t *testing.T, inputs []types.OutPoint, hashes ...common.Uint256) string {
+	txn := &types.Transaction{
+		TxType: types.WithdrawFromSideChain,
+		Payload: &payload.WithdrawFromSideChain{
+			GenesisBlockAddress:        testAddress,
+			SideChainTransactionHashes: hashes,
+		},
+	}
+	for _, op := range inputs {
+		txn.Inputs = append(txn.Inputs, &types.Input{Previous: op})
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, txn.Serialize(buf))
+	return common.BytesToHexString(buf.Bytes())
+}
+
+func TestMainNode_Blocks(t *testing.T) {
+	node := newTestMainNode(t)
+	defer node.Close()
+
+	height, err := rpc.GetCurrentHeight(node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), height)
+
+	assert.Equal(t, uint32(1), node.AddBlock())
+	height, err = rpc.GetCurrentHeight(node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), height)
+
+	block, err := rpc.GetBlockByHeight(1, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), block.Height)
+	assert.Equal(t, blockHash(0), block.PreviousBlockHash)
+
+	hash := common.Hash([]byte("block 1"))
+	byHash, err := rpc.GetBlockByHash(&hash, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, block.Hash, byHash.Hash)
+
+	_, err = rpc.GetBlockByHeight(2, node.RpcConfig())
+	assert.Error(t, err)
+}
+
+func TestMainNode_Arbitrators(t *testing.T) {
+	node := newTestMainNode(t)
+	defer node.Close()
+
+	node.SetArbitrators([]string{"a", "b", "c"}, 1)
+	node.AddBlock()
+	node.SetArbitrators([]string{"b", "c", "d"}, 2)
+	node.AddBlock()
+
+	info, err := rpc.GetArbitratorGroupInfoByHeight(1, mainConfig(node))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, info.Arbitrators)
+	assert.Equal(t, 1, info.OnDutyArbitratorIndex)
+	info, err = rpc.GetArbitratorGroupInfoByHeight(5, mainConfig(node))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, info.Arbitrators)
+	_, err = rpc.GetArbitratorGroupInfoByHeight(0, mainConfig(node))
+	assert.Error(t, err)
+
+	pk := "03e435ccd6073813917c2d841a0815d21301ec3286bc1412bb5b099178c68a10b6"
+	node.SetCrossChainArbiters([]string{pk})
+	peers, err := rpc.GetActiveDposPeers(10, mainConfig(node))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(peers))
+	assert.Equal(t, pk, common.BytesToHexString(peers[0][:]))
+}
+
+func TestMainNode_SendWithdrawTransaction(t *testing.T) {
+	node := newTestMainNode(t)
+	defer node.Close()
+
+	utxoID := common.Uint256{1}
+	node.AddUTXO(base.UTXOInfo{
+		Txid:    common.ToReversedString(utxoID),
+		Address: testAddress,
+		Amount:  "10",
+	})
+	node.AddWithdrawnTxs(common.Uint256{9})
+
+	utxos, err := rpc.GetWithdrawUTXOsByAmount(testAddress, 5*1e8, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(utxos))
+	_, err = rpc.GetWithdrawUTXOsByAmount(testAddress, 11*1e8, node.RpcConfig())
+	assert.Error(t, err)
+	amount, err := rpc.GetAmountByInputs([]*types.Input{
+		{Previous: types.OutPoint{TxID: utxoID}}}, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, common.Fixed64(10*1e8), amount)
+
+	// duplicated side chain transaction
+	op := types.OutPoint{TxID: utxoID}
+	resp, err := rpc.CallAndUnmarshalResponse("sendrawtransaction",
+		rpc.Param("data", withdrawTx(t, []types.OutPoint{op},
+			common.Uint256{2}, common.Uint256{9})), node.RpcConfig())
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, cs.MCErrSidechainTxDuplicate, resp.Code)
+
+	resp, err = rpc.CallAndUnmarshalResponse("sendrawtransaction",
+		rpc.Param("data", withdrawTx(t, []types.OutPoint{op},
+			common.Uint256{2})), node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Nil(t, resp.Error)
+	txid := resp.Result
+	assert.Equal(t, 1, len(node.Transactions()))
+
+	exist, err := rpc.GetExistWithdrawTransactions([]string{
+		common.Uint256{2}.String(), common.Uint256{3}.String()}, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{common.Uint256{2}.String()}, exist)
+	utxos, err = rpc.GetUnspentUtxo([]string{testAddress}, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(utxos))
+
+	// the spent utxo can not be spent again
+	resp, err = rpc.CallAndUnmarshalResponse("sendrawtransaction",
+		rpc.Param("data", withdrawTx(t, []types.OutPoint{op},
+			common.Uint256{3})), node.RpcConfig())
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, cs.MCErrDoubleSpend, resp.Code)
+
+	height := node.AddBlock()
+	block, err := rpc.GetBlockByHeight(height, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{txid}, block.Tx)
+}
+
+func TestSideNode_Withdraws(t *testing.T) {
+	node := newTestSideNode()
+	defer node.Close()
+
+	withdraw := &base.WithdrawTxInfo{
+		TxID: common.ToReversedString(common.Uint256{1}),
+		CrossChainAssets: []*base.WithdrawOutputInfo{
+			{CrossChainAddress: testAddress, CrossChainAmount: "1", OutputAmount: "1.0001"},
+		},
+	}
+	evidence := &base.SidechainIllegalDataInfo{IllegalType: 1, Height: 1, Evidence: "01"}
+	node.AddBlock([]*base.WithdrawTxInfo{withdraw}, []*base.SidechainIllegalDataInfo{evidence})
+	node.AddBlock(nil, nil)
+
+	withdraws, evidences, err := rpc.GetWithdrawTxsAndEvidencesByHeights(
+		context.Background(), []uint32{1, 2}, []uint32{1}, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, [][]*base.WithdrawTxInfo{{withdraw}, {}}, withdraws)
+	assert.Equal(t, [][]*base.SidechainIllegalDataInfo{{evidence}}, evidences)
+	_, err = rpc.GetWithdrawTransactionByHeight(3, node.RpcConfig())
+	assert.Error(t, err)
+
+	tx, err := rpc.GetTransactionInfoByHash(common.Uint256{1}.String(), node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, withdraw, tx)
+
+	valid, err := rpc.CheckIllegalEvidence(evidence, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	valid, err = rpc.CheckIllegalEvidence(&base.SidechainIllegalDataInfo{Evidence: "02"},
+		node.RpcConfig())
+	assert.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestSideNode_Deposits(t *testing.T) {
+	node := newTestSideNode()
+	defer node.Close()
+
+	node.AddRechargedTxs(common.Uint256{1})
+	hash := common.Uint256{2}
+	resp, err := rpc.CallAndUnmarshalResponse("sendrechargetransaction",
+		rpc.Param("txid", hash.String()), node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, []common.Uint256{hash}, node.Deposits())
+
+	resp, err = rpc.CallAndUnmarshalResponse("sendrechargetransaction",
+		rpc.Param("txid", hash.String()), node.RpcConfig())
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, arbitrator.SCErrMainchainTxDuplicate, resp.Code)
+
+	exist, err := rpc.GetExistDepositTransactions([]string{
+		common.Uint256{1}.String(), hash.String(), common.Uint256{3}.String()},
+		node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{common.Uint256{1}.String(), hash.String()}, exist)
+}
+
+func TestSideNode_AuxPow(t *testing.T) {
+	node := newTestSideNode()
+	defer node.Close()
+
+	result, err := rpc.CallAndUnmarshal("createauxblock",
+		rpc.Param("paytoaddress", testAddress), node.RpcConfig())
+	assert.NoError(t, err)
+	auxBlock := result.(map[string]interface{})
+	assert.Equal(t, float64(1), auxBlock["height"])
+
+	params := rpc.Param("blockhash", auxBlock["hash"]).Add("sideauxpow", "00")
+	_, err = rpc.CallAndUnmarshal("submitsideauxblock", params, node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), node.Height())
+	assert.Equal(t, 1, len(node.AuxPows()))
+
+	// the aux pow of a stale block is refused
+	_, err = rpc.CallAndUnmarshal("submitsideauxblock", params, node.RpcConfig())
+	assert.Error(t, err)
+}
+
+func TestServer_Scripted(t *testing.T) {
+	node := newTestSideNode()
+	defer node.Close()
+
+	node.FailNext("getblockcount", 45002, "node is busy")
+	_, err := rpc.GetCurrentHeight(node.RpcConfig())
+	assert.EqualError(t, err, "node is busy")
+	_, err = rpc.GetCurrentHeight(node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(node.Requests("getblockcount")))
+
+	node.Handle("getblockcount", func(params servers.Params) (interface{}, *rpc.Error) {
+		return 100, nil
+	})
+	height, err := rpc.GetCurrentHeight(node.RpcConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(99), height)
+
+	_, err = rpc.CallAndUnmarshal("unknownmethod", nil, node.RpcConfig())
+	assert.Error(t, err)
+}
+
+func TestServer_Auth(t *testing.T) {
+	node := NewSideNode()
+	node.SetAuth("user", "pass")
+	node.Start()
+	defer node.Close()
+
+	_, err := rpc.GetCurrentHeight(node.RpcConfig())
+	assert.NoError(t, err)
+
+	cfg := *node.RpcConfig()
+	cfg.Pass = "wrong"
+	_, err = rpc.GetCurrentHeight(&cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,336 @@
+package fakenode
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	elaerrors "github.com/elastos/Elastos.ELA.Arbiter/errors"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+type arbitratorGroup struct {
+	height uint32
+	info   rpc.ArbitratorGroupInfo
+}
+
+// MainNode stands in for an ELA main node. Withdraw transactions sent to it
+// are checked for duplicated side chain transactions and double spent UTXOs
+// the same as the main node, and packed into the next block.
+type MainNode struct {
+	*Server
+
+	chain              chain
+	groups             []*arbitratorGroup
+	crossChainArbiters []string
+	utxos              []*base.UTXOInfo
+	spent              map[string]struct{}
+	withdrawn          map[common.Uint256]struct{}
+	transactions       []*types.Transaction
+	illegalData        []string
+}
+
+// NewMainNode creates a main node of the genesis block only, it is started by
+// Start or Listen.
+func NewMainNode() *MainNode {
+	n := &MainNode{
+		Server:    newServer(),
+		spent:     make(map[string]struct{}),
+		withdrawn: make(map[common.Uint256]struct{}),
+	}
+	n.chain.addBlock(nil)
+	n.chain.handle(n.Server)
+	n.handleLocked("getarbitratorgroupbyheight", n.getArbitratorGroupByHeight)
+	n.handleLocked("getcrosschainpeersinfo", n.getCrossChainPeersInfo)
+	n.handleLocked("getcrcpeersinfo", n.getCrossChainPeersInfo)
+	n.handleLocked("getexistwithdrawtransactions", n.getExistWithdrawTransactions)
+	n.handleLocked("getutxosbyamount", n.getUTXOsByAmount)
+	n.handleLocked("listunspent", n.listUnspent)
+	n.handleLocked("getamountbyinputs", n.getAmountByInputs)
+	n.handleLocked("sendrawtransaction", n.sendRawTransaction)
+	n.handleLocked("submitsidechainillegaldata", n.submitSidechainIllegalData)
+	return n
+}
+
+// AddBlock appends a block of the transactions sent since the last block,
+// and returns its height.
+func (n *MainNode) AddBlock() uint32 {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return n.chain.addBlock(nil)
+}
+
+// Height returns the height of the best block.
+func (n *MainNode) Height() uint32 {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return n.chain.height()
+}
+
+// SetArbitrators sets the arbiters and the index of the on duty one, from the
+// next block on.
+func (n *MainNode) SetArbitrators(arbiters []string, onDutyIndex int) {
+	n.state.Lock()
+	defer n.state.Unlock()
+	n.groups = append(n.groups, &arbitratorGroup{
+		height: n.chain.height() + 1,
+		info: rpc.ArbitratorGroupInfo{
+			OnDutyArbitratorIndex: onDutyIndex,
+			Arbitrators:           append([]string(nil), arbiters...),
+		},
+	})
+}
+
+// SetCrossChainArbiters sets the public keys of the arbiters answered by
+// getcrosschainpeersinfo and getcrcpeersinfo.
+func (n *MainNode) SetCrossChainArbiters(publicKeys []string) {
+	n.state.Lock()
+	defer n.state.Unlock()
+	n.crossChainArbiters = append([]string(nil), publicKeys...)
+	sort.Strings(n.crossChainArbiters)
+}
+
+// AddUTXO adds an unspent output, Txid is in reversed hex as the ones in
+// responses of the main node.
+func (n *MainNode) AddUTXO(utxo base.UTXOInfo) {
+	n.state.Lock()
+	defer n.state.Unlock()
+	n.utxos = append(n.utxos, &utxo)
+}
+
+// AddWithdrawnTxs marks the side chain transactions as withdrawn by
+// transactions already on chain.
+func (n *MainNode) AddWithdrawnTxs(hashes ...common.Uint256) {
+	n.state.Lock()
+	defer n.state.Unlock()
+	for _, hash := range hashes {
+		n.withdrawn[hash] = struct{}{}
+	}
+}
+
+// Transactions returns the transactions accepted by sendrawtransaction.
+func (n *MainNode) Transactions() []*types.Transaction {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return append([]*types.Transaction(nil), n.transactions...)
+}
+
+// IllegalData returns the hex of illegal data submitted by
+// submitsidechainillegaldata.
+func (n *MainNode) IllegalData() []string {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return append([]string(nil), n.illegalData...)
+}
+
+func (n *MainNode) getArbitratorGroupByHeight(params servers.Params) (interface{}, *rpc.Error) {
+	height, ok := params.Uint("height")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	for i := len(n.groups) - 1; i >= 0; i-- {
+		if n.groups[i].height <= height {
+			return &n.groups[i].info, nil
+		}
+	}
+	return nil, newError(elaerrors.InternalError, "no arbitrators at height "+
+		strconv.FormatUint(uint64(height), 10))
+}
+
+func (n *MainNode) getCrossChainPeersInfo(params servers.Params) (interface{}, *rpc.Error) {
+	publicKeys := n.crossChainArbiters
+	if publicKeys == nil {
+		publicKeys = []string{}
+	}
+	return map[string]interface{}{"nodepublickeys": publicKeys}, nil
+}
+
+func (n *MainNode) getExistWithdrawTransactions(params servers.Params) (interface{}, *rpc.Error) {
+	txs, ok := params.ArrayString("txs")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "txs not found")
+	}
+	result := make([]string, 0)
+	for _, tx := range txs {
+		hash, err := common.Uint256FromHexString(tx)
+		if err != nil {
+			return nil, newError(elaerrors.InvalidParams, "")
+		}
+		if _, ok := n.withdrawn[*hash]; ok {
+			result = append(result, tx)
+		}
+	}
+	return result, nil
+}
+
+func outPointKey(txid string, vout uint32) string {
+	return txid + ":" + strconv.FormatUint(uint64(vout), 10)
+}
+
+// unspent returns the unspent outputs of the addresses.
+func (n *MainNode) unspent(addresses map[string]struct{}) []*base.UTXOInfo {
+	result := make([]*base.UTXOInfo, 0)
+	for _, utxo := range n.utxos {
+		if _, ok := addresses[utxo.Address]; !ok {
+			continue
+		}
+		if _, ok := n.spent[outPointKey(utxo.Txid, utxo.VOut)]; ok {
+			continue
+		}
+		result = append(result, utxo)
+	}
+	return result
+}
+
+func (n *MainNode) getUTXOsByAmount(params servers.Params) (interface{}, *rpc.Error) {
+	address, ok := params.String("address")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "need a parameter named address!")
+	}
+	amountStr, ok := params.String("amount")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "need a parameter named amount!")
+	}
+	amount, err := common.StringToFixed64(amountStr)
+	if err != nil {
+		return nil, newError(elaerrors.InvalidParams, "invalid amount!")
+	}
+
+	result := make([]*base.UTXOInfo, 0)
+	var total common.Fixed64
+	for _, utxo := range n.unspent(map[string]struct{}{address: {}}) {
+		if total >= *amount {
+			break
+		}
+		value, err := common.StringToFixed64(utxo.Amount)
+		if err != nil {
+			return nil, newError(elaerrors.InternalError, err.Error())
+		}
+		total += *value
+		result = append(result, utxo)
+	}
+	if total < *amount {
+		return nil, newError(elaerrors.InternalError, "not enough utxo")
+	}
+	return result, nil
+}
+
+func (n *MainNode) listUnspent(params servers.Params) (interface{}, *rpc.Error) {
+	list, ok := params.ArrayString("addresses")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "need addresses in an array!")
+	}
+	addresses := make(map[string]struct{})
+	for _, address := range list {
+		addresses[address] = struct{}{}
+	}
+	return n.unspent(addresses), nil
+}
+
+func (n *MainNode) getAmountByInputs(params servers.Params) (interface{}, *rpc.Error) {
+	inputStr, ok := params.String("inputs")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "need a parameter named inputs!")
+	}
+	inputBytes, err := common.HexStringToBytes(inputStr)
+	if err != nil {
+		return nil, newError(elaerrors.InvalidParams, "invalid inputs")
+	}
+	r := bytes.NewReader(inputBytes)
+	count, err := common.ReadVarUint(r, 0)
+	if err != nil {
+		return nil, newError(elaerrors.InvalidParams, "invalid inputs")
+	}
+
+	var amount common.Fixed64
+	for i := uint64(0); i < count; i++ {
+		input := new(types.Input)
+		if err := input.Deserialize(r); err != nil {
+			return nil, newError(elaerrors.InvalidParams, "invalid inputs")
+		}
+		utxo := n.findUTXO(input.Previous)
+		if utxo == nil {
+			return nil, newError(elaerrors.InternalError, "unknown transaction "+
+				input.Previous.TxID.String()+" from persisted utxo")
+		}
+		value, err := common.StringToFixed64(utxo.Amount)
+		if err != nil {
+			return nil, newError(elaerrors.InternalError, err.Error())
+		}
+		amount += *value
+	}
+	return amount.String(), nil
+}
+
+// findUTXO returns the output referred by the out point, spent or not.
+func (n *MainNode) findUTXO(op types.OutPoint) *base.UTXOInfo {
+	txid := common.ToReversedString(op.TxID)
+	for _, utxo := range n.utxos {
+		if utxo.Txid == txid && utxo.VOut == uint32(op.Index) {
+			return utxo
+		}
+	}
+	return nil
+}
+
+func (n *MainNode) sendRawTransaction(params servers.Params) (interface{}, *rpc.Error) {
+	data, ok := params.String("data")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "need a string parameter named data")
+	}
+	txBytes, err := common.HexStringToBytes(data)
+	if err != nil {
+		return nil, newError(elaerrors.InvalidParams, "hex string to bytes error")
+	}
+	txn := new(types.Transaction)
+	if err := txn.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return nil, newError(elaerrors.InvalidTransaction, err.Error())
+	}
+
+	for _, input := range txn.Inputs {
+		key := outPointKey(common.ToReversedString(input.Previous.TxID),
+			uint32(input.Previous.Index))
+		if _, ok := n.spent[key]; ok {
+			return nil, &rpc.Error{Code: cs.MCErrDoubleSpend,
+				Message: "double spent utxo " + key}
+		}
+	}
+	var sideChainTxHashes []common.Uint256
+	if p, ok := txn.Payload.(*payload.WithdrawFromSideChain); ok {
+		sideChainTxHashes = p.SideChainTransactionHashes
+	}
+	for _, hash := range sideChainTxHashes {
+		if _, ok := n.withdrawn[hash]; ok {
+			return nil, &rpc.Error{Code: cs.MCErrSidechainTxDuplicate,
+				Message: "duplicated side chain transaction " + hash.String()}
+		}
+	}
+
+	for _, input := range txn.Inputs {
+		n.spent[outPointKey(common.ToReversedString(input.Previous.TxID),
+			uint32(input.Previous.Index))] = struct{}{}
+	}
+	for _, hash := range sideChainTxHashes {
+		n.withdrawn[hash] = struct{}{}
+	}
+	n.transactions = append(n.transactions, txn)
+	txid := common.ToReversedString(txn.Hash())
+	n.chain.mempool = append(n.chain.mempool, txid)
+	return txid, nil
+}
+
+func (n *MainNode) submitSidechainIllegalData(params servers.Params) (interface{}, *rpc.Error) {
+	data, ok := params.String("illegaldata")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "need a string parameter named illegaldata")
+	}
+	n.illegalData = append(n.illegalData, data)
+	return true, nil
+}
@@ -0,0 +1,314 @@
+// Package fakenode provides programmable stand-ins of the JSON-RPC servers of
+// ELA main and side nodes. They keep the chain state in memory, accept
+// scripted blocks and transactions, and record the transactions submitted by
+// the arbiter, so tests and sandbox runs need no live network.
+package fakenode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	elaerrors "github.com/elastos/Elastos.ELA.Arbiter/errors"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// Handler handles the request of a method, the returned error is sent as the
+// error of the response.
+type Handler func(params servers.Params) (interface{}, *rpc.Error)
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Params servers.Params
+}
+
+type request struct {
+	ID      int64          `json:"id"`
+	Version string         `json:"jsonrpc"`
+	Method  string         `json:"method"`
+	Params  servers.Params `json:"params"`
+}
+
+// Server is a JSON-RPC server in the format of ELA nodes, it answers single
+// and batch requests by the handlers of methods.
+type Server struct {
+	// state guards the chain state of the node.
+	state sync.Mutex
+
+	mux      sync.Mutex
+	handlers map[string]Handler
+	failures map[string][]*rpc.Error
+	requests []*Request
+
+	user string
+	pass string
+
+	httpServer *httptest.Server
+	rpcConfig  *config.RpcConfig
+}
+
+func newServer() *Server {
+	return &Server{
+		handlers: make(map[string]Handler),
+		failures: make(map[string][]*rpc.Error),
+	}
+}
+
+// SetAuth makes the server refuse requests not authenticated by user and
+// pass, it must be called before Start or Listen.
+func (s *Server) SetAuth(user, pass string) {
+	s.user = user
+	s.pass = pass
+}
+
+// Start starts the server on a random port of the loopback interface.
+func (s *Server) Start() {
+	s.httpServer = httptest.NewServer(s)
+	s.setRpcConfig(s.httpServer.Listener.Addr().String())
+}
+
+// Listen starts the server on the given address, such as "127.0.0.1:20336",
+// to stand in for a node in the config of the arbiter.
+func (s *Server) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.httpServer = httptest.NewUnstartedServer(s)
+	s.httpServer.Listener.Close()
+	s.httpServer.Listener = listener
+	s.httpServer.Start()
+	s.setRpcConfig(listener.Addr().String())
+	return nil
+}
+
+func (s *Server) setRpcConfig(address string) {
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := strconv.Atoi(port)
+	s.rpcConfig = &config.RpcConfig{
+		IpAddress:    host,
+		HttpJsonPort: p,
+		User:         s.user,
+		Pass:         s.pass,
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// RpcConfig returns the config to call the started server.
+func (s *Server) RpcConfig() *config.RpcConfig {
+	return s.rpcConfig
+}
+
+// Handle sets the handler of the method, replacing the default one. Handlers
+// set by Handle may call the methods of the node.
+func (s *Server) Handle(method string, handler Handler) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.handlers[method] = handler
+}
+
+// handleLocked sets the handler of the method run under the state lock.
+func (s *Server) handleLocked(method string, handler Handler) {
+	s.Handle(method, func(params servers.Params) (interface{}, *rpc.Error) {
+		s.state.Lock()
+		defer s.state.Unlock()
+		return handler(params)
+	})
+}
+
+// FailNext makes the next request of the method answered by the error instead
+// of the handler, errors of the same method are used in the order added.
+func (s *Server) FailNext(method string, code int64, message string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.failures[method] = append(s.failures[method],
+		&rpc.Error{Code: code, Message: message})
+}
+
+// Requests returns the requests received of the method, all requests if
+// method is empty.
+func (s *Server) Requests(method string) []*Request {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var requests []*Request
+	for _, r := range s.requests {
+		if method == "" || r.Method == method {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.user != "" || s.pass != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != s.user || pass != s.pass {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var data []byte
+	if len(body) > 0 && body[0] == '[' {
+		var requests []request
+		if err := json.Unmarshal(body, &requests); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		responses := make([]rpc.Response, 0, len(requests))
+		for _, req := range requests {
+			responses = append(responses, s.call(req))
+		}
+		data, err = json.Marshal(responses)
+	} else {
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, err = json.Marshal(s.call(req))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Server) call(req request) rpc.Response {
+	if req.Params == nil {
+		req.Params = servers.Params{}
+	}
+	resp := rpc.Response{ID: req.ID, Version: "2.0"}
+
+	s.mux.Lock()
+	s.requests = append(s.requests, &Request{Method: req.Method, Params: req.Params})
+	handler, ok := s.handlers[req.Method]
+	var failure *rpc.Error
+	if failures := s.failures[req.Method]; len(failures) > 0 {
+		failure = failures[0]
+		s.failures[req.Method] = failures[1:]
+	}
+	s.mux.Unlock()
+
+	switch {
+	case failure != nil:
+		resp.Error = failure
+	case !ok:
+		resp.Error = newError(elaerrors.InvalidMethod, "")
+	default:
+		resp.Result, resp.Error = handler(req.Params)
+	}
+	return resp
+}
+
+// newError creates the error of the code, message defaults to the message of
+// the code.
+func newError(code elaerrors.ErrCode, message string) *rpc.Error {
+	if message == "" {
+		message = code.Message()
+	}
+	return &rpc.Error{Code: int64(code), Message: message}
+}
+
+// chain is the in-memory blocks shared by main and side nodes, guarded by
+// the state lock of the server.
+type chain struct {
+	blocks  []*block
+	mempool []interface{}
+}
+
+type block struct {
+	hash string
+	txs  []interface{}
+}
+
+// addBlock appends a block of the transactions in mempool and txs, and
+// returns its height.
+func (c *chain) addBlock(txs []interface{}) uint32 {
+	height := uint32(len(c.blocks))
+	b := &block{hash: blockHash(height), txs: append(c.mempool, txs...)}
+	if b.txs == nil {
+		b.txs = []interface{}{}
+	}
+	c.blocks = append(c.blocks, b)
+	c.mempool = nil
+	return height
+}
+
+func (c *chain) height() uint32 {
+	return uint32(len(c.blocks)) - 1
+}
+
+func (c *chain) blockInfo(height uint32) (interface{}, *rpc.Error) {
+	if height >= uint32(len(c.blocks)) {
+		return nil, newError(elaerrors.UnknownBlock, "")
+	}
+	info := &base.BlockInfo{
+		Hash:          c.blocks[height].hash,
+		Height:        height,
+		Confirmations: uint32(len(c.blocks)) - height,
+		Tx:            c.blocks[height].txs,
+	}
+	if height > 0 {
+		info.PreviousBlockHash = c.blocks[height-1].hash
+	}
+	if height < c.height() {
+		info.NextBlockHash = c.blocks[height+1].hash
+	}
+	return info, nil
+}
+
+func (c *chain) handle(s *Server) {
+	s.handleLocked("getblockcount", func(params servers.Params) (interface{}, *rpc.Error) {
+		return len(c.blocks), nil
+	})
+	s.handleLocked("getblockbyheight", func(params servers.Params) (interface{}, *rpc.Error) {
+		height, ok := params.Uint("height")
+		if !ok {
+			return nil, newError(elaerrors.InvalidParams, "")
+		}
+		return c.blockInfo(height)
+	})
+	s.handleLocked("getblock", func(params servers.Params) (interface{}, *rpc.Error) {
+		hash, ok := params.String("blockhash")
+		if !ok {
+			return nil, newError(elaerrors.InvalidParams, "")
+		}
+		for height, b := range c.blocks {
+			if b.hash == hash {
+				return c.blockInfo(uint32(height))
+			}
+		}
+		return nil, newError(elaerrors.UnknownBlock, "")
+	})
+}
+
+// blockHash returns the hash of the block at height, in reversed hex as the
+// block hashes in responses of nodes.
+func blockHash(height uint32) string {
+	return common.ToReversedString(common.Hash([]byte("block " +
+		strconv.FormatUint(uint64(height), 10))))
+}
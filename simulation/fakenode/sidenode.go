@@ -0,0 +1,246 @@
+package fakenode
+
+import (
+	"encoding/json"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	elaerrors "github.com/elastos/Elastos.ELA.Arbiter/errors"
+	"github.com/elastos/Elastos.ELA.Arbiter/net/servers"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// AuxPow is a side chain aux pow submitted by submitsideauxblock.
+type AuxPow struct {
+	BlockHash  string
+	SideAuxPow string
+}
+
+// SideNode stands in for an ELA side node. Deposit transactions recharged to
+// it are refused if recharged before, the same as the side node.
+type SideNode struct {
+	*Server
+
+	chain     chain
+	withdraws map[uint32][]*base.WithdrawTxInfo
+	evidences map[uint32][]*base.SidechainIllegalDataInfo
+	recharged map[common.Uint256]struct{}
+	deposits  []common.Uint256
+	auxPows   []*AuxPow
+}
+
+// NewSideNode creates a side node of the genesis block only, it is started by
+// Start or Listen.
+func NewSideNode() *SideNode {
+	n := &SideNode{
+		Server:    newServer(),
+		withdraws: make(map[uint32][]*base.WithdrawTxInfo),
+		evidences: make(map[uint32][]*base.SidechainIllegalDataInfo),
+		recharged: make(map[common.Uint256]struct{}),
+	}
+	n.chain.addBlock(nil)
+	n.chain.handle(n.Server)
+	n.handleLocked("getwithdrawtransactionsbyheight", n.getWithdrawTransactionsByHeight)
+	n.handleLocked("getillegalevidencebyheight", n.getIllegalEvidenceByHeight)
+	n.handleLocked("getwithdrawtransaction", n.getWithdrawTransaction)
+	n.handleLocked("checkillegalevidence", n.checkIllegalEvidence)
+	n.handleLocked("getexistdeposittransactions", n.getExistDepositTransactions)
+	n.handleLocked("sendrechargetransaction", n.sendRechargeTransaction)
+	n.handleLocked("createauxblock", n.createAuxBlock)
+	n.handleLocked("submitsideauxblock", n.submitSideAuxBlock)
+	return n
+}
+
+// AddBlock appends a block of the withdraw transactions, the illegal
+// evidences and the transactions recharged since the last block, and
+// returns its height. TxID of withdraw transactions is in reversed hex as
+// the ones in responses of the side node.
+func (n *SideNode) AddBlock(withdraws []*base.WithdrawTxInfo,
+	evidences []*base.SidechainIllegalDataInfo) uint32 {
+	n.state.Lock()
+	defer n.state.Unlock()
+	txs := make([]interface{}, 0, len(withdraws))
+	for _, tx := range withdraws {
+		txs = append(txs, tx.TxID)
+	}
+	height := n.chain.addBlock(txs)
+	n.withdraws[height] = withdraws
+	n.evidences[height] = evidences
+	return height
+}
+
+// Height returns the height of the best block.
+func (n *SideNode) Height() uint32 {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return n.chain.height()
+}
+
+// AddRechargedTxs marks the main chain deposit transactions as recharged by
+// transactions already on chain.
+func (n *SideNode) AddRechargedTxs(hashes ...common.Uint256) {
+	n.state.Lock()
+	defer n.state.Unlock()
+	for _, hash := range hashes {
+		n.recharged[hash] = struct{}{}
+	}
+}
+
+// Deposits returns the main chain deposit transactions recharged by
+// sendrechargetransaction.
+func (n *SideNode) Deposits() []common.Uint256 {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return append([]common.Uint256(nil), n.deposits...)
+}
+
+// AuxPows returns the aux pows submitted by submitsideauxblock.
+func (n *SideNode) AuxPows() []*AuxPow {
+	n.state.Lock()
+	defer n.state.Unlock()
+	return append([]*AuxPow(nil), n.auxPows...)
+}
+
+func (n *SideNode) heightParam(params servers.Params) (uint32, *rpc.Error) {
+	height, ok := params.Uint("height")
+	if !ok {
+		return 0, newError(elaerrors.InvalidParams, "")
+	}
+	if height > n.chain.height() {
+		return 0, newError(elaerrors.UnknownBlock, "")
+	}
+	return height, nil
+}
+
+func (n *SideNode) getWithdrawTransactionsByHeight(params servers.Params) (interface{}, *rpc.Error) {
+	height, err := n.heightParam(params)
+	if err != nil {
+		return nil, err
+	}
+	txs := n.withdraws[height]
+	if txs == nil {
+		txs = []*base.WithdrawTxInfo{}
+	}
+	return txs, nil
+}
+
+func (n *SideNode) getIllegalEvidenceByHeight(params servers.Params) (interface{}, *rpc.Error) {
+	height, err := n.heightParam(params)
+	if err != nil {
+		return nil, err
+	}
+	evidences := n.evidences[height]
+	if evidences == nil {
+		evidences = []*base.SidechainIllegalDataInfo{}
+	}
+	return evidences, nil
+}
+
+func (n *SideNode) getWithdrawTransaction(params servers.Params) (interface{}, *rpc.Error) {
+	txid, ok := params.String("txid")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	for _, txs := range n.withdraws {
+		for _, tx := range txs {
+			if tx.TxID == txid {
+				return tx, nil
+			}
+		}
+	}
+	return nil, newError(elaerrors.UnknownTransaction, "")
+}
+
+// checkIllegalEvidence answers true if the evidence is one of the evidences
+// on chain.
+func (n *SideNode) checkIllegalEvidence(params servers.Params) (interface{}, *rpc.Error) {
+	data, err := json.Marshal(params["evidence"])
+	if err != nil {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	var evidence base.SidechainIllegalDataInfo
+	if err := json.Unmarshal(data, &evidence); err != nil {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	for _, evidences := range n.evidences {
+		for _, e := range evidences {
+			if *e == evidence {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (n *SideNode) getExistDepositTransactions(params servers.Params) (interface{}, *rpc.Error) {
+	txs, ok := params.ArrayString("txs")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "txs not found")
+	}
+	result := make([]string, 0)
+	for _, tx := range txs {
+		hash, err := common.Uint256FromHexString(tx)
+		if err != nil {
+			return nil, newError(elaerrors.InvalidParams, "")
+		}
+		if _, ok := n.recharged[*hash]; ok {
+			result = append(result, tx)
+		}
+	}
+	return result, nil
+}
+
+func (n *SideNode) sendRechargeTransaction(params servers.Params) (interface{}, *rpc.Error) {
+	txid, ok := params.String("txid")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	hash, err := common.Uint256FromHexString(txid)
+	if err != nil {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	if _, ok := n.recharged[*hash]; ok {
+		return nil, &rpc.Error{Code: arbitrator.SCErrMainchainTxDuplicate,
+			Message: "main chain transaction " + txid + " is recharged"}
+	}
+	n.recharged[*hash] = struct{}{}
+	n.deposits = append(n.deposits, *hash)
+	rechargeTxID := common.ToReversedString(common.Hash(append([]byte("recharge "), hash[:]...)))
+	n.chain.mempool = append(n.chain.mempool, rechargeTxID)
+	return rechargeTxID, nil
+}
+
+func (n *SideNode) createAuxBlock(params servers.Params) (interface{}, *rpc.Error) {
+	if _, ok := params.String("paytoaddress"); !ok {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	height := n.chain.height() + 1
+	return map[string]interface{}{
+		"genesishash":       n.chain.blocks[0].hash,
+		"height":            height,
+		"bits":              "1d00ffff",
+		"hash":              blockHash(height),
+		"previousblockhash": n.chain.blocks[height-1].hash,
+	}, nil
+}
+
+// submitSideAuxBlock accepts the aux pow of the block created by
+// createauxblock and appends the block.
+func (n *SideNode) submitSideAuxBlock(params servers.Params) (interface{}, *rpc.Error) {
+	hash, ok := params.String("blockhash")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	auxPow, ok := params.String("sideauxpow")
+	if !ok {
+		return nil, newError(elaerrors.InvalidParams, "")
+	}
+	if hash != blockHash(n.chain.height()+1) {
+		return nil, newError(elaerrors.UnknownBlock, "block hash is not of the aux block")
+	}
+	n.auxPows = append(n.auxPows, &AuxPow{BlockHash: hash, SideAuxPow: auxPow})
+	n.chain.addBlock(nil)
+	return true, nil
+}
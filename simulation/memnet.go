@@ -0,0 +1,247 @@
+// Package simulation runs multiple arbiters in one process for tests. The
+// arbiters are nodes the same as the ones run by main, backed by fakenode main
+// and side nodes and connected by an in-memory network in place of the DPoS
+// p2p server. Messages are delivered in order only when asked, so the
+// scenarios run deterministically.
+package simulation
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	elap2p "github.com/elastos/Elastos.ELA/p2p"
+)
+
+type envelope struct {
+	from    peer.PID
+	to      peer.PID
+	command string
+	payload []byte
+}
+
+// Network is an in-memory network of DPoS p2p servers. Two servers are
+// connected when both are online and in the connect list of each other, the
+// same as the DPoS p2p server.
+type Network struct {
+	mux     sync.Mutex
+	servers map[peer.PID]*server
+	pending []*envelope
+	dropped int
+}
+
+func NewNetwork() *Network {
+	return &Network{servers: make(map[peer.PID]*server)}
+}
+
+// NewServer creates a server of the network, it has the signature of
+// p2p.NewServer.
+func (n *Network) NewServer(cfg *p2p.Config) (p2p.Server, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if _, ok := n.servers[cfg.PID]; ok {
+		return nil, errors.New("duplicated server PID " + cfg.PID.String())
+	}
+	s := &server{
+		network:      n,
+		cfg:          cfg,
+		online:       true,
+		connectPeers: make(map[peer.PID]struct{}),
+	}
+	n.servers[cfg.PID] = s
+	return s, nil
+}
+
+// SetOnline takes the server of the PID online or offline, messages to or
+// from an offline server are dropped.
+func (n *Network) SetOnline(pid peer.PID, online bool) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if s, ok := n.servers[pid]; ok {
+		s.online = online
+	}
+}
+
+// Pending returns the count of messages sent but not delivered yet.
+func (n *Network) Pending() int {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return len(n.pending)
+}
+
+// Dropped returns the count of messages dropped as the servers are not
+// connected or the message can not be decoded.
+func (n *Network) Dropped() int {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.dropped
+}
+
+// Deliver delivers the pending messages in the order they are sent, and
+// returns the count delivered. Messages sent while delivering are left
+// pending.
+func (n *Network) Deliver() int {
+	n.mux.Lock()
+	pending := n.pending
+	n.pending = nil
+	n.mux.Unlock()
+
+	delivered := 0
+	for _, e := range pending {
+		n.mux.Lock()
+		to, ok := n.servers[e.to]
+		connected := ok && n.connected(e.from, e.to)
+		n.mux.Unlock()
+		if !connected {
+			n.drop()
+			continue
+		}
+
+		msg, err := to.cfg.MakeEmptyMessage(e.command)
+		if err != nil {
+			n.drop()
+			continue
+		}
+		if err := msg.Deserialize(bytes.NewReader(e.payload)); err != nil {
+			n.drop()
+			continue
+		}
+		to.cfg.HandleMessage(e.from, msg)
+		delivered++
+	}
+	return delivered
+}
+
+func (n *Network) drop() {
+	n.mux.Lock()
+	n.dropped++
+	n.mux.Unlock()
+}
+
+// connected returns if the servers are connected, the caller holds mux.
+func (n *Network) connected(a, b peer.PID) bool {
+	sa, ok := n.servers[a]
+	if !ok || !sa.online || !sa.started {
+		return false
+	}
+	sb, ok := n.servers[b]
+	if !ok || !sb.online || !sb.started {
+		return false
+	}
+	_, aToB := sa.connectPeers[b]
+	_, bToA := sb.connectPeers[a]
+	return aToB && bToA
+}
+
+func (n *Network) send(from, to peer.PID, msg elap2p.Message) error {
+	buf := new(bytes.Buffer)
+	if err := msg.Serialize(buf); err != nil {
+		return err
+	}
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if !n.connected(from, to) {
+		return errors.New("peer " + to.String() + " is not connected")
+	}
+	n.pending = append(n.pending, &envelope{
+		from:    from,
+		to:      to,
+		command: msg.CMD(),
+		payload: buf.Bytes(),
+	})
+	return nil
+}
+
+// server is a DPoS p2p server of the in-memory network.
+type server struct {
+	network *Network
+	cfg     *p2p.Config
+
+	// guarded by network.mux
+	online       bool
+	started      bool
+	connectPeers map[peer.PID]struct{}
+}
+
+func (s *server) Start() {
+	s.network.mux.Lock()
+	s.started = true
+	s.network.mux.Unlock()
+}
+
+func (s *server) Stop() error {
+	s.network.mux.Lock()
+	s.started = false
+	s.network.mux.Unlock()
+	return nil
+}
+
+func (s *server) AddAddr(pid peer.PID, addr string) {}
+
+func (s *server) ConnectPeers(peers []peer.PID) {
+	s.network.mux.Lock()
+	defer s.network.mux.Unlock()
+	s.connectPeers = make(map[peer.PID]struct{})
+	for _, pid := range peers {
+		if !pid.Equal(s.cfg.PID) {
+			s.connectPeers[pid] = struct{}{}
+		}
+	}
+}
+
+func (s *server) SendMessageToPeer(pid peer.PID, msg elap2p.Message) error {
+	return s.network.send(s.cfg.PID, pid, msg)
+}
+
+func (s *server) BroadcastMessage(msg elap2p.Message, exclPeers ...peer.PID) {
+	s.network.mux.Lock()
+	var peers []peer.PID
+	for pid := range s.connectPeers {
+		peers = append(peers, pid)
+	}
+	s.network.mux.Unlock()
+
+	excluded := make(map[peer.PID]struct{})
+	for _, pid := range exclPeers {
+		excluded[pid] = struct{}{}
+	}
+	for _, pid := range sortPIDs(peers) {
+		if _, ok := excluded[pid]; ok {
+			continue
+		}
+		s.network.send(s.cfg.PID, pid, msg)
+	}
+}
+
+func (s *server) ConnectedPeers() []p2p.Peer {
+	return nil
+}
+
+func (s *server) DumpPeersInfo() []*p2p.PeerInfo {
+	s.network.mux.Lock()
+	defer s.network.mux.Unlock()
+	var peers []peer.PID
+	for pid := range s.connectPeers {
+		peers = append(peers, pid)
+	}
+	var infos []*p2p.PeerInfo
+	for _, pid := range sortPIDs(peers) {
+		state := p2p.CSNoneConnection
+		if s.network.connected(s.cfg.PID, pid) {
+			state = p2p.CS2WayConnection
+		}
+		infos = append(infos, &p2p.PeerInfo{PID: pid, State: state})
+	}
+	return infos
+}
+
+// sortPIDs sorts the PIDs in place so broadcasting is in a fixed order.
+func sortPIDs(pids []peer.PID) []peer.PID {
+	sort.Slice(pids, func(i, j int) bool {
+		return bytes.Compare(pids[i][:], pids[j][:]) < 0
+	})
+	return pids
+}
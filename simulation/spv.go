@@ -0,0 +1,129 @@
+package simulation
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	"github.com/elastos/Elastos.ELA.SPV/interface"
+	"github.com/elastos/Elastos.ELA.SPV/interface/iutil"
+	spvstore "github.com/elastos/Elastos.ELA.SPV/interface/store"
+	"github.com/elastos/Elastos.ELA.SPV/util"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+)
+
+// spvService stands in for the spv module of an arbiter. It syncs the headers
+// of the blocks of the main node into a header store in the spv data
+// directory, the same as the spv module, and notifies the listeners of the
+// deposit transactions of the cluster in the blocks synced. Only
+// RegisterTransactionListener, SubmitTransactionReceipt, HeaderStore, Start
+// and Stop are implemented.
+type spvService struct {
+	_interface.SPVService
+
+	cluster *Cluster
+	node    *Node
+
+	mux       sync.Mutex
+	headers   spvstore.HeaderStore
+	listeners []_interface.TransactionListener
+	stopped   bool
+}
+
+func newSpvService(c *Cluster, n *Node, dataDir string) (*spvService, error) {
+	headers, err := spvstore.NewHeaderStore(dataDir, func() util.BlockHeader {
+		return iutil.NewHeader(&types.Header{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &spvService{cluster: c, node: n, headers: headers}, nil
+}
+
+func (s *spvService) RegisterTransactionListener(listener _interface.TransactionListener) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.listeners = append(s.listeners, listener)
+	return nil
+}
+
+func (s *spvService) SubmitTransactionReceipt(notifyId common.Uint256, txId common.Uint256) error {
+	return nil
+}
+
+func (s *spvService) HeaderStore() spvstore.HeaderStore {
+	return s.headers
+}
+
+func (s *spvService) Start() {
+	s.sync()
+}
+
+func (s *spvService) Stop() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.stopped {
+		s.stopped = true
+		s.headers.Close()
+	}
+}
+
+// sync syncs the headers from the best one to the best block of the main
+// node, and notifies the listeners of the deposit transactions in them but
+// the ones the node misses.
+func (s *spvService) sync() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stopped {
+		return
+	}
+
+	var previous common.Uint256
+	height := uint32(0)
+	if best, err := s.headers.GetBest(); err == nil {
+		previous = best.Hash()
+		height = best.Height + 1
+	}
+	for ; height <= s.cluster.MainNode.Height(); height++ {
+		header := &util.Header{
+			BlockHeader: iutil.NewHeader(&types.Header{Previous: previous, Height: height}),
+			Height:      height,
+			TotalWork:   big.NewInt(int64(height)),
+		}
+		if err := s.headers.Put(header, true); err != nil {
+			return
+		}
+		previous = header.Hash()
+
+		for _, tx := range s.cluster.deposits(height) {
+			if !s.cluster.missed(s.node, tx) {
+				s.notify(tx, height)
+			}
+		}
+	}
+}
+
+// notify notifies the listeners interested in the transaction confirmed in
+// the main chain block of the height, the same as the spv module. Listeners
+// are interested in the transactions of their type paying to their address.
+func (s *spvService) notify(tx *types.Transaction, height uint32) {
+	proof := bloom.MerkleProof{Height: height, Transactions: 1}
+	for _, listener := range s.listeners {
+		if listener.Type() != tx.TxType || !paysTo(tx, listener.Address()) {
+			continue
+		}
+		notifyId := common.Hash(append(tx.Hash().Bytes(), []byte(listener.Address())...))
+		listener.Notify(notifyId, proof, *tx)
+	}
+}
+
+// paysTo returns if any output of the transaction pays to the address.
+func paysTo(tx *types.Transaction, address string) bool {
+	for _, output := range tx.Outputs {
+		if addr, err := output.ProgramHash.ToAddress(); err == nil && addr == address {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"math"
 	"os"
 	"path/filepath"
@@ -18,10 +19,14 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var (
-	DBDocumentNAME  = filepath.Join(config.DataPath, config.DataDir, "arbiter")
-	DBNameMainChain = filepath.Join(DBDocumentNAME, "mainChainCache.db")
-	DBNameSideChain = filepath.Join(DBDocumentNAME, "sideChainCache.db")
+// DBDocumentNAME is the default directory of the databases, the databases of
+// an arbiter are named DBNameMainChain, DBNameSideChain and FinishedTxsDBName
+// in the directory.
+var DBDocumentNAME = filepath.Join(config.DataPath, config.DataDir, config.ArbiterDir)
+
+const (
+	DBNameMainChain = "mainChainCache.db"
+	DBNameSideChain = "sideChainCache.db"
 )
 
 const (
@@ -45,7 +50,15 @@ const (
 				TransactionHash VARCHAR UNIQUE,
 				GenesisBlockAddress VARCHAR(34),
 				TransactionData BLOB,
-				BlockHeight INTEGER
+				BlockHeight INTEGER,
+				State INTEGER NOT NULL DEFAULT 0
+			);`
+	CreateSignedWithdrawVolumesTable = `CREATE TABLE IF NOT EXISTS SignedWithdrawVolumes (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				TransactionHash VARCHAR UNIQUE,
+				GenesisBlockAddress VARCHAR(34),
+				Amount INTEGER,
+				SignTime INTEGER
 			);`
 	CreateMainChainTxsTable = `CREATE TABLE IF NOT EXISTS MainChainTxs (
 				Id INTEGER NOT NULL PRIMARY KEY,
@@ -53,14 +66,33 @@ const (
 				GenesisBlockAddress VARCHAR(34),
 				TransactionData BLOB,
 				MerkleProof BLOB,
+				Attempts INTEGER NOT NULL DEFAULT 0,
+				NextRetryTime INTEGER NOT NULL DEFAULT 0,
                 UNIQUE (TransactionHash, GenesisBlockAddress)
 			);`
 )
 
-var (
-	DbCache DataStoreImpl
+// States of withdraw transactions in SideChainTxs.
+const (
+	// WithdrawTxPending is proposed automatically.
+	WithdrawTxPending uint8 = iota
+
+	// WithdrawTxHeld waits for the approval of operator.
+	WithdrawTxHeld
+
+	// WithdrawTxApproved is approved by operator and proposed as usual.
+	WithdrawTxApproved
 )
 
+// SignedWithdrawVolume is the amount withdrawn by a withdraw transaction
+// signed by the signing policy, at unix time SignTime.
+type SignedWithdrawVolume struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Amount              common.Fixed64
+	SignTime            int64
+}
+
 type AddressUTXO struct {
 	Input               *types.Input
 	Amount              *common.Fixed64
@@ -69,7 +101,7 @@ type AddressUTXO struct {
 
 type DataStore interface {
 	ResetDataStore() error
-	catchSystemSignals()
+	Close() error
 }
 
 type DataStoreMainChain interface {
@@ -84,12 +116,17 @@ type DataStoreMainChain interface {
 	GetAllMainChainTxHashes() ([]string, []string, error)
 	GetAllMainChainTxs() ([]*base.MainChainTransaction, error)
 	GetMainChainTxsFromHashes(transactionHashes []string, genesisBlockAddresses string) ([]*base.SpvTransaction, error)
+	AddMainChainTxAttempt(transactionHash, genesisBlockAddress string) (uint32, error)
+	SetMainChainTxNextRetryTime(transactionHash, genesisBlockAddress string, nextRetryTime int64) error
+	GetMainChainTxsToRetry(now int64) ([]*base.MainChainTransaction, error)
+	GetMainChainTxsToSend(now int64) ([]*base.MainChainTransaction, error)
 }
 
 type DataStoreSideChain interface {
 	DataStore
 
 	CurrentSideHeight(genesisBlockAddress string, height uint32) uint32
+	SetCurrentSideHeight(genesisBlockAddress string, height uint32) error
 	AddSideChainTx(tx *base.SideChainTransaction) error
 	AddSideChainTxs(txs []*base.SideChainTransaction) error
 	HasSideChainTx(transactionHash string) (bool, error)
@@ -98,6 +135,13 @@ type DataStoreSideChain interface {
 	GetAllSideChainTxHashesAndHeights(genesisBlockAddress string) ([]string, []uint32, error)
 	GetSideChainTxsFromHashes(transactionHashes []string) ([]*base.WithdrawTx, error)
 	GetSideChainTxsFromHashesAndGenesisAddress(transactionHashes []string, genesisBlockAddress string) ([]*base.WithdrawTx, error)
+	GetSideChainTxHeights(transactionHashes []string, genesisBlockAddress string) (map[string]uint32, error)
+	HoldSideChainTxs(transactionHashes []string) error
+	ApproveSideChainTx(transactionHash string) error
+	GetSideChainTxsByState(genesisBlockAddress string, state uint8) ([]*base.SideChainTransaction, error)
+	AddSignedWithdrawVolume(volume *SignedWithdrawVolume) error
+	RemoveSignedWithdrawVolumes(before int64) error
+	GetSignedWithdrawVolumes(since int64) ([]*SignedWithdrawVolume, error)
 }
 
 type DataStoreImpl struct {
@@ -106,87 +150,80 @@ type DataStoreImpl struct {
 }
 
 type DataStoreMainChainImpl struct {
-	mux *sync.Mutex
+	mux  *sync.Mutex
+	path string
 
 	*sql.DB
 }
 
 type DataStoreSideChainImpl struct {
-	mux *sync.Mutex
+	mux       *sync.Mutex
+	path      string
+	sideNodes []*config.SideNodeConfig
 
 	*sql.DB
 }
 
-func OpenDataStore() (*DataStoreImpl, error) {
-	if err := checkAndCreateArbiterDataDir(); err != nil {
-		log.Errorf("create arbiter db dir error: %s\n", err)
-		return nil, err
+// Close closes the databases of main chain and side chains.
+func (store *DataStoreImpl) Close() error {
+	mainErr := store.MainChainStore.Close()
+	if err := store.SideChainStore.Close(); err != nil {
+		return err
 	}
+	return mainErr
+}
 
-	dbMainChain, err := initMainChainDB()
+// OpenDataStore opens the databases of main chain and side chains in dir,
+// the heights of sideNodes are initialized in the side chain database.
+func OpenDataStore(dir string, sideNodes []*config.SideNodeConfig) (*DataStoreImpl, error) {
+	mainChainStore, err := OpenMainChainDataStore(dir)
 	if err != nil {
 		return nil, err
 	}
-	dbSideChain, err := initSideChainDB()
+	sideChainStore, err := OpenSideChainDataStore(dir, sideNodes)
 	if err != nil {
+		mainChainStore.Close()
 		return nil, err
 	}
 	dataStore := &DataStoreImpl{
-		MainChainStore: &DataStoreMainChainImpl{mux: new(sync.Mutex), DB: dbMainChain},
-		SideChainStore: &DataStoreSideChainImpl{mux: new(sync.Mutex), DB: dbSideChain}}
-
-	// Handle system interrupt signals
-	dataStore.MainChainStore.catchSystemSignals()
-	dataStore.SideChainStore.catchSystemSignals()
+		MainChainStore: mainChainStore,
+		SideChainStore: sideChainStore}
 
 	return dataStore, nil
 }
 
-func OpenMainChainDataStore() (*DataStoreMainChainImpl, error) {
-	dbMainChain, err := initMainChainDB()
+func OpenMainChainDataStore(dir string) (*DataStoreMainChainImpl, error) {
+	path := filepath.Join(dir, DBNameMainChain)
+	dbMainChain, err := initMainChainDB(path)
 	if err != nil {
 		return nil, err
 	}
-	dataStore := &DataStoreMainChainImpl{mux: new(sync.Mutex), DB: dbMainChain}
-
-	// Handle system interrupt signals
-	dataStore.catchSystemSignals()
+	dataStore := &DataStoreMainChainImpl{mux: new(sync.Mutex), path: path, DB: dbMainChain}
 
 	return dataStore, nil
 }
 
-func OpenSideChainDataStore() (*DataStoreSideChainImpl, error) {
-	dbSideChain, err := initSideChainDB()
+func OpenSideChainDataStore(dir string, sideNodes []*config.SideNodeConfig) (*DataStoreSideChainImpl, error) {
+	path := filepath.Join(dir, DBNameSideChain)
+	dbSideChain, err := initSideChainDB(path, sideNodes)
 	if err != nil {
 		return nil, err
 	}
-	dataStore := &DataStoreSideChainImpl{mux: new(sync.Mutex), DB: dbSideChain}
-
-	// Handle system interrupt signals
-	dataStore.catchSystemSignals()
+	dataStore := &DataStoreSideChainImpl{mux: new(sync.Mutex), path: path,
+		sideNodes: sideNodes, DB: dbSideChain}
 
 	return dataStore, nil
 }
 
-func checkAndCreateArbiterDataDir() error {
-	arbiterPath := filepath.Join(config.DataPath, config.DataDir, config.ArbiterDir)
-	if _, err := os.Stat(arbiterPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(arbiterPath, 0740); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func initMainChainDB() (*sql.DB, error) {
-	err := CheckAndCreateDocument(DBDocumentNAME)
+func initMainChainDB(path string) (*sql.DB, error) {
+	err := CheckAndCreateDocument(filepath.Dir(path))
 	if err != nil {
-		log.Error("create DBCache doucument error:", err)
+		log.Store.Error("[initMainChainDB] create DBCache document error", log.F("path", path), log.Err(err))
 		return nil, err
 	}
-	db, err := sql.Open(DriverName, DBNameMainChain)
+	db, err := sql.Open(DriverName, path)
 	if err != nil {
-		log.Error("Open data db error:", err)
+		log.Store.Error("[initMainChainDB] open data db error", log.F("path", path), log.Err(err))
 		return nil, err
 	}
 	// Create info table
@@ -199,6 +236,15 @@ func initMainChainDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Add retry columns to MainChainTxs table created by old versions
+	err = addColumnIfNotExist(db, "MainChainTxs", "Attempts", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, err
+	}
+	err = addColumnIfNotExist(db, "MainChainTxs", "NextRetryTime", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, err
+	}
 	stmt, err := db.Prepare("INSERT INTO Info(Name, Value) values(?,?)")
 	if err != nil {
 		return nil, err
@@ -207,15 +253,15 @@ func initMainChainDB() (*sql.DB, error) {
 	return db, nil
 }
 
-func initSideChainDB() (*sql.DB, error) {
-	err := CheckAndCreateDocument(DBDocumentNAME)
+func initSideChainDB(path string, sideNodes []*config.SideNodeConfig) (*sql.DB, error) {
+	err := CheckAndCreateDocument(filepath.Dir(path))
 	if err != nil {
-		log.Error("Create DBCache doucument error:", err)
+		log.Store.Error("[initSideChainDB] create DBCache document error", log.F("path", path), log.Err(err))
 		return nil, err
 	}
-	db, err := sql.Open(DriverName, DBNameSideChain)
+	db, err := sql.Open(DriverName, path)
 	if err != nil {
-		log.Error("Open data db error:", err)
+		log.Store.Error("[initSideChainDB] open data db error", log.F("path", path), log.Err(err))
 		return nil, err
 	}
 	// Create SideHeightInfo table
@@ -228,8 +274,18 @@ func initSideChainDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Add State column to SideChainTxs table created by old versions
+	err = addColumnIfNotExist(db, "SideChainTxs", "State", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, err
+	}
+	// Create SignedWithdrawVolumes table
+	_, err = db.Exec(CreateSignedWithdrawVolumesTable)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, node := range config.Parameters.SideNodeList {
+	for _, node := range sideNodes {
 		stmt, err := db.Prepare("INSERT INTO SideHeightInfo(GenesisBlockAddress, Height) values(?,?)")
 		if err != nil {
 			return nil, err
@@ -240,12 +296,42 @@ func initSideChainDB() (*sql.DB, error) {
 	return db, nil
 }
 
+func addColumnIfNotExist(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(sql.RawBytes)
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+		// the second column of table_info is the column name
+		if string(*values[1].(*sql.RawBytes)) == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
 func (store *DataStoreSideChainImpl) ResetDataStore() error {
 	store.DB.Close()
-	os.Remove(DBNameSideChain)
+	os.Remove(store.path)
 
 	var err error
-	store.DB, err = initSideChainDB()
+	store.DB, err = initSideChainDB(store.path, store.sideNodes)
 	if err != nil {
 		return err
 	}
@@ -253,12 +339,11 @@ func (store *DataStoreSideChainImpl) ResetDataStore() error {
 	return nil
 }
 
-func (store *DataStoreSideChainImpl) catchSystemSignals() {
-	HandleSignal(func() {
-		store.mux.Lock()
-		store.DB.Close()
-		os.Exit(-1)
-	})
+// Close closes the database after the operation in progress.
+func (store *DataStoreSideChainImpl) Close() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.DB.Close()
 }
 
 func (store *DataStoreSideChainImpl) CurrentSideHeight(genesisBlockAddress string, height uint32) uint32 {
@@ -288,6 +373,28 @@ func (store *DataStoreSideChainImpl) CurrentSideHeight(genesisBlockAddress strin
 	return storedHeight
 }
 
+// SetCurrentSideHeight overwrites the stored height of the side chain, unlike
+// CurrentSideHeight it also accepts a height lower than the stored one.
+func (store *DataStoreSideChainImpl) SetCurrentSideHeight(genesisBlockAddress string, height uint32) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	stmt, err := store.Prepare("UPDATE SideHeightInfo SET Height=? WHERE GenesisBlockAddress=?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(height, genesisBlockAddress)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errors.New("unknown side chain genesis address " + genesisBlockAddress)
+	}
+	return nil
+}
+
 func (store *DataStoreSideChainImpl) AddSideChainTxs(txs []*base.SideChainTransaction) error {
 	store.mux.Lock()
 	defer store.mux.Unlock()
@@ -309,7 +416,8 @@ func (store *DataStoreSideChainImpl) AddSideChainTxs(txs []*base.SideChainTransa
 	for _, tx := range txs {
 		_, err = stmt.Exec(tx.TransactionHash, tx.GenesisBlockAddress, tx.Transaction, tx.BlockHeight)
 		if err != nil {
-			log.Error("[AddSideChainTxs] err")
+			log.Store.Error("[AddSideChainTxs] add side chain transaction failed", log.Chain(tx.GenesisBlockAddress),
+				log.TxHash(tx.TransactionHash), log.Height(tx.BlockHeight), log.Err(err))
 			continue
 		}
 	}
@@ -492,12 +600,147 @@ func (store *DataStoreSideChainImpl) GetSideChainTxsFromHashesAndGenesisAddress(
 	return txs, nil
 }
 
+// GetSideChainTxHeights returns the side chain block heights of the stored
+// transactions, transactions not found are not in the result.
+func (store *DataStoreSideChainImpl) GetSideChainTxHeights(transactionHashes []string, genesisBlockAddress string) (map[string]uint32, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	heights := make(map[string]uint32)
+	for _, txHash := range transactionHashes {
+		var height uint32
+		err := store.QueryRow(`SELECT BlockHeight FROM SideChainTxs WHERE TransactionHash=? AND GenesisBlockAddress=?`,
+			txHash, genesisBlockAddress).Scan(&height)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		heights[txHash] = height
+	}
+	return heights, nil
+}
+
+// HoldSideChainTxs holds the pending withdraw transactions, the approved ones
+// are not changed.
+func (store *DataStoreSideChainImpl) HoldSideChainTxs(transactionHashes []string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	stmt, err := tx.Prepare("UPDATE SideChainTxs SET State=? WHERE TransactionHash=? AND State=?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, txHash := range transactionHashes {
+		if _, err := stmt.Exec(WithdrawTxHeld, txHash, WithdrawTxPending); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApproveSideChainTx approves the held withdraw transaction.
+func (store *DataStoreSideChainImpl) ApproveSideChainTx(transactionHash string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	result, err := store.Exec("UPDATE SideChainTxs SET State=? WHERE TransactionHash=? AND State=?",
+		WithdrawTxApproved, transactionHash, WithdrawTxHeld)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errors.New("withdraw transaction " + transactionHash + " is not held")
+	}
+	return nil
+}
+
+// GetSideChainTxsByState returns the withdraw transactions of the side chain
+// in the given state.
+func (store *DataStoreSideChainImpl) GetSideChainTxsByState(genesisBlockAddress string, state uint8) ([]*base.SideChainTransaction, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, TransactionData, BlockHeight FROM SideChainTxs WHERE GenesisBlockAddress=? AND State=?`,
+		genesisBlockAddress, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*base.SideChainTransaction
+	for rows.Next() {
+		tx := &base.SideChainTransaction{GenesisBlockAddress: genesisBlockAddress}
+		if err := rows.Scan(&tx.TransactionHash, &tx.Transaction, &tx.BlockHeight); err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// AddSignedWithdrawVolume records the volume of the withdraw transaction
+// signed, the one recorded before of the same transaction is replaced.
+func (store *DataStoreSideChainImpl) AddSignedWithdrawVolume(volume *SignedWithdrawVolume) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec(`INSERT OR REPLACE INTO SignedWithdrawVolumes(TransactionHash, GenesisBlockAddress, Amount, SignTime) values(?,?,?,?)`,
+		volume.TransactionHash, volume.GenesisBlockAddress, int64(volume.Amount), volume.SignTime)
+	return err
+}
+
+// RemoveSignedWithdrawVolumes removes the volumes signed before the unix time.
+func (store *DataStoreSideChainImpl) RemoveSignedWithdrawVolumes(before int64) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec(`DELETE FROM SignedWithdrawVolumes WHERE SignTime<?`, before)
+	return err
+}
+
+// GetSignedWithdrawVolumes returns the volumes signed since the unix time, in
+// the order signed.
+func (store *DataStoreSideChainImpl) GetSignedWithdrawVolumes(since int64) ([]*SignedWithdrawVolume, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, Amount, SignTime FROM SignedWithdrawVolumes WHERE SignTime>=? ORDER BY SignTime`,
+		since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var volumes []*SignedWithdrawVolume
+	for rows.Next() {
+		var amount int64
+		volume := new(SignedWithdrawVolume)
+		err := rows.Scan(&volume.TransactionHash, &volume.GenesisBlockAddress, &amount, &volume.SignTime)
+		if err != nil {
+			return nil, err
+		}
+		volume.Amount = common.Fixed64(amount)
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
 func (store *DataStoreMainChainImpl) ResetDataStore() error {
 	store.DB.Close()
-	os.Remove(DBNameMainChain)
+	os.Remove(store.path)
 
 	var err error
-	store.DB, err = initMainChainDB()
+	store.DB, err = initMainChainDB(store.path)
 	if err != nil {
 		return err
 	}
@@ -505,12 +748,11 @@ func (store *DataStoreMainChainImpl) ResetDataStore() error {
 	return nil
 }
 
-func (store *DataStoreMainChainImpl) catchSystemSignals() {
-	HandleSignal(func() {
-		store.mux.Lock()
-		store.DB.Close()
-		os.Exit(-1)
-	})
+// Close closes the database after the operation in progress.
+func (store *DataStoreMainChainImpl) Close() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.DB.Close()
 }
 
 func (store *DataStoreMainChainImpl) CurrentHeight(height uint32) uint32 {
@@ -768,6 +1010,96 @@ func (store *DataStoreMainChainImpl) GetMainChainTxsFromHashes(transactionHashes
 	return spvTxs, nil
 }
 
+// AddMainChainTxAttempt records a failed attempt to send the deposit
+// transaction, and returns the count of attempts.
+func (store *DataStoreMainChainImpl) AddMainChainTxAttempt(transactionHash, genesisBlockAddress string) (uint32, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	result, err := store.Exec("UPDATE MainChainTxs SET Attempts=Attempts+1 WHERE TransactionHash=? AND GenesisBlockAddress=?",
+		transactionHash, genesisBlockAddress)
+	if err != nil {
+		return 0, err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		return 0, errors.New("main chain transaction " + transactionHash + " not found")
+	}
+
+	var attempts uint32
+	row := store.QueryRow("SELECT Attempts FROM MainChainTxs WHERE TransactionHash=? AND GenesisBlockAddress=?",
+		transactionHash, genesisBlockAddress)
+	if err := row.Scan(&attempts); err != nil {
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// SetMainChainTxNextRetryTime sets the time in unix seconds after which the
+// failed deposit transaction is retried.
+func (store *DataStoreMainChainImpl) SetMainChainTxNextRetryTime(transactionHash, genesisBlockAddress string,
+	nextRetryTime int64) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec("UPDATE MainChainTxs SET NextRetryTime=? WHERE TransactionHash=? AND GenesisBlockAddress=?",
+		nextRetryTime, transactionHash, genesisBlockAddress)
+	return err
+}
+
+// GetMainChainTxsToRetry returns the deposit transactions failed before and
+// due to retry at now in unix seconds.
+func (store *DataStoreMainChainImpl) GetMainChainTxsToRetry(now int64) ([]*base.MainChainTransaction, error) {
+	return store.getMainChainTxs(`Attempts>0 AND NextRetryTime<=?`, now)
+}
+
+// GetMainChainTxsToSend returns the deposit transactions never failed, and
+// the ones failed before and due to retry at now in unix seconds, the ones
+// waiting for their retry time are not sent.
+func (store *DataStoreMainChainImpl) GetMainChainTxsToSend(now int64) ([]*base.MainChainTransaction, error) {
+	return store.getMainChainTxs(`Attempts=0 OR NextRetryTime<=?`, now)
+}
+
+func (store *DataStoreMainChainImpl) getMainChainTxs(condition string, args ...interface{}) ([]*base.MainChainTransaction, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof
+									FROM MainChainTxs WHERE `+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*base.MainChainTransaction
+	for rows.Next() {
+		var txHash string
+		var genesisAddress string
+		var transactionBytes []byte
+		var merkleProofBytes []byte
+		err = rows.Scan(&txHash, &genesisAddress, &transactionBytes, &merkleProofBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		var tx types.Transaction
+		if err := tx.Deserialize(bytes.NewReader(transactionBytes)); err != nil {
+			return nil, err
+		}
+		var mp bloom.MerkleProof
+		if err := mp.Deserialize(bytes.NewReader(merkleProofBytes)); err != nil {
+			return nil, err
+		}
+
+		txs = append(txs, &base.MainChainTransaction{
+			TransactionHash:     txHash,
+			GenesisBlockAddress: genesisAddress,
+			Transaction:         &tx,
+			Proof:               &mp,
+		})
+	}
+	return txs, nil
+}
+
 func CheckAndCreateDocument(path string) error {
 	exist, err := PathExists(path)
 	if err != nil {
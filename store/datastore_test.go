@@ -23,7 +23,7 @@ func setup() {
 }
 
 func TestDataStoreImpl_AddSideChainTx(t *testing.T) {
-	datastore, err := OpenSideChainDataStore()
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -59,7 +59,7 @@ func TestDataStoreImpl_AddSideChainTx(t *testing.T) {
 }
 
 func TestDataStoreImpl_AddSideChainTxs(t *testing.T) {
-	datastore, err := OpenSideChainDataStore()
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -132,7 +132,7 @@ func TestDataStoreImpl_AddSideChainTxs(t *testing.T) {
 }
 
 func TestDataStoreImpl_RemoveSideChainTxs(t *testing.T) {
-	datastore, err := OpenSideChainDataStore()
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -179,7 +179,7 @@ func TestDataStoreImpl_RemoveSideChainTxs(t *testing.T) {
 }
 
 func TestDataStoreImpl_GetAllSideChainTxHashes(t *testing.T) {
-	datastore, err := OpenSideChainDataStore()
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -229,7 +229,7 @@ func TestDataStoreImpl_GetAllSideChainTxHashes(t *testing.T) {
 }
 
 func TestDataStoreImpl_GetSideChainTxsFromHashes(t *testing.T) {
-	datastore, err := OpenSideChainDataStore()
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -275,8 +275,149 @@ func TestDataStoreImpl_GetSideChainTxsFromHashes(t *testing.T) {
 	datastore.ResetDataStore()
 }
 
+func TestDataStoreImpl_GetSideChainTxHeights(t *testing.T) {
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	genesisBlockAddress := "testAddress"
+	genesisBlockAddress2 := "testAddress2"
+
+	datastore.AddSideChainTx(&base.SideChainTransaction{
+		TransactionHash: "testHash", GenesisBlockAddress: genesisBlockAddress, BlockHeight: 10})
+	datastore.AddSideChainTx(&base.SideChainTransaction{
+		TransactionHash: "testHash2", GenesisBlockAddress: genesisBlockAddress, BlockHeight: 20})
+	datastore.AddSideChainTx(&base.SideChainTransaction{
+		TransactionHash: "testHash3", GenesisBlockAddress: genesisBlockAddress2, BlockHeight: 30})
+
+	heights, err := datastore.GetSideChainTxHeights(
+		[]string{"testHash", "testHash2", "testHash3", "unknownHash"}, genesisBlockAddress)
+	if err != nil {
+		t.Error("Get side chain transaction heights error.")
+	}
+	if len(heights) != 2 || heights["testHash"] != 10 || heights["testHash2"] != 20 {
+		t.Error("Get side chain transaction heights error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestDataStoreImpl_HoldSideChainTxs(t *testing.T) {
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	genesisBlockAddress := "testAddress"
+	datastore.AddSideChainTx(&base.SideChainTransaction{
+		TransactionHash: "testHash", GenesisBlockAddress: genesisBlockAddress, BlockHeight: 10})
+	datastore.AddSideChainTx(&base.SideChainTransaction{
+		TransactionHash: "testHash2", GenesisBlockAddress: genesisBlockAddress, BlockHeight: 20})
+
+	if err := datastore.ApproveSideChainTx("testHash"); err == nil {
+		t.Error("Should not approve pending transaction.")
+	}
+	if err := datastore.HoldSideChainTxs([]string{"testHash"}); err != nil {
+		t.Error("Hold side chain transactions error.")
+	}
+	txs, err := datastore.GetSideChainTxsByState(genesisBlockAddress, WithdrawTxHeld)
+	if err != nil || len(txs) != 1 || txs[0].TransactionHash != "testHash" || txs[0].BlockHeight != 10 {
+		t.Error("Get held side chain transactions error.")
+	}
+
+	if err := datastore.ApproveSideChainTx("testHash"); err != nil {
+		t.Error("Approve side chain transaction error.")
+	}
+	// approved transactions are not held again
+	if err := datastore.HoldSideChainTxs([]string{"testHash"}); err != nil {
+		t.Error("Hold side chain transactions error.")
+	}
+	txs, err = datastore.GetSideChainTxsByState(genesisBlockAddress, WithdrawTxApproved)
+	if err != nil || len(txs) != 1 {
+		t.Error("Get approved side chain transactions error.")
+	}
+	txs, err = datastore.GetSideChainTxsByState(genesisBlockAddress, WithdrawTxHeld)
+	if err != nil || len(txs) != 0 {
+		t.Error("Get held side chain transactions error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestDataStoreImpl_SignedWithdrawVolumes(t *testing.T) {
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	genesisBlockAddress := "testAddress"
+	datastore.AddSignedWithdrawVolume(&SignedWithdrawVolume{TransactionHash: "testHash",
+		GenesisBlockAddress: genesisBlockAddress, Amount: 100, SignTime: 10})
+	datastore.AddSignedWithdrawVolume(&SignedWithdrawVolume{TransactionHash: "testHash2",
+		GenesisBlockAddress: genesisBlockAddress, Amount: 200, SignTime: 20})
+	// signed again
+	if err := datastore.AddSignedWithdrawVolume(&SignedWithdrawVolume{TransactionHash: "testHash",
+		GenesisBlockAddress: genesisBlockAddress, Amount: 100, SignTime: 30}); err != nil {
+		t.Error("Add signed withdraw volume error.")
+	}
+
+	volumes, err := datastore.GetSignedWithdrawVolumes(0)
+	if err != nil || len(volumes) != 2 {
+		t.Error("Get signed withdraw volumes error.")
+	}
+	if volumes[0].TransactionHash != "testHash2" || volumes[0].Amount != 200 ||
+		volumes[0].GenesisBlockAddress != genesisBlockAddress || volumes[1].SignTime != 30 {
+		t.Error("Get signed withdraw volumes error.")
+	}
+
+	if err := datastore.RemoveSignedWithdrawVolumes(30); err != nil {
+		t.Error("Remove signed withdraw volumes error.")
+	}
+	volumes, err = datastore.GetSignedWithdrawVolumes(0)
+	if err != nil || len(volumes) != 1 || volumes[0].TransactionHash != "testHash" {
+		t.Error("Get signed withdraw volumes error.")
+	}
+	volumes, err = datastore.GetSignedWithdrawVolumes(31)
+	if err != nil || len(volumes) != 0 {
+		t.Error("Get signed withdraw volumes error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestDataStoreImpl_SetCurrentSideHeight(t *testing.T) {
+	datastore, err := OpenSideChainDataStore(DBDocumentNAME, config.Parameters.SideNodeList)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	genesisBlockAddress := config.Parameters.SideNodeList[0].GenesisBlockAddress
+	if height := datastore.CurrentSideHeight(genesisBlockAddress, 100); height != 100 {
+		t.Error("Update side chain height error.")
+	}
+
+	// CurrentSideHeight never decreases the stored height
+	if height := datastore.CurrentSideHeight(genesisBlockAddress, 50); height != 100 {
+		t.Error("Side chain height should not decrease.")
+	}
+
+	if err := datastore.SetCurrentSideHeight(genesisBlockAddress, 50); err != nil {
+		t.Error("Set side chain height error.")
+	}
+	if height := datastore.CurrentSideHeight(genesisBlockAddress, QueryHeightCode); height != 50 {
+		t.Error("Side chain height should be rewound.")
+	}
+
+	if err := datastore.SetCurrentSideHeight("unknownAddress", 50); err == nil {
+		t.Error("Should not set height of unknown side chain.")
+	}
+
+	datastore.ResetDataStore()
+}
+
 func TestDataStoreImpl_AddMainChainTx(t *testing.T) {
-	datastore, err := OpenMainChainDataStore()
+	datastore, err := OpenMainChainDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -309,8 +450,67 @@ func TestDataStoreImpl_AddMainChainTx(t *testing.T) {
 	datastore.ResetDataStore()
 }
 
+func TestDataStoreImpl_AddMainChainTxAttempt(t *testing.T) {
+	datastore, err := OpenMainChainDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	txHash := "testHash"
+	genesisAddress := "testAddress"
+	tx := &types.Transaction{TxType: types.WithdrawFromSideChain, Payload: new(payload.WithdrawFromSideChain)}
+	mp := new(bloom.MerkleProof)
+	if err := datastore.AddMainChainTx(&base.MainChainTransaction{txHash, genesisAddress, tx, mp}); err != nil {
+		t.Error("Add main chain transaction error.")
+	}
+
+	txs, err := datastore.GetMainChainTxsToRetry(100)
+	if err != nil || len(txs) != 0 {
+		t.Error("Transaction never failed should not be retried.")
+	}
+	txs, err = datastore.GetMainChainTxsToSend(100)
+	if err != nil || len(txs) != 1 {
+		t.Error("Transaction never failed should be sent.")
+	}
+
+	attempts, err := datastore.AddMainChainTxAttempt(txHash, genesisAddress)
+	if err != nil || attempts != 1 {
+		t.Error("Add main chain transaction attempt error.")
+	}
+	attempts, err = datastore.AddMainChainTxAttempt(txHash, genesisAddress)
+	if err != nil || attempts != 2 {
+		t.Error("Add main chain transaction attempt error.")
+	}
+	if _, err := datastore.AddMainChainTxAttempt("unknownHash", genesisAddress); err == nil {
+		t.Error("Should not add attempt of unknown transaction.")
+	}
+	if err := datastore.SetMainChainTxNextRetryTime(txHash, genesisAddress, 200); err != nil {
+		t.Error("Set next retry time of main chain transaction error.")
+	}
+
+	txs, err = datastore.GetMainChainTxsToRetry(100)
+	if err != nil || len(txs) != 0 {
+		t.Error("Transaction should not be retried before next retry time.")
+	}
+	txs, err = datastore.GetMainChainTxsToSend(100)
+	if err != nil || len(txs) != 0 {
+		t.Error("Transaction should not be sent before next retry time.")
+	}
+	txs, err = datastore.GetMainChainTxsToSend(200)
+	if err != nil || len(txs) != 1 {
+		t.Error("Transaction should be sent at next retry time.")
+	}
+	txs, err = datastore.GetMainChainTxsToRetry(200)
+	if err != nil || len(txs) != 1 || txs[0].TransactionHash != txHash ||
+		txs[0].GenesisBlockAddress != genesisAddress {
+		t.Error("Get main chain transactions to retry error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
 func TestDataStoreImpl_AddMainChainTxs(t *testing.T) {
-	datastore, err := OpenMainChainDataStore()
+	datastore, err := OpenMainChainDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -387,7 +587,7 @@ func TestDataStoreImpl_AddMainChainTxs(t *testing.T) {
 }
 
 func TestDataStoreImpl_RemoveMainChainTxs(t *testing.T) {
-	datastore, err := OpenMainChainDataStore()
+	datastore, err := OpenMainChainDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -449,7 +649,7 @@ func TestDataStoreImpl_RemoveMainChainTxs(t *testing.T) {
 }
 
 func TestDataStoreImpl_GetAllMainChainTxHashes(t *testing.T) {
-	datastore, err := OpenMainChainDataStore()
+	datastore, err := OpenMainChainDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
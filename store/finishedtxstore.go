@@ -1,6 +1,7 @@
 package store
 
 import (
+	"bytes"
 	"database/sql"
 	"errors"
 	"os"
@@ -10,10 +11,13 @@ import (
 
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var FinishedTxsDBName = filepath.Join(DBDocumentNAME, "finishedTxs.db")
+const FinishedTxsDBName = "finishedTxs.db"
 
 const (
 	//TransactionHash: tx3
@@ -39,11 +43,116 @@ const (
 				TransactionData BLOB,
 				RecordTime TEXT
 			);`
+	//TransactionHash: tx5
+	//TransactionData: tx5 held and rejected by operator
+	CreateRejectedWithdrawTransactionsTable = `CREATE TABLE IF NOT EXISTS RejectedWithdrawTransactions (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				TransactionHash VARCHAR UNIQUE,
+				GenesisBlockAddress VARCHAR(34),
+				TransactionData BLOB,
+				Reason TEXT,
+				RecordTime TEXT
+			);`
+	//TransactionHash: tx3
+	//GenesisBlockAddress: sidechain
+	//TransactionData: tx3 failed with terminal error or too many attempts
+	CreateDeadLetterDepositTransactionsTable = `CREATE TABLE IF NOT EXISTS DeadLetterDepositTransactions (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				TransactionHash VARCHAR,
+				GenesisBlockAddress VARCHAR(34),
+				TransactionData BLOB,
+				MerkleProof BLOB,
+				Attempts INTEGER,
+				ErrorCode INTEGER,
+				ErrorMessage TEXT,
+				RecordTime TEXT,
+				UNIQUE (TransactionHash, GenesisBlockAddress)
+			);`
+	//TransactionHash: tx5
+	//GenesisBlockAddress: sidechain
+	//Succeed: tx5 moved back into SideChainTxs or not
+	CreateWithdrawRedriveLogsTable = `CREATE TABLE IF NOT EXISTS WithdrawRedriveLogs (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				TransactionHash VARCHAR,
+				GenesisBlockAddress VARCHAR(34),
+				Succeed BOOLEAN,
+				Reason TEXT,
+				Message TEXT,
+				RecordTime TEXT
+			);`
+	//TransactionHash: tx3 or tx5
+	//GenesisBlockAddress: sidechain
+	//Amount: ELA locked by tx3 or to be released for tx5
+	CreateSolvencyFlowsTable = `CREATE TABLE IF NOT EXISTS SolvencyFlows (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				TransactionHash VARCHAR,
+				GenesisBlockAddress VARCHAR(34),
+				Deposit BOOLEAN,
+				Amount INTEGER,
+				RecordTime TEXT,
+				UNIQUE (TransactionHash, GenesisBlockAddress, Deposit)
+			);`
+	//GenesisBlockAddress: sidechain
+	//Amount: the baseline of the supply of sidechain
+	CreateSolvencyBaselinesTable = `CREATE TABLE IF NOT EXISTS SolvencyBaselines (
+				GenesisBlockAddress VARCHAR(34) NOT NULL PRIMARY KEY,
+				Amount INTEGER,
+				RecordTime TEXT
+			);`
 )
 
-var (
-	FinishedTxsDbCache FinishedTransactionsDataStore
-)
+// RejectedWithdrawTx is a side chain withdraw transaction rejected by
+// operator.
+type RejectedWithdrawTx struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Reason              string
+	RecordTime          string
+}
+
+// WithdrawRedriveLog is an attempt to re-drive a failed withdraw transaction.
+type WithdrawRedriveLog struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Succeed             bool
+	Reason              string
+	Message             string
+	RecordTime          string
+}
+
+// DeadLetterDepositTx is a deposit transaction failed with a terminal error
+// of side node, or failed too many times.
+type DeadLetterDepositTx struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Transaction         *types.Transaction
+	Proof               *bloom.MerkleProof
+	Attempts            uint32
+	ErrorCode           int64
+	ErrorMessage        string
+	RecordTime          string
+}
+
+// SolvencyFlow is a deposit transaction locking ELA into the genesis address
+// of a side chain, or a side chain withdraw transaction burning the amount of
+// ELA to be released from it.
+type SolvencyFlow struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Deposit             bool
+	Amount              common.Fixed64
+}
+
+// SolvencyFlows are the totals of the solvency flows of a side chain.
+type SolvencyFlows struct {
+	Deposited common.Fixed64
+	Withdrawn common.Fixed64
+
+	// Failed and Rejected are the parts of Withdrawn failed on main chain
+	// and rejected by operator.
+	Failed   common.Fixed64
+	Rejected common.Fixed64
+}
 
 type FinishedTransactionsDataStore interface {
 	AddFailedDepositTxs(transactionHashes, genesisBlockAddresses []string) error
@@ -52,47 +161,63 @@ type FinishedTransactionsDataStore interface {
 	GetDepositTxByHash(transactionHash string) ([]bool, []string, error)
 	GetDepositTxByHashAndGenesisAddress(transactionHash string, genesisAddress string) (bool, error)
 	GetDepositTxs(succeed bool) ([]string, []string, error)
+	AddDeadLetterDepositTx(tx *DeadLetterDepositTx) error
+	GetDeadLetterDepositTxs() ([]*DeadLetterDepositTx, error)
+	GetDeadLetterDepositTx(transactionHash, genesisBlockAddress string) (*DeadLetterDepositTx, error)
+	RemoveDeadLetterDepositTx(transactionHash, genesisBlockAddress string) error
 
 	AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte) error
 	AddSucceedWithdrawTxs(transactionHashes []string) error
 	HasWithdrawTx(transactionHash string) (bool, error)
 	GetWithdrawTxByHash(transactionHash string) (bool, []byte, error)
 	GetWithdrawTxs(succeed bool) ([]string, error)
+	AddRejectedWithdrawTx(transactionHash, genesisBlockAddress string, transactionByte []byte, reason string) error
+	GetRejectedWithdrawTxs() ([]*RejectedWithdrawTx, error)
+	RemoveFailedWithdrawTx(transactionHash string) error
+	AddWithdrawRedriveLog(log *WithdrawRedriveLog) error
+	GetWithdrawRedriveLogs() ([]*WithdrawRedriveLog, error)
 
 	AddSideChainTx(transactionByte []byte) error
 	GetSideChainTx(sideChainTransactionId uint64) ([]byte, error)
 
+	AddSolvencyFlows(flows []*SolvencyFlow) error
+	GetSolvencyFlows(genesisBlockAddress string) (*SolvencyFlows, error)
+	AddSolvencyBaseline(genesisBlockAddress string, amount common.Fixed64) error
+	GetSolvencyBaseline(genesisBlockAddress string) (common.Fixed64, bool, error)
+
 	ResetDataStore() error
+	Close() error
 }
 
 type FinishedTxsDataStoreImpl struct {
-	mux *sync.Mutex
+	mux  *sync.Mutex
+	path string
 
 	*sql.DB
 }
 
-func OpenFinishedTxsDataStore() (FinishedTransactionsDataStore, error) {
-	db, err := initFinishedTxsDB()
+// OpenFinishedTxsDataStore opens the database of finished transactions in
+// dir.
+func OpenFinishedTxsDataStore(dir string) (FinishedTransactionsDataStore, error) {
+	path := filepath.Join(dir, FinishedTxsDBName)
+	db, err := initFinishedTxsDB(path)
 	if err != nil {
 		return nil, err
 	}
-	dataStore := &FinishedTxsDataStoreImpl{DB: db, mux: new(sync.Mutex)}
-
-	// Handle system interrupt signals
-	dataStore.catchSystemSignals()
+	dataStore := &FinishedTxsDataStoreImpl{DB: db, mux: new(sync.Mutex), path: path}
 
 	return dataStore, nil
 }
 
-func initFinishedTxsDB() (*sql.DB, error) {
-	err := CheckAndCreateDocument(DBDocumentNAME)
+func initFinishedTxsDB(path string) (*sql.DB, error) {
+	err := CheckAndCreateDocument(filepath.Dir(path))
 	if err != nil {
-		log.Error("Create DBCache doucument error:", err)
+		log.Store.Error("[initFinishedTxsDB] create DBCache document error", log.F("path", path), log.Err(err))
 		return nil, err
 	}
-	db, err := sql.Open(DriverName, FinishedTxsDBName)
+	db, err := sql.Open(DriverName, path)
 	if err != nil {
-		log.Error("Open data db error:", err)
+		log.Store.Error("[initFinishedTxsDB] open data db error", log.F("path", path), log.Err(err))
 		return nil, err
 	}
 	// Create error deposit transactions table
@@ -110,25 +235,56 @@ func initFinishedTxsDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Create rejected withdraw transactions table
+	_, err = db.Exec(CreateRejectedWithdrawTransactionsTable)
+	if err != nil {
+		return nil, err
+	}
+	// Create dead letter deposit transactions table
+	_, err = db.Exec(CreateDeadLetterDepositTransactionsTable)
+	if err != nil {
+		return nil, err
+	}
+	// Create withdraw re-drive logs table
+	_, err = db.Exec(CreateWithdrawRedriveLogsTable)
+	if err != nil {
+		return nil, err
+	}
+	// Create solvency flows table
+	_, err = db.Exec(CreateSolvencyFlowsTable)
+	if err != nil {
+		return nil, err
+	}
+	// Create solvency baselines table
+	_, err = db.Exec(CreateSolvencyBaselinesTable)
+	if err != nil {
+		return nil, err
+	}
+	// Remove rejected withdraw transactions recorded as failed by old versions,
+	// they have no failed main chain transaction in SideChainTransactions
+	_, err = db.Exec(`DELETE FROM WithdrawTransactions WHERE SideChainTransactionId=0 AND
+		TransactionHash IN (SELECT TransactionHash FROM RejectedWithdrawTransactions)`)
+	if err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
 
-func (store *FinishedTxsDataStoreImpl) catchSystemSignals() {
-	HandleSignal(func() {
-		store.mux.Lock()
-		store.Close()
-		os.Exit(-1)
-	})
+// Close closes the database after the operation in progress.
+func (store *FinishedTxsDataStoreImpl) Close() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.DB.Close()
 }
 
 func (store *FinishedTxsDataStoreImpl) ResetDataStore() error {
 
 	store.DB.Close()
-	os.Remove(FinishedTxsDBName)
+	os.Remove(store.path)
 
 	var err error
-	store.DB, err = initFinishedTxsDB()
+	store.DB, err = initFinishedTxsDB(store.path)
 	if err != nil {
 		return err
 	}
@@ -184,8 +340,12 @@ func (store *FinishedTxsDataStoreImpl) AddSucceedDepositTxs(transactionHashes, g
 	for i := 0; i < len(transactionHashes); i++ {
 		_, err = stmt.Exec(transactionHashes[i], genesisBlockAddresses[i], true, time.Now().Format("2006-01-02_15.04.05"))
 		if err != nil {
+			log.Deposit.Warn("[AddSucceedDepositTxs] add succeed deposit transaction failed",
+				log.Chain(genesisBlockAddresses[i]), log.TxHash(transactionHashes[i]), log.Err(err))
 			continue
 		}
+		log.Deposit.Debug("[AddSucceedDepositTxs] deposit transaction finished",
+			log.Chain(genesisBlockAddresses[i]), log.TxHash(transactionHashes[i]))
 	}
 	return nil
 }
@@ -277,6 +437,134 @@ func (store *FinishedTxsDataStoreImpl) GetDepositTxs(succeed bool) ([]string, []
 	return txHashes, genesisAddresses, nil
 }
 
+// AddDeadLetterDepositTx records the deposit transaction into dead letters
+// and as a failed deposit transaction.
+func (store *FinishedTxsDataStoreImpl) AddDeadLetterDepositTx(deadLetter *DeadLetterDepositTx) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	txBuf := new(bytes.Buffer)
+	if err := deadLetter.Transaction.Serialize(txBuf); err != nil {
+		return err
+	}
+	proofBuf := new(bytes.Buffer)
+	if err := deadLetter.Proof.Serialize(proofBuf); err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	recordTime := time.Now().Format("2006-01-02_15.04.05")
+	_, err = tx.Exec("INSERT OR REPLACE INTO DeadLetterDepositTransactions(TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof, Attempts, ErrorCode, ErrorMessage, RecordTime) values(?,?,?,?,?,?,?,?)",
+		deadLetter.TransactionHash, deadLetter.GenesisBlockAddress, txBuf.Bytes(), proofBuf.Bytes(),
+		deadLetter.Attempts, deadLetter.ErrorCode, deadLetter.ErrorMessage, recordTime)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("INSERT OR IGNORE INTO DepositTransactions(TransactionHash, GenesisBlockAddress, Succeed, RecordTime) values(?,?,?,?)",
+		deadLetter.TransactionHash, deadLetter.GenesisBlockAddress, false, recordTime)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (store *FinishedTxsDataStoreImpl) GetDeadLetterDepositTxs() ([]*DeadLetterDepositTx, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof,
+									Attempts, ErrorCode, ErrorMessage, RecordTime FROM DeadLetterDepositTransactions ORDER BY Id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*DeadLetterDepositTx
+	for rows.Next() {
+		tx, err := scanDeadLetterDepositTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func (store *FinishedTxsDataStoreImpl) GetDeadLetterDepositTx(transactionHash,
+	genesisBlockAddress string) (*DeadLetterDepositTx, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof,
+									Attempts, ErrorCode, ErrorMessage, RecordTime FROM DeadLetterDepositTransactions
+									WHERE TransactionHash=? AND GenesisBlockAddress=?`, transactionHash, genesisBlockAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("deposit transaction " + transactionHash + " is not dead letter")
+	}
+	return scanDeadLetterDepositTx(rows)
+}
+
+// RemoveDeadLetterDepositTx removes the deposit transaction from dead letters
+// and failed deposit transactions.
+func (store *FinishedTxsDataStoreImpl) RemoveDeadLetterDepositTx(transactionHash, genesisBlockAddress string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM DeadLetterDepositTransactions WHERE TransactionHash=? AND GenesisBlockAddress=?",
+		transactionHash, genesisBlockAddress)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		tx.Rollback()
+		return errors.New("deposit transaction " + transactionHash + " is not dead letter")
+	}
+	_, err = tx.Exec("DELETE FROM DepositTransactions WHERE TransactionHash=? AND GenesisBlockAddress=? AND Succeed=?",
+		transactionHash, genesisBlockAddress, false)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanDeadLetterDepositTx(rows *sql.Rows) (*DeadLetterDepositTx, error) {
+	var transactionBytes []byte
+	var merkleProofBytes []byte
+	deadLetter := &DeadLetterDepositTx{
+		Transaction: new(types.Transaction),
+		Proof:       new(bloom.MerkleProof),
+	}
+	err := rows.Scan(&deadLetter.TransactionHash, &deadLetter.GenesisBlockAddress, &transactionBytes,
+		&merkleProofBytes, &deadLetter.Attempts, &deadLetter.ErrorCode, &deadLetter.ErrorMessage,
+		&deadLetter.RecordTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := deadLetter.Transaction.Deserialize(bytes.NewReader(transactionBytes)); err != nil {
+		return nil, err
+	}
+	if err := deadLetter.Proof.Deserialize(bytes.NewReader(merkleProofBytes)); err != nil {
+		return nil, err
+	}
+	return deadLetter, nil
+}
+
 func (store *FinishedTxsDataStoreImpl) AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte) error {
 	store.mux.Lock()
 	defer store.mux.Unlock()
@@ -339,21 +627,28 @@ func (store *FinishedTxsDataStoreImpl) AddSucceedWithdrawTxs(transactionHashes [
 	// Do insert
 	for _, txHash := range transactionHashes {
 		if _, err := stmt.Exec(txHash, 0, true, time.Now().Format("2006-01-02_15.04.05")); err != nil {
-			log.Error("[AddSucceedWithdrawTxs] txHash:", txHash, "err:", err.Error())
+			log.Withdraw.Error("[AddSucceedWithdrawTxs] add succeed withdraw transaction failed",
+				log.TxHash(txHash), log.Err(err))
+			continue
 		}
+		log.Withdraw.Debug("[AddSucceedWithdrawTxs] withdraw transaction finished", log.TxHash(txHash))
 	}
 	return nil
 }
 
+// HasWithdrawTx returns if the withdraw transaction is finished, succeed,
+// failed or rejected by operator.
 func (store *FinishedTxsDataStoreImpl) HasWithdrawTx(transactionHash string) (bool, error) {
 	store.mux.Lock()
 	defer store.mux.Unlock()
 
-	rows, err := store.Query(`SELECT Succeed FROM WithdrawTransactions WHERE TransactionHash=?`, transactionHash)
-	defer rows.Close()
+	rows, err := store.Query(`SELECT TransactionHash FROM WithdrawTransactions WHERE TransactionHash=?
+		UNION SELECT TransactionHash FROM RejectedWithdrawTransactions WHERE TransactionHash=?`,
+		transactionHash, transactionHash)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 
 	return rows.Next(), nil
 }
@@ -423,6 +718,92 @@ func (store *FinishedTxsDataStoreImpl) GetWithdrawTxs(succeed bool) ([]string, e
 	return txHashes, nil
 }
 
+// AddRejectedWithdrawTx records the side chain withdraw transaction rejected
+// by operator with the reason. It is not recorded into WithdrawTransactions,
+// as there is no failed main chain transaction of it.
+func (store *FinishedTxsDataStoreImpl) AddRejectedWithdrawTx(transactionHash, genesisBlockAddress string,
+	transactionByte []byte, reason string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	recordTime := time.Now().Format("2006-01-02_15.04.05")
+	_, err := store.Exec("INSERT INTO RejectedWithdrawTransactions(TransactionHash, GenesisBlockAddress, TransactionData, Reason, RecordTime) values(?,?,?,?,?)",
+		transactionHash, genesisBlockAddress, transactionByte, reason, recordTime)
+	return err
+}
+
+func (store *FinishedTxsDataStoreImpl) GetRejectedWithdrawTxs() ([]*RejectedWithdrawTx, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, Reason, RecordTime FROM RejectedWithdrawTransactions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*RejectedWithdrawTx
+	for rows.Next() {
+		tx := new(RejectedWithdrawTx)
+		err = rows.Scan(&tx.TransactionHash, &tx.GenesisBlockAddress, &tx.Reason, &tx.RecordTime)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// RemoveFailedWithdrawTx removes the failed withdraw transaction, so it is
+// no longer finished. The failed main chain transaction in
+// SideChainTransactions is kept for the other withdraw transactions of it.
+func (store *FinishedTxsDataStoreImpl) RemoveFailedWithdrawTx(transactionHash string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	result, err := store.Exec(`DELETE FROM WithdrawTransactions WHERE TransactionHash=? AND Succeed=?`,
+		transactionHash, false)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		return errors.New("withdraw transaction " + transactionHash + " is not failed")
+	}
+	return nil
+}
+
+func (store *FinishedTxsDataStoreImpl) AddWithdrawRedriveLog(log *WithdrawRedriveLog) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec("INSERT INTO WithdrawRedriveLogs(TransactionHash, GenesisBlockAddress, Succeed, Reason, Message, RecordTime) values(?,?,?,?,?,?)",
+		log.TransactionHash, log.GenesisBlockAddress, log.Succeed, log.Reason, log.Message,
+		time.Now().Format("2006-01-02_15.04.05"))
+	return err
+}
+
+func (store *FinishedTxsDataStoreImpl) GetWithdrawRedriveLogs() ([]*WithdrawRedriveLog, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, Succeed, Reason, Message, RecordTime FROM WithdrawRedriveLogs ORDER BY Id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []*WithdrawRedriveLog
+	for rows.Next() {
+		l := new(WithdrawRedriveLog)
+		err = rows.Scan(&l.TransactionHash, &l.GenesisBlockAddress, &l.Succeed, &l.Reason, &l.Message, &l.RecordTime)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
 func (store *FinishedTxsDataStoreImpl) AddSideChainTx(transactionByte []byte) error {
 	store.mux.Lock()
 	defer store.mux.Unlock()
@@ -460,3 +841,89 @@ func (store *FinishedTxsDataStoreImpl) GetSideChainTx(sideChainTransactionId uin
 
 	return transactionBytes, nil
 }
+
+// AddSolvencyFlows records the solvency flows, the ones recorded before are
+// ignored, so a transaction found again is not counted twice.
+func (store *FinishedTxsDataStoreImpl) AddSolvencyFlows(flows []*SolvencyFlow) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	recordTime := time.Now().Format("2006-01-02_15.04.05")
+	for _, flow := range flows {
+		_, err := tx.Exec("INSERT OR IGNORE INTO SolvencyFlows(TransactionHash, GenesisBlockAddress, Deposit, Amount, RecordTime) values(?,?,?,?,?)",
+			flow.TransactionHash, flow.GenesisBlockAddress, flow.Deposit, int64(flow.Amount), recordTime)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSolvencyFlows returns the totals of the solvency flows of the side
+// chain, with the withdraw transactions failed or rejected by operator.
+func (store *FinishedTxsDataStoreImpl) GetSolvencyFlows(genesisBlockAddress string) (*SolvencyFlows, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var deposited, withdrawn, failed, rejected int64
+	err := store.QueryRow(`SELECT
+			COALESCE(SUM(CASE WHEN Deposit THEN Amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN Deposit THEN 0 ELSE Amount END), 0)
+		FROM SolvencyFlows WHERE GenesisBlockAddress=?`, genesisBlockAddress).Scan(&deposited, &withdrawn)
+	if err != nil {
+		return nil, err
+	}
+	err = store.QueryRow(`SELECT COALESCE(SUM(Amount), 0) FROM SolvencyFlows
+		WHERE GenesisBlockAddress=? AND NOT Deposit AND TransactionHash IN
+		(SELECT TransactionHash FROM WithdrawTransactions WHERE Succeed=?)`,
+		genesisBlockAddress, false).Scan(&failed)
+	if err != nil {
+		return nil, err
+	}
+	err = store.QueryRow(`SELECT COALESCE(SUM(Amount), 0) FROM SolvencyFlows
+		WHERE GenesisBlockAddress=? AND NOT Deposit AND TransactionHash IN
+		(SELECT TransactionHash FROM RejectedWithdrawTransactions)`, genesisBlockAddress).Scan(&rejected)
+	if err != nil {
+		return nil, err
+	}
+	return &SolvencyFlows{
+		Deposited: common.Fixed64(deposited),
+		Withdrawn: common.Fixed64(withdrawn),
+		Failed:    common.Fixed64(failed),
+		Rejected:  common.Fixed64(rejected),
+	}, nil
+}
+
+// AddSolvencyBaseline records the baseline of the supply of the side chain,
+// the one recorded before is kept.
+func (store *FinishedTxsDataStoreImpl) AddSolvencyBaseline(genesisBlockAddress string, amount common.Fixed64) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec("INSERT OR IGNORE INTO SolvencyBaselines(GenesisBlockAddress, Amount, RecordTime) values(?,?,?)",
+		genesisBlockAddress, int64(amount), time.Now().Format("2006-01-02_15.04.05"))
+	return err
+}
+
+// GetSolvencyBaseline returns the baseline of the supply of the side chain,
+// and false if it is not recorded yet.
+func (store *FinishedTxsDataStoreImpl) GetSolvencyBaseline(genesisBlockAddress string) (common.Fixed64, bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var amount int64
+	err := store.QueryRow(`SELECT Amount FROM SolvencyBaselines WHERE GenesisBlockAddress=?`,
+		genesisBlockAddress).Scan(&amount)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return common.Fixed64(amount), true, nil
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
 	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
 )
 
 func TestFinishedTxsDataStoreImpl_AddSucceedDepositTxs(t *testing.T) {
-	datastore, err := OpenFinishedTxsDataStore()
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -58,7 +60,7 @@ func TestFinishedTxsDataStoreImpl_AddSucceedDepositTxs(t *testing.T) {
 }
 
 func TestFinishedTxsDataStoreImpl_AddSucceedDepositTx(t *testing.T) {
-	datastore, err := OpenFinishedTxsDataStore()
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -107,7 +109,7 @@ func TestFinishedTxsDataStoreImpl_AddSucceedDepositTx(t *testing.T) {
 }
 
 func TestFinishedTxsDataStoreImpl_GetDepositTxs(t *testing.T) {
-	datastore, err := OpenFinishedTxsDataStore()
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -145,7 +147,7 @@ func TestFinishedTxsDataStoreImpl_GetDepositTxs(t *testing.T) {
 }
 
 func TestFinishedTxsDataStoreImpl_AddWithdrawTxs(t *testing.T) {
-	datastore, err := OpenFinishedTxsDataStore()
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -247,7 +249,7 @@ func TestFinishedTxsDataStoreImpl_AddWithdrawTxs(t *testing.T) {
 }
 
 func TestFinishedTxsDataStoreImpl_AddSucceedWIthdrawTx(t *testing.T) {
-	datastore, err := OpenFinishedTxsDataStore()
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -293,7 +295,7 @@ func TestFinishedTxsDataStoreImpl_AddSucceedWIthdrawTx(t *testing.T) {
 }
 
 func TestFinishedTxsDataStoreImpl_GetWithdrawTxs(t *testing.T) {
-	datastore, err := OpenFinishedTxsDataStore()
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
 	if err != nil {
 		t.Error("Open database error.")
 	}
@@ -331,3 +333,232 @@ func TestFinishedTxsDataStoreImpl_GetWithdrawTxs(t *testing.T) {
 
 	datastore.ResetDataStore()
 }
+
+func TestFinishedTxsDataStoreImpl_AddRejectedWithdrawTx(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	txHash := "testHash"
+	genesisBlockAddress := "testAddress"
+
+	err = datastore.AddRejectedWithdrawTx(txHash, genesisBlockAddress, []byte{1}, "too large")
+	if err != nil {
+		t.Error("Add rejected withdraw transaction error.")
+	}
+	if err = datastore.AddRejectedWithdrawTx(txHash, genesisBlockAddress, []byte{1}, "too large"); err == nil {
+		t.Error("Should not reject withdraw transaction twice.")
+	}
+
+	ok, err := datastore.HasWithdrawTx(txHash)
+	if err != nil || !ok {
+		t.Error("Rejected withdraw transaction should be finished.")
+	}
+	failedTxs, err := datastore.GetWithdrawTxs(false)
+	if err != nil || len(failedTxs) != 0 {
+		t.Error("Rejected withdraw transaction should not be failed.")
+	}
+	if _, _, err = datastore.GetWithdrawTxByHash(txHash); err == nil {
+		t.Error("Rejected withdraw transaction should have no failed transaction.")
+	}
+
+	rejectedTxs, err := datastore.GetRejectedWithdrawTxs()
+	if err != nil || len(rejectedTxs) != 1 {
+		t.Error("Get rejected withdraw transactions error.")
+	}
+	if rejectedTxs[0].TransactionHash != txHash ||
+		rejectedTxs[0].GenesisBlockAddress != genesisBlockAddress ||
+		rejectedTxs[0].Reason != "too large" {
+		t.Error("Get rejected withdraw transactions error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestFinishedTxsDataStoreImpl_RemoveFailedWithdrawTx(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	if err = datastore.AddFailedWithdrawTxs([]string{"failedHash"}, []byte{1}); err != nil {
+		t.Error("Add failed withdraw transaction error.")
+	}
+	if err = datastore.AddSucceedWithdrawTxs([]string{"succeedHash"}); err != nil {
+		t.Error("Add succeed withdraw transaction error.")
+	}
+
+	if err = datastore.RemoveFailedWithdrawTx("succeedHash"); err == nil {
+		t.Error("Should not remove succeed withdraw transaction.")
+	}
+	if err = datastore.RemoveFailedWithdrawTx("failedHash"); err != nil {
+		t.Error("Remove failed withdraw transaction error.")
+	}
+	if ok, err := datastore.HasWithdrawTx("failedHash"); err != nil || ok {
+		t.Error("Removed withdraw transaction should not be finished.")
+	}
+	if err = datastore.RemoveFailedWithdrawTx("failedHash"); err == nil {
+		t.Error("Should not remove withdraw transaction twice.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestFinishedTxsDataStoreImpl_AddWithdrawRedriveLog(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	err = datastore.AddWithdrawRedriveLog(&WithdrawRedriveLog{
+		TransactionHash:     "testHash",
+		GenesisBlockAddress: "testAddress",
+		Succeed:             false,
+		Reason:              "fee fixed",
+		Message:             "not found on side chain",
+	})
+	if err != nil {
+		t.Error("Add withdraw re-drive log error.")
+	}
+	err = datastore.AddWithdrawRedriveLog(&WithdrawRedriveLog{
+		TransactionHash:     "testHash",
+		GenesisBlockAddress: "testAddress",
+		Succeed:             true,
+		Reason:              "fee fixed",
+	})
+	if err != nil {
+		t.Error("Add withdraw re-drive log error.")
+	}
+
+	logs, err := datastore.GetWithdrawRedriveLogs()
+	if err != nil || len(logs) != 2 {
+		t.Error("Get withdraw re-drive logs error.")
+	}
+	if logs[0].Succeed || logs[0].Message != "not found on side chain" ||
+		!logs[1].Succeed || logs[1].Reason != "fee fixed" || logs[1].TransactionHash != "testHash" {
+		t.Error("Get withdraw re-drive logs error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestFinishedTxsDataStoreImpl_AddDeadLetterDepositTx(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	txHash := "testHash"
+	genesisBlockAddress := "testAddress"
+	tx := &types.Transaction{TxType: types.TransferCrossChainAsset, Payload: new(payload.TransferCrossChainAsset)}
+	err = datastore.AddDeadLetterDepositTx(&DeadLetterDepositTx{
+		TransactionHash:     txHash,
+		GenesisBlockAddress: genesisBlockAddress,
+		Transaction:         tx,
+		Proof:               new(bloom.MerkleProof),
+		Attempts:            3,
+		ErrorCode:           43001,
+		ErrorMessage:        "invalid transaction",
+	})
+	if err != nil {
+		t.Error("Add dead letter deposit transaction error.")
+	}
+
+	succeed, err := datastore.GetDepositTxByHashAndGenesisAddress(txHash, genesisBlockAddress)
+	if err != nil || succeed {
+		t.Error("Dead letter deposit transaction should be failed.")
+	}
+	deadLetters, err := datastore.GetDeadLetterDepositTxs()
+	if err != nil || len(deadLetters) != 1 {
+		t.Error("Get dead letter deposit transactions error.")
+	}
+	deadLetter, err := datastore.GetDeadLetterDepositTx(txHash, genesisBlockAddress)
+	if err != nil {
+		t.Error("Get dead letter deposit transaction error.")
+	}
+	if deadLetter.Attempts != 3 || deadLetter.ErrorCode != 43001 ||
+		deadLetter.ErrorMessage != "invalid transaction" || deadLetter.Transaction.Hash() != tx.Hash() {
+		t.Error("Get dead letter deposit transaction error.")
+	}
+
+	if err = datastore.RemoveDeadLetterDepositTx(txHash, genesisBlockAddress); err != nil {
+		t.Error("Remove dead letter deposit transaction error.")
+	}
+	if ok, err := datastore.HasDepositTx(txHash, genesisBlockAddress); err != nil || ok {
+		t.Error("Removed dead letter deposit transaction should not be finished.")
+	}
+	if _, err = datastore.GetDeadLetterDepositTx(txHash, genesisBlockAddress); err == nil {
+		t.Error("Removed dead letter deposit transaction should not be got.")
+	}
+	if err = datastore.RemoveDeadLetterDepositTx(txHash, genesisBlockAddress); err == nil {
+		t.Error("Should not remove dead letter deposit transaction twice.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestFinishedTxsDataStoreImpl_AddSolvencyFlows(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	flows := []*SolvencyFlow{
+		{TransactionHash: "deposit", GenesisBlockAddress: "testAddress", Deposit: true, Amount: 1000},
+		{TransactionHash: "withdraw1", GenesisBlockAddress: "testAddress", Amount: 100},
+		{TransactionHash: "withdraw2", GenesisBlockAddress: "testAddress", Amount: 200},
+		{TransactionHash: "withdraw3", GenesisBlockAddress: "testAddress", Amount: 300},
+		{TransactionHash: "deposit", GenesisBlockAddress: "otherAddress", Deposit: true, Amount: 5000},
+	}
+	if err = datastore.AddSolvencyFlows(flows); err != nil {
+		t.Error("Add solvency flows error.")
+	}
+	// the flows found again are not counted twice
+	if err = datastore.AddSolvencyFlows(flows[:2]); err != nil {
+		t.Error("Add solvency flows error.")
+	}
+	if err = datastore.AddFailedWithdrawTxs([]string{"withdraw2"}, []byte{1}); err != nil {
+		t.Error("Add failed withdraw transaction error.")
+	}
+	if err = datastore.AddRejectedWithdrawTx("withdraw3", "testAddress", []byte{1}, "too large"); err != nil {
+		t.Error("Add rejected withdraw transaction error.")
+	}
+
+	totals, err := datastore.GetSolvencyFlows("testAddress")
+	if err != nil {
+		t.Error("Get solvency flows error.")
+	}
+	if totals.Deposited != 1000 || totals.Withdrawn != 600 || totals.Failed != 200 || totals.Rejected != 300 {
+		t.Error("Get solvency flows error.")
+	}
+	totals, err = datastore.GetSolvencyFlows("unknownAddress")
+	if err != nil || *totals != (SolvencyFlows{}) {
+		t.Error("Get solvency flows of unknown side chain error.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestFinishedTxsDataStoreImpl_AddSolvencyBaseline(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore(DBDocumentNAME)
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	if _, ok, err := datastore.GetSolvencyBaseline("testAddress"); err != nil || ok {
+		t.Error("Solvency baseline should not be recorded.")
+	}
+	if err = datastore.AddSolvencyBaseline("testAddress", 1000); err != nil {
+		t.Error("Add solvency baseline error.")
+	}
+	// the baseline recorded is kept
+	if err = datastore.AddSolvencyBaseline("testAddress", 2000); err != nil {
+		t.Error("Add solvency baseline error.")
+	}
+	if baseline, ok, err := datastore.GetSolvencyBaseline("testAddress"); err != nil || !ok || baseline != 1000 {
+		t.Error("Get solvency baseline error.")
+	}
+
+	datastore.ResetDataStore()
+}